@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+// defaultFilesDir is where encrypted attachments are kept unless
+// ENVX_FILES_DIR says otherwise
+const defaultFilesDir = ".envx/files"
+
+// manifestName is the file listing the attachments of a files directory
+const manifestName = "manifest.json"
+
+// attachmentHeader starts the plaintext of every attachment. It cannot be
+// read as base64, so Encrypt never mistakes file contents for a value that
+// is already encrypted.
+const attachmentHeader = "envx-file:"
+
+type fileAddOpts struct {
+	KeyStore string
+	Password string
+}
+
+type fileGetOpts struct {
+	KeyStore string
+	Password string
+	Output   string
+}
+
+type fileMaterializeOpts struct {
+	KeyStore string
+	Password string
+	Force    bool
+}
+
+// attachment is an entry of the manifest: the path a file was added from,
+// its permissions and the object holding its encrypted contents
+type attachment struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Object string `json:"object"`
+}
+
+// manifest lists the attachments of a files directory, sorted by path
+type manifest struct {
+	Files []attachment `json:"files"`
+}
+
+// newFileGroup builds the "file" command and its subcommands
+func newFileGroup() *group {
+	cmds := make(map[string]executor)
+
+	addCmd := new(command[fileAddOpts])
+	addCmd.flags = flag.NewFlagSet("add", flag.ExitOnError)
+	addCmd.flags.StringVarP(&addCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	addCmd.flags.StringVarP(&addCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	addCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	addCmd.fn = fileAddCmdFn
+	cmds[addCmd.flags.Name()] = addCmd
+
+	getCmd := new(command[fileGetOpts])
+	getCmd.flags = flag.NewFlagSet("get", flag.ExitOnError)
+	getCmd.flags.StringVarP(&getCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	getCmd.flags.StringVarP(&getCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	getCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	getCmd.flags.StringVarP(&getCmd.val.Output, "output", "o", "", "Writes the file here, with its original permissions, instead of printing it")
+	getCmd.fn = fileGetCmdFn
+	cmds[getCmd.flags.Name()] = getCmd
+
+	materializeCmd := new(command[fileMaterializeOpts])
+	materializeCmd.flags = flag.NewFlagSet("materialize", flag.ExitOnError)
+	materializeCmd.flags.StringVarP(&materializeCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	materializeCmd.flags.StringVarP(&materializeCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	materializeCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	materializeCmd.flags.BoolVar(&materializeCmd.val.Force, "force", false, "Overwrites existing files that differ from the attachment")
+	materializeCmd.fn = fileMaterializeCmdFn
+	cmds[materializeCmd.flags.Name()] = materializeCmd
+
+	listCmd := new(command[struct{}])
+	listCmd.flags = flag.NewFlagSet("list", flag.ExitOnError)
+	listCmd.fn = fileListCmdFn
+	cmds[listCmd.flags.Name()] = listCmd
+
+	return &group{name: "file", cmds: cmds}
+}
+
+// filesDir returns the directory attachments are kept in
+func filesDir() string {
+	if dir := os.Getenv("ENVX_FILES_DIR"); dir != "" {
+		return dir
+	}
+	return defaultFilesDir
+}
+
+// loadManifest reads the manifest of dir; a missing one is empty
+func loadManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName)) // #nosec G304 -- Manifest in the envx files directory
+	if os.IsNotExist(err) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing file manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// save writes the manifest to dir
+func (m *manifest) save(dir string) error {
+	slices.SortFunc(m.Files, func(a, b attachment) int { return strings.Compare(a.Path, b.Path) })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), append(data, '\n'), env.SecureFileMode); err != nil {
+		return fmt.Errorf("error writing file manifest: %w", err)
+	}
+	return nil
+}
+
+// get returns the attachment added from path
+func (m *manifest) get(path string) (attachment, bool) {
+	for _, a := range m.Files {
+		if a.Path == path {
+			return a, true
+		}
+	}
+	return attachment{}, false
+}
+
+// set adds or replaces the attachment for a.Path
+func (m *manifest) set(a attachment) {
+	for i := range m.Files {
+		if m.Files[i].Path == a.Path {
+			m.Files[i] = a
+			return
+		}
+	}
+	m.Files = append(m.Files, a)
+}
+
+// attachmentPath returns how path is recorded in the manifest. Only files
+// inside the working directory can be attached, so materializing never
+// writes outside of it.
+func attachmentPath(path string) (string, error) {
+	clean := filepath.Clean(path)
+	if !filepath.IsLocal(clean) {
+		return "", fmt.Errorf("%s is not inside the current directory", path)
+	}
+	return filepath.ToSlash(clean), nil
+}
+
+// objectName returns the name of the object holding the attachment of path
+func objectName(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:16]) + ".enc"
+}
+
+// fileMode returns the permissions recorded for a
+func (a attachment) fileMode() (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(a.Mode, 8, 32)
+	if err != nil || mode > uint64(fs.ModePerm) {
+		return 0, fmt.Errorf("invalid mode %q for %s in file manifest", a.Mode, a.Path)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// fileAddCmdFn encrypts files into the files directory and records them in
+// its manifest, replacing earlier versions
+func fileAddCmdFn(ctx context.Context, opts fileAddOpts, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: envx file add <path>...")
+	}
+
+	dir := filesDir()
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(args))
+	for i, arg := range args {
+		if paths[i], err = attachmentPath(arg); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return nil
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating files directory: %w", err)
+	}
+	encryptor := selectedEncryptor(ctx)
+	for _, path := range paths {
+		info, err := os.Stat(filepath.FromSlash(path))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+		content, err := os.ReadFile(filepath.FromSlash(path)) // #nosec G304 -- User-provided file to attach
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		ciphertext, err := encryptor.Encrypt(ctx, attachmentHeader+string(content), key)
+		secure.Zero(content)
+		if err != nil {
+			return fmt.Errorf("error encrypting %s: %w", path, err)
+		}
+
+		a := attachment{Path: path, Mode: fmt.Sprintf("%04o", info.Mode().Perm()), Object: objectName(path)}
+		if err := os.WriteFile(filepath.Join(dir, a.Object), []byte(ciphertext+"\n"), env.SecureFileMode); err != nil {
+			return fmt.Errorf("error writing %s: %w", a.Object, err)
+		}
+		m.set(a)
+		fmt.Println(path)
+	}
+	return m.save(dir)
+}
+
+// fileGetCmdFn prints an attachment, or writes it with its original
+// permissions with --output
+func fileGetCmdFn(ctx context.Context, opts fileGetOpts, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: envx file get <path>")
+	}
+
+	dir := filesDir()
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	path, err := attachmentPath(args[0])
+	if err != nil {
+		return err
+	}
+	a, ok := m.get(path)
+	if !ok {
+		return fmt.Errorf("no attachment for %s; add it with \"envx file add %s\"", path, path)
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+	if err := auditAccess("file get", filepath.Join(dir, manifestName), opts.KeyStore, opts.Password, []string{path}); err != nil {
+		return err
+	}
+
+	content, err := decryptAttachment(ctx, dir, a, key)
+	if err != nil {
+		return err
+	}
+	defer secure.Zero(content)
+	if opts.Output == "" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	mode, err := a.fileMode()
+	if err != nil {
+		return err
+	}
+	return writeAttachment(opts.Output, content, mode)
+}
+
+// fileMaterializeCmdFn restores attachments, all of them unless paths are
+// given, to the paths they were added from with their original permissions
+func fileMaterializeCmdFn(ctx context.Context, opts fileMaterializeOpts, args ...string) error {
+	dir := filesDir()
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	selected := m.Files
+	if len(args) > 0 {
+		selected = nil
+		for _, arg := range args {
+			path, err := attachmentPath(arg)
+			if err != nil {
+				return err
+			}
+			a, ok := m.get(path)
+			if !ok {
+				return fmt.Errorf("no attachment for %s", path)
+			}
+			selected = append(selected, a)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+	paths := make([]string, len(selected))
+	for i, a := range selected {
+		paths[i] = a.Path
+	}
+	if err := auditAccess("file materialize", filepath.Join(dir, manifestName), opts.KeyStore, opts.Password, paths); err != nil {
+		return err
+	}
+
+	// Decrypt and check everything before writing anything
+	contents := make([][]byte, len(selected))
+	defer func() {
+		for _, content := range contents {
+			secure.Zero(content)
+		}
+	}()
+	for i, a := range selected {
+		if !filepath.IsLocal(filepath.FromSlash(a.Path)) {
+			return fmt.Errorf("file manifest contains unsafe path %q", a.Path)
+		}
+		if contents[i], err = decryptAttachment(ctx, dir, a, key); err != nil {
+			return err
+		}
+		if err := checkRestoreTarget(filepath.FromSlash(a.Path), contents[i], opts.Force); err != nil {
+			return err
+		}
+	}
+
+	for i, a := range selected {
+		if dryRun {
+			fmt.Println(a.Path)
+			continue
+		}
+		mode, err := a.fileMode()
+		if err != nil {
+			return err
+		}
+		if err := writeAttachment(filepath.FromSlash(a.Path), contents[i], mode); err != nil {
+			return err
+		}
+		fmt.Println(a.Path)
+	}
+	return nil
+}
+
+// fileListCmdFn prints the mode and path of each attachment
+func fileListCmdFn(ctx context.Context, _ struct{}, args ...string) error {
+	m, err := loadManifest(filesDir())
+	if err != nil {
+		return err
+	}
+	for _, a := range m.Files {
+		fmt.Printf("%s %s\n", a.Mode, a.Path)
+	}
+	return nil
+}
+
+// decryptAttachment returns the contents of the attachment a
+func decryptAttachment(ctx context.Context, dir string, a attachment, key []byte) ([]byte, error) {
+	if filepath.Base(a.Object) != a.Object {
+		return nil, fmt.Errorf("file manifest contains unsafe object name %q", a.Object)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, a.Object)) // #nosec G304 -- Object in the envx files directory
+	if err != nil {
+		return nil, fmt.Errorf("error reading attachment %s: %w", a.Path, err)
+	}
+	ciphertext := strings.TrimSpace(string(data))
+	encryptor := selectedEncryptor(ctx)
+	if !encryptor.IsEncrypted(ciphertext) {
+		return nil, fmt.Errorf("attachment %s is not encrypted", a.Path)
+	}
+	plaintext, err := encryptor.Decrypt(ctx, ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting %s: %w", a.Path, err)
+	}
+	content, ok := strings.CutPrefix(plaintext, attachmentHeader)
+	if !ok {
+		return nil, fmt.Errorf("attachment %s is malformed", a.Path)
+	}
+	return []byte(content), nil
+}
+
+// writeAttachment writes content to path with exactly mode, creating its
+// directory if needed
+func writeAttachment(path string, content []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, content, mode); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	// WriteFile leaves the mode of existing files alone and applies the umask
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("error setting permissions of %s: %w", path, err)
+	}
+	return nil
+}
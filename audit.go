@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/audit"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+	flag "github.com/spf13/pflag"
+)
+
+type auditShowOpts struct {
+	JSON bool
+	Last int
+	File string
+}
+
+// auditNow returns the time entries are recorded with; tests replace it
+var auditNow = time.Now
+
+func newAuditGroup() *group {
+	cmds := make(map[string]executor)
+
+	showCmd := new(command[auditShowOpts])
+	showCmd.flags = flag.NewFlagSet("show", flag.ExitOnError)
+	showCmd.flags.BoolVar(&showCmd.val.JSON, "json", false, "Prints entries as JSON lines")
+	showCmd.flags.IntVar(&showCmd.val.Last, "last", 0, "Prints only the last n entries")
+	showCmd.flags.StringVarP(&showCmd.val.File, "file", "f", "", "Prints only entries for this env file")
+	showCmd.fn = auditShowCmdFn
+	cmds[showCmd.flags.Name()] = showCmd
+
+	return &group{name: "audit", cmds: cmds}
+}
+
+// auditConfig reads the audit settings from the environment. Auditing is
+// enabled by ENVX_AUDIT=true or by setting ENVX_AUDIT_LOG to the log path;
+// ENVX_AUDIT_SYSLOG and ENVX_AUDIT_FORWARD forward entries as well.
+func auditConfig() (enabled bool, path string, sinks audit.Multi, err error) {
+	path = os.Getenv("ENVX_AUDIT_LOG")
+	enabled = path != ""
+	if value := os.Getenv("ENVX_AUDIT"); value != "" {
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return false, "", nil, fmt.Errorf("invalid ENVX_AUDIT value %q: %w", value, err)
+		}
+	}
+	if path == "" {
+		path = audit.DefaultPath()
+	}
+	sinks = audit.Multi{audit.NewFileLog(path)}
+
+	if value := os.Getenv("ENVX_AUDIT_SYSLOG"); value != "" {
+		forward, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, "", nil, fmt.Errorf("invalid ENVX_AUDIT_SYSLOG value %q: %w", value, err)
+		}
+		if forward {
+			sinks = append(sinks, audit.NewSyslog("envx"))
+		}
+	}
+	if forward := os.Getenv("ENVX_AUDIT_FORWARD"); forward != "" {
+		sinks = append(sinks, audit.NewFileLog(forward))
+	}
+	return enabled, path, sinks, nil
+}
+
+// auditAccess records that command read keys from file when auditing is
+// enabled. A failure to record is returned so secrets are not handed out
+// without a trace.
+func auditAccess(command, file, storeTypeStr, password string, keys []string) error {
+	enabled, _, sinks, err := auditConfig()
+	if err != nil || !enabled {
+		return err
+	}
+
+	storeType, _, err := resolveKeyStoreType(storeTypeStr, password)
+	if err != nil {
+		return err
+	}
+	user, err := currentUser()
+	if err != nil {
+		return err
+	}
+
+	entry := audit.Entry{
+		Time:     auditNow().UTC(),
+		User:     user,
+		Command:  command,
+		File:     auditFile(file),
+		Keys:     keys,
+		KeyStore: string(storeType),
+	}
+	if err := sinks.Record(entry); err != nil {
+		return fmt.Errorf("error recording audit entry: %w", err)
+	}
+	return nil
+}
+
+// varKeys returns the keys of vars in order
+func varKeys(vars env.Variables) []string {
+	keys := make([]string, len(vars))
+	for i, v := range vars {
+		keys[i] = v.Key
+	}
+	return keys
+}
+
+func auditShowCmdFn(ctx context.Context, opts auditShowOpts, args ...string) error {
+	_, path, _, err := auditConfig()
+	if err != nil {
+		return err
+	}
+	entries, err := audit.NewFileLog(path).Read()
+	if err != nil {
+		return err
+	}
+
+	if opts.File != "" {
+		file := absPath(opts.File)
+		filtered := entries[:0]
+		for _, e := range entries {
+			if e.File == file {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+	if opts.Last > 0 && len(entries) > opts.Last {
+		entries = entries[len(entries)-opts.Last:]
+	}
+
+	for _, e := range entries {
+		if opts.JSON {
+			line, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(line))
+			continue
+		}
+		fmt.Println(e)
+	}
+	return nil
+}
+
+// auditFile returns how file is identified in audit entries
+func auditFile(file string) string {
+	if file == stdinFile {
+		return "<stdin>"
+	}
+	if remote.IsURL(file) || remote.IsObjectURI(file) {
+		return file
+	}
+	return absPath(file)
+}
+
+// absPath returns file as an absolute path so entries from different working
+// directories match, or file itself if that fails
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/audit"
+)
+
+func TestAuditAccess(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	originalNow := auditNow
+	defer func() { auditNow = originalNow }()
+	auditNow = func() time.Time { return time.Unix(1700000000, 0) }
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.log")
+	forwardPath := filepath.Join(dir, "forward.log")
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("A=1\nB=2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is recorded unless auditing is enabled
+	t.Setenv("ENVX_AUDIT_LOG", "")
+	t.Setenv("HOME", dir)
+	if _, err := captureStdout(t, func() error {
+		return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "A")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(audit.DefaultPath()); !os.IsNotExist(err) {
+		t.Errorf("audit log written while auditing is disabled: %v", err)
+	}
+
+	t.Setenv("ENVX_AUDIT_LOG", logPath)
+	t.Setenv("ENVX_AUDIT_FORWARD", forwardPath)
+	calls := []func() error{
+		func() error {
+			return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "A")
+		},
+		func() error {
+			return getVCmdFn(context.Background(), getVOpts{File: envFile, KeyStore: "mock", Separator: ","})
+		},
+		func() error {
+			return decryptCmd(context.Background(), decryptOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "B")
+		},
+	}
+	for _, call := range calls {
+		if _, err := captureStdout(t, call); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := audit.NewFileLog(logPath).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, e := range entries {
+		if e.File != envFile || e.KeyStore != "mock" || e.User == "" || !e.Time.Equal(auditNow()) {
+			t.Errorf("unexpected audit entry %+v", e)
+		}
+		got = append(got, append([]string{e.Command}, e.Keys...))
+	}
+	want := [][]string{{"get", "A"}, {"getv", "A", "B"}, {"decrypt", "B"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("audit entries = %v, want %v", got, want)
+	}
+
+	forwarded, err := audit.NewFileLog(forwardPath).Read()
+	if err != nil || len(forwarded) != len(entries) {
+		t.Errorf("forwarded %d entries (%v), want %d", len(forwarded), err, len(entries))
+	}
+
+	output, err := captureStdout(t, func() error {
+		return auditShowCmdFn(context.Background(), auditShowOpts{Last: 1})
+	})
+	if err != nil {
+		t.Fatalf("auditShowCmdFn() unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(output), "\n"); len(lines) != 1 || !strings.Contains(lines[0], "decrypt "+envFile) {
+		t.Errorf("auditShowCmdFn() --last 1 = %q", output)
+	}
+
+	output, err = captureStdout(t, func() error {
+		return auditShowCmdFn(context.Background(), auditShowOpts{JSON: true, File: filepath.Join(dir, "other.env")})
+	})
+	if err != nil || output != "" {
+		t.Errorf("auditShowCmdFn() for another file = %q, %v", output, err)
+	}
+
+	// Failing to record refuses access
+	t.Setenv("ENVX_AUDIT_LOG", filepath.Join(envFile, "audit.log"))
+	err = getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "A")
+	if err == nil || !strings.Contains(err.Error(), "audit") {
+		t.Errorf("getCmdFn() with an unwritable audit log error = %v", err)
+	}
+
+	t.Setenv("ENVX_AUDIT", "maybe")
+	if err := auditAccess("get", envFile, "mock", "", nil); err == nil {
+		t.Error("auditAccess() expected error for an invalid ENVX_AUDIT")
+	}
+}
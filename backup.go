@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+	flag "github.com/spf13/pflag"
+)
+
+type backupPruneOpts struct {
+	Name string
+	File string
+	Keep int
+}
+
+// backupLayout is the timestamp in backup names; it sorts in time order
+const backupLayout = "20060102T150405.000000000Z"
+
+// backupNow returns the time backups are named after; tests replace it
+var backupNow = time.Now
+
+func newBackupGroup() *group {
+	cmds := make(map[string]executor)
+
+	pruneCmd := new(command[backupPruneOpts])
+	pruneCmd.flags = flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneCmd.flags.StringVarP(&pruneCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	pruneCmd.flags.StringVarP(&pruneCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	pruneCmd.flags.IntVar(&pruneCmd.val.Keep, "keep", -1, "Number of most recent backups to keep (default ENVX_BACKUP_KEEP)")
+	pruneCmd.fn = backupPruneCmdFn
+	cmds[pruneCmd.flags.Name()] = pruneCmd
+
+	return &group{name: "backup", cmds: cmds}
+}
+
+// backupConfig reads the backup settings from the environment. Backups are
+// enabled by ENVX_BACKUP=true or by setting ENVX_BACKUP_DIR to the directory
+// they are kept in, which is otherwise that of the file. ENVX_BACKUP_KEEP
+// limits how many are kept per file; 0 keeps them all.
+func backupConfig() (enabled bool, dir string, keep int, err error) {
+	dir = os.Getenv("ENVX_BACKUP_DIR")
+	enabled = dir != ""
+	if value := os.Getenv("ENVX_BACKUP"); value != "" {
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return false, "", 0, fmt.Errorf("invalid ENVX_BACKUP value %q: %w", value, err)
+		}
+	}
+	if value := os.Getenv("ENVX_BACKUP_KEEP"); value != "" {
+		if keep, err = strconv.Atoi(value); err != nil || keep < 0 {
+			return false, "", 0, fmt.Errorf("invalid ENVX_BACKUP_KEEP value %q: expected a non-negative number", value)
+		}
+	}
+	return enabled, dir, keep, nil
+}
+
+// backupMaxAge reads ENVX_BACKUP_MAX_AGE, how long backups are kept, such
+// as "30d". 0, the default, keeps them regardless of age.
+func backupMaxAge() (time.Duration, error) {
+	value := os.Getenv("ENVX_BACKUP_MAX_AGE")
+	if value == "" {
+		return 0, nil
+	}
+	maxAge, err := env.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ENVX_BACKUP_MAX_AGE value: %w", err)
+	}
+	return maxAge, nil
+}
+
+// backupDir returns the directory backups of file are kept in
+func backupDir(file, dir string) string {
+	if dir == "" {
+		return filepath.Dir(file)
+	}
+	return dir
+}
+
+// backupFile copies file to <file>.backup.<timestamp> before envx
+// overwrites it, when backups are enabled, then prunes its old backups.
+// Files that do not exist yet, stdin and remote files are not backed up.
+func backupFile(file string) error {
+	enabled, dir, keep, err := backupConfig()
+	if err != nil || !enabled {
+		return err
+	}
+	if file == stdinFile || remote.IsURL(file) || remote.IsObjectURI(file) {
+		return nil
+	}
+	content, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error backing up %s: %w", file, err)
+	}
+
+	dir = backupDir(file, dir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating backup directory: %w", err)
+	}
+	backups, err := listBackups(file, dir)
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Join(dir, filepath.Base(file)+".backup.")
+	stamp := backupNow().UTC()
+	if len(backups) > 0 {
+		// Keep backups written within the clock's resolution in order
+		last, _ := time.Parse(backupLayout, strings.TrimPrefix(backups[len(backups)-1], prefix))
+		if !stamp.After(last) {
+			stamp = last.Add(time.Nanosecond)
+		}
+	}
+	path := prefix + stamp.Format(backupLayout)
+	if err := os.WriteFile(path, content, env.SecureFileMode); err != nil {
+		return fmt.Errorf("error backing up %s: %w", file, err)
+	}
+	if keep > 0 {
+		if _, err := pruneBackups(file, dir, keep); err != nil {
+			return err
+		}
+	}
+	maxAge, err := backupMaxAge()
+	if err != nil || maxAge == 0 {
+		return err
+	}
+	_, err = pruneExpiredBackups(file, dir, maxAge)
+	return err
+}
+
+// listBackups returns the paths of the backups of file kept in dir, oldest
+// first
+func listBackups(file, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup directory: %w", err)
+	}
+
+	prefix := filepath.Base(file) + ".backup."
+	var backups []string
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupLayout, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, entry.Name()))
+	}
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// pruneBackups removes all but the keep most recent backups of file from
+// dir and returns the paths removed. With --dry-run nothing is removed.
+func pruneBackups(file, dir string, keep int) ([]string, error) {
+	backups, err := listBackups(file, dir)
+	if err != nil || len(backups) <= keep {
+		return nil, err
+	}
+	stale := backups[:len(backups)-keep]
+	if dryRun {
+		return stale, nil
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing backup: %w", err)
+		}
+	}
+	return stale, nil
+}
+
+// pruneExpiredBackups removes the backups of file in dir taken more than
+// maxAge ago, going by the timestamp in their names, and returns the paths
+// removed. With --dry-run nothing is removed.
+func pruneExpiredBackups(file, dir string, maxAge time.Duration) ([]string, error) {
+	backups, err := listBackups(file, dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Join(dir, filepath.Base(file)+".backup.")
+	cutoff := backupNow().Add(-maxAge)
+	var expired []string
+	for _, path := range backups {
+		taken, _ := time.Parse(backupLayout, strings.TrimPrefix(path, prefix))
+		if !taken.Before(cutoff) {
+			// Backups are oldest first, so the rest are newer still
+			break
+		}
+		expired = append(expired, path)
+	}
+	if dryRun {
+		return expired, nil
+	}
+	for _, path := range expired {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing backup: %w", err)
+		}
+	}
+	return expired, nil
+}
+
+// backupPruneCmdFn removes old backups of the env file, printing the path of
+// each backup removed
+func backupPruneCmdFn(ctx context.Context, opts backupPruneOpts, args ...string) error {
+	_, dir, keep, err := backupConfig()
+	if err != nil {
+		return err
+	}
+	if opts.Keep >= 0 {
+		keep = opts.Keep
+	} else if os.Getenv("ENVX_BACKUP_KEEP") == "" {
+		return fmt.Errorf("no retention set; use --keep or ENVX_BACKUP_KEEP")
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	removed, err := pruneBackups(file, backupDir(file, dir), keep)
+	if err != nil {
+		return err
+	}
+	for _, path := range removed {
+		fmt.Println(path)
+	}
+	return nil
+}
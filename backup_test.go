@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupOnWrite(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	backupNow = func() time.Time { return now }
+	defer func() { backupNow = time.Now }()
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var previous []string
+	set := func(arg string) {
+		t.Helper()
+		now = now.Add(time.Minute)
+		content, err := os.ReadFile(envFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		previous = append(previous, string(content))
+		if err := setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, arg); err != nil {
+			t.Fatalf("setCmdFn() unexpected error: %v", err)
+		}
+	}
+
+	set("PORT=2")
+	if backups, _ := listBackups(envFile, dir); len(backups) != 0 {
+		t.Fatalf("backups written while disabled: %v", backups)
+	}
+
+	backups := filepath.Join(dir, "backups")
+	t.Setenv("ENVX_BACKUP_DIR", backups)
+	t.Setenv("ENVX_BACKUP_KEEP", "2")
+	for _, arg := range []string{"PORT=3", "PORT=4", "PORT=5"} {
+		set(arg)
+	}
+	got, err := listBackups(envFile, backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("listBackups() = %v, want the 2 most recent", got)
+	}
+	for i, want := range previous[len(previous)-2:] {
+		if content, _ := os.ReadFile(got[i]); string(content) != want {
+			t.Errorf("backup %s = %q, want %q", got[i], content, want)
+		}
+	}
+	if want := ".env.backup.20261016T120400.000000000Z"; filepath.Base(got[1]) != want {
+		t.Errorf("backup name = %q, want %q", filepath.Base(got[1]), want)
+	}
+
+	t.Setenv("ENVX_BACKUP_KEEP", "")
+	output, err := captureStdout(t, func() error {
+		return backupPruneCmdFn(context.Background(), backupPruneOpts{File: envFile, Keep: 1})
+	})
+	if err != nil {
+		t.Fatalf("backupPruneCmdFn() unexpected error: %v", err)
+	}
+	if output != got[0]+"\n" {
+		t.Errorf("backupPruneCmdFn() = %q, want %q", output, got[0]+"\n")
+	}
+	if err := backupPruneCmdFn(context.Background(), backupPruneOpts{File: envFile, Keep: -1}); err == nil || !strings.Contains(err.Error(), "--keep") {
+		t.Errorf("backupPruneCmdFn() without retention error = %v", err)
+	}
+
+	t.Setenv("ENVX_BACKUP", "sometimes")
+	if err := setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "PORT=6"); err == nil {
+		t.Error("setCmdFn() expected error for an invalid ENVX_BACKUP")
+	}
+}
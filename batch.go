@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	flag "github.com/spf13/pflag"
+)
+
+// batchOpts makes a command operate over several env files at once
+type batchOpts struct {
+	all  bool
+	glob string
+}
+
+func NewBatchOpts(flags *flag.FlagSet) *batchOpts {
+	opts := new(batchOpts)
+	flags.BoolVar(&opts.all, "all-resolved", false, "Operates on every env file next to --file (.env, .env.local, .env.*), printing a summary per file")
+	flags.StringVar(&opts.glob, "glob", "", "Operates on every file matching a glob pattern such as '.env.*', printing a summary per file")
+	return opts
+}
+
+// Enabled reports whether a batch of files was asked for
+func (opts *batchOpts) Enabled() bool {
+	return opts != nil && (opts.all || opts.glob != "")
+}
+
+// Files returns the existing env files of the batch, in order. Backups and
+// the .env.example template are left out: they are not environments.
+func (opts *batchOpts) Files(base string) ([]string, error) {
+	if opts.all && opts.glob != "" {
+		return nil, fmt.Errorf("--all-resolved and --glob cannot be used together")
+	}
+
+	var candidates []string
+	if opts.glob != "" {
+		matches, err := filepath.Glob(opts.glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", opts.glob, err)
+		}
+		slices.Sort(matches)
+		candidates = matches
+	} else {
+		var err error
+		if candidates, err = envFileCandidates(base, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	for _, file := range candidates {
+		name := filepath.Base(file)
+		if strings.Contains(name, ".backup.") || name == defaultExampleFile {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no env files found")
+	}
+	return files, nil
+}
+
+// batchResult is the outcome of a command on one file of a batch
+type batchResult struct {
+	File   string `json:"file"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// runBatch runs fn on every file, carrying on past failures, then prints a
+// summary table, or a JSON array with asJSON. It fails if any file did.
+func runBatch(files []string, asJSON bool, fn func(file string) (string, error)) error {
+	results := make([]batchResult, 0, len(files))
+	failed := 0
+	for _, file := range files {
+		detail, err := fn(file)
+		result := batchResult{File: file, OK: err == nil, Detail: detail}
+		if err != nil {
+			result.Detail = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if asJSON {
+		if err := writeJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tRESULT\tDETAIL")
+		for _, r := range results {
+			result := "ok"
+			if !r.OK {
+				result = "failed"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.File, result, r.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		diagf("%d of %d files failed\n", failed, len(files))
+		return &exitError{code: 1}
+	}
+	return nil
+}
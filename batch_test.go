@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestBatchOpts_Files(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	for _, name := range []string{".env", ".env.local", ".env.prod", ".env.example", ".env.backup.20260101T000000.000000000Z"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("A=1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".env.d"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    batchOpts
+		want    []string
+		wantErr bool
+	}{
+		{name: "all resolved", opts: batchOpts{all: true}, want: []string{".env", ".env.local", ".env.prod"}},
+		{name: "glob", opts: batchOpts{glob: filepath.Join(dir, ".env.*")}, want: []string{".env.local", ".env.prod"}},
+		{name: "no match", opts: batchOpts{glob: filepath.Join(dir, "*.yaml")}, wantErr: true},
+		{name: "both", opts: batchOpts{all: true, glob: "*"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := tt.opts.Files(base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Files() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, file := range files {
+				names = append(names, filepath.Base(file))
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Files() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchEncryptAndVerify(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	files := []string{base, base + ".prod"}
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("SECRET=value\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = captureStdout(t, func() error {
+		return encryptCmd(context.Background(), encryptOpts{File: base, KeyStore: "mock", FmtOpts: &fmtOpts{}, Batch: &batchOpts{all: true}})
+	})
+	if err == nil || !strings.Contains(err.Error(), "--write") {
+		t.Errorf("encryptCmd() batch without --write error = %v", err)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return encryptCmd(context.Background(), encryptOpts{File: base, KeyStore: "mock", FmtOpts: &fmtOpts{}, Write: true, Batch: &batchOpts{all: true}})
+	})
+	if err != nil {
+		t.Fatalf("encryptCmd() batch error = %v", err)
+	}
+	if strings.Count(output, "encrypted: 1,") != 2 {
+		t.Errorf("encryptCmd() batch output = %q", output)
+	}
+	for _, file := range files {
+		vars, err := loadEnv(context.Background(), file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, err := crypto.NewAESEncryptor().Decrypt(context.Background(), vars.Get("SECRET").Value, key); err != nil || value != "value" {
+			t.Errorf("%s SECRET = %q, %v", file, value, err)
+		}
+	}
+
+	// Neither file is signed: every file is reported, then the batch fails
+	output, err = captureStdout(t, func() error {
+		return verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: base, AllowAnySigner: true, JSON: true, Batch: &batchOpts{all: true}})
+	})
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != 1 {
+		t.Errorf("verifySignatureCmdFn() batch error = %v, want exit status 1", err)
+	}
+	var results []batchResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output %q is not JSON: %v", output, err)
+	}
+	if len(results) != 2 || results[0].OK || results[1].OK {
+		t.Errorf("verifySignatureCmdFn() batch results = %+v", results)
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	for _, file := range []string{base, base + ".staging"} {
+		if err := os.WriteFile(file, []byte("A=1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := captureStdout(t, func() error {
+		return statusCmdFn(context.Background(), statusOpts{File: base, KeyStore: "mock", JSON: true, Batch: &batchOpts{all: true}})
+	})
+	if err != nil {
+		t.Fatalf("statusCmdFn() batch error = %v", err)
+	}
+	var statuses []envStatus
+	if err := json.Unmarshal([]byte(output), &statuses); err != nil {
+		t.Fatalf("output %q is not JSON: %v", output, err)
+	}
+	if len(statuses) != 2 || statuses[1].File != absPath(base+".staging") || !statuses[1].Exists {
+		t.Errorf("statusCmdFn() batch = %+v", statuses)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type benchOpts struct {
+	Name      string
+	File      string
+	KeyStore  string
+	Password  string
+	Values    int
+	Size      int
+	KDFTarget time.Duration
+	JSON      bool
+}
+
+// keyStoreRounds is how many times bench loads the key to average the
+// keystore latency; the first load may warm up caches the others use
+const keyStoreRounds = 3
+
+func newBenchCmd() *command[benchOpts] {
+	cmd := new(command[benchOpts])
+	cmd.flags = flag.NewFlagSet("bench", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.IntVar(&cmd.val.Values, "values", 1000, "Number of values to encrypt and decrypt")
+	cmd.flags.IntVar(&cmd.val.Size, "size", 64, "Size in bytes of each value encrypted")
+	cmd.flags.DurationVar(&cmd.val.KDFTarget, "kdf-target", 500*time.Millisecond, "Key derivation time to suggest password iterations for")
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the measurements as a JSON array")
+	cmd.fn = benchCmdFn
+	return cmd
+}
+
+// benchResult is one measurement of envx bench. A skipped measurement has
+// no operations.
+type benchResult struct {
+	Name    string        `json:"name"`
+	Ops     int           `json:"ops"`
+	PerOp   time.Duration `json:"ns_per_op"`
+	Detail  string        `json:"detail"`
+	Skipped bool          `json:"skipped,omitempty"`
+}
+
+// benchCmdFn measures the operations envx spends its time on with the
+// current configuration: password key derivation, loading the key from the
+// keystore, encrypting and decrypting values, and loading the env file. The
+// key is never created, and it is only loaded when that needs no prompt.
+func benchCmdFn(ctx context.Context, opts benchOpts, args ...string) error {
+	if opts.Values <= 0 {
+		return fmt.Errorf("--values must be positive, got %d", opts.Values)
+	}
+	if opts.Size < 0 {
+		return fmt.Errorf("--size must not be negative, got %d", opts.Size)
+	}
+	if opts.KDFTarget <= 0 {
+		return fmt.Errorf("--kdf-target must be positive, got %s", opts.KDFTarget)
+	}
+
+	kdf, err := benchKDF(opts.KDFTarget)
+	if err != nil {
+		return err
+	}
+	store, err := benchKeyStore(opts)
+	if err != nil {
+		return err
+	}
+	values, err := benchEncryptor(ctx, opts.Values, opts.Size)
+	if err != nil {
+		return err
+	}
+	load, err := benchLoad(ctx, env.BuildFilename(opts.File, opts.Name))
+	if err != nil {
+		return err
+	}
+	results := append([]benchResult{kdf, store}, values...)
+	results = append(results, load)
+
+	if opts.JSON {
+		return writeJSON(os.Stdout, results)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MEASUREMENT\tOPS\tPER OP\tDETAIL")
+	for _, r := range results {
+		if r.Skipped {
+			fmt.Fprintf(w, "%s\t-\t-\t%s\n", r.Name, r.Detail)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Name, r.Ops, roundDuration(r.PerOp), r.Detail)
+	}
+	return w.Flush()
+}
+
+// benchKDF times one password key derivation with the iterations new
+// password keystore keys get, and suggests the iterations that would take
+// about target
+func benchKDF(target time.Duration) (benchResult, error) {
+	config, err := passwordKeyStoreConfig("")
+	if err != nil {
+		return benchResult{}, err
+	}
+	iterations := config.Iterations
+	if iterations <= 0 {
+		iterations = keystore.DefaultIterations
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return benchResult{}, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	start := time.Now()
+	key, err := keystore.DeriveKey("envx bench", salt, iterations)
+	elapsed := time.Since(start)
+	if err != nil {
+		return benchResult{}, fmt.Errorf("failed to derive key: %w", err)
+	}
+	secure.Zero(key)
+
+	return benchResult{
+		Name:   "kdf",
+		Ops:    1,
+		PerOp:  elapsed,
+		Detail: fmt.Sprintf("pbkdf2-sha256, %d iterations; %d iterations take about %s", iterations, suggestedIterations(iterations, elapsed, target), target),
+	}, nil
+}
+
+// suggestedIterations scales iterations, which took elapsed, to take about
+// target, rounded down to ten thousand and never below the minimum
+func suggestedIterations(iterations int, elapsed, target time.Duration) int {
+	if elapsed <= 0 {
+		return iterations
+	}
+	suggested := int(float64(iterations)*float64(target)/float64(elapsed)) / 10000 * 10000
+	return max(suggested, keystore.DefaultIterations)
+}
+
+// benchKeyStore times loading the key from the selected keystore. It is
+// skipped when the key does not exist yet or loading it would prompt.
+func benchKeyStore(opts benchOpts) (benchResult, error) {
+	storeType, password, err := resolveKeyStoreType(opts.KeyStore, opts.Password)
+	if err != nil {
+		return benchResult{}, err
+	}
+	result := benchResult{Name: "keystore"}
+
+	override, source, err := keyOverride()
+	if err != nil {
+		return benchResult{}, err
+	}
+	if override != nil {
+		secure.Zero(override)
+		result.Skipped = true
+		result.Detail = "skipped: the key is given with " + source
+		return result, nil
+	}
+	if state := keyState(storeType, password); state != keyAvailable {
+		result.Skipped = true
+		result.Detail = fmt.Sprintf("skipped: %s keystore key is %s", storeType, state)
+		return result, nil
+	}
+
+	start := time.Now()
+	for range keyStoreRounds {
+		key, err := loadKeyWithTypeAndPassword(storeType, password)
+		if err != nil {
+			return benchResult{}, err
+		}
+		secure.Zero(key)
+	}
+	result.Ops = keyStoreRounds
+	result.PerOp = time.Since(start) / keyStoreRounds
+	result.Detail = string(storeType) + " keystore"
+	if storeType == KeyStoreTypePassword {
+		result.Detail += ", including key derivation"
+	}
+	return result, nil
+}
+
+// benchEncryptor times encrypting n values of size bytes with the selected
+// encryptor and a throwaway key, then decrypting them
+func benchEncryptor(ctx context.Context, n, size int) ([]benchResult, error) {
+	encryptor := selectedEncryptor(ctx)
+	key := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	defer secure.Zero(key)
+	plaintext := strings.Repeat("x", size)
+	detail := fmt.Sprintf("%d byte values", size)
+
+	ciphertexts := make([]string, n)
+	start := time.Now()
+	for i := range ciphertexts {
+		ciphertext, err := encryptor.Encrypt(ctx, plaintext, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt: %w", err)
+		}
+		ciphertexts[i] = ciphertext
+	}
+	encrypt := benchResult{Name: "encrypt", Ops: n, PerOp: time.Since(start) / time.Duration(n), Detail: detail}
+
+	start = time.Now()
+	for _, ciphertext := range ciphertexts {
+		if _, err := encryptor.Decrypt(ctx, ciphertext, key); err != nil {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+	}
+	decrypt := benchResult{Name: "decrypt", Ops: n, PerOp: time.Since(start) / time.Duration(n), Detail: detail}
+	return []benchResult{encrypt, decrypt}, nil
+}
+
+// benchLoad times loading file with its includes, bypassing the parse cache
+// so every load reads and parses it
+func benchLoad(ctx context.Context, file string) (benchResult, error) {
+	result := benchResult{Name: "load"}
+	if _, err := os.Stat(file); err != nil {
+		result.Skipped = true
+		result.Detail = "skipped: " + file + " does not exist"
+		return result, nil
+	}
+
+	ctx = env.WithCache(ctx, nil)
+	start := time.Now()
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return benchResult{}, err
+	}
+	result.Ops = 1
+	result.PerOp = time.Since(start)
+	result.Detail = fmt.Sprintf("%s, %d variables", file, len(vars))
+	return result, nil
+}
+
+// roundDuration keeps about three significant digits of d for display
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	case d >= time.Microsecond:
+		return d.Round(10 * time.Nanosecond)
+	default:
+		return d
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/keystore"
+)
+
+func TestBench(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	if _, err := loadKeyWithType(KeyStoreTypeMock); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(file, []byte("A=1\nB=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return benchCmdFn(context.Background(), benchOpts{File: file, KeyStore: "mock", Values: 10, Size: 16, KDFTarget: time.Second, JSON: true})
+	})
+	if err != nil {
+		t.Fatalf("benchCmdFn() error = %v", err)
+	}
+	var results []benchResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output %q is not JSON: %v", output, err)
+	}
+
+	want := []string{"kdf", "keystore", "encrypt", "decrypt", "load"}
+	if len(results) != len(want) {
+		t.Fatalf("benchCmdFn() results = %+v", results)
+	}
+	for i, r := range results {
+		if r.Name != want[i] || r.Skipped || r.Ops == 0 || r.PerOp <= 0 {
+			t.Errorf("result %d = %+v, want a measurement of %s", i, r, want[i])
+		}
+	}
+	if results[2].Ops != 10 {
+		t.Errorf("encrypt ops = %d, want 10", results[2].Ops)
+	}
+
+	// Without the env file its load is skipped, not failed
+	output, err = captureStdout(t, func() error {
+		return benchCmdFn(context.Background(), benchOpts{File: file + ".missing", KeyStore: "mock", Values: 1, KDFTarget: time.Second, JSON: true})
+	})
+	if err != nil {
+		t.Fatalf("benchCmdFn() error = %v", err)
+	}
+	if err := json.Unmarshal([]byte(output), &results); err != nil || !results[len(results)-1].Skipped {
+		t.Errorf("benchCmdFn() without file = %+v, %v", results, err)
+	}
+}
+
+func TestSuggestedIterations(t *testing.T) {
+	tests := []struct {
+		iterations int
+		elapsed    time.Duration
+		want       int
+	}{
+		{iterations: 100000, elapsed: 100 * time.Millisecond, want: 500000},
+		{iterations: 100000, elapsed: 300 * time.Millisecond, want: 160000},
+		{iterations: 100000, elapsed: time.Second, want: keystore.DefaultIterations},
+		{iterations: 200000, elapsed: 0, want: 200000},
+	}
+	for _, tt := range tests {
+		if got := suggestedIterations(tt.iterations, tt.elapsed, 500*time.Millisecond); got != tt.want {
+			t.Errorf("suggestedIterations(%d, %s) = %d, want %d", tt.iterations, tt.elapsed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/bundle"
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+type bundleExportOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	Output   string
+	NoKey    bool
+	NoSalts  bool
+}
+
+type bundleImportOpts struct {
+	KeyStore string
+	Dir      string
+	NoKey    bool
+	Force    bool
+}
+
+// newBundleGroup builds the "bundle" command and its subcommands
+func newBundleGroup() *group {
+	cmds := make(map[string]executor)
+
+	exportCmd := new(command[bundleExportOpts])
+	exportCmd.flags = flag.NewFlagSet("export", flag.ExitOnError)
+	exportCmd.flags.StringVarP(&exportCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env when no files are given")
+	exportCmd.flags.StringVarP(&exportCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	exportCmd.flags.StringVarP(&exportCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	exportCmd.flags.StringVarP(&exportCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	exportCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	exportCmd.flags.StringVarP(&exportCmd.val.Output, "output", "o", "envx.bundle", "Path of the bundle to write")
+	exportCmd.flags.BoolVar(&exportCmd.val.NoKey, "no-key", false, "Leaves the encryption key out of the bundle")
+	exportCmd.flags.BoolVar(&exportCmd.val.NoSalts, "no-salts", false, "Leaves the password keystore salts out of the bundle")
+	exportCmd.fn = bundleExportCmdFn
+	cmds[exportCmd.flags.Name()] = exportCmd
+
+	importCmd := new(command[bundleImportOpts])
+	importCmd.flags = flag.NewFlagSet("import", flag.ExitOnError)
+	importCmd.flags.StringVarP(&importCmd.val.KeyStore, "keystore", "k", "", "Keystore type to store the key in (macos, mock; default macos)")
+	importCmd.flags.StringVarP(&importCmd.val.Dir, "dir", "d", ".", "Directory to restore env files into")
+	importCmd.flags.BoolVar(&importCmd.val.NoKey, "no-key", false, "Does not import the encryption key")
+	importCmd.flags.BoolVar(&importCmd.val.Force, "force", false, "Overwrites existing files, salts and keys that differ from the bundle")
+	importCmd.fn = bundleImportCmdFn
+	cmds[importCmd.flags.Name()] = importCmd
+
+	return &group{name: "bundle", cmds: cmds}
+}
+
+func bundleExportCmdFn(ctx context.Context, opts bundleExportOpts, args ...string) error {
+	b := &bundle.Bundle{Files: make(map[string][]byte)}
+
+	files := args
+	if len(files) == 0 {
+		files = []string{env.BuildFilename(opts.File, opts.Name)}
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		b.Files[bundlePath(file)] = content
+	}
+
+	if !opts.NoKey {
+		key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+		if err != nil {
+			return fmt.Errorf("error loading key: %w", err)
+		}
+		defer secure.Zero(key)
+		b.Key = key
+	}
+
+	if !opts.NoSalts {
+		salts, err := filepath.Glob(filepath.Join(keystore.SaltDir(), "*.salt"))
+		if err != nil {
+			return fmt.Errorf("error listing salt files: %w", err)
+		}
+		// The recorded key parameters travel with the salts they belong to
+		params, err := filepath.Glob(filepath.Join(keystore.SaltDir(), "*.params"))
+		if err != nil {
+			return fmt.Errorf("error listing salt files: %w", err)
+		}
+		salts = append(salts, params...)
+		b.Salts = make(map[string][]byte, len(salts))
+		for _, salt := range salts {
+			content, err := os.ReadFile(salt) // #nosec G304 -- Salt files from the envx salt directory
+			if err != nil {
+				return fmt.Errorf("error reading salt file %s: %w", salt, err)
+			}
+			b.Salts[filepath.Base(salt)] = content
+		}
+	}
+
+	passphrase, err := readBundlePassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := bundle.Seal(b, passphrase)
+	if err != nil {
+		return fmt.Errorf("error sealing bundle: %w", err)
+	}
+	if err := os.WriteFile(opts.Output, sealed, env.SecureFileMode); err != nil {
+		return fmt.Errorf("error writing bundle %s: %w", opts.Output, err)
+	}
+
+	summary := fmt.Sprintf("%d file(s), %d salt(s)", len(b.Files), saltCount(b.Salts))
+	if b.Key != nil {
+		summary += " and key " + crypto.Fingerprint(b.Key)
+	}
+	diagf("Wrote %s with %s\n", opts.Output, summary)
+	return nil
+}
+
+func bundleImportCmdFn(ctx context.Context, opts bundleImportOpts, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one bundle file")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("error reading bundle %s: %w", args[0], err)
+	}
+
+	passphrase, err := readBundlePassphrase(false)
+	if err != nil {
+		return err
+	}
+
+	b, err := bundle.Open(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("error opening bundle: %w", err)
+	}
+	defer secure.Zero(b.Key)
+
+	// Validate everything before writing anything
+	names := make([]string, 0, len(b.Files))
+	for name, content := range b.Files {
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("bundle contains unsafe file path %q", name)
+		}
+		if err := checkNoSymlink(opts.Dir, name); err != nil {
+			return err
+		}
+		if err := checkRestoreTarget(filepath.Join(opts.Dir, name), content, opts.Force); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for name, content := range b.Salts {
+		if !filepath.IsLocal(name) || filepath.Base(name) != name {
+			return fmt.Errorf("bundle contains unsafe salt name %q", name)
+		}
+		if err := checkRestoreTarget(filepath.Join(keystore.SaltDir(), name), content, opts.Force); err != nil {
+			return err
+		}
+	}
+
+	if b.Key != nil && !opts.NoKey {
+		storeType, err := storeKey(opts.KeyStore, b.Key, opts.Force)
+		if err != nil {
+			return fmt.Errorf("error importing key: %w", err)
+		}
+		diagf("Imported key %s into the %s keystore\n", crypto.Fingerprint(b.Key), storeType)
+	}
+
+	if len(b.Salts) > 0 {
+		if err := os.MkdirAll(keystore.SaltDir(), 0o700); err != nil {
+			return fmt.Errorf("error creating salt directory: %w", err)
+		}
+		for name, content := range b.Salts {
+			if err := os.WriteFile(filepath.Join(keystore.SaltDir(), name), content, env.SecureFileMode); err != nil {
+				return fmt.Errorf("error writing salt %s: %w", name, err)
+			}
+		}
+		diagf("Imported %d salt(s)\n", saltCount(b.Salts))
+	}
+
+	for _, name := range names {
+		target := filepath.Join(opts.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return fmt.Errorf("error creating directory for %s: %w", target, err)
+		}
+		if err := checkNoSymlink(opts.Dir, name); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, b.Files[name], env.SecureFileMode); err != nil {
+			return fmt.Errorf("error writing %s: %w", target, err)
+		}
+		fmt.Println(target)
+	}
+	return nil
+}
+
+// bundlePath returns the path a file is stored under in a bundle: relative
+// paths inside the working directory are kept, anything else is flattened
+func bundlePath(file string) string {
+	clean := filepath.Clean(file)
+	if filepath.IsLocal(clean) {
+		return filepath.ToSlash(clean)
+	}
+	return filepath.Base(clean)
+}
+
+// checkNoSymlink refuses to restore the bundle file name into dir when any
+// part of its path under dir is a symbolic link, which could point the write
+// outside dir
+func checkNoSymlink(dir, name string) error {
+	path := dir
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error checking %s: %w", path, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to restore %s through the symbolic link %s", name, path)
+		}
+	}
+	return nil
+}
+
+// checkRestoreTarget refuses to replace an existing file with different content unless forced
+func checkRestoreTarget(path string, content []byte, force bool) error {
+	existing, err := os.ReadFile(path) // #nosec G304 -- Restore target inside the chosen directory
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if !bytes.Equal(existing, content) && !force {
+		return fmt.Errorf("%s already exists with different content; use --force to overwrite it", path)
+	}
+	return nil
+}
+
+// readBundlePassphrase returns ENVX_BUNDLE_PASSPHRASE or prompts for a
+// passphrase, asking twice when creating a bundle
+func readBundlePassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("ENVX_BUNDLE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Bundle passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(passphrase, again) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+// saltCount returns the number of salt files in salts, which also holds the
+// key parameters recorded next to them
+func saltCount(salts map[string][]byte) int {
+	n := 0
+	for name := range salts {
+		if strings.HasSuffix(name, ".salt") {
+			n++
+		}
+	}
+	return n
+}
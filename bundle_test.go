@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/bundle"
+	"github.com/almahoozi/envx/pkg/keystore"
+)
+
+func TestBundleExportImport(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVX_BUNDLE_PASSPHRASE", "correct horse battery staple")
+
+	original, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	envFile := filepath.Join(src, ".env")
+	content := []byte("API_KEY=envx:abc\nPORT=8080\n")
+	if err := os.WriteFile(envFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	saltDir := keystore.SaltDir()
+	if err := os.MkdirAll(saltDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("0123456789abcdef0123456789abcdef")
+	if err := os.WriteFile(filepath.Join(saltDir, "alice.salt"), salt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(src, "envx.bundle")
+	exportOpts := bundleExportOpts{File: envFile, KeyStore: "mock", Output: output}
+	if err := bundleExportCmdFn(context.Background(), exportOpts); err != nil {
+		t.Fatalf("bundleExportCmdFn() unexpected error: %v", err)
+	}
+
+	// Import on a "new machine": empty keystore, salt dir and target dir
+	testKeystore = keystore.NewMockKeyStore()
+	if err := os.RemoveAll(saltDir); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	importOpts := bundleImportOpts{KeyStore: "mock", Dir: dst}
+	if err := bundleImportCmdFn(context.Background(), importOpts, output); err != nil {
+		t.Fatalf("bundleImportCmdFn() unexpected error: %v", err)
+	}
+
+	imported, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imported, original) {
+		t.Error("bundleImportCmdFn() stored a different key than the one exported")
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, ".env")); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("bundleImportCmdFn() restored %q (err: %v), want %q", got, err, content)
+	}
+	if got, err := os.ReadFile(filepath.Join(saltDir, "alice.salt")); err != nil || !bytes.Equal(got, salt) {
+		t.Errorf("bundleImportCmdFn() restored salt %q (err: %v), want %q", got, err, salt)
+	}
+
+	// Changed files are only overwritten with --force
+	if err := os.WriteFile(filepath.Join(dst, ".env"), []byte("PORT=9090\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundleImportCmdFn(context.Background(), importOpts, output); err == nil {
+		t.Error("bundleImportCmdFn() expected error when a restored file differs")
+	}
+	importOpts.Force = true
+	if err := bundleImportCmdFn(context.Background(), importOpts, output); err != nil {
+		t.Errorf("bundleImportCmdFn() with --force unexpected error: %v", err)
+	}
+
+	t.Setenv("ENVX_BUNDLE_PASSPHRASE", "wrong")
+	if err := bundleImportCmdFn(context.Background(), importOpts, output); err == nil {
+		t.Error("bundleImportCmdFn() expected error with the wrong passphrase")
+	}
+}
+
+func TestBundlePath(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{file: ".env", expected: ".env"},
+		{file: "./config/.env.prod", expected: "config/.env.prod"},
+		{file: "../other/.env", expected: ".env"},
+		{file: "/etc/app/.env.local", expected: ".env.local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := bundlePath(tt.file); got != tt.expected {
+				t.Errorf("bundlePath(%q) = %q, want %q", tt.file, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBundleImportRefusesSymlinks(t *testing.T) {
+	t.Setenv("ENVX_BUNDLE_PASSPHRASE", "correct horse battery staple")
+
+	dst := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dst, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(outside, "target")
+	if err := os.WriteFile(target, []byte("original\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dst, ".env")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"sub/.env", ".env"} {
+		sealed, err := bundle.Seal(&bundle.Bundle{Files: map[string][]byte{name: []byte("PORT=8080\n")}}, "correct horse battery staple")
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := filepath.Join(t.TempDir(), "envx.bundle")
+		if err := os.WriteFile(output, sealed, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		opts := bundleImportOpts{KeyStore: "mock", Dir: dst, Force: true}
+		if err := bundleImportCmdFn(context.Background(), opts, output); err == nil {
+			t.Errorf("bundleImportCmdFn() of %s expected error writing through a symbolic link", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, ".env")); !os.IsNotExist(err) {
+		t.Error("bundleImportCmdFn() wrote outside --dir through a symbolic link directory")
+	}
+	if got, err := os.ReadFile(target); err != nil || string(got) != "original\n" {
+		t.Errorf("bundleImportCmdFn() changed the symbolic link target to %q (err: %v)", got, err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+type cleanOpts struct {
+	Name      string
+	File      string
+	OlderThan time.Duration
+}
+
+// tempPatterns match the temporary files and directories envx creates. A
+// command that crashes leaves them behind, and they may hold plaintext.
+var tempPatterns = []string{
+	"envx_temp_output_*", // printVars
+	"envx-tpm-*",         // the tpm keystore
+	"envx-s3-*",          // object storage env files
+}
+
+func newCleanCmd() *command[cleanOpts] {
+	cmd := new(command[cleanOpts])
+	cmd.flags = flag.NewFlagSet("clean", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.DurationVar(&cmd.val.OlderThan, "older-than", time.Hour, "Only removes temporary files at least this old, sparing those of running commands")
+	cmd.fn = cleanCmdFn
+	return cmd
+}
+
+// cleanCmdFn removes envx temporary files left behind by crashed commands
+// and prunes the backups of the env files next to the file according to
+// ENVX_BACKUP_KEEP and ENVX_BACKUP_MAX_AGE, printing the path of each thing
+// removed. With --dry-run it only prints them.
+func cleanCmdFn(ctx context.Context, opts cleanOpts, args ...string) error {
+	removed, err := collectGarbage(opts.File, opts.Name, opts.OlderThan)
+	for _, path := range removed {
+		fmt.Println(path)
+	}
+	return err
+}
+
+// collectGarbage removes stale temporary files and the expired backups of
+// the env files next to base, including its name variant, and returns the
+// paths removed
+func collectGarbage(base, name string, tempAge time.Duration) ([]string, error) {
+	removed, err := removeStaleTempFiles(tempAge)
+	if err != nil {
+		return removed, err
+	}
+
+	_, dir, keep, err := backupConfig()
+	if err != nil {
+		return removed, err
+	}
+	maxAge, err := backupMaxAge()
+	if err != nil {
+		return removed, err
+	}
+	if keep == 0 && maxAge == 0 {
+		return removed, nil
+	}
+
+	files, err := envFileCandidates(base, name)
+	if err != nil {
+		return removed, err
+	}
+	for _, file := range files {
+		if strings.Contains(filepath.Base(file), ".backup.") {
+			continue
+		}
+		fileDir := backupDir(file, dir)
+		if keep > 0 {
+			pruned, err := pruneBackups(file, fileDir, keep)
+			removed = append(removed, pruned...)
+			if err != nil {
+				return removed, err
+			}
+		}
+		if maxAge > 0 {
+			pruned, err := pruneExpiredBackups(file, fileDir, maxAge)
+			if err != nil {
+				return removed, err
+			}
+			// With --dry-run pruneBackups may already have listed some
+			for _, path := range pruned {
+				if !slices.Contains(removed, path) {
+					removed = append(removed, path)
+				}
+			}
+		}
+	}
+	return removed, nil
+}
+
+// removeStaleTempFiles removes the envx temporary files and directories of
+// the system temporary directory last modified at least minAge ago. Those
+// of other users are skipped.
+func removeStaleTempFiles(minAge time.Duration) ([]string, error) {
+	cutoff := backupNow().Add(-minAge)
+	var removed []string
+	for _, pattern := range tempPatterns {
+		matches, err := filepath.Glob(filepath.Join(os.TempDir(), pattern))
+		if err != nil {
+			return removed, fmt.Errorf("error listing temporary files: %w", err)
+		}
+		for _, path := range matches {
+			info, err := os.Lstat(path)
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			if !dryRun {
+				if err := os.RemoveAll(path); errors.Is(err, fs.ErrPermission) {
+					continue
+				} else if err != nil {
+					return removed, fmt.Errorf("error removing temporary file: %w", err)
+				}
+			}
+			removed = append(removed, path)
+		}
+	}
+	return removed, nil
+}
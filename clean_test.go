@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	backupNow = func() time.Time { return now }
+	defer func() { backupNow = time.Now }()
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	stale := filepath.Join(tmp, "envx_temp_output_1")
+	fresh := filepath.Join(tmp, "envx_temp_output_2")
+	staleDir := filepath.Join(tmp, "envx-s3-1")
+	other := filepath.Join(tmp, "unrelated")
+	for _, path := range []string{stale, fresh, other} {
+		if err := os.WriteFile(path, []byte("A=1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(staleDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{stale, staleDir, other} {
+		if err := os.Chtimes(path, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(fresh, now.Add(-time.Minute), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var backups []string
+	for _, age := range []time.Duration{40 * 24 * time.Hour, 20 * 24 * time.Hour, time.Hour} {
+		path := envFile + ".backup." + now.Add(-age).Format(backupLayout)
+		if err := os.WriteFile(path, []byte("A=0\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, path)
+	}
+	t.Setenv("ENVX_BACKUP_MAX_AGE", "30d")
+
+	dryRun = true
+	output, err := captureStdout(t, func() error {
+		return cleanCmdFn(context.Background(), cleanOpts{File: envFile, OlderThan: time.Hour})
+	})
+	dryRun = false
+	if err != nil {
+		t.Fatalf("cleanCmdFn() --dry-run error = %v", err)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("cleanCmdFn() --dry-run removed %s", stale)
+	}
+
+	removed, err := collectGarbage(envFile, "", time.Hour)
+	if err != nil {
+		t.Fatalf("collectGarbage() error = %v", err)
+	}
+	want := []string{stale, staleDir, backups[0]}
+	if !slices.Equal(removed, want) {
+		t.Errorf("collectGarbage() = %v, want %v", removed, want)
+	}
+	if output != stale+"\n"+staleDir+"\n"+backups[0]+"\n" {
+		t.Errorf("cleanCmdFn() --dry-run output = %q", output)
+	}
+	for _, path := range want {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+	for _, path := range []string{fresh, other, envFile, backups[1], backups[2]} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", path, err)
+		}
+	}
+}
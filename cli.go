@@ -1,24 +1,69 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/almahoozi/envx/pkg/crypto"
 	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/remote"
+	"github.com/almahoozi/envx/pkg/schema"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/vcs"
 	flag "github.com/spf13/pflag"
 	"golang.org/x/term"
 )
 
-// TODO: Add support for subcommand and option autocomplete, as well as env keys
-// Load from JSON into env :shrug:
-
 var emptyPassword = string([]byte{1})
 
+// verbose enables diagnostic output, such as parser warnings, on stderr
+var verbose bool
+
+// strict turns warnings about insecure file permissions into errors
+var strict bool
+
+// dryRun prints the changes a command would write instead of writing them
+var dryRun bool
+
+// assumeYes answers confirmation prompts with yes
+var assumeYes bool
+
+// noCreateKey turns a missing key into an error instead of creating one
+var noCreateKey bool
+
+// envSection selects a [name] section of a file holding several environments
+var envSection string
+
+// offline loads env files given as URLs from the cache instead of fetching them
+var offline bool
+
+// passwordIterations and passwordRetries override ENVX_PASSWORD_ITERATIONS
+// and ENVX_PASSWORD_RETRIES for the password keystore; empty means unset
+var passwordIterations, passwordRetries string
+
+// accountOverride replaces the user name keys are stored under in the
+// keystore
+var accountOverride string
+
+// rawKey is a hex encoded key given with --key, used instead of any keystore
+var rawKey string
+
+// keySeedFlag is the seed the mock keystore derives its key from, given with
+// --key-seed
+var keySeedFlag string
+
 type command[T any] struct {
 	flags *flag.FlagSet
 	fn    func(context.Context, T, ...string) error
@@ -29,9 +74,23 @@ func (c *command[T]) execute(ctx context.Context, args ...string) error {
 	if err := c.flags.Parse(args); err != nil {
 		return err
 	}
+	// Files are parsed and values decrypted at most once per command
+	if env.CacheFrom(ctx) == nil {
+		ctx = env.WithCache(ctx, env.NewCache())
+	}
+	if ctx.Value(encryptorContextKey{}) == nil {
+		var err error
+		if ctx, err = withEncryptor(ctx); err != nil {
+			return err
+		}
+	}
 	return c.fn(ctx, c.val, c.flags.Args()...)
 }
 
+func (c *command[T]) flagSet() *flag.FlagSet {
+	return c.flags
+}
+
 // Use the Format type from the env package
 type Format = env.Format
 
@@ -39,6 +98,8 @@ const (
 	FormatEnv  = env.FormatEnv
 	FormatJSON = env.FormatJSON
 	FormatYAML = env.FormatYAML
+	FormatCSV  = env.FormatCSV
+	FormatTSV  = env.FormatTSV
 )
 
 type fmtOpts struct {
@@ -50,7 +111,7 @@ type fmtOpts struct {
 
 func NewFmtOpts(flags *flag.FlagSet) *fmtOpts {
 	opts := new(fmtOpts)
-	flags.StringVarP(&opts.format, "fmt", "F", "", "Format of the output. Supported formats: env, json, yaml (default \"env\")")
+	flags.StringVarP(&opts.format, "fmt", "F", "", "Format of the output. Supported formats: env, json, yaml, csv, tsv (default \"env\")")
 	// TODO: Consider whether we really want the shorthands
 	flags.BoolVarP(&opts.json, "json", "j", false, "Format the output to JSON")
 	flags.BoolVar(&opts.yaml, "yaml", false, "Format the output to YAML") // TODO: Change to an alias
@@ -61,9 +122,8 @@ func NewFmtOpts(flags *flag.FlagSet) *fmtOpts {
 
 func (opts *fmtOpts) Format() (Format, error) {
 	switch Format(opts.format) {
-	case FormatEnv, FormatJSON, FormatYAML:
+	case FormatEnv, FormatJSON, FormatYAML, FormatCSV, FormatTSV:
 		if opts.json || opts.yaml || opts.yml {
-			fmt.Println(opts.json, opts.yaml, opts.yml, opts.format)
 			return "", fmt.Errorf("cannot use both format and json/yaml/yml flags")
 		}
 		return Format(opts.format), nil
@@ -87,40 +147,163 @@ func (opts *fmtOpts) Format() (Format, error) {
 	return FormatEnv, nil
 }
 
+// OutputFormat returns the format of output that is printed rather than
+// written to a file when write is false: the one selected with the flags,
+// or else the default from ENVX_FORMAT. Files are only written in another
+// format when a flag asks for it.
+func (opts *fmtOpts) OutputFormat(write bool) (Format, error) {
+	if write || opts.format != "" || opts.json || opts.yaml || opts.yml {
+		format, err := opts.Format()
+		if err == nil && write && isTable(format) {
+			// envx cannot read tables back, so env files are never written as one
+			return "", fmt.Errorf("cannot write a file as %s; it is only for printed output", format)
+		}
+		return format, err
+	}
+	format, _, err := defaultFormat()
+	return format, err
+}
+
+// defaultFormat returns the format printed output uses when no format flag
+// is given, and where it was set
+func defaultFormat() (Format, string, error) {
+	value := os.Getenv("ENVX_FORMAT")
+	switch Format(value) {
+	case "":
+		return FormatEnv, "default", nil
+	case FormatEnv, FormatJSON:
+		// No command prints YAML yet, so it is no use as a default
+		return Format(value), "ENVX_FORMAT", nil
+	default:
+		return "", "", fmt.Errorf("invalid ENVX_FORMAT %q: expected %s or %s", value, FormatEnv, FormatJSON)
+	}
+}
+
+// isTable reports whether format prints variables as a CSV or TSV table
+func isTable(format Format) bool {
+	return format == FormatCSV || format == FormatTSV
+}
+
+type tableOpts struct {
+	header    bool
+	encrypted bool
+}
+
+func NewTableOpts(flags *flag.FlagSet) *tableOpts {
+	opts := new(tableOpts)
+	flags.BoolVar(&opts.header, "header", false, "Prints a header row naming the columns (csv and tsv formats)")
+	flags.BoolVar(&opts.encrypted, "encrypted-column", false, "Adds a column telling whether each value is encrypted in the file (csv and tsv formats)")
+	return opts
+}
+
+// Options returns the table options for vars, as loaded from the file before
+// decryption, printed in format
+func (opts *tableOpts) Options(format Format, vars env.Variables) (env.TableOptions, error) {
+	if opts == nil {
+		opts = new(tableOpts)
+	}
+	if !isTable(format) {
+		if opts.header || opts.encrypted {
+			return env.TableOptions{}, fmt.Errorf("--header and --encrypted-column require --fmt csv or tsv")
+		}
+		return env.TableOptions{}, nil
+	}
+	options := env.TableOptions{Header: opts.header}
+	if opts.encrypted {
+		encryptor := crypto.NewAESEncryptor()
+		options.Encrypted = func(key string) bool {
+			v := vars.Get(key)
+			return v != nil && encryptor.IsEncrypted(v.Value)
+		}
+	}
+	return options, nil
+}
+
+type orderOpts struct {
+	sort   bool
+	groups []string
+}
+
+func NewOrderOpts(flags *flag.FlagSet) *orderOpts {
+	opts := new(orderOpts)
+	flags.BoolVar(&opts.sort, "sort", false, "Sorts variables alphabetically by key")
+	flags.StringSliceVar(&opts.groups, "sort-groups", nil, "Comma separated key prefixes to group variables by, in order, before sorting alphabetically (implies --sort)")
+	return opts
+}
+
+// Apply sorts vars in place if sorting was requested
+func (opts *orderOpts) Apply(vars env.Variables) {
+	if opts == nil || (!opts.sort && len(opts.groups) == 0) {
+		return
+	}
+	vars.Sort(opts.groups...)
+}
+
 type encryptOpts struct {
-	Name     string
-	File     string
-	KeyStore string
-	Password string
-	FmtOpts  *fmtOpts
-	Write    bool
+	Name      string
+	File      string
+	KeyStore  string
+	Password  string
+	FmtOpts   *fmtOpts
+	OrderOpts *orderOpts
+	Batch     *batchOpts
+	Write     bool
+	Force     bool
+	Report    bool
+}
+
+// encryptReport summarizes what an encrypt operation did to each variable
+type encryptReport struct {
+	encrypted   int
+	reencrypted int
+	skipped     int
+	plaintext   int
+}
+
+func (r encryptReport) String() string {
+	return fmt.Sprintf("encrypted: %d, re-encrypted: %d, skipped (already encrypted): %d, left plaintext: %d",
+		r.encrypted, r.reencrypted, r.skipped, r.plaintext)
 }
 
 type decryptOpts struct {
-	Name     string
-	File     string
-	KeyStore string
-	Password string
-	FmtOpts  *fmtOpts
-	Write    bool
+	Name         string
+	File         string
+	KeyStore     string
+	Password     string
+	FmtOpts      *fmtOpts
+	OrderOpts    *orderOpts
+	Write        bool
+	Check        bool
+	AllowTracked bool
 }
 
 type addOpts struct {
-	Name     string
-	File     string
-	KeyStore string
-	Password string
-	FmtOpts  *fmtOpts
-	print    bool
+	Name        string
+	File        string
+	KeyStore    string
+	Password    string
+	FmtOpts     *fmtOpts
+	OrderOpts   *orderOpts
+	RotateAfter string
+	Interactive bool
+	Schema      string
+	Example     string
+	IfAbsent    bool
+	print       bool
 }
 
 type setOpts struct {
-	Name     string
-	File     string
-	KeyStore string
-	Password string
-	FmtOpts  *fmtOpts
-	print    bool
+	Name        string
+	File        string
+	KeyStore    string
+	Password    string
+	FmtOpts     *fmtOpts
+	OrderOpts   *orderOpts
+	RotateAfter string
+	Stdin       bool
+	InputFormat string
+	IfChanged   bool
+	print       bool
 }
 
 type getOpts struct {
@@ -130,6 +313,14 @@ type getOpts struct {
 	Password   string
 	FmtOpts    *fmtOpts
 	ValuesOnly bool
+	QR         bool
+	Template   string
+	TableOpts  *tableOpts
+	Default    optionalString
+	Required   bool
+	Full       bool
+
+	IgnoreDecryptErrors bool
 }
 
 type getVOpts struct {
@@ -138,18 +329,149 @@ type getVOpts struct {
 	KeyStore  string
 	Password  string
 	Separator string
+	Template  string
+	Default   optionalString
+	Required  bool
+
+	IgnoreDecryptErrors bool
+}
+
+// optionalString is a string flag that records whether it was given, so an
+// empty value can be told apart from none
+type optionalString struct {
+	value string
+	set   bool
+}
+
+func (s *optionalString) Set(value string) error {
+	s.value, s.set = value, true
+	return nil
+}
+
+func (s *optionalString) String() string {
+	return s.value
+}
+
+func (s *optionalString) Type() string {
+	return "string"
 }
 
 type runOpts struct {
-	Name     string
-	File     string
-	KeyStore string
-	Password string
-	Args     []string
+	Name             string
+	File             string
+	KeyStore         string
+	Password         string
+	Args             []string
+	RequireEncrypted bool
+	Timeout          time.Duration
+	KillAfter        time.Duration
+	Chdir            string
+	EnvRelative      string
+	Require          []string
+	Interpolate      bool
+	Mount            []string
+	Restart          string
+	MaxRestarts      int
+	RestartDelay     time.Duration
+	Redact           bool
+	RedactMinLength  int
+
+	IgnoreDecryptErrors bool
+	// redact holds the values masked in the program's output
+	redact []string
+}
+
+type sortOpts struct {
+	Name    string
+	File    string
+	FmtOpts *fmtOpts
+	Groups  []string
+	Write   bool
+}
+
+type chmodOpts struct {
+	Name  string
+	File  string
+	Salts bool
+}
+
+type lintOpts struct {
+	Name             string
+	File             string
+	JSON             bool
+	RequireEncrypted bool
+}
+
+// lintIssue is a problem found by lint, as printed by lint --json
+type lintIssue struct {
+	File string `json:"file"`
+	// Line and Column locate parse problems; they are 0 for problems with a
+	// variable as a whole
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
 }
 
 type executor interface {
 	execute(ctx context.Context, args ...string) error
+	flagSet() *flag.FlagSet
+}
+
+// group dispatches to named subcommands, e.g. "envx key split"
+type group struct {
+	name string
+	cmds map[string]executor
+}
+
+func (g *group) execute(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing %s subcommand (available: %s)", g.name, strings.Join(g.names(), ", "))
+	}
+	cmd, ok := g.cmds[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown %s subcommand: %s (available: %s)", g.name, args[0], strings.Join(g.names(), ", "))
+	}
+	return cmd.execute(ctx, args[1:]...)
+}
+
+func (g *group) flagSet() *flag.FlagSet {
+	return nil
+}
+
+func (g *group) names() []string {
+	names := make([]string, 0, len(g.cmds))
+	for name := range g.cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addGlobalFlags registers the flags shared by every command, descending into groups
+func addGlobalFlags(cmd executor) {
+	if g, ok := cmd.(*group); ok {
+		for _, sub := range g.cmds {
+			addGlobalFlags(sub)
+		}
+		return
+	}
+	cmd.flagSet().BoolVar(&verbose, "verbose", false, "Prints diagnostics such as parser warnings to stderr")
+	cmd.flagSet().BoolVar(&strict, "strict", false, "Fails instead of warning when env or salt files are accessible by group or others")
+	cmd.flagSet().BoolVar(&dryRun, "dry-run", false, "Prints a diff of the changes instead of writing the file")
+	cmd.flagSet().BoolVar(&assumeYes, "yes", false, "Answers yes to confirmation prompts")
+	cmd.flagSet().BoolVar(&noColor, "no-color", false, "Disables colored output")
+	cmd.flagSet().BoolVarP(&quiet, "quiet", "q", false, "Prints only data to stdout and errors to stderr, silencing notices and warnings")
+	cmd.flagSet().BoolVar(&noProgress, "no-progress", false, "Disables progress indicators for slow operations")
+	cmd.flagSet().StringVar(&envSection, "env", "", "Uses the [NAME] section of a file holding several environments")
+	cmd.flagSet().BoolVar(&noCreateKey, "no-create-key", false, "Fails if no key exists instead of creating one (also ENVX_KEY_CREATE=false)")
+	cmd.flagSet().BoolVar(&offline, "offline", false, "Uses the cached copy of env files given as URLs instead of fetching them")
+	cmd.flagSet().BoolVar(&enforce, "enforce", false, "Refuses to write variables that break the policy (also ENVX_POLICY_ENFORCE=true)")
+	cmd.flagSet().StringVar(&passwordIterations, "password-iterations", "", "PBKDF2 iterations for new password keystore keys (default 100000, also ENVX_PASSWORD_ITERATIONS)")
+	cmd.flagSet().StringVar(&passwordRetries, "password-retries", "", "Times a wrong password is prompted for again (default 2, also ENVX_PASSWORD_RETRIES)")
+	cmd.flagSet().StringVar(&accountOverride, "account", "", "Stores and looks up keys under this account instead of the user name (also ENVX_ACCOUNT)")
+	cmd.flagSet().StringVar(&rawKey, "key", "", "Hex encoded key to use instead of the keystore (also ENVX_KEY)")
+	cmd.flagSet().StringVar(&keySeedFlag, "key-seed", "", "Derives the mock keystore key from this seed, for reproducible test fixtures (implies --keystore mock, also ENVX_KEY_SEED)")
 }
 
 func start() error {
@@ -167,9 +489,24 @@ func start() error {
 	runCmd.flags = flag.NewFlagSet("run", flag.ExitOnError)
 	runCmd.flags.StringVarP(&runCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	runCmd.flags.StringVarP(&runCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	runCmd.flags.StringVarP(&runCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	runCmd.flags.StringVarP(&runCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	runCmd.flags.StringVarP(&runCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	runCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	runCmd.flags.BoolVar(&runCmd.val.RequireEncrypted, "require-encrypted", false, "Refuses to run if secret-like keys (e.g. *_SECRET, *_TOKEN, *PASSWORD*) hold plaintext values")
+	runCmd.flags.DurationVar(&runCmd.val.Timeout, "timeout", 0, "Stops the program with SIGTERM after this long (e.g. 30s, 5m); runs it as a child process instead of replacing envx")
+	runCmd.flags.DurationVar(&runCmd.val.KillAfter, "kill-after", 10*time.Second, "Sends SIGKILL if a child process is still running this long after it was signalled")
+	runCmd.flags.DurationVar(&runCmd.val.KillAfter, "kill-timeout", 10*time.Second, "Same as --kill-after")
+	runCmd.flags.BoolVar(&runCmd.val.IgnoreDecryptErrors, "ignore-decrypt-errors", false, "Skips variables that cannot be decrypted, with a warning, instead of failing")
+	runCmd.flags.StringSliceVar(&runCmd.val.Require, "require", nil, "Comma separated variables that must be set and non-empty, or the program is not started")
+	runCmd.flags.BoolVar(&runCmd.val.Interpolate, "interpolate", false, "Replaces {{VAR}} and ${VAR} in the program arguments with values from the env file; those variables are not exported")
+	runCmd.flags.StringArrayVar(&runCmd.val.Mount, "mount", nil, "Writes a variable to a 0600 file instead of exporting it, as KEY=PATH or KEY (path exported as KEY_FILE); removed when the program exits")
+	runCmd.flags.StringVarP(&runCmd.val.Chdir, "chdir", "C", "", "Runs the program in this directory")
+	runCmd.flags.StringVar(&runCmd.val.Restart, "restart", restartNo, "Restarts the program when it exits: no, on-failure or always; secrets are reloaded on every restart")
+	runCmd.flags.IntVar(&runCmd.val.MaxRestarts, "max-restarts", 0, "Gives up after this many restarts (0 means no limit)")
+	runCmd.flags.DurationVar(&runCmd.val.RestartDelay, "restart-delay", time.Second, "Waits this long before the first restart, doubling after each quick failure up to a minute")
+	runCmd.flags.BoolVar(&runCmd.val.Redact, "redact", false, "Masks the values of the env file in the program's stdout and stderr; runs it as a child process")
+	runCmd.flags.IntVar(&runCmd.val.RedactMinLength, "redact-min-length", 6, "Masks only values at least this many bytes long, with --redact")
+	runCmd.flags.StringVar(&runCmd.val.EnvRelative, "env-relative", envRelativeCwd, "Resolves a relative env file against the current directory (cwd) or the --chdir directory (chdir)")
 	runCmd.fn = run
 	cmds[runCmd.flags.Name()] = runCmd
 
@@ -177,11 +514,15 @@ func start() error {
 	encCmd.flags = flag.NewFlagSet("encrypt", flag.ExitOnError)
 	encCmd.flags.StringVarP(&encCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	encCmd.flags.StringVarP(&encCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	encCmd.flags.StringVarP(&encCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	encCmd.flags.StringVarP(&encCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	encCmd.flags.StringVarP(&encCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	encCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	encCmd.val.FmtOpts = NewFmtOpts(encCmd.flags)
+	encCmd.val.OrderOpts = NewOrderOpts(encCmd.flags)
 	encCmd.flags.BoolVarP(&encCmd.val.Write, "write", "w", false, "Overwrites the file with encrypted values.")
+	encCmd.flags.BoolVar(&encCmd.val.Force, "force", false, "Decrypts and re-encrypts values that are already encrypted, producing fresh ciphertexts")
+	encCmd.flags.BoolVar(&encCmd.val.Report, "report", false, "Prints a summary of encrypted, skipped and plaintext values to stderr")
+	encCmd.val.Batch = NewBatchOpts(encCmd.flags)
 	encCmd.fn = encryptCmd
 	cmds[encCmd.flags.Name()] = encCmd
 
@@ -189,11 +530,14 @@ func start() error {
 	decCmd.flags = flag.NewFlagSet("decrypt", flag.ExitOnError)
 	decCmd.flags.StringVarP(&decCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	decCmd.flags.StringVarP(&decCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	decCmd.flags.StringVarP(&decCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	decCmd.flags.StringVarP(&decCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	decCmd.flags.StringVarP(&decCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	decCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	decCmd.val.FmtOpts = NewFmtOpts(decCmd.flags)
+	decCmd.val.OrderOpts = NewOrderOpts(decCmd.flags)
 	decCmd.flags.BoolVarP(&decCmd.val.Write, "write", "w", false, "Overwrites the file with decrypted values.")
+	decCmd.flags.BoolVar(&decCmd.val.AllowTracked, "allow-tracked", false, "Allows writing plaintext to a file that is tracked by git or not covered by .gitignore")
+	decCmd.flags.BoolVar(&decCmd.val.Check, "check", false, "Only verifies that the selected values can be decrypted, without printing or writing anything")
 	decCmd.fn = decryptCmd
 	cmds[decCmd.flags.Name()] = decCmd
 
@@ -201,11 +545,17 @@ func start() error {
 	addCmd.flags = flag.NewFlagSet("add", flag.ExitOnError)
 	addCmd.flags.StringVarP(&addCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	addCmd.flags.StringVarP(&addCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	addCmd.flags.StringVarP(&addCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	addCmd.flags.StringVarP(&addCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	addCmd.flags.StringVarP(&addCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	addCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	addCmd.val.FmtOpts = NewFmtOpts(addCmd.flags)
+	addCmd.val.OrderOpts = NewOrderOpts(addCmd.flags)
 	addCmd.flags.BoolVarP(&addCmd.val.print, "print", "p", false, "Prints the output instead of writing to the file.")
+	addCmd.flags.StringVar(&addCmd.val.RotateAfter, "rotate-after", "", "Marks the values as due for rotation on a date (2027-01-31) or every interval (90d)")
+	addCmd.flags.BoolVarP(&addCmd.val.Interactive, "interactive", "i", false, "Prompts for each variable the schema or example file expects that the file is missing, then writes them all at once")
+	addCmd.flags.StringVar(&addCmd.val.Schema, "schema", "", "Schema file listing the expected variables, with --interactive (default ENVX_SCHEMA or "+schema.DefaultFile+")")
+	addCmd.flags.StringVar(&addCmd.val.Example, "example", defaultExampleFile, "Example env file listing the expected variables, with --interactive")
+	addCmd.flags.BoolVar(&addCmd.val.IfAbsent, "if-absent", false, "Skips variables that already exist instead of failing")
 	addCmd.fn = addCmdFn
 	cmds[addCmd.flags.Name()] = addCmd
 
@@ -213,11 +563,16 @@ func start() error {
 	setCmd.flags = flag.NewFlagSet("set", flag.ExitOnError)
 	setCmd.flags.StringVarP(&setCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	setCmd.flags.StringVarP(&setCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	setCmd.flags.StringVarP(&setCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	setCmd.flags.StringVarP(&setCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	setCmd.flags.StringVarP(&setCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	setCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	setCmd.val.FmtOpts = NewFmtOpts(setCmd.flags)
+	setCmd.val.OrderOpts = NewOrderOpts(setCmd.flags)
 	setCmd.flags.BoolVarP(&setCmd.val.print, "print", "p", false, "Prints the output instead of writing to the file.")
+	setCmd.flags.StringVar(&setCmd.val.RotateAfter, "rotate-after", "", "Marks the values as due for rotation on a date (2027-01-31) or every interval (90d)")
+	setCmd.flags.BoolVar(&setCmd.val.Stdin, "stdin", false, "Reads the variables to set from stdin instead of the arguments, written in one go")
+	setCmd.flags.StringVar(&setCmd.val.InputFormat, "input-format", string(FormatJSON), "Format of the variables read with --stdin: json (an object), yaml (a flat mapping) or env")
+	setCmd.flags.BoolVar(&setCmd.val.IfChanged, "if-changed", false, "Skips variables that already hold the value, leaving the file untouched when none changed")
 	setCmd.fn = setCmdFn
 	cmds[setCmd.flags.Name()] = setCmd
 
@@ -225,11 +580,18 @@ func start() error {
 	getCmd.flags = flag.NewFlagSet("get", flag.ExitOnError)
 	getCmd.flags.StringVarP(&getCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	getCmd.flags.StringVarP(&getCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	getCmd.flags.StringVarP(&getCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	getCmd.flags.StringVarP(&getCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	getCmd.flags.StringVarP(&getCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	getCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	getCmd.flags.BoolVarP(&getCmd.val.ValuesOnly, "vals", "v", false, "Prints only the values without keys. Use getv command instead to set a custom separator. Ignores formatting options.")
 	getCmd.val.FmtOpts = NewFmtOpts(getCmd.flags)
+	getCmd.val.TableOpts = NewTableOpts(getCmd.flags)
+	getCmd.flags.BoolVar(&getCmd.val.QR, "qr", false, "Prints the value of a single variable as a QR code in the terminal")
+	getCmd.flags.StringVar(&getCmd.val.Template, "template", "", "Prints each variable with a Go template over .Key and .Value, e.g. '{{.Key}}: {{.Value}}'. Ignores formatting options.")
+	getCmd.flags.Var(&getCmd.val.Default, "default", "Prints this value for requested variables that are missing or empty")
+	getCmd.flags.BoolVar(&getCmd.val.Required, "required", false, "Fails with exit status 3 when a requested variable is missing or empty")
+	getCmd.flags.BoolVar(&getCmd.val.IgnoreDecryptErrors, "ignore-decrypt-errors", false, "Skips variables that cannot be decrypted, with a warning, instead of failing")
+	getCmd.flags.BoolVar(&getCmd.val.Full, "full", false, "Prints long values in full on a terminal instead of truncating them to its width")
 	getCmd.fn = getCmdFn
 	cmds[getCmd.flags.Name()] = getCmd
 
@@ -237,15 +599,119 @@ func start() error {
 	getVCmd.flags = flag.NewFlagSet("getv", flag.ExitOnError)
 	getVCmd.flags.StringVarP(&getVCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
 	getVCmd.flags.StringVarP(&getVCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
-	getVCmd.flags.StringVarP(&getVCmd.val.KeyStore, "keystore", "k", "macos", "Keystore type to use (macos, password, mock)")
+	getVCmd.flags.StringVarP(&getVCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
 	getVCmd.flags.StringVarP(&getVCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
 	getVCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
 	getVCmd.flags.StringVarP(&getVCmd.val.Separator, "separator", "s", "\n", "Separator for the values (default is new line)")
+	getVCmd.flags.StringVar(&getVCmd.val.Template, "template", "", "Prints each variable with a Go template over .Key and .Value instead of its value")
+	getVCmd.flags.Var(&getVCmd.val.Default, "default", "Prints this value for requested variables that are missing or empty")
+	getVCmd.flags.BoolVar(&getVCmd.val.Required, "required", false, "Fails with exit status 3 when a requested variable is missing or empty")
+	getVCmd.flags.BoolVar(&getVCmd.val.IgnoreDecryptErrors, "ignore-decrypt-errors", false, "Skips variables that cannot be decrypted, with a warning, instead of failing")
 	getVCmd.fn = getVCmdFn
 	cmds[getVCmd.flags.Name()] = getVCmd
 
+	sortCmd := new(command[sortOpts])
+	sortCmd.flags = flag.NewFlagSet("sort", flag.ExitOnError)
+	sortCmd.flags.StringVarP(&sortCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	sortCmd.flags.StringVarP(&sortCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	sortCmd.val.FmtOpts = NewFmtOpts(sortCmd.flags)
+	sortCmd.flags.StringSliceVarP(&sortCmd.val.Groups, "groups", "g", nil, "Comma separated key prefixes to group variables by, in order, before sorting alphabetically")
+	sortCmd.flags.BoolVarP(&sortCmd.val.Write, "write", "w", false, "Overwrites the file with sorted variables.")
+	sortCmd.fn = sortCmdFn
+	cmds[sortCmd.flags.Name()] = sortCmd
+
+	chmodCmd := new(command[chmodOpts])
+	chmodCmd.flags = flag.NewFlagSet("chmod", flag.ExitOnError)
+	chmodCmd.flags.StringVarP(&chmodCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	chmodCmd.flags.StringVarP(&chmodCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	chmodCmd.flags.BoolVar(&chmodCmd.val.Salts, "salts", true, "Also fixes the password keystore salt directory and files")
+	chmodCmd.fn = chmodCmdFn
+	cmds[chmodCmd.flags.Name()] = chmodCmd
+
+	lintCmd := new(command[lintOpts])
+	lintCmd.flags = flag.NewFlagSet("lint", flag.ExitOnError)
+	lintCmd.flags.StringVarP(&lintCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	lintCmd.flags.StringVarP(&lintCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	lintCmd.flags.BoolVar(&lintCmd.val.JSON, "json", false, "Prints the issues as a JSON array")
+	lintCmd.flags.BoolVar(&lintCmd.val.RequireEncrypted, "require-encrypted", false, "Also reports secret-like keys holding plaintext values (implied by ENVX_ENCRYPT_PATTERNS)")
+	lintCmd.fn = lintCmdFn
+	cmds[lintCmd.flags.Name()] = lintCmd
+
+	lsCmd := new(command[lsOpts])
+	lsCmd.flags = flag.NewFlagSet("ls", flag.ExitOnError)
+	lsCmd.flags.StringVarP(&lsCmd.val.File, "file", "f", ".env", "Uses a specific base file instead of the default .env")
+	lsCmd.flags.StringVarP(&lsCmd.val.Name, "name", "n", "", "Marks .env.<name> as the file that would be used")
+	lsCmd.flags.BoolVar(&lsCmd.val.JSON, "json", false, "Prints the files as a JSON array")
+	lsCmd.fn = lsCmdFn
+	cmds[lsCmd.flags.Name()] = lsCmd
+
+	whichCmd := newExplainCmd("which", false)
+	cmds[whichCmd.flags.Name()] = whichCmd
+
+	explainCmd := newExplainCmd("explain", true)
+	cmds[explainCmd.flags.Name()] = explainCmd
+
+	envNameCmd := newStatusCmd("env-name", false)
+	cmds[envNameCmd.flags.Name()] = envNameCmd
+	statusCmd := newStatusCmd("status", true)
+	cmds[statusCmd.flags.Name()] = statusCmd
+	totpCmd := newTotpCmd()
+	cmds[totpCmd.flags.Name()] = totpCmd
+	shellCmd := newShellCmd()
+	cmds[shellCmd.flags.Name()] = shellCmd
+	signCmd := newSignCmd()
+	cmds[signCmd.flags.Name()] = signCmd
+	verifySignatureCmd := newVerifySignatureCmd()
+	cmds[verifySignatureCmd.flags.Name()] = verifySignatureCmd
+	exportCmd := newExportCmd()
+	cmds[exportCmd.flags.Name()] = exportCmd
+	pushCmd := newPushCmd()
+	cmds[pushCmd.flags.Name()] = pushCmd
+	expiringCmd := newExpiringCmd()
+	cmds[expiringCmd.flags.Name()] = expiringCmd
+	undoCmd := newUndoCmd()
+	cmds[undoCmd.flags.Name()] = undoCmd
+	docsCmd := newDocsCmd()
+	cmds[docsCmd.flags.Name()] = docsCmd
+	diffCmd := newDiffCmd()
+	cmds[diffCmd.flags.Name()] = diffCmd
+	completionCmd := newCompletionCmd()
+	cmds[completionCmd.flags.Name()] = completionCmd
+	versionCmd := newVersionCmd()
+	cmds[versionCmd.flags.Name()] = versionCmd
+	statsCmd := newStatsCmd()
+	cmds[statsCmd.flags.Name()] = statsCmd
+	cmds["file"] = newFileGroup()
+	webhookCmd := newWebhookCmd()
+	cmds[webhookCmd.flags.Name()] = webhookCmd
+	hasCmd := newHasCmd()
+	cmds[hasCmd.flags.Name()] = hasCmd
+	cleanCmd := newCleanCmd()
+	cmds[cleanCmd.flags.Name()] = cleanCmd
+	benchCmd := newBenchCmd()
+	cmds[benchCmd.flags.Name()] = benchCmd
+
+	cmds["key"] = newKeyGroup()
+	cmds["bundle"] = newBundleGroup()
+	cmds["audit"] = newAuditGroup()
+	cmds["systemd"] = newSystemdGroup()
+	cmds["policy"] = newPolicyGroup()
+	cmds["backup"] = newBackupGroup()
+
+	for _, cmd := range cmds {
+		addGlobalFlags(cmd)
+	}
+
 	cmds[""] = runCmd
 
+	if len(os.Args) >= 2 && os.Args[1] == completeCommand {
+		// Completion runs on every tab, so it stays silent and off the network
+		quiet, offline = true, true
+		for _, candidate := range complete(context.Background(), cmds, os.Args[2:]) {
+			fmt.Println(candidate)
+		}
+		return nil
+	}
 	if len(os.Args) >= 2 {
 		if cmd, ok := cmds[os.Args[1]]; ok {
 			return cmd.execute(context.Background(), os.Args[2:]...)
@@ -259,54 +725,272 @@ func start() error {
 	return fmt.Errorf("missing command")
 }
 
+func sortCmdFn(ctx context.Context, opts sortOpts, args ...string) error {
+	format, err := opts.FmtOpts.OutputFormat(opts.Write)
+	if err != nil {
+		return fmt.Errorf("error parsing format: %w", err)
+	}
+	if format == FormatYAML {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+
+	vars, err := loadEnv(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+
+	vars.Sort(opts.Groups...)
+
+	if !opts.Write {
+		return printVars(vars, format)
+	}
+
+	if err := enforcePolicy(ctx, file, vars, nil); err != nil {
+		return err
+	}
+	return writeEnvFile(ctx, file, vars, format)
+}
+
+func chmodCmdFn(ctx context.Context, opts chmodOpts, args ...string) error {
+	file := env.BuildFilename(opts.File, opts.Name)
+	if err := restrictPermissions(file); err != nil {
+		return err
+	}
+
+	if !opts.Salts {
+		return nil
+	}
+
+	saltDir := keystore.SaltDir()
+	if err := restrictPermissions(saltDir); err != nil {
+		return err
+	}
+	salts, err := filepath.Glob(filepath.Join(saltDir, "*.salt"))
+	if err != nil {
+		return fmt.Errorf("error listing salt files: %w", err)
+	}
+	for _, salt := range salts {
+		if err := restrictPermissions(salt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictPermissions removes all group and other permission bits from path,
+// printing the change if one was made. Missing paths are ignored.
+func restrictPermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading permissions of %s: %w", path, err)
+	}
+
+	mode := info.Mode().Perm()
+	secure := mode &^ 0o077
+	if mode == secure {
+		return nil
+	}
+
+	if err := os.Chmod(path, secure); err != nil {
+		return fmt.Errorf("error changing permissions of %s: %w", path, err)
+	}
+	fmt.Printf("%s: %04o -> %04o\n", path, mode, secure)
+	return nil
+}
+
+func lintCmdFn(ctx context.Context, opts lintOpts, args ...string) error {
+	file := env.BuildFilename(opts.File, opts.Name)
+
+	loader := env.NewFileLoader()
+	vars, warnings, err := loader.LoadWithWarnings(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+
+	// Plaintext secrets are only problems once asked for, so lint keeps
+	// passing on files it passed before the encryption policy existed
+	var plaintext []string
+	if opts.RequireEncrypted || os.Getenv("ENVX_ENCRYPT_PATTERNS") != "" {
+		plaintext = plaintextSecrets(vars, selectedEncryptor(ctx))
+	}
+	if opts.JSON {
+		issues := make([]lintIssue, 0, len(warnings)+len(plaintext))
+		for _, w := range warnings {
+			issues = append(issues, lintIssue{File: w.File, Line: w.Line, Column: w.Column, Message: w.Message})
+		}
+		for _, key := range plaintext {
+			issues = append(issues, lintIssue{File: file, Key: key, Message: "holds a plaintext value but must be encrypted"})
+		}
+		if err := writeJSON(os.Stdout, issues); err != nil {
+			return err
+		}
+	} else {
+		for _, w := range warnings {
+			fmt.Println(w)
+		}
+		for _, key := range plaintext {
+			fmt.Printf("%s: %s holds a plaintext value but must be encrypted\n", file, key)
+		}
+	}
+	if issues := len(warnings) + len(plaintext); issues > 0 {
+		return fmt.Errorf("found %d issue(s) in %s", issues, file)
+	}
+	return nil
+}
+
 func getVCmdFn(ctx context.Context, opts getVOpts, args ...string) error {
+	render, err := variableRenderer(opts.Template)
+	if err != nil {
+		return err
+	}
+	if err := checkFallback(opts.Default, opts.Required, args); err != nil {
+		return err
+	}
 	file := env.BuildFilename(opts.File, opts.Name)
 
 	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
 
-	encryptor := crypto.NewAESEncryptor()
-	vars, err := loadDecryptedEnv(ctx, file, encryptor, key)
+	lazy, err := loadLazyEnv(ctx, file, newEncryptor(ctx), key)
 	if err != nil {
 		return fmt.Errorf("error loading %s file: %w", file, err)
 	}
 
-	varMap := vars.ToMap()
-
-	vals := make([]string, 0, len(vars))
+	vals := make([]string, 0, lazy.Len())
 	if len(args) == 0 {
+		vars, err := lazy.All()
+		if err != nil && opts.IgnoreDecryptErrors {
+			vars, err = skipUndecryptable(vars, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error loading %s file: %w", file, err)
+		}
+		if err := resolveSecretRefs(vars); err != nil {
+			return err
+		}
+		if err := auditAccess("getv", file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+			return err
+		}
 		for _, v := range vars {
-			vals = append(vals, v.Value)
+			val, err := render(v)
+			if err != nil {
+				return err
+			}
+			vals = append(vals, val)
 		}
 		fmt.Println(strings.Join(vals, opts.Separator))
 		return nil
 	}
 
+	if err := auditAccess("getv", file, opts.KeyStore, opts.Password, args); err != nil {
+		return err
+	}
+
+	// Only the requested values are decrypted
 	for _, arg := range args {
-		if value, exists := varMap[arg]; exists {
-			vals = append(vals, value)
-		} else {
-			return fmt.Errorf("variable %s not found in %s file", arg, file)
+		value, exists, err := lazy.Get(arg)
+		var decryptErrs *env.DecryptErrors
+		if opts.IgnoreDecryptErrors && errors.As(err, &decryptErrs) {
+			warnUndecryptable(decryptErrs.Errors[0])
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error loading %s file: %w", file, err)
 		}
+		if value, err = resolveSecretRef(value); err != nil {
+			return fmt.Errorf("error resolving %s: %w", arg, err)
+		}
+		if value, err = fallback(arg, value, exists, file, opts.Default, opts.Required); err != nil {
+			return err
+		}
+		val, err := render(env.Variable{Key: arg, Value: value})
+		if err != nil {
+			return err
+		}
+		vals = append(vals, val)
 	}
 	fmt.Println(strings.Join(vals, opts.Separator))
 	return nil
 }
 
+// missingExitCode is the exit status of get and getv --required when a
+// requested variable is missing, so scripts can tell it from other failures
+const missingExitCode = 3
+
+// checkFallback validates --default and --required, which apply to the
+// variables named on the command line
+func checkFallback(def optionalString, required bool, args []string) error {
+	if def.set && required {
+		return fmt.Errorf("cannot use both --default and --required")
+	}
+	if (def.set || required) && len(args) == 0 {
+		return fmt.Errorf("--default and --required apply to the variables given as arguments")
+	}
+	return nil
+}
+
+// fallback returns the value get and getv print for key. Like ${KEY:-value}
+// and ${KEY:?} in the shell, --default and --required treat an empty value
+// as missing; without them only a missing variable is an error.
+func fallback(key, value string, exists bool, file string, def optionalString, required bool) (string, error) {
+	if exists && (value != "" || !(def.set || required)) {
+		return value, nil
+	}
+	switch {
+	case def.set:
+		return def.value, nil
+	case required:
+		return "", &exitError{code: missingExitCode, err: fmt.Errorf("required variable %s is not set in %s file", key, file)}
+	default:
+		return "", fmt.Errorf("variable %s not found in %s file", key, file)
+	}
+}
+
+// variableRenderer returns how getv prints a variable: its value, or the
+// output of the Go template text over the env.Variable when text is set
+func variableRenderer(text string) (func(env.Variable) (string, error), error) {
+	if text == "" {
+		return func(v env.Variable) (string, error) { return v.Value, nil }, nil
+	}
+	tmpl, err := template.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --template: %w", err)
+	}
+	return func(v env.Variable) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, v); err != nil {
+			return "", fmt.Errorf("error executing --template for %s: %w", v.Key, err)
+		}
+		return b.String(), nil
+	}, nil
+}
+
 func getCmdFn(ctx context.Context, opts getOpts, args ...string) error {
-	if opts.ValuesOnly {
-		return getVCmdFn(ctx, getVOpts{opts.Name, opts.File, opts.KeyStore, opts.Password, "\n"}, args...)
+	if opts.QR {
+		return getQRCmdFn(ctx, opts, args...)
+	}
+	if opts.ValuesOnly || opts.Template != "" {
+		return getVCmdFn(ctx, getVOpts{opts.Name, opts.File, opts.KeyStore, opts.Password, "\n", opts.Template, opts.Default, opts.Required, opts.IgnoreDecryptErrors}, args...)
 	}
 
-	format, err := opts.FmtOpts.Format()
+	format, err := opts.FmtOpts.OutputFormat(false)
 	if err != nil {
 		return fmt.Errorf("error parsing format: %w", err)
 	}
 	if format == FormatYAML {
 		return fmt.Errorf("unsupported format: %s", format)
 	}
+	if err := checkFallback(opts.Default, opts.Required, args); err != nil {
+		return err
+	}
 
 	file := env.BuildFilename(opts.File, opts.Name)
 
@@ -314,44 +998,90 @@ func getCmdFn(ctx context.Context, opts getOpts, args ...string) error {
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
 
-	encryptor := crypto.NewAESEncryptor()
-	vars, err := loadDecryptedEnv(ctx, file, encryptor, key)
+	lazy, err := loadLazyEnv(ctx, file, newEncryptor(ctx), key)
 	if err != nil {
 		return fmt.Errorf("error loading %s file: %w", file, err)
 	}
-
-	varMap := vars.ToMap()
+	table, err := opts.TableOpts.Options(format, lazy.Raw())
+	if err != nil {
+		return err
+	}
+	// On a terminal, lines are cut to its width; piped output is complete
+	width := 0
+	if !opts.Full {
+		width = terminalWidth()
+	}
 
 	if len(args) == 0 {
+		vars, err := lazy.All()
+		if err != nil && opts.IgnoreDecryptErrors {
+			vars, err = skipUndecryptable(vars, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error loading %s file: %w", file, err)
+		}
+		if err := resolveSecretRefs(vars); err != nil {
+			return err
+		}
+		if err := auditAccess("get", file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+			return err
+		}
+		if isTable(format) {
+			return printTable(vars, format, table)
+		}
 		for _, v := range vars {
 			switch format {
 			case FormatJSON:
 				fmt.Printf("%q:%q\n", v.Key, v.Value)
 			default:
-				fmt.Printf("%s=%s\n", v.Key, v.Value)
+				fmt.Println(truncateLine(v.Key+"="+v.Value, width))
 			}
 		}
 		return nil
 	}
 
+	if err := auditAccess("get", file, opts.KeyStore, opts.Password, args); err != nil {
+		return err
+	}
+
+	// Only the requested values are decrypted
+	var selected env.Variables
 	for _, arg := range args {
-		if value, exists := varMap[arg]; exists {
-			switch format {
-			case FormatJSON:
-				fmt.Printf("%q:%q\n", arg, value)
-			default:
-				fmt.Printf("%s=%s\n", arg, value)
-			}
-		} else {
-			return fmt.Errorf("variable %s not found in %s file", arg, file)
+		value, exists, err := lazy.Get(arg)
+		var decryptErrs *env.DecryptErrors
+		if opts.IgnoreDecryptErrors && errors.As(err, &decryptErrs) {
+			warnUndecryptable(decryptErrs.Errors[0])
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error loading %s file: %w", file, err)
+		}
+		if value, err = resolveSecretRef(value); err != nil {
+			return fmt.Errorf("error resolving %s: %w", arg, err)
+		}
+		if value, err = fallback(arg, value, exists, file, opts.Default, opts.Required); err != nil {
+			return err
+		}
+		switch format {
+		case FormatJSON:
+			fmt.Printf("%q:%q\n", arg, value)
+		case FormatCSV, FormatTSV:
+			// Tables are printed whole, after the header
+			selected = append(selected, env.Variable{Key: arg, Value: value})
+		default:
+			fmt.Println(truncateLine(arg+"="+value, width))
 		}
 	}
+	if isTable(format) {
+		return printTable(selected, format, table)
+	}
 	return nil
 }
 
 func setCmdFn(ctx context.Context, opts setOpts, args ...string) error {
-	format, err := opts.FmtOpts.Format()
+	format, err := opts.FmtOpts.OutputFormat(!opts.print)
 	if err != nil {
 		return fmt.Errorf("error parsing format: %w", err)
 	}
@@ -361,72 +1091,116 @@ func setCmdFn(ctx context.Context, opts setOpts, args ...string) error {
 
 	file := env.BuildFilename(opts.File, opts.Name)
 
+	// Values are read before the key, which may prompt on the terminal
+	var keyValues map[string]string
+	if opts.Stdin {
+		if keyValues, err = readStdinValues(Format(opts.InputFormat), args); err != nil {
+			return err
+		}
+	}
+
 	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
 
 	vars, err := loadEnv(ctx, file)
 	if err != nil {
 		return fmt.Errorf("error loading %s file: %w", file, err)
 	}
+	index := env.NewIndex(vars)
 
-	// Parse arguments supporting both key=value and key-only formats
-	keyValues, err := parseKeyValueArgs(args)
-	if err != nil {
-		return fmt.Errorf("error parsing arguments: %w", err)
+	if !opts.Stdin {
+		// Parse arguments supporting both key=value and key-only formats
+		if keyValues, err = parseKeyValueArgs(args); err != nil {
+			return fmt.Errorf("error parsing arguments: %w", err)
+		}
 	}
 
-	encryptor := crypto.NewAESEncryptor()
-
-	if opts.print {
-		// Create a new Variables slice with only the newly set values
-		newVars := make(env.Variables, 0, len(keyValues))
+	if opts.IfChanged {
 		for k, v := range keyValues {
-			ciphertext, err := encryptor.Encrypt(v, key)
+			current, exists, err := currentValue(ctx, index, k, key)
 			if err != nil {
-				return fmt.Errorf("error encrypting value for key %s: %w", k, err)
+				return fmt.Errorf("error decrypting value for key %s: %w", k, err)
+			}
+			if exists && current == v {
+				if verbose {
+					diagf("Skipping %s: value unchanged\n", k)
+				}
+				delete(keyValues, k)
 			}
-			newVars = append(newVars, env.Variable{Key: k, Value: ciphertext})
-		}
-
-		writer := env.NewFileWriter()
-		// Use a temp file to get the output
-		tempFile, err := createTempFile()
-		if err != nil {
-			return err
-		}
-		err = writer.Write(tempFile, newVars, format)
-		if err != nil {
-			return fmt.Errorf("error formatting output: %w", err)
 		}
-		content, err := os.ReadFile(tempFile)
-		if err != nil {
-			return fmt.Errorf("error reading formatted output: %w", err)
+		if len(keyValues) == 0 {
+			return nil
 		}
-		removeFileIgnoreError(tempFile)
-		fmt.Print(string(content))
-		return nil
+	}
+
+	encrypt, err := newValueEncrypter(ctx, selectedEncryptor(ctx))
+	if err != nil {
+		return err
+	}
+	hide, err := hideNames()
+	if err != nil {
+		return err
+	}
+
+	if opts.print {
+		// Create a new Variables slice with only the newly set values
+		newVars := make(env.Variables, 0, len(keyValues))
+		for k, v := range keyValues {
+			stored, err := encryptVar(index, k, v, key, encrypt, hide)
+			if err != nil {
+				return fmt.Errorf("error encrypting value for key %s: %w", k, err)
+			}
+			newVars = append(newVars, stored)
+		}
+
+		if showDiff(format) {
+			keys := make([]string, 0, len(newVars))
+			for _, v := range newVars {
+				index.Set(v.Key, v.Value)
+				keys = append(keys, v.Key)
+			}
+			rotations, err := rotationsFor(ctx, file, keys, opts.RotateAfter)
+			if err != nil {
+				return err
+			}
+			vars = index.Variables()
+			opts.OrderOpts.Apply(vars)
+			return printDiff(ctx, file, vars, format, rotations...)
+		}
+
+		opts.OrderOpts.Apply(newVars)
+		return printVars(newVars, format)
 	}
 
 	// If not printing, update the actual vars and write to file
+	keys := make([]string, 0, len(keyValues))
 	for k, v := range keyValues {
-		ciphertext, err := encryptor.Encrypt(v, key)
+		stored, err := encryptVar(index, k, v, key, encrypt, hide)
 		if err != nil {
 			return fmt.Errorf("error encrypting value for key %s: %w", k, err)
 		}
-		vars.Set(k, ciphertext)
+		index.Set(stored.Key, stored.Value)
+		keys = append(keys, stored.Key)
+	}
+	rotations, err := rotationsFor(ctx, file, keys, opts.RotateAfter)
+	if err != nil {
+		return err
 	}
 
-	writer := env.NewFileWriter()
-	if err := writer.Write(file, vars, format); err != nil {
-		return fmt.Errorf("error writing %s file: %w", file, err)
+	vars = index.Variables()
+	opts.OrderOpts.Apply(vars)
+
+	if err := enforcePolicy(ctx, file, vars, key); err != nil {
+		return err
 	}
-	return nil
+	return writeEnvFile(ctx, file, vars, format, rotations...)
 }
 
 func addCmdFn(ctx context.Context, opts addOpts, args ...string) error {
-	format, err := opts.FmtOpts.Format()
+	format, err := opts.FmtOpts.OutputFormat(!opts.print)
 	if err != nil {
 		return fmt.Errorf("error parsing format: %w", err)
 	}
@@ -440,77 +1214,119 @@ func addCmdFn(ctx context.Context, opts addOpts, args ...string) error {
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
 
 	vars, err := loadEnv(ctx, file)
 	if err != nil {
 		return fmt.Errorf("error loading %s file: %w", file, err)
 	}
 
-	varMap := vars.ToMap()
+	index := env.NewIndex(vars)
 
-	// Parse arguments supporting both key=value and key-only formats
-	keyValues, err := parseKeyValueArgs(args)
-	if err != nil {
-		return fmt.Errorf("error parsing arguments: %w", err)
+	var keyValues map[string]string
+	if opts.Interactive {
+		if len(args) > 0 {
+			return fmt.Errorf("cannot use both --interactive and arguments")
+		}
+		expected, err := expectedVars(ctx, opts.Schema, opts.Example)
+		if err != nil {
+			return err
+		}
+		if keyValues, err = promptMissing(expected, index, key); err != nil {
+			return err
+		}
+		if len(keyValues) == 0 {
+			diagf("Nothing to add to %s\n", file)
+			return nil
+		}
+	} else {
+		// Parse arguments supporting both key=value and key-only formats
+		if keyValues, err = parseKeyValueArgs(args); err != nil {
+			return fmt.Errorf("error parsing arguments: %w", err)
+		}
 	}
 
 	// Check for existing keys first
 	for k := range keyValues {
-		if _, exists := varMap[k]; exists {
-			return fmt.Errorf("variable %s already exists in %s file", k, file)
+		if index.Has(k) || index.Has(crypto.NameToken(k, key)) {
+			if !opts.IfAbsent {
+				return fmt.Errorf("variable %s already exists in %s file", k, file)
+			}
+			if verbose {
+				diagf("Skipping %s: already exists\n", k)
+			}
+			delete(keyValues, k)
 		}
 	}
+	if opts.IfAbsent && len(keyValues) == 0 {
+		return nil
+	}
 
-	encryptor := crypto.NewAESEncryptor()
+	encrypt, err := newValueEncrypter(ctx, selectedEncryptor(ctx))
+	if err != nil {
+		return err
+	}
+	hide, err := hideNames()
+	if err != nil {
+		return err
+	}
 
 	if opts.print {
 		// Create a new Variables slice with only the newly added values
 		newVars := make(env.Variables, 0, len(keyValues))
 		for k, v := range keyValues {
-			ciphertext, err := encryptor.Encrypt(v, key)
+			stored, err := encryptVar(index, k, v, key, encrypt, hide)
 			if err != nil {
 				return fmt.Errorf("error encrypting value for key %s: %w", k, err)
 			}
-			newVars = append(newVars, env.Variable{Key: k, Value: ciphertext})
+			newVars = append(newVars, stored)
 		}
 
-		writer := env.NewFileWriter()
-		// Use a temp file to get the output
-		tempFile, err := createTempFile()
-		if err != nil {
-			return err
-		}
-		err = writer.Write(tempFile, newVars, format)
-		if err != nil {
-			return fmt.Errorf("error formatting output: %w", err)
-		}
-		content, err := os.ReadFile(tempFile)
-		if err != nil {
-			return fmt.Errorf("error reading formatted output: %w", err)
+		if showDiff(format) {
+			keys := make([]string, 0, len(newVars))
+			for _, v := range newVars {
+				index.Set(v.Key, v.Value)
+				keys = append(keys, v.Key)
+			}
+			rotations, err := rotationsFor(ctx, file, keys, opts.RotateAfter)
+			if err != nil {
+				return err
+			}
+			vars = index.Variables()
+			opts.OrderOpts.Apply(vars)
+			return printDiff(ctx, file, vars, format, rotations...)
 		}
-		removeFileIgnoreError(tempFile)
-		fmt.Print(string(content))
-		return nil
+
+		opts.OrderOpts.Apply(newVars)
+		return printVars(newVars, format)
 	}
 
 	// If not printing, update the actual vars and write to file
+	keys := make([]string, 0, len(keyValues))
 	for k, v := range keyValues {
-		ciphertext, err := encryptor.Encrypt(v, key)
+		stored, err := encryptVar(index, k, v, key, encrypt, hide)
 		if err != nil {
 			return fmt.Errorf("error encrypting value for key %s: %w", k, err)
 		}
-		vars.Set(k, ciphertext)
+		index.Set(stored.Key, stored.Value)
+		keys = append(keys, stored.Key)
+	}
+	rotations, err := rotationsFor(ctx, file, keys, opts.RotateAfter)
+	if err != nil {
+		return err
 	}
 
-	writer := env.NewFileWriter()
-	if err := writer.Write(file, vars, format); err != nil {
-		return fmt.Errorf("error writing %s file: %w", file, err)
+	vars = index.Variables()
+	opts.OrderOpts.Apply(vars)
+
+	if err := enforcePolicy(ctx, file, vars, key); err != nil {
+		return err
 	}
-	return nil
+	return writeEnvFile(ctx, file, vars, format, rotations...)
 }
 
 func encryptCmd(ctx context.Context, opts encryptOpts, args ...string) error {
-	format, err := opts.FmtOpts.Format()
+	format, err := opts.FmtOpts.OutputFormat(opts.Write)
 	if err != nil {
 		return fmt.Errorf("error parsing format: %w", err)
 	}
@@ -518,17 +1334,46 @@ func encryptCmd(ctx context.Context, opts encryptOpts, args ...string) error {
 		return fmt.Errorf("unsupported format: %s", format)
 	}
 
-	file := env.BuildFilename(opts.File, opts.Name)
+	var files []string
+	if opts.Batch.Enabled() {
+		if !opts.Write {
+			return fmt.Errorf("--all-resolved and --glob require --write")
+		}
+		if files, err = opts.Batch.Files(opts.File); err != nil {
+			return err
+		}
+	}
 
 	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
+
+	if files != nil {
+		return runBatch(files, false, func(file string) (string, error) {
+			report, err := encryptFile(ctx, opts, format, file, key, args...)
+			return report.String(), err
+		})
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	report, err := encryptFile(ctx, opts, format, file, key, args...)
+	if err == nil && opts.Report {
+		diagf("%s\n", report)
+	}
+	return err
+}
+
+// encryptFile encrypts the variables of one file with key, printing the
+// result or writing the file back with -w
+func encryptFile(ctx context.Context, opts encryptOpts, format Format, file string, key []byte, args ...string) (encryptReport, error) {
+	var report encryptReport
 
 	// Load .env file if exists
 	vars, err := loadEnv(ctx, file)
 	if err != nil {
-		return fmt.Errorf("error loading %s file: %w", file, err)
+		return report, fmt.Errorf("error loading %s file: %w", file, err)
 	}
 
 	argMap := make(map[string]bool, len(args))
@@ -536,48 +1381,94 @@ func encryptCmd(ctx context.Context, opts encryptOpts, args ...string) error {
 		argMap[arg] = true
 	}
 
-	encryptor := crypto.NewAESEncryptor()
+	encryptor := selectedEncryptor(ctx)
+	encrypt, err := newValueEncrypter(ctx, encryptor)
+	if err != nil {
+		return report, err
+	}
+	hide, err := hideNames()
+	if err != nil {
+		return report, err
+	}
+	policy := encryptionPolicy()
 
+	var positions []int
 	for i, v := range vars {
-		// If it isn't already encrypted, encrypt it
-		if len(args) == 0 || argMap[v.Key] {
-			ciphertext, err := encryptor.Encrypt(v.Value, key)
-			if err != nil {
-				return fmt.Errorf("error encrypting value: %w", err)
+		// Named keys are encrypted as asked; otherwise the policy decides
+		if (len(args) > 0 && !argMap[v.Key]) || (len(args) == 0 && !policy.Encrypts(v.Key)) {
+			if !encryptor.IsEncrypted(v.Value) {
+				report.plaintext++
 			}
-			vars[i].Value = ciphertext
+			continue
 		}
+
+		if encryptor.IsEncrypted(v.Value) {
+			// If it is already encrypted, only touch it when forced or when
+			// its name is still to be hidden
+			if !opts.Force && (!hide || crypto.IsNameToken(v.Key)) {
+				report.skipped++
+				continue
+			}
+			report.reencrypted++
+		} else {
+			report.encrypted++
+		}
+		positions = append(positions, i)
 	}
 
-	if !opts.Write {
-		writer := env.NewFileWriter()
-		// Use a temp file to get the output
-		tempFile, err := createTempFile()
-		if err != nil {
-			return err
+	names := make([]string, len(vars))
+	p := startProgress("Encrypting", len(positions))
+	err = vars.TransformAt(positions, func(i int, v env.Variable) (string, error) {
+		defer p.Step()
+		value := v.Value
+		if encryptor.IsEncrypted(value) {
+			var err error
+			if value, err = encryptor.Decrypt(ctx, value, key); err != nil {
+				return "", fmt.Errorf("error decrypting %s for re-encryption: %w", v.Key, err)
+			}
 		}
-		err = writer.Write(tempFile, vars, format)
-		if err != nil {
-			return fmt.Errorf("error formatting output: %w", err)
+		// A hidden name is already part of the decrypted value
+		if hide && !crypto.IsNameToken(v.Key) {
+			hidden, err := env.HideName(env.Variable{Key: v.Key, Value: value}, key, encrypt)
+			if err != nil {
+				return "", fmt.Errorf("error encrypting value: %w", err)
+			}
+			names[i] = hidden.Key
+			return hidden.Value, nil
 		}
-		content, err := os.ReadFile(tempFile)
+		ciphertext, err := encrypt(v.Key, value, key)
 		if err != nil {
-			return fmt.Errorf("error reading formatted output: %w", err)
+			return "", fmt.Errorf("error encrypting value: %w", err)
+		}
+		return ciphertext, nil
+	})
+	p.Stop()
+	if err != nil {
+		return report, err
+	}
+	for i, name := range names {
+		if name != "" {
+			vars[i].Key = name
 		}
-		removeFileIgnoreError(tempFile)
-		fmt.Print(string(content))
-		return nil
 	}
 
-	writer := env.NewFileWriter()
-	if err := writer.Write(file, vars, format); err != nil {
-		return fmt.Errorf("error writing %s file: %w", file, err)
+	opts.OrderOpts.Apply(vars)
+
+	if !opts.Write {
+		if showDiff(format) {
+			return report, printDiff(ctx, file, vars, format)
+		}
+		return report, printVars(vars, format)
 	}
-	return nil
+
+	if err := enforcePolicy(ctx, file, vars, key); err != nil {
+		return report, err
+	}
+	return report, writeEnvFile(ctx, file, vars, format)
 }
 
 func decryptCmd(ctx context.Context, opts decryptOpts, args ...string) error {
-	format, err := opts.FmtOpts.Format()
+	format, err := opts.FmtOpts.OutputFormat(opts.Write)
 	if err != nil {
 		return fmt.Errorf("error parsing format: %w", err)
 	}
@@ -591,6 +1482,7 @@ func decryptCmd(ctx context.Context, opts decryptOpts, args ...string) error {
 	if err != nil {
 		return fmt.Errorf("error loading key: %w", err)
 	}
+	defer secure.Zero(key)
 
 	// Load .env file if exists
 	vars, err := loadEnv(ctx, file)
@@ -603,43 +1495,61 @@ func decryptCmd(ctx context.Context, opts decryptOpts, args ...string) error {
 		argMap[arg] = true
 	}
 
-	encryptor := crypto.NewAESEncryptor()
+	encryptor := newEncryptor(ctx)
 
+	// Variables with hidden names are stored under their tokens
+	for _, arg := range args {
+		argMap[crypto.NameToken(arg, key)] = true
+	}
+
+	var positions []int
 	for i, v := range vars {
 		if len(args) == 0 || argMap[v.Key] {
-			plaintext, err := encryptor.Decrypt(v.Value, key)
-			if err != nil {
-				return fmt.Errorf("error decrypting value: %w", err)
-			}
-			vars[i].Value = plaintext
+			positions = append(positions, i)
 		}
 	}
 
+	if err := vars.DecryptAt(ctx, positions, encryptor, key); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if opts.Check {
+		return nil
+	}
+	accessed := make([]string, len(positions))
+	for i, pos := range positions {
+		accessed[i] = vars[pos].Key
+	}
+	if err := auditAccess("decrypt", file, opts.KeyStore, opts.Password, accessed); err != nil {
+		return err
+	}
+
+	opts.OrderOpts.Apply(vars)
+
 	if !opts.Write {
-		writer := env.NewFileWriter()
-		// Use a temp file to get the output
-		tempFile, err := createTempFile()
-		if err != nil {
-			return err
-		}
-		err = writer.Write(tempFile, vars, format)
-		if err != nil {
-			return fmt.Errorf("error formatting output: %w", err)
+		if showDiff(format) {
+			return printDiff(ctx, file, vars, format)
 		}
-		content, err := os.ReadFile(tempFile)
-		if err != nil {
-			return fmt.Errorf("error reading formatted output: %w", err)
-		}
-		removeFileIgnoreError(tempFile)
-		fmt.Print(string(content))
-		return nil
+		return printVars(vars, format)
 	}
 
-	writer := env.NewFileWriter()
-	if err := writer.Write(file, vars, format); err != nil {
-		return fmt.Errorf("error writing %s file: %w", file, err)
+	if err := enforcePolicy(ctx, file, vars, key); err != nil {
+		return err
 	}
-	return nil
+	if dryRun {
+		// The diff is still shown, with the refusal a real write would meet
+		if err := guardPlaintextWrite(file, opts.AllowTracked); err != nil {
+			diagf("Warning: %v\n", err)
+		}
+		return writeEnvFile(ctx, file, vars, format)
+	}
+	if err := guardPlaintextWrite(file, opts.AllowTracked); err != nil {
+		return err
+	}
+	if err := confirm(fmt.Sprintf("Overwrite %s with plaintext values?", file)); err != nil {
+		return err
+	}
+
+	return writeEnvFile(ctx, file, vars, format)
 }
 
 func run(ctx context.Context, opts runOpts, args ...string) error {
@@ -649,24 +1559,39 @@ func run(ctx context.Context, opts runOpts, args ...string) error {
 
 	exe := args[0]
 
-	file := env.BuildFilename(opts.File, opts.Name)
-
-	// TODO: Move out
-	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	opts, err := resolveChdir(opts)
 	if err != nil {
-		return fmt.Errorf("error loading key: %w", err)
+		return err
 	}
 
-	encryptor := crypto.NewAESEncryptor()
-	vars, err := loadDecryptedEnv(ctx, file, encryptor, key)
+	vars, err := loadRunEnv(ctx, opts, "run")
 	if err != nil {
-		return fmt.Errorf("error loading env file: %w", err)
+		return err
 	}
 
-	for _, v := range vars {
-		if err := os.Setenv(v.Key, v.Value); err != nil {
-			return fmt.Errorf("error setting env var %s: %w", v.Key, err)
+	if opts.Chdir != "" {
+		if err := os.Chdir(opts.Chdir); err != nil {
+			return fmt.Errorf("error changing directory: %w", err)
 		}
+		if err := os.Setenv("PWD", opts.Chdir); err != nil {
+			return fmt.Errorf("error setting env var PWD: %w", err)
+		}
+	}
+
+	mounts, err := newMountSet(opts.Mount)
+	if err != nil {
+		return err
+	}
+	defer mounts.remove()
+
+	if opts.Redact {
+		opts.redact = redactedValues(vars, opts.RedactMinLength)
+	}
+
+	original := args
+	args, exported, err := exportRunEnv(opts, vars, args, mounts)
+	if err != nil {
+		return err
 	}
 
 	// Execute the new process in place of the Go process
@@ -675,6 +1600,15 @@ func run(ctx context.Context, opts runOpts, args ...string) error {
 		return fmt.Errorf("executable not found: %s", exe)
 	}
 
+	if opts.Restart != "" && opts.Restart != restartNo {
+		return supervise(ctx, opts, exe, original, args, exported, mounts)
+	}
+	// Mounted files are removed after the program exits and output is only
+	// redacted while passing through envx, so envx must outlive the program
+	if opts.Timeout > 0 || mounts != nil || opts.Redact {
+		return spawn(ctx, exe, args, opts.Timeout, opts.KillAfter, opts.redact)
+	}
+
 	// TODO: Resolve shell alias
 	/*
 	  out, err := exec.Command("bash", "-i", "-c", "type "+exe).Output()
@@ -686,11 +1620,443 @@ func run(ctx context.Context, opts runOpts, args ...string) error {
 	  }
 	*/
 
-	err = syscall.Exec(exe, args, os.Environ()) // #nosec G204 -- Intentional subprocess execution with validated executable path
+	return execOrSpawn(ctx, exe, args, opts.KillAfter)
+}
+
+// exportRunEnv sets vars in the environment the program inherits and, with
+// --interpolate, substitutes them into its arguments instead. Mounted
+// variables are written to files. It returns the arguments to run the program
+// with and the keys that were exported.
+func exportRunEnv(opts runOpts, vars env.Variables, args []string, mounts *mountSet) ([]string, []string, error) {
+	// Variables passed as arguments or files stay out of the program's environment
+	withheld := map[string]bool{}
+	if opts.Interpolate {
+		interpolated, used, err := interpolateArgs(args[1:], vars)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append([]string{args[0]}, interpolated...)
+		for key := range used {
+			withheld[key] = true
+		}
+	}
+
+	exported := make([]string, 0, len(vars))
+	if mounts != nil {
+		mounted, files, err := mounts.write(vars)
+		if err != nil {
+			return nil, nil, err
+		}
+		for key := range mounted {
+			withheld[key] = true
+		}
+		exported = append(exported, files...)
+	}
+
+	for _, v := range vars {
+		if withheld[v.Key] {
+			continue
+		}
+		if err := os.Setenv(v.Key, v.Value); err != nil {
+			return nil, nil, fmt.Errorf("error setting env var %s: %w", v.Key, err)
+		}
+		exported = append(exported, v.Key)
+	}
+	return args, exported, nil
+}
+
+// Values of --env-relative
+const (
+	envRelativeCwd   = "cwd"
+	envRelativeChdir = "chdir"
+)
+
+// resolveChdir checks the --chdir directory and makes it absolute, and with
+// --env-relative chdir resolves a relative env file against it
+func resolveChdir(opts runOpts) (runOpts, error) {
+	switch opts.EnvRelative {
+	case "", envRelativeCwd, envRelativeChdir:
+	default:
+		return opts, fmt.Errorf("invalid --env-relative value %q (supported: %s, %s)", opts.EnvRelative, envRelativeCwd, envRelativeChdir)
+	}
+	if opts.Chdir == "" {
+		return opts, nil
+	}
+
+	dir, err := filepath.Abs(opts.Chdir)
+	if err != nil {
+		return opts, fmt.Errorf("error resolving --chdir: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return opts, fmt.Errorf("error resolving --chdir: %w", err)
+	}
+	if !info.IsDir() {
+		return opts, fmt.Errorf("--chdir %s is not a directory", opts.Chdir)
+	}
+	opts.Chdir = dir
+
+	if opts.File == stdinFile || remote.IsURL(opts.File) || remote.IsObjectURI(opts.File) || filepath.IsAbs(opts.File) {
+		return opts, nil
+	}
+	if opts.EnvRelative == envRelativeChdir {
+		opts.File = filepath.Join(dir, opts.File)
+		return opts, nil
+	}
+	// Keep resolving against the current directory once envx has moved
+	if opts.File, err = filepath.Abs(opts.File); err != nil {
+		return opts, fmt.Errorf("error resolving env file: %w", err)
+	}
+	return opts, nil
+}
+
+// missingRequired returns the required keys that are neither set to a
+// non-empty value in vars nor in the environment the program inherits.
+// Encrypted values count as set; they are checked before decryption so a
+// missing variable is reported without loading the key.
+func missingRequired(vars env.Variables, required []string) []string {
+	var missing []string
+	for _, key := range required {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if v := vars.Get(key); v != nil && v.Value != "" {
+			continue
+		}
+		if os.Getenv(key) != "" {
+			continue
+		}
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+// loadRunEnv loads and decrypts the variables a program is started with,
+// applying --require-encrypted and --ignore-decrypt-errors, and records the
+// access as command in the audit log
+func loadRunEnv(ctx context.Context, opts runOpts, command string) (env.Variables, error) {
+	file := env.BuildFilename(opts.File, opts.Name)
+
+	encryptor := newEncryptor(ctx)
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading env file: %w", err)
+	}
+
+	if opts.RequireEncrypted {
+		if plaintext := plaintextSecrets(vars, encryptor); len(plaintext) > 0 {
+			return nil, fmt.Errorf("refusing to run: %s holds plaintext values for secret-like keys: %s", file, strings.Join(plaintext, ", "))
+		}
+	}
+
+	if missing := missingRequired(vars, opts.Require); len(missing) > 0 {
+		return nil, fmt.Errorf("refusing to run: required variables missing or empty in %s and the environment: %s", file, strings.Join(missing, ", "))
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error loading key: %w", err)
+	}
+	// Zeroed here rather than by the caller, whose deferred calls never run
+	// once the process is replaced
+	defer secure.Zero(key)
+
+	err = vars.DecryptAll(ctx, encryptor, key)
+	if err != nil && opts.IgnoreDecryptErrors {
+		vars, err = skipUndecryptable(vars, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading env file: %w", err)
+	}
+	if err := resolveSecretRefs(vars); err != nil {
+		return nil, err
+	}
+
+	if err := auditAccess(command, file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+		return nil, err
+	}
+	warnDueRotations(ctx, file)
+	return vars, nil
+}
+
+// guardPlaintextWrite refuses to write plaintext to a file that git could
+// commit. When allowed, it only prints a warning.
+func guardPlaintextWrite(file string, allow bool) error {
+	exposure, err := vcs.CheckExposure(file)
+	if err != nil {
+		return err
+	}
+	if !exposure.Exposed() {
+		return nil
+	}
+	if !allow {
+		return fmt.Errorf("refusing to write plaintext to %s: file is %s (add it to .gitignore or pass --allow-tracked)", file, exposure)
+	}
+	diagf("Warning: writing plaintext to %s, which is %s\n", file, exposure)
+	return nil
+}
+
+// writeEnvFile writes variables to file, or prints a diff against the current
+// contents of file when --dry-run is set
+func writeEnvFile(ctx context.Context, file string, vars env.Variables, format Format, rotations ...env.Rotation) error {
+	if dryRun {
+		return printDiff(ctx, file, vars, format, rotations...)
+	}
+
+	content, err := renderEnvFile(ctx, file, vars, format, rotations...)
+	if err != nil {
+		return err
+	}
+	if remote.IsObjectURI(file) {
+		return writeObject(file, []byte(content))
+	}
+	if err := checkExternalChange(file, content); err != nil {
+		return err
+	}
+	if err := backupFile(file); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, []byte(content), env.SecureFileMode); err != nil {
+		return fmt.Errorf("error writing %s file: %w", file, err)
+	}
+	recordWritten(file, []byte(content))
+	return nil
+}
+
+// renderEnvFile returns the contents file would have once vars are written in
+// format. In a file holding several environments only the section selected
+// with --env is replaced and the others are kept, as are include directives.
+// Rotation directives are kept for the keys still in vars and replaced by
+// rotations.
+func renderEnvFile(ctx context.Context, file string, vars env.Variables, format Format, rotations ...env.Rotation) (string, error) {
+	writer := env.NewFileWriter()
+	sections, encoding, err := loadFileSections(ctx, file)
+	if err != nil {
+		return "", fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	normalize, err := normalizeFiles()
+	if err != nil {
+		return "", err
+	}
+	if normalize || format != FormatEnv {
+		encoding = env.Encoding{}
+	}
+
+	sections = sections.Set(envSection, vars)
+	for _, r := range rotations {
+		sections = sections.SetRotation(envSection, r)
+	}
+	if envSection == "" && len(sections.Names()) == 0 && !sections.HasIncludes() && !sections.HasRotations() {
+		content, err := writer.Render(vars, format)
+		return encoding.Apply(content), err
+	}
+	if format != FormatEnv {
+		return "", fmt.Errorf("files with [sections] or envx directives can only be written in %s format", FormatEnv)
+	}
+	return encoding.Apply(writer.RenderSections(sections)), nil
+}
+
+// normalizeFiles reports whether ENVX_NORMALIZE=true asks for files to be
+// rewritten with LF line endings and no byte order mark, instead of keeping
+// those they have
+func normalizeFiles() (bool, error) {
+	value := os.Getenv("ENVX_NORMALIZE")
+	if value == "" {
+		return false, nil
+	}
+	normalize, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ENVX_NORMALIZE value %q: %w", value, err)
+	}
+	return normalize, nil
+}
+
+// loadFileSections loads the sections of file, wherever it is kept, along
+// with its line endings and byte order mark
+func loadFileSections(ctx context.Context, file string) (env.Sections, env.Encoding, error) {
+	if !remote.IsObjectURI(file) {
+		sections, _, err := env.NewFileLoader().LoadSections(ctx, file)
+		if err != nil {
+			return nil, env.Encoding{}, err
+		}
+		data, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+		if err != nil && !os.IsNotExist(err) {
+			return nil, env.Encoding{}, fmt.Errorf("error reading %s file: %w", file, err)
+		}
+		return sections, env.DetectEncoding(data), nil
+	}
+	data, err := readObject(file)
 	if err != nil {
-		fmt.Println("Error executing process:", err, exe, args)
-		os.Exit(1)
+		return nil, env.Encoding{}, err
+	}
+	sections, _, err := env.ParseSections(bytes.NewReader(data), file)
+	return sections, env.DetectEncoding(data), err
+}
+
+// confirm asks the user to confirm an action on the terminal. It succeeds
+// without asking when --yes is set or stdin is not a terminal.
+func confirm(question string) error {
+	if assumeYes || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted")
+	}
+}
+
+// valueEncrypter encrypts the value of the variable name
+type valueEncrypter func(name, value string, key []byte) (string, error)
+
+// newValueEncrypter returns how values are encrypted: with a random nonce,
+// or deterministically when ENVX_DETERMINISTIC=true opts in, so unchanged
+// values keep their ciphertext at the cost of revealing equal values
+func newValueEncrypter(ctx context.Context, encryptor crypto.Encryptor) (valueEncrypter, error) {
+	random := func(_, value string, key []byte) (string, error) {
+		return encryptor.Encrypt(ctx, value, key)
+	}
+	value := os.Getenv("ENVX_DETERMINISTIC")
+	if value == "" {
+		return random, nil
+	}
+	deterministic, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENVX_DETERMINISTIC value %q: %w", value, err)
+	}
+	if !deterministic {
+		return random, nil
+	}
+	d, ok := encryptor.(deterministicEncryptor)
+	if !ok {
+		return nil, fmt.Errorf("ENVX_DETERMINISTIC is not supported by the selected encryptor")
+	}
+	return func(name, value string, key []byte) (string, error) {
+		return d.EncryptDeterministic(ctx, name, value, key)
+	}, nil
+}
+
+// deterministicEncryptor is an encryptor that can also encrypt
+// deterministically, as crypto.AESEncryptor does
+type deterministicEncryptor interface {
+	EncryptDeterministic(ctx context.Context, name, plaintext string, key []byte) (string, error)
+}
+
+// hideNames reports whether ENVX_ENCRYPT_NAMES=true asks for variable names
+// to be encrypted along with their values
+func hideNames() (bool, error) {
+	value := os.Getenv("ENVX_ENCRYPT_NAMES")
+	if value == "" {
+		return false, nil
+	}
+	hide, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ENVX_ENCRYPT_NAMES value %q: %w", value, err)
+	}
+	return hide, nil
+}
+
+// encryptVar returns the variable to store for name and value. A variable
+// already stored under a hidden name stays hidden; a new one is hidden when
+// hide is set.
+func encryptVar(index *env.Index, name, value string, key []byte, encrypt valueEncrypter, hide bool) (env.Variable, error) {
+	if index.Has(crypto.NameToken(name, key)) || (hide && !index.Has(name)) {
+		return env.HideName(env.Variable{Key: name, Value: value}, key, encrypt)
+	}
+	ciphertext, err := encrypt(name, value, key)
+	if err != nil {
+		return env.Variable{}, err
+	}
+	return env.Variable{Key: name, Value: ciphertext}, nil
+}
+
+// currentValue returns the decrypted value of the variable name, looking it
+// up under its hidden name too, and whether it exists
+func currentValue(ctx context.Context, index *env.Index, name string, key []byte) (string, bool, error) {
+	encryptor := selectedEncryptor(ctx)
+	token := crypto.NameToken(name, key)
+	if v := index.Get(token); v != nil {
+		plaintext, err := encryptor.Decrypt(ctx, v.Value, key)
+		if err != nil {
+			return "", false, err
+		}
+		if _, value, ok := env.RevealName(token, plaintext, key); ok {
+			return value, true, nil
+		}
+	}
+	v := index.Get(name)
+	if v == nil {
+		return "", false, nil
 	}
+	value, err := encryptor.Decrypt(ctx, v.Value, key)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// encryptionPolicy returns the policy set with ENVX_ENCRYPT_PATTERNS and
+// ENVX_PLAINTEXT_PATTERNS, comma separated lists of key glob patterns
+func encryptionPolicy() env.Policy {
+	return env.Policy{
+		Encrypt:   env.ParsePatterns(os.Getenv("ENVX_ENCRYPT_PATTERNS")),
+		Plaintext: env.ParsePatterns(os.Getenv("ENVX_PLAINTEXT_PATTERNS")),
+	}
+}
+
+// plaintextSecrets returns the keys the encryption policy requires to be
+// encrypted but that hold plaintext values
+func plaintextSecrets(vars env.Variables, encryptor crypto.Encryptor) []string {
+	policy := encryptionPolicy()
+	var keys []string
+	for _, v := range vars {
+		if policy.Requires(v.Key) && v.Value != "" && !encryptor.IsEncrypted(v.Value) {
+			keys = append(keys, v.Key)
+		}
+	}
+	return keys
+}
+
+// printTable prints vars as a CSV or TSV table
+func printTable(vars env.Variables, format Format, opts env.TableOptions) error {
+	content, err := env.RenderTable(vars, format, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(content)
+	return nil
+}
+
+// printVars formats variables in the given format and prints them to stdout
+func printVars(vars env.Variables, format Format) error {
+	writer := env.NewFileWriter()
+	// Use a temp file to get the output
+	tempFile, err := createTempFile()
+	if err != nil {
+		return err
+	}
+	defer removeFileIgnoreError(tempFile)
+
+	if err := writer.Write(tempFile, vars, format); err != nil {
+		return fmt.Errorf("error formatting output: %w", err)
+	}
+	content, err := os.ReadFile(tempFile)
+	if err != nil {
+		return fmt.Errorf("error reading formatted output: %w", err)
+	}
+	fmt.Print(string(content))
 	return nil
 }
 
@@ -710,18 +2076,73 @@ func createTempFile() (string, error) {
 	return tempFileName, nil
 }
 
-// promptForSecretValue prompts the user to enter a secret value securely
+// readSecretLine reads a line from the terminal without echoing it; tests
+// replace it
+var readSecretLine = func() ([]byte, error) {
+	return term.ReadPassword(int(os.Stdin.Fd()))
+}
+
+// promptForSecretValue prompts the user to enter a secret value securely.
+// Values of keys matching ENVX_CONFIRM_PATTERNS are shown masked and must be
+// entered twice, so a typo is caught here rather than when the secret is
+// first used.
 func promptForSecretValue(key string) (string, error) {
-	fmt.Printf("Enter value for %s: ", key)
+	fmt.Fprintf(os.Stderr, "Enter value for %s: ", key)
 
 	// Read password without echoing to terminal
-	bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
+	bytePassword, err := readSecretLine()
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr) // Print newline after password input
+	value := string(bytePassword)
+	if !env.MatchesAny(key, env.ParsePatterns(os.Getenv("ENVX_CONFIRM_PATTERNS"))) {
+		return value, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s will be set to %s\n", key, maskSecret(value))
+	fmt.Fprintf(os.Stderr, "Enter value for %s again: ", key)
+	again, err := readSecretLine()
 	if err != nil {
 		return "", fmt.Errorf("failed to read password: %w", err)
 	}
+	fmt.Fprintln(os.Stderr)
+	if string(again) != value {
+		return "", fmt.Errorf("values entered for %s do not match", key)
+	}
+	return value, nil
+}
 
-	fmt.Println() // Print newline after password input
-	return string(bytePassword), nil
+// maskSecret shows enough of a secret to spot a typo or a paste of the
+// wrong value: its length and, for long values, its first and last two
+// characters
+func maskSecret(value string) string {
+	runes := []rune(value)
+	n := len(runes)
+	if n == 0 {
+		return "an empty value"
+	}
+	if n < 12 {
+		return fmt.Sprintf("%s (%d characters)", strings.Repeat("*", n), n)
+	}
+	return fmt.Sprintf("%s%s%s (%d characters)", string(runes[:2]), strings.Repeat("*", n-4), string(runes[n-2:]), n)
+}
+
+// readStdinValues reads the variables set --stdin sets, refusing arguments
+// alongside them
+func readStdinValues(format Format, args []string) (map[string]string, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("cannot use both --stdin and arguments")
+	}
+	vars, err := env.ReadValues(stdin, format)
+	if err != nil {
+		return nil, fmt.Errorf("error reading variables from stdin: %w", err)
+	}
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("no variables to set on stdin")
+	}
+	return vars.ToMap(), nil
 }
 
 // parseKeyValueArgs parses arguments that can be either "key=value" or just "key"
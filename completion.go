@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+	flag "github.com/spf13/pflag"
+)
+
+// completeCommand is the hidden command the completion scripts run with the
+// words typed after envx, the last one being the word to complete. It prints
+// the candidates one per line; printing none lets the shell complete file
+// names instead.
+const completeCommand = "__complete"
+
+// variableCommands take the names of variables in the env file as arguments
+var variableCommands = []string{"get", "getv", "set", "has", "encrypt", "decrypt", "export", "diff"}
+
+// completionScripts hook envx into each shell's completion system
+var completionScripts = map[string]string{
+	"bash": `_envx() {
+	local IFS=$'\n'
+	COMPREPLY=($(envx ` + completeCommand + ` "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -o nospace -F _envx envx
+`,
+	"zsh": `#compdef envx
+_envx() {
+	local -a candidates
+	candidates=("${(@f)$(envx ` + completeCommand + ` "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _envx envx
+`,
+	"fish": `complete -c envx -a '(envx ` + completeCommand + ` (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`,
+}
+
+func newCompletionCmd() *command[struct{}] {
+	cmd := new(command[struct{}])
+	cmd.flags = flag.NewFlagSet("completion", flag.ExitOnError)
+	cmd.fn = completionCmdFn
+	return cmd
+}
+
+// completionCmdFn prints the completion script for a shell
+func completionCmdFn(ctx context.Context, _ struct{}, args ...string) error {
+	shells := make([]string, 0, len(completionScripts))
+	for shell := range completionScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	if len(args) != 1 {
+		return fmt.Errorf("usage: envx completion <%s>", strings.Join(shells, "|"))
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return fmt.Errorf("unsupported shell: %s (supported: %s)", args[0], strings.Join(shells, ", "))
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// complete returns the candidates for the last of words: command and
+// subcommand names, flags, or the names of the variables in the env file the
+// other words select, which are listed without decrypting anything
+func complete(ctx context.Context, cmds map[string]executor, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, typed := words[len(words)-1], words[:len(words)-1]
+
+	if len(typed) == 0 {
+		if strings.HasPrefix(current, "-") {
+			return withPrefix(flagNames(cmds[""].flagSet()), current)
+		}
+		return withPrefix(commandNames(cmds), current)
+	}
+	name, cmd := typed[0], cmds[typed[0]]
+	typed = typed[1:]
+	if g, ok := cmd.(*group); ok {
+		if len(typed) == 0 {
+			return withPrefix(g.names(), current)
+		}
+		name, cmd = typed[0], g.cmds[typed[0]]
+		typed = typed[1:]
+	}
+	if cmd == nil || cmd.flagSet() == nil {
+		return nil
+	}
+
+	flags := cmd.flagSet()
+	if len(typed) > 0 && takesValue(flags, typed[len(typed)-1]) {
+		return nil
+	}
+	if strings.HasPrefix(current, "-") {
+		return withPrefix(flagNames(flags), current)
+	}
+	if !slices.Contains(variableCommands, name) {
+		return nil
+	}
+
+	keys, err := completionKeys(ctx, typed)
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, key := range keys {
+		if !slices.Contains(typed, key) {
+			candidates = append(candidates, key)
+		}
+	}
+	return withPrefix(candidates, current)
+}
+
+// completionKeys lists the keys of the env file selected by the --file,
+// --name and --env flags among words. Remote files are not fetched.
+func completionKeys(ctx context.Context, words []string) ([]string, error) {
+	file, name := ".env", ""
+	for i, word := range words {
+		var value string
+		if before, after, ok := strings.Cut(word, "="); ok {
+			word, value = before, after
+		} else if i+1 < len(words) {
+			value = words[i+1]
+		}
+		switch word {
+		case "-f", "--file":
+			file = value
+		case "-n", "--name":
+			name = value
+		case "--env":
+			envSection = value
+		}
+	}
+
+	file = env.BuildFilename(file, name)
+	if file == stdinFile || remote.IsURL(file) || remote.IsObjectURI(file) {
+		return nil, nil
+	}
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return varKeys(vars), nil
+}
+
+// commandNames returns the names of the commands, without the default run
+// command
+func commandNames(cmds map[string]executor) []string {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagNames returns the long and short forms of the visible flags
+func flagNames(flags *flag.FlagSet) []string {
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		names = append(names, "--"+f.Name)
+		if f.Shorthand != "" {
+			names = append(names, "-"+f.Shorthand)
+		}
+	})
+	sort.Strings(names)
+	return names
+}
+
+// takesValue reports whether word is a flag whose value is the next word
+func takesValue(flags *flag.FlagSet, word string) bool {
+	var f *flag.Flag
+	switch {
+	case strings.HasPrefix(word, "--") && !strings.Contains(word, "="):
+		f = flags.Lookup(word[2:])
+	case len(word) == 2 && word[0] == '-':
+		f = flags.ShorthandLookup(word[1:])
+	}
+	return f != nil && f.NoOptDefVal == "" && f.Value.Type() != "bool"
+}
+
+// withPrefix returns the candidates starting with prefix
+func withPrefix(candidates []string, prefix string) []string {
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
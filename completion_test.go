@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "PORT=8080\nAPI_KEY=ENC[abc]\nAPI_URL=http://localhost\n\n[prod]\nPROD_ONLY=1\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { envSection = "" }()
+
+	cmds := map[string]executor{
+		"":           newCompletionCmd(),
+		"completion": newCompletionCmd(),
+		"diff":       newDiffCmd(),
+		"docs":       newDocsCmd(),
+		"backup":     newBackupGroup(),
+	}
+	for _, cmd := range cmds {
+		addGlobalFlags(cmd)
+	}
+
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{"commands", []string{""}, []string{"backup", "completion", "diff", "docs"}},
+		{"command prefix", []string{"d"}, []string{"diff", "docs"}},
+		{"subcommands", []string{"backup", ""}, []string{"prune"}},
+		{"flags", []string{"docs", "--sch"}, []string{"--schema"}},
+		{"flag value", []string{"diff", "-f", ""}, nil},
+		{"variables", []string{"diff", "-f", envFile, "API"}, []string{"API_KEY", "API_URL"}},
+		{"typed variables skipped", []string{"diff", "--file=" + envFile, "API_KEY", ""}, []string{"PORT", "API_URL"}},
+		{"section", []string{"diff", "-f", envFile, "--env", "prod", ""}, []string{"PROD_ONLY"}},
+		{"no variables", []string{"docs", "-f", envFile, ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envSection = ""
+			got := complete(context.Background(), cmds, tt.words)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("complete(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
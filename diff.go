@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type diffOpts struct {
+	Name       string
+	File       string
+	KeyStore   string
+	Password   string
+	AgainstOS  bool
+	ShowValues bool
+	JSON       bool
+}
+
+// Ways a variable of the file can differ from the environment
+const (
+	diffChanged = "changed" // set to another value
+	diffUnset   = "unset"   // not set at all
+)
+
+// envDifference is a variable of diff --json
+type envDifference struct {
+	Key   string `json:"key"`
+	State string `json:"state"`
+}
+
+func newDiffCmd() *command[diffOpts] {
+	cmd := new(command[diffOpts])
+	cmd.flags = flag.NewFlagSet("diff", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVar(&cmd.val.AgainstOS, "against-os", false, "Compares the decrypted variables with the environment envx runs in")
+	cmd.flags.BoolVar(&cmd.val.ShowValues, "show-values", false, "Prints differing values in full instead of masked")
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the differences as a JSON array")
+	cmd.fn = diffCmdFn
+	return cmd
+}
+
+// diffCmdFn reports the variables of the env file, all or the ones given,
+// whose decrypted values the environment does not hold, to debug programs
+// that behave differently in a shell and under envx run. Variables the file
+// does not set are not compared. Like diff(1), it exits with status 1 when
+// there are differences.
+func diffCmdFn(ctx context.Context, opts diffOpts, args ...string) error {
+	if !opts.AgainstOS {
+		return fmt.Errorf("nothing to compare the file with; use --against-os")
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	lazy, err := loadLazyEnv(ctx, file, newEncryptor(ctx), key)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	vars, err := lazy.All()
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	if vars, err = selectVars(vars, args, file); err != nil {
+		return err
+	}
+	if err := auditAccess("diff", file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+		return err
+	}
+
+	differences := make([]envDifference, 0)
+	color := useColor()
+	for _, v := range vars {
+		actual, set := os.LookupEnv(v.Key)
+		switch {
+		case !set:
+			differences = append(differences, envDifference{Key: v.Key, State: diffUnset})
+			if !opts.JSON {
+				fmt.Println(colored(color, colorRed, "- "+v.Key+": not set in the environment"))
+			}
+		case actual != v.Value:
+			differences = append(differences, envDifference{Key: v.Key, State: diffChanged})
+			if !opts.JSON {
+				fmt.Println(colored(color, colorCyan, "~ "+v.Key+": differs"))
+				fmt.Printf("    file:        %s\n", diffValue(v.Value, opts.ShowValues))
+				fmt.Printf("    environment: %s\n", diffValue(actual, opts.ShowValues))
+			}
+		}
+	}
+	if opts.JSON {
+		if err := writeJSON(os.Stdout, differences); err != nil {
+			return err
+		}
+	}
+
+	if len(differences) == 0 {
+		diagf("%s: the environment matches\n", file)
+		return nil
+	}
+	return &exitError{code: 1}
+}
+
+// diffValue returns how diff shows a value
+func diffValue(value string, show bool) string {
+	if show {
+		return fmt.Sprintf("%q", value)
+	}
+	return maskSecret(value)
+}
+
+// colored wraps text in the color code when color is on
+func colored(color bool, code, text string) string {
+	if !color {
+		return text
+	}
+	return code + text + colorReset
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffAgainstOS(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "ENVX_TEST_PORT=8080\nENVX_TEST_SAME=same\nENVX_TEST_UNSET=value\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_TEST_PORT", "9090")
+	t.Setenv("ENVX_TEST_SAME", "same")
+	t.Setenv("ENVX_TEST_UNSET", "")
+	os.Unsetenv("ENVX_TEST_UNSET")
+
+	opts := diffOpts{File: envFile, KeyStore: "mock", AgainstOS: true}
+	output, err := captureStdout(t, func() error { return diffCmdFn(context.Background(), opts) })
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != 1 || exitErr.err != nil {
+		t.Fatalf("diffCmdFn() error = %v, want exit status 1", err)
+	}
+	want := "~ ENVX_TEST_PORT: differs\n" +
+		"    file:        **** (4 characters)\n" +
+		"    environment: **** (4 characters)\n" +
+		"- ENVX_TEST_UNSET: not set in the environment\n"
+	if output != want {
+		t.Errorf("diffCmdFn() output =\n%s\nwant\n%s", output, want)
+	}
+
+	opts.ShowValues = true
+	output, _ = captureStdout(t, func() error { return diffCmdFn(context.Background(), opts, "ENVX_TEST_PORT") })
+	if want := "~ ENVX_TEST_PORT: differs\n    file:        \"8080\"\n    environment: \"9090\"\n"; output != want {
+		t.Errorf("diffCmdFn(--show-values) output = %q, want %q", output, want)
+	}
+
+	opts.ShowValues, opts.JSON = false, true
+	output, _ = captureStdout(t, func() error { return diffCmdFn(context.Background(), opts) })
+	if want := `[{"key":"ENVX_TEST_PORT","state":"changed"},{"key":"ENVX_TEST_UNSET","state":"unset"}]` + "\n"; output != want {
+		t.Errorf("diffCmdFn(--json) output = %q, want %q", output, want)
+	}
+
+	if err := diffCmdFn(context.Background(), opts, "ENVX_TEST_SAME"); err != nil {
+		t.Errorf("diffCmdFn() of a matching variable error = %v", err)
+	}
+	if err := diffCmdFn(context.Background(), diffOpts{File: envFile, KeyStore: "mock"}); err == nil {
+		t.Error("diffCmdFn() without --against-os expected error")
+	}
+}
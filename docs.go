@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/schema"
+	flag "github.com/spf13/pflag"
+)
+
+type docsOpts struct {
+	Name   string
+	File   string
+	Schema string
+}
+
+// maxExampleLength is how much of a masked value docs shows
+const maxExampleLength = 32
+
+func newDocsCmd() *command[docsOpts] {
+	cmd := new(command[docsOpts])
+	cmd.flags = flag.NewFlagSet("docs", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVar(&cmd.val.Schema, "schema", "", "Schema file describing the variables (default ENVX_SCHEMA or "+schema.DefaultFile+")")
+	cmd.fn = docsCmdFn
+	return cmd
+}
+
+// docsCmdFn prints a Markdown table documenting the variables of the env
+// file and those its schema expects. Nothing is decrypted: examples come
+// from the schema, or else are masked from the values in the file.
+func docsCmdFn(ctx context.Context, opts docsOpts, args ...string) error {
+	s, _, err := loadSchema(opts.Schema)
+	if err != nil {
+		return err
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadEnv(ctx, file)
+	if err != nil && (s == nil || !errors.Is(err, os.ErrNotExist)) {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	fmt.Print(renderDocs(vars, s))
+	return nil
+}
+
+// loadSchema loads the schema at path, ENVX_SCHEMA or the default schema
+// file. It returns a nil schema if the default file does not exist, along
+// with the path that was looked for.
+func loadSchema(path string) (*schema.Schema, string, error) {
+	if path == "" {
+		path = os.Getenv("ENVX_SCHEMA")
+	}
+	if path == "" {
+		path = schema.DefaultFile
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, path, nil
+		}
+	}
+	s, err := schema.Load(path)
+	return s, path, err
+}
+
+// renderDocs returns the Markdown table for the variables in the file, in
+// file order, followed by those only the schema describes
+func renderDocs(vars env.Variables, s *schema.Schema) string {
+	var sb strings.Builder
+	sb.WriteString("| Variable | Description | Required | Example |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+	row := func(key, value string, inFile bool) {
+		described := s.Get(key)
+		if described == nil {
+			described = &schema.Var{Key: key}
+		}
+		required := ""
+		if described.Required {
+			required = "yes"
+		}
+		example := ""
+		switch {
+		case described.Example != "":
+			example = markdownCode(described.Example)
+		case inFile:
+			example = maskedExample(value)
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", markdownCode(key), markdownCell(described.Description), required, example)
+	}
+
+	for _, v := range vars {
+		row(v.Key, v.Value, true)
+	}
+	if s != nil {
+		for _, v := range s.Vars {
+			if vars.Get(v.Key) == nil {
+				row(v.Key, "", false)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// maskedExample hides a value from the file while keeping its shape:
+// letters become x and digits 0, so a URL still reads as one. Encrypted
+// values are only marked as such.
+func maskedExample(value string) string {
+	if value == "" {
+		return ""
+	}
+	if crypto.NewAESEncryptor().IsEncrypted(value) {
+		return "*encrypted*"
+	}
+	masked := []rune(strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r):
+			return 'x'
+		case unicode.IsDigit(r):
+			return '0'
+		}
+		return r
+	}, value))
+	if len(masked) > maxExampleLength {
+		masked = append(masked[:maxExampleLength], '…')
+	}
+	return markdownCode(string(masked))
+}
+
+// markdownCode returns s as an inline code span in a table cell
+func markdownCode(s string) string {
+	s = markdownCell(s)
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+// markdownCell escapes s for a single line of a Markdown table
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r\n", "<br>", "\n", "<br>").Replace(s)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestDocsCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "s3cret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("API_KEY="+secret+"\nDATABASE_URL=postgres://db:5432/app\nPORT=8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	schemaFile := filepath.Join(dir, "schema.json")
+	schemaJSON := `{"vars": [
+		{"key": "PORT", "description": "Port to listen on", "example": "8080"},
+		{"key": "API_KEY", "description": "Key for the | payments API", "required": true},
+		{"key": "SENTRY_DSN", "description": "Error reporting", "required": true}
+	]}`
+	if err := os.WriteFile(schemaFile, []byte(schemaJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return docsCmdFn(context.Background(), docsOpts{File: envFile, Schema: schemaFile})
+	})
+	if err != nil {
+		t.Fatalf("docsCmdFn() error = %v", err)
+	}
+	want := "| Variable | Description | Required | Example |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| `API_KEY` | Key for the \\| payments API | yes | *encrypted* |\n" +
+		"| `DATABASE_URL` |  |  | `xxxxxxxx://xx:0000/xxx` |\n" +
+		"| `PORT` | Port to listen on |  | `8080` |\n" +
+		"| `SENTRY_DSN` | Error reporting | yes |  |\n"
+	if output != want {
+		t.Errorf("docsCmdFn() output =\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestMaskedExample(t *testing.T) {
+	tests := map[string]string{
+		"":                                   "",
+		"abc-123":                            "`xxx-000`",
+		"a`b":                                "`` x`x ``",
+		"0123456789012345678901234567890123": "`" + "00000000000000000000000000000000" + "…`",
+	}
+	for value, want := range tests {
+		if got := maskedExample(value); got != want {
+			t.Errorf("maskedExample(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+	flag "github.com/spf13/pflag"
+)
+
+type expiringOpts struct {
+	Name   string
+	File   string
+	Within string
+	JSON   bool
+}
+
+// rotationReport is a variable due for rotation, as printed by expiring
+// --json
+type rotationReport struct {
+	Key string `json:"key"`
+	// Due is the date the value should be rotated by, as YYYY-MM-DD
+	Due string `json:"due"`
+	// Every is the rotation interval, empty for a one-off date
+	Every string `json:"every,omitempty"`
+	// Days is how many days remain until Due, negative once overdue
+	Days int `json:"days"`
+}
+
+// rotationNow is the time rotations are scheduled and checked against; tests
+// replace it
+var rotationNow = time.Now
+
+func newExpiringCmd() *command[expiringOpts] {
+	cmd := new(command[expiringOpts])
+	cmd.flags = flag.NewFlagSet("expiring", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.Within, "within", "w", "0d", "Also lists secrets due within this long, e.g. 14d")
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the secrets as a JSON array")
+	cmd.fn = expiringCmdFn
+	return cmd
+}
+
+// expiringCmdFn lists the variables due for rotation, most overdue first
+func expiringCmdFn(ctx context.Context, opts expiringOpts, args ...string) error {
+	within, err := env.ParseDuration(opts.Within)
+	if err != nil {
+		return fmt.Errorf("invalid --within: %w", err)
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	rotations, err := fileRotations(ctx, file)
+	if err != nil {
+		return err
+	}
+	due := dueRotations(rotations, within)
+	if opts.JSON {
+		reports := make([]rotationReport, len(due))
+		for i, r := range due {
+			reports[i] = rotationReport{Key: r.Key, Due: r.Due.Format(env.DateLayout), Days: daysUntil(r)}
+			if r.Every > 0 {
+				reports[i].Every = env.FormatDuration(r.Every)
+			}
+		}
+		return writeJSON(os.Stdout, reports)
+	}
+	printRotations(os.Stdout, due)
+	return nil
+}
+
+// fileRotations returns the rotation directives of the section of file
+// selected with --env
+func fileRotations(ctx context.Context, file string) ([]env.Rotation, error) {
+	if file == stdinFile || remote.IsURL(file) {
+		return nil, nil
+	}
+	sections, _, err := loadFileSections(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	return sections.Rotations(envSection), nil
+}
+
+// dueRotations returns the rotations due within d from now, earliest first
+func dueRotations(rotations []env.Rotation, d time.Duration) []env.Rotation {
+	now := rotationNow()
+	var due []env.Rotation
+	for _, r := range rotations {
+		if r.DueWithin(now, d) {
+			due = append(due, r)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b env.Rotation) int { return a.Due.Compare(b.Due) })
+	return due
+}
+
+// printRotations writes one line per rotation with its due date and how far
+// off it is
+func printRotations(w io.Writer, rotations []env.Rotation) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range rotations {
+		days := daysUntil(r)
+		var when string
+		switch {
+		case days < 0:
+			when = fmt.Sprintf("overdue by %dd", -days)
+		case days == 0:
+			when = "due today"
+		default:
+			when = fmt.Sprintf("due in %dd", days)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Key, r.Due.Format(env.DateLayout), when)
+	}
+	_ = tw.Flush()
+}
+
+// daysUntil returns the number of days from today until r is due
+func daysUntil(r env.Rotation) int {
+	return int(r.Due.Sub(env.Day(rotationNow())) / (24 * time.Hour))
+}
+
+// warnDueRotations warns on stderr about variables of file that are due for
+// rotation. Errors are ignored so a reminder never stops a command.
+func warnDueRotations(ctx context.Context, file string) {
+	rotations, err := fileRotations(ctx, file)
+	if err != nil {
+		return
+	}
+	for _, r := range dueRotations(rotations, 0) {
+		diagf("Warning: %s in %s was due for rotation on %s; see envx expiring\n", r.Key, file, r.Due.Format(env.DateLayout))
+	}
+}
+
+// parseRotateAfter reads a --rotate-after value: a date such as 2027-01-31
+// for a one-off rotation, or an interval such as 90d after which the value
+// is due again every time it is set
+func parseRotateAfter(text string) (env.Rotation, error) {
+	if due, err := time.Parse(env.DateLayout, text); err == nil {
+		return env.Rotation{Due: due}, nil
+	}
+	every, err := env.ParseDuration(text)
+	if err != nil || every <= 0 {
+		return env.Rotation{}, fmt.Errorf("invalid --rotate-after %q: want a date such as 2027-01-31 or an interval such as 90d", text)
+	}
+	return env.Rotation{Every: every}.Reschedule(rotationNow()), nil
+}
+
+// rotationsFor returns the rotations to record once keys are set in file:
+// those --rotate-after asks for, or else the current ones of keys that
+// repeat, moved forward an interval from now
+func rotationsFor(ctx context.Context, file string, keys []string, rotateAfter string) ([]env.Rotation, error) {
+	var rotations []env.Rotation
+	if rotateAfter != "" {
+		r, err := parseRotateAfter(rotateAfter)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			r.Key = key
+			rotations = append(rotations, r)
+		}
+		return rotations, nil
+	}
+
+	if _, err := os.Stat(file); err != nil && !remote.IsObjectURI(file) {
+		return nil, nil
+	}
+	sections, _, err := loadFileSections(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	now := rotationNow()
+	for _, key := range keys {
+		if r, ok := sections.Rotation(envSection, key); ok && r.Every > 0 {
+			rotations = append(rotations, r.Reschedule(now))
+		}
+	}
+	return rotations, nil
+}
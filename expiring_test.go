@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateAfter(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rotationNow = func() time.Time { return now }
+	defer func() { rotationNow = time.Now }()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	readFile := func() string {
+		t.Helper()
+		content, err := os.ReadFile(envFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	set := func(rotateAfter string, args ...string) error {
+		return setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, RotateAfter: rotateAfter}, args...)
+	}
+	if err := set("90d", "API_TOKEN=one"); err != nil {
+		t.Fatalf("setCmdFn() unexpected error: %v", err)
+	}
+	if err := addCmdFn(context.Background(), addOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, RotateAfter: "2026-10-20"}, "DB_PASSWORD=two"); err != nil {
+		t.Fatalf("addCmdFn() unexpected error: %v", err)
+	}
+	content := readFile()
+	for _, want := range []string{"# envx:rotate-after API_TOKEN 2027-01-14 every 90d\n", "# envx:rotate-after DB_PASSWORD 2026-10-20\n", "PORT=8080\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("file does not contain %q:\n%s", want, content)
+		}
+	}
+	if err := set("soon", "API_TOKEN=one"); err == nil {
+		t.Error("setCmdFn() expected error for an invalid --rotate-after")
+	}
+
+	output, err := captureStdout(t, func() error {
+		return expiringCmdFn(context.Background(), expiringOpts{File: envFile, Within: "7d"})
+	})
+	if err != nil {
+		t.Fatalf("expiringCmdFn() unexpected error: %v", err)
+	}
+	if want := "DB_PASSWORD  2026-10-20  due in 4d\n"; output != want {
+		t.Errorf("expiringCmdFn() = %q, want %q", output, want)
+	}
+
+	// Setting a value that rotates on an interval moves its date forward
+	now = now.AddDate(0, 4, 0)
+	if err := set("", "API_TOKEN=rotated"); err != nil {
+		t.Fatalf("setCmdFn() unexpected error: %v", err)
+	}
+	content = readFile()
+	if !strings.Contains(content, "# envx:rotate-after API_TOKEN 2027-05-17 every 90d\n") {
+		t.Errorf("setCmdFn() did not reschedule the rotation:\n%s", content)
+	}
+
+	output, err = captureStdout(t, func() error {
+		return expiringCmdFn(context.Background(), expiringOpts{File: envFile, Within: "0d"})
+	})
+	if err != nil {
+		t.Fatalf("expiringCmdFn() unexpected error: %v", err)
+	}
+	if want := "DB_PASSWORD  2026-10-20  overdue by 119d\n"; output != want {
+		t.Errorf("expiringCmdFn() = %q, want %q", output, want)
+	}
+}
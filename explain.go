@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/vcs"
+	flag "github.com/spf13/pflag"
+)
+
+type explainOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	JSON     bool
+
+	flags *flag.FlagSet
+}
+
+// resolution is one resolved setting and where its value came from, as
+// printed by explain --json
+type resolution struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	// Source is why the value was chosen, empty when there is nothing to add
+	Source string `json:"source"`
+}
+
+// whichReport is the resolved env file, as printed by which --json
+type whichReport struct {
+	File string `json:"file"`
+}
+
+// newExplainCmd builds the "which" (file only) or "explain" (full trace) command
+func newExplainCmd(name string, full bool) *command[explainOpts] {
+	cmd := new(command[explainOpts])
+	cmd.flags = flag.NewFlagSet(name, flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the result as JSON")
+	cmd.val.flags = cmd.flags
+	if full {
+		cmd.fn = explainCmdFn
+	} else {
+		cmd.fn = whichCmdFn
+	}
+	return cmd
+}
+
+func whichCmdFn(ctx context.Context, opts explainOpts, args ...string) error {
+	file := env.BuildFilename(opts.File, opts.Name)
+	if opts.JSON {
+		return writeJSON(os.Stdout, whichReport{File: file})
+	}
+	fmt.Println(file)
+	return nil
+}
+
+func explainCmdFn(ctx context.Context, opts explainOpts, args ...string) error {
+	resolutions, err := explain(opts)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		return writeJSON(os.Stdout, resolutions)
+	}
+	printResolutions(os.Stdout, resolutions)
+	return nil
+}
+
+// explain traces how the env file, keystore and account are resolved for the
+// given options, without loading or creating a key
+func explain(opts explainOpts) ([]resolution, error) {
+	var resolutions []resolution
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	resolutions = append(resolutions, resolution{Setting: "file", Value: file, Source: fileSource(opts)})
+	resolutions = append(resolutions, resolution{Setting: "file status", Value: fileStatus(file)})
+
+	if exposure, err := vcs.CheckExposure(file); err == nil && exposure != vcs.NotInRepository {
+		resolutions = append(resolutions, resolution{Setting: "git", Value: exposure.String()})
+	}
+
+	format, source, err := defaultFormat()
+	if err != nil {
+		return nil, err
+	}
+	resolutions = append(resolutions, resolution{Setting: "format", Value: string(format), Source: source})
+
+	key, source, err := keyOverride()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		secure.Zero(key)
+		return append(resolutions, resolution{Setting: "keystore", Value: "none, raw key", Source: source}), nil
+	}
+
+	storeType, password, err := resolveKeyStoreType(opts.KeyStore, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	resolutions = append(resolutions, resolution{Setting: "keystore", Value: string(storeType), Source: keyStoreSource(opts)})
+
+	account, err := currentAccount()
+	if err != nil {
+		return nil, err
+	}
+	accountSource := "current user"
+	switch {
+	case accountOverride != "":
+		accountSource = "--account"
+	case os.Getenv("ENVX_ACCOUNT") != "":
+		accountSource = "ENVX_ACCOUNT"
+	}
+	if os.Getenv("ENVX_PROFILE") != "" {
+		accountSource += " and ENVX_PROFILE"
+	}
+	resolutions = append(resolutions, resolution{Setting: "account", Value: account, Source: accountSource})
+
+	if storeType == KeyStoreTypePassword {
+		salt := keystore.SaltFilePath(account)
+		resolutions = append(resolutions, resolution{Setting: "salt file", Value: salt, Source: fileStatus(salt)})
+
+		passwordSource := "prompt"
+		switch {
+		case password != "":
+			passwordSource = "--password"
+		case os.Getenv("ENVX_PASSWORD") != "":
+			passwordSource = "ENVX_PASSWORD"
+		}
+		resolutions = append(resolutions, resolution{Setting: "password", Value: "(hidden)", Source: passwordSource})
+	}
+	if seed, source := keySeed(); storeType == KeyStoreTypeMock && seed != "" {
+		resolutions = append(resolutions, resolution{Setting: "key seed", Value: seed, Source: source})
+	}
+
+	return resolutions, nil
+}
+
+// fileSource describes which flags produced the env file name
+func fileSource(opts explainOpts) string {
+	var sources []string
+	if opts.flags != nil && opts.flags.Changed("file") {
+		sources = append(sources, "--file "+opts.File)
+	} else {
+		sources = append(sources, "default "+opts.File)
+	}
+	if opts.Name != "" {
+		sources = append(sources, "--name "+opts.Name)
+	}
+	return strings.Join(sources, " + ")
+}
+
+// keyStoreSource describes why the keystore type was chosen
+func keyStoreSource(opts explainOpts) string {
+	switch {
+	case opts.Password == emptyPassword || opts.Password != "":
+		return "implied by --password"
+	case os.Getenv("ENVX_PASSWORD") != "":
+		return "implied by ENVX_PASSWORD"
+	case opts.KeyStore == "" && hasKeySeed():
+		_, source := keySeed()
+		return "implied by " + source
+	case opts.KeyStore == "" && hasCredential():
+		return "implied by CREDENTIALS_DIRECTORY"
+	case opts.KeyStore != "":
+		return chainSource("--keystore", opts.KeyStore)
+	case os.Getenv("ENVX_KEYSTORE") != "":
+		return chainSource("ENVX_KEYSTORE", os.Getenv("ENVX_KEYSTORE"))
+	default:
+		return "default"
+	}
+}
+
+// chainSource names the setting a keystore came from, along with the list
+// it was picked from when it is a fallback list
+func chainSource(setting, value string) string {
+	if strings.Contains(value, ",") {
+		return "first available of " + setting + " " + value
+	}
+	return setting
+}
+
+// hasKeySeed reports whether the mock keystore key is derived from a seed
+func hasKeySeed() bool {
+	seed, _ := keySeed()
+	return seed != ""
+}
+
+// hasCredential reports whether systemd passed envx its key credential
+func hasCredential() bool {
+	_, ok := keystore.CredentialFromEnv()
+	return ok
+}
+
+// fileStatus summarizes whether a file exists and if its permissions are safe
+func fileStatus(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return err.Error()
+	}
+	status := fmt.Sprintf("exists, mode %04o", info.Mode().Perm())
+	if err := env.CheckPermissions(path); errors.Is(err, env.ErrInsecurePermissions) {
+		status += " (accessible by group or others)"
+	}
+	return status
+}
+
+// printResolutions writes resolutions as aligned "setting: value (source)" lines
+func printResolutions(w io.Writer, resolutions []resolution) {
+	width := 0
+	for _, r := range resolutions {
+		width = max(width, len(r.Setting))
+	}
+	for _, r := range resolutions {
+		line := fmt.Sprintf("%-*s  %s", width+1, r.Setting+":", r.Value)
+		if r.Source != "" {
+			line += " (" + r.Source + ")"
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestExplain(t *testing.T) {
+	t.Setenv("ENVX_PASSWORD", "")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".env")
+	if err := os.WriteFile(file+".prod", []byte("A=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newExplainCmd("explain", true)
+	if err := cmd.flags.Parse([]string{"-f", file, "-n", "prod", "-P"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resolutions, err := explain(cmd.val)
+	if err != nil {
+		t.Fatalf("explain() unexpected error: %v", err)
+	}
+
+	got := make(map[string]resolution, len(resolutions))
+	for _, r := range resolutions {
+		got[r.Setting] = r
+	}
+
+	if r := got["file"]; r.Value != file+".prod" || r.Source != "--file "+file+" + --name prod" {
+		t.Errorf("file resolution = %+v", r)
+	}
+	if r := got["file status"]; r.Value != "exists, mode 0644 (accessible by group or others)" {
+		t.Errorf("file status resolution = %+v", r)
+	}
+	if r := got["keystore"]; r.Value != string(KeyStoreTypePassword) || r.Source != "implied by --password" {
+		t.Errorf("keystore resolution = %+v", r)
+	}
+	if r := got["password"]; r.Source != "prompt" {
+		t.Errorf("password resolution = %+v", r)
+	}
+}
+
+func TestKeyStoreSource(t *testing.T) {
+	t.Setenv("ENVX_PASSWORD", "")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.StringP("keystore", "k", "", "")
+
+	if got := keyStoreSource(explainOpts{flags: flags}); got != "default" {
+		t.Errorf("keyStoreSource() = %q, want default", got)
+	}
+	t.Setenv("ENVX_KEYSTORE", "tpm,password")
+	if got := keyStoreSource(explainOpts{flags: flags}); got != "first available of ENVX_KEYSTORE tpm,password" {
+		t.Errorf("keyStoreSource() = %q, want ENVX_KEYSTORE", got)
+	}
+	if got := keyStoreSource(explainOpts{KeyStore: "macos", flags: flags}); got != "--keystore" {
+		t.Errorf("keyStoreSource() with an explicit macos keystore = %q, want --keystore", got)
+	}
+	if err := flags.Parse([]string{"-k", "mock"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := keyStoreSource(explainOpts{KeyStore: "mock", flags: flags}); got != "--keystore" {
+		t.Errorf("keyStoreSource() = %q, want --keystore", got)
+	}
+
+	t.Setenv("ENVX_PASSWORD", "secret")
+	if got := keyStoreSource(explainOpts{KeyStore: "mock", flags: flags}); got != "implied by ENVX_PASSWORD" {
+		t.Errorf("keyStoreSource() = %q, want implied by ENVX_PASSWORD", got)
+	}
+}
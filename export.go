@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type exportOpts struct {
+	Name       string
+	File       string
+	KeyStore   string
+	Password   string
+	Format     string
+	ValuesKey  string
+	SecretName string
+	Shell      string
+	TableOpts  *tableOpts
+
+	IgnoreDecryptErrors bool
+}
+
+// exportFormats are the formats the export command can print
+var exportFormats = []Format{FormatEnv, FormatJSON, env.FormatHelm, env.FormatKustomize, env.FormatProperties, env.FormatINI, FormatCSV, FormatTSV}
+
+// newExportCmd builds the "export" command, which prints decrypted variables
+// in a format other tools consume, such as Kubernetes templating pipelines
+func newExportCmd() *command[exportOpts] {
+	cmd := new(command[exportOpts])
+	cmd.flags = flag.NewFlagSet("export", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.StringVarP(&cmd.val.Format, "fmt", "F", string(FormatEnv), "Format of the output. Supported formats: env, json, helm, kustomize, properties, ini, csv, tsv")
+	cmd.flags.StringVarP(&cmd.val.Shell, "shell", "s", "", "Prints statements setting the variables in this shell: "+strings.Join(env.ShellDialects, ", "))
+	cmd.val.TableOpts = NewTableOpts(cmd.flags)
+	cmd.flags.StringVar(&cmd.val.ValuesKey, "values-key", "", "Nests Helm values under this dot separated key, e.g. secrets.env")
+	cmd.flags.StringVar(&cmd.val.SecretName, "secret-name", env.DefaultSecretName, "Name of the Kustomize secretGenerator entry")
+	cmd.flags.BoolVar(&cmd.val.IgnoreDecryptErrors, "ignore-decrypt-errors", false, "Skips variables that cannot be decrypted, with a warning, instead of failing")
+	cmd.fn = exportCmdFn
+	return cmd
+}
+
+func exportCmdFn(ctx context.Context, opts exportOpts, args ...string) error {
+	format := Format(opts.Format)
+	if opts.Shell != "" && format != FormatEnv {
+		return fmt.Errorf("cannot use both --shell and --fmt %s", format)
+	}
+	if _, err := env.RenderShell(nil, opts.Shell); opts.Shell != "" && err != nil {
+		return err
+	}
+	if !slices.Contains(exportFormats, format) {
+		return fmt.Errorf("unsupported format: %s (supported: env, json, helm, kustomize, properties, ini, csv, tsv)", format)
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading env file: %w", err)
+	}
+
+	// Only the requested values are decrypted, in the order given
+	if vars, err = selectVars(vars, args, file); err != nil {
+		return err
+	}
+
+	// Whether a value is encrypted is known only before decrypting it
+	table, err := opts.TableOpts.Options(format, slices.Clone(vars))
+	if err != nil {
+		return err
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	err = vars.DecryptAll(ctx, newEncryptor(ctx), key)
+	if err != nil && opts.IgnoreDecryptErrors {
+		vars, err = skipUndecryptable(vars, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	if err := auditAccess("export", file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+		return err
+	}
+
+	if opts.Shell != "" {
+		content, err := env.RenderShell(vars, opts.Shell)
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+		return nil
+	}
+
+	switch format {
+	case env.FormatHelm:
+		fmt.Print(env.RenderHelmValues(vars, opts.ValuesKey))
+	case env.FormatKustomize:
+		fmt.Print(env.RenderKustomizeSecret(vars, opts.SecretName))
+	case env.FormatINI:
+		// The selected --env section becomes the INI section
+		content, err := env.RenderINI(vars, envSection)
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+	case FormatCSV, FormatTSV:
+		return printTable(vars, format, table)
+	default:
+		return printVars(vars, format)
+	}
+	return nil
+}
+
+// selectVars returns the variables with the given keys in that order, or all
+// of them when no keys are given
+func selectVars(vars env.Variables, keys []string, file string) (env.Variables, error) {
+	if len(keys) == 0 {
+		return vars, nil
+	}
+	selected := make(env.Variables, 0, len(keys))
+	for _, key := range keys {
+		v := vars.Get(key)
+		if v == nil {
+			return nil, fmt.Errorf("variable %s not found in %s file", key, file)
+		}
+		selected = append(selected, *v)
+	}
+	return selected, nil
+}
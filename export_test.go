@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestExportCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "s3cret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_KEY="+secret+"\nPORT=8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    exportOpts
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "env",
+			opts: exportOpts{Format: "env"},
+			want: "API_KEY=s3cret\nPORT=8080\n",
+		},
+		{
+			name: "helm nested",
+			opts: exportOpts{Format: "helm", ValuesKey: "app.env"},
+			want: "app:\n  env:\n    API_KEY: \"s3cret\"\n    PORT: \"8080\"\n",
+		},
+		{
+			name: "kustomize selected variables",
+			opts: exportOpts{Format: "kustomize", SecretName: "api"},
+			args: []string{"PORT", "API_KEY"},
+			want: "secretGenerator:\n- name: \"api\"\n  literals:\n  - \"PORT=8080\"\n  - \"API_KEY=s3cret\"\n",
+		},
+		{
+			name: "properties",
+			opts: exportOpts{Format: "properties"},
+			want: "API_KEY=s3cret\nPORT=8080\n",
+		},
+		{
+			name: "ini",
+			opts: exportOpts{Format: "ini"},
+			args: []string{"PORT"},
+			want: "PORT = 8080\n",
+		},
+		{
+			name: "powershell",
+			opts: exportOpts{Format: "env", Shell: "powershell"},
+			args: []string{"API_KEY"},
+			want: "$env:API_KEY = \"s3cret\"\n",
+		},
+		{
+			name: "csv with header and encryption state",
+			opts: exportOpts{Format: "csv", TableOpts: &tableOpts{header: true, encrypted: true}},
+			want: "key,value,encrypted\nAPI_KEY,s3cret,true\nPORT,8080,false\n",
+		},
+		{
+			name: "tsv",
+			opts: exportOpts{Format: "tsv"},
+			args: []string{"PORT"},
+			want: "PORT\t8080\n",
+		},
+		{name: "header without a table format", opts: exportOpts{Format: "json", TableOpts: &tableOpts{header: true}}, wantErr: true},
+		{name: "shell with another format", opts: exportOpts{Format: "json", Shell: "fish"}, wantErr: true},
+		{name: "unknown variable", opts: exportOpts{Format: "helm"}, args: []string{"MISSING"}, wantErr: true},
+		{name: "unsupported format", opts: exportOpts{Format: "yaml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.File = envFile
+			tt.opts.KeyStore = "mock"
+			output, err := captureStdout(t, func() error {
+				return exportCmdFn(context.Background(), tt.opts, tt.args...)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exportCmdFn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && output != tt.want {
+				t.Errorf("exportCmdFn() output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
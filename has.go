@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type hasOpts struct {
+	Name        string
+	File        string
+	KeyStore    string
+	Password    string
+	Encrypted   bool
+	Decryptable bool
+}
+
+func newHasCmd() *command[hasOpts] {
+	cmd := new(command[hasOpts])
+	cmd.flags = flag.NewFlagSet("has", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVar(&cmd.val.Encrypted, "encrypted", false, "Also requires the values to be encrypted")
+	cmd.flags.BoolVar(&cmd.val.Decryptable, "decryptable", false, "Also requires the values to decrypt with the key")
+	cmd.fn = hasCmdFn
+	return cmd
+}
+
+// hasCmdFn prints nothing and exits with status 0 when the env file has all
+// the variables, or missingExitCode when any is missing or fails the
+// --encrypted or --decryptable checks. Other failures exit with status 1
+// and a message. The key is only loaded for --decryptable or when the file
+// hides names.
+func hasCmdFn(ctx context.Context, opts hasOpts, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: envx has <key>...")
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	index := env.NewIndex(vars)
+
+	var key []byte
+	if opts.Decryptable || slices.ContainsFunc(vars, func(v env.Variable) bool { return crypto.IsNameToken(v.Key) }) {
+		if key, err = loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password); err != nil {
+			return fmt.Errorf("error loading key: %w", err)
+		}
+		defer secure.Zero(key)
+	}
+
+	encryptor := selectedEncryptor(ctx)
+	missing := &exitError{code: missingExitCode}
+	for _, name := range args {
+		v := index.Get(name)
+		if v == nil && key != nil {
+			v = index.Get(crypto.NameToken(name, key))
+		}
+		if v == nil || (opts.Encrypted && !encryptor.IsEncrypted(v.Value)) {
+			return missing
+		}
+		if opts.Decryptable {
+			if _, err := encryptor.Decrypt(ctx, v.Value, key); err != nil {
+				return missing
+			}
+		}
+	}
+	return nil
+}
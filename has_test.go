@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestHas(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "secret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := make([]byte, crypto.KeySize)
+	foreign, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "secret", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "API_KEY=" + encrypted + "\nPORT=8080\nOLD_TOKEN=" + foreign + "\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  hasOpts
+		keys  []string
+		found bool
+	}{
+		{"all present", hasOpts{}, []string{"API_KEY", "PORT"}, true},
+		{"one missing", hasOpts{}, []string{"API_KEY", "MISSING"}, false},
+		{"encrypted", hasOpts{Encrypted: true}, []string{"API_KEY"}, true},
+		{"plaintext", hasOpts{Encrypted: true}, []string{"PORT"}, false},
+		{"decryptable", hasOpts{Decryptable: true}, []string{"API_KEY", "PORT"}, true},
+		{"other key", hasOpts{Decryptable: true}, []string{"OLD_TOKEN"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.File, tt.opts.KeyStore = envFile, "mock"
+			output, err := captureStdout(t, func() error { return hasCmdFn(context.Background(), tt.opts, tt.keys...) })
+			if output != "" {
+				t.Errorf("hasCmdFn() printed %q", output)
+			}
+			var exitErr *exitError
+			switch {
+			case tt.found && err != nil:
+				t.Errorf("hasCmdFn(%v) error = %v, want none", tt.keys, err)
+			case !tt.found && (!errors.As(err, &exitErr) || exitErr.code != missingExitCode || exitErr.err != nil):
+				t.Errorf("hasCmdFn(%v) error = %v, want silent exit status %d", tt.keys, err, missingExitCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// placeholder matches {{VAR}} and ${VAR}, allowing spaces inside the braces
+// of the former
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateArgs replaces {{VAR}} and ${VAR} placeholders in args with the
+// values of vars. It returns the new arguments and the keys that were used;
+// a placeholder naming a variable not in vars is an error.
+func interpolateArgs(args []string, vars env.Variables) ([]string, map[string]bool, error) {
+	index := env.NewIndex(vars)
+	used := make(map[string]bool)
+	var unknown []string
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = placeholder.ReplaceAllStringFunc(arg, func(match string) string {
+			groups := placeholder.FindStringSubmatch(match)
+			key := groups[1] + groups[2]
+			v := index.Get(key)
+			if v == nil {
+				unknown = append(unknown, key)
+				return match
+			}
+			used[key] = true
+			return v.Value
+		})
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown variables in arguments: %s", strings.Join(unknown, ", "))
+	}
+	return out, used, nil
+}
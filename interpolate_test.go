@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+func TestInterpolateArgs(t *testing.T) {
+	vars := env.Variables{{Key: "API_TOKEN", Value: "s3cret"}, {Key: "HOST", Value: "example.com"}}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		wantUsed []string
+		wantErr  string
+	}{
+		{
+			name:     "both forms",
+			args:     []string{"-H", "Authorization: Bearer {{API_TOKEN}}", "https://${HOST}/v1"},
+			want:     []string{"-H", "Authorization: Bearer s3cret", "https://example.com/v1"},
+			wantUsed: []string{"API_TOKEN", "HOST"},
+		},
+		{
+			name:     "spaces inside braces",
+			args:     []string{"{{ HOST }}:{{HOST}}"},
+			want:     []string{"example.com:example.com"},
+			wantUsed: []string{"HOST"},
+		},
+		{
+			name: "no placeholders",
+			args: []string{"$HOST", "{HOST}", "${1}", "{{ }}"},
+			want: []string{"$HOST", "{HOST}", "${1}", "{{ }}"},
+		},
+		{
+			name:    "unknown variables",
+			args:    []string{"{{MISSING}}", "${ALSO_MISSING}"},
+			wantErr: "MISSING, ALSO_MISSING",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, used, err := interpolateArgs(tt.args, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("interpolateArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolateArgs() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("interpolateArgs() = %q, want %q", got, tt.want)
+			}
+			if len(used) != len(tt.wantUsed) {
+				t.Errorf("interpolateArgs() used = %v, want %v", used, tt.wantUsed)
+			}
+			for _, key := range tt.wantUsed {
+				if !used[key] {
+					t.Errorf("interpolateArgs() did not report %s as used", key)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Interpolate(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_TOKEN=s3cret\nREGION=eu\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("API_TOKEN", "")
+	t.Setenv("REGION", "")
+
+	original := execProcess
+	defer func() { execProcess = original }()
+	var gotArgs []string
+	var token, region string
+	execProcess = func(_ string, args []string, _ []string) error {
+		gotArgs = args
+		token, region = os.Getenv("API_TOKEN"), os.Getenv("REGION")
+		return nil
+	}
+
+	err := run(context.Background(), runOpts{File: envFile, KeyStore: "mock", Interpolate: true}, "true", "--token={{API_TOKEN}}")
+	if err != nil {
+		t.Fatalf("run() unexpected error: %v", err)
+	}
+	if want := []string{"true", "--token=s3cret"}; !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("program args = %q, want %q", gotArgs, want)
+	}
+	if token != "" || region != "eu" {
+		t.Errorf("environment API_TOKEN = %q, REGION = %q; want only REGION exported", token, region)
+	}
+
+	// Without opting in, arguments are passed as is
+	err = run(context.Background(), runOpts{File: envFile, KeyStore: "mock"}, "true", "--token={{API_TOKEN}}")
+	if err != nil {
+		t.Fatalf("run() unexpected error: %v", err)
+	}
+	if gotArgs[1] != "--token={{API_TOKEN}}" {
+		t.Errorf("program args = %q, want placeholders untouched", gotArgs)
+	}
+}
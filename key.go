@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/paper"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/shamir"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+const fingerprintComment = "# key fingerprint: "
+
+type keySplitOpts struct {
+	KeyStore  string
+	Password  string
+	Shares    int
+	Threshold int
+	Dir       string
+}
+
+type keyExportOpts struct {
+	KeyStore string
+	Password string
+	Paper    bool
+	QR       bool
+}
+
+type keyListOpts struct {
+	KeyStore string
+	JSON     bool
+}
+
+type keyRecoverOpts struct {
+	KeyStore string
+	Password string
+	Print    bool
+	Force    bool
+	Paper    bool
+}
+
+// newKeyGroup builds the "key" command and its subcommands
+func newKeyGroup() *group {
+	cmds := make(map[string]executor)
+
+	splitCmd := new(command[keySplitOpts])
+	splitCmd.flags = flag.NewFlagSet("split", flag.ExitOnError)
+	splitCmd.flags.StringVarP(&splitCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	splitCmd.flags.StringVarP(&splitCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	splitCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	splitCmd.flags.IntVar(&splitCmd.val.Shares, "shares", 5, "Number of shares to produce")
+	splitCmd.flags.IntVar(&splitCmd.val.Threshold, "threshold", 3, "Number of shares required to recover the key")
+	splitCmd.flags.StringVarP(&splitCmd.val.Dir, "dir", "d", ".", "Directory to write the share files to")
+	splitCmd.fn = keySplitCmdFn
+	cmds[splitCmd.flags.Name()] = splitCmd
+
+	recoverCmd := new(command[keyRecoverOpts])
+	recoverCmd.flags = flag.NewFlagSet("recover", flag.ExitOnError)
+	recoverCmd.flags.StringVarP(&recoverCmd.val.KeyStore, "keystore", "k", "", "Keystore type to store the recovered key in (macos, tpm, yubikey, mock; default macos)")
+	recoverCmd.flags.BoolVarP(&recoverCmd.val.Print, "print", "p", false, "Prints the recovered key as hex instead of storing it")
+	recoverCmd.flags.BoolVar(&recoverCmd.val.Force, "force", false, "Replaces an existing, different key in the keystore")
+	recoverCmd.flags.BoolVar(&recoverCmd.val.Paper, "paper", false, "Recovers the key from a paper backup typed in line by line")
+	recoverCmd.fn = keyRecoverCmdFn
+	cmds[recoverCmd.flags.Name()] = recoverCmd
+
+	exportCmd := new(command[keyExportOpts])
+	exportCmd.flags = flag.NewFlagSet("export", flag.ExitOnError)
+	exportCmd.flags.StringVarP(&exportCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, tpm, yubikey, mock; default macos)")
+	exportCmd.flags.StringVarP(&exportCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	exportCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	exportCmd.flags.BoolVar(&exportCmd.val.Paper, "paper", false, "Prints the key as checksummed lines for a paper backup instead of hex")
+	exportCmd.flags.BoolVar(&exportCmd.val.QR, "qr", false, "Prints the key as hex in a QR code in the terminal")
+	exportCmd.fn = keyExportCmdFn
+	cmds[exportCmd.flags.Name()] = exportCmd
+
+	listCmd := new(command[keyListOpts])
+	listCmd.flags = flag.NewFlagSet("list", flag.ExitOnError)
+	listCmd.flags.StringVarP(&listCmd.val.KeyStore, "keystore", "k", "", "Keystore type to list (macos, password, tpm, yubikey, mock; default macos)")
+	listCmd.flags.BoolVar(&listCmd.val.JSON, "json", false, "Prints the keys as a JSON array")
+	listCmd.fn = keyListCmdFn
+	cmds[listCmd.flags.Name()] = listCmd
+
+	ephemeralCmd := new(command[struct{}])
+	ephemeralCmd.flags = flag.NewFlagSet("ephemeral", flag.ExitOnError)
+	ephemeralCmd.fn = keyEphemeralCmdFn
+	cmds[ephemeralCmd.flags.Name()] = ephemeralCmd
+
+	return &group{name: "key", cmds: cmds}
+}
+
+// keyEphemeralCmdFn prints a new random key as hex without storing it, for
+// use with --key or ENVX_KEY
+func keyEphemeralCmdFn(ctx context.Context, _ struct{}, args ...string) error {
+	key := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate random key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	fmt.Println(hex.EncodeToString(key))
+	diagf("Notice: ephemeral key %s is not stored anywhere; keep it to decrypt what is encrypted with it\n", crypto.Fingerprint(key))
+	return nil
+}
+
+func keySplitCmdFn(ctx context.Context, opts keySplitOpts, args ...string) error {
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	shares, err := shamir.Split(key, opts.Shares, opts.Threshold)
+	if err != nil {
+		return fmt.Errorf("error splitting key: %w", err)
+	}
+
+	fingerprint := crypto.Fingerprint(key)
+	paths := make([]string, len(shares))
+	for i := range shares {
+		paths[i] = filepath.Join(opts.Dir, fmt.Sprintf("envx-key-share-%d-of-%d.txt", i+1, len(shares)))
+		if _, err := os.Stat(paths[i]); err == nil {
+			return fmt.Errorf("refusing to overwrite existing share file %s", paths[i])
+		}
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return fmt.Errorf("error creating %s: %w", opts.Dir, err)
+	}
+
+	for i, share := range shares {
+		content := fmt.Sprintf("# envx key share %d of %d; any %d shares recover the key\n%s%s\n%s\n",
+			i+1, len(shares), opts.Threshold, fingerprintComment, fingerprint, share)
+		if err := os.WriteFile(paths[i], []byte(content), env.SecureFileMode); err != nil {
+			return fmt.Errorf("error writing share file %s: %w", paths[i], err)
+		}
+		fmt.Println(paths[i])
+	}
+	return nil
+}
+
+func keyListCmdFn(ctx context.Context, opts keyListOpts, args ...string) error {
+	storeType, password, err := resolveKeyStoreType(opts.KeyStore, "")
+	if err != nil {
+		return err
+	}
+	user, err := keyOwner()
+	if err != nil {
+		return err
+	}
+	account, err := currentAccount()
+	if err != nil {
+		return err
+	}
+	store, err := newKeyStore(storeType, password, account)
+	if err != nil {
+		return err
+	}
+	accounts, err := keystore.Accounts(store)
+	if err != nil {
+		return fmt.Errorf("error listing %s keystore: %w", storeType, err)
+	}
+	keys := keyAccounts(accounts, user, account)
+	if opts.JSON {
+		return writeJSON(os.Stdout, keys)
+	}
+	return printKeyAccounts(os.Stdout, keys)
+}
+
+// keyAccount is a key held in the keystore, as printed by key list --json
+type keyAccount struct {
+	Account string `json:"account"`
+	// Profile is the key profile of an account of the current user, "" for
+	// the default key
+	Profile string `json:"profile"`
+	// Own is set for accounts of the current user
+	Own bool `json:"own"`
+	// Signing is set for signing identities rather than encryption keys
+	Signing bool `json:"signing"`
+	// Selected marks the account envx uses in the current environment
+	Selected bool `json:"selected"`
+}
+
+// keyAccounts describes accounts, grouping those of user by profile ahead of
+// the accounts of other users. Other users' accounts are not split into user
+// and profile since user names may contain dots.
+func keyAccounts(accounts []string, user, selected string) []keyAccount {
+	keys := make([]keyAccount, 0, len(accounts))
+	for _, account := range accounts {
+		key := keyAccount{Account: account, Selected: account == selected || account == signingAccount(selected)}
+		name, signing := strings.CutSuffix(account, "."+signingSuffix)
+		key.Signing = signing
+		if name == user {
+			key.Own = true
+		} else if profile, ok := strings.CutPrefix(name, user+"."); ok && profileName.MatchString(profile) {
+			key.Own, key.Profile = true, profile
+		}
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Own != b.Own {
+			return a.Own
+		}
+		if a.Profile != b.Profile {
+			return a.Profile < b.Profile
+		}
+		return a.Account < b.Account
+	})
+	return keys
+}
+
+// printKeyAccounts writes keys as an aligned table. The accounts in use are
+// marked with "*".
+func printKeyAccounts(w io.Writer, keys []keyAccount) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "\tPROFILE\tKIND\tACCOUNT")
+	for _, key := range keys {
+		marker := ""
+		if key.Selected {
+			marker = "*"
+		}
+		profile := key.Profile
+		switch {
+		case !key.Own:
+			profile = "(other user)"
+		case profile == "":
+			profile = "(default)"
+		}
+		kind := "key"
+		if key.Signing {
+			kind = "signing"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", marker, profile, kind, key.Account)
+	}
+	return tw.Flush()
+}
+
+// keyExportCmdFn prints the key for an offline backup, as hex, as a QR code
+// of the hex or as a paper backup that `key recover --paper` reads back
+func keyExportCmdFn(ctx context.Context, opts keyExportOpts, args ...string) error {
+	if opts.Paper && opts.QR {
+		return fmt.Errorf("--paper and --qr cannot be used together")
+	}
+	if !stdoutIsTerminal() && !assumeYes {
+		return fmt.Errorf("refusing to print the key when stdout is not a terminal; use --yes to override")
+	}
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	if opts.QR {
+		encoded := make([]byte, hex.EncodedLen(len(key)))
+		hex.Encode(encoded, key)
+		defer secure.Zero(encoded)
+		return writeQR(encoded, "the key")
+	}
+	if !opts.Paper {
+		return writeKeyHex(key)
+	}
+
+	account, err := currentAccount()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# envx paper key backup for %s; restore with envx key recover --paper\n", account)
+	fmt.Printf("%s%s\n", fingerprintComment, crypto.Fingerprint(key))
+	for _, line := range paper.Encode(key) {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func keyRecoverCmdFn(ctx context.Context, opts keyRecoverOpts, args ...string) error {
+	if opts.Paper {
+		if len(args) > 0 {
+			return fmt.Errorf("--paper reads the backup from stdin and takes no share files")
+		}
+		key, err := readPaperKey(stdin, os.Stderr, term.IsTerminal(int(os.Stdin.Fd())))
+		if err != nil {
+			return err
+		}
+		defer secure.Zero(key)
+		return recoveredKey(key, opts)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing share files")
+	}
+
+	var shares []shamir.Share
+	fingerprint := ""
+	for _, path := range args {
+		share, fp, err := readShareFile(path)
+		if err != nil {
+			return err
+		}
+		if fp != "" {
+			if fingerprint != "" && fp != fingerprint {
+				return fmt.Errorf("share %s belongs to a different key (fingerprint %s, expected %s)", path, fp, fingerprint)
+			}
+			fingerprint = fp
+		}
+		shares = append(shares, share)
+	}
+
+	combined, err := shamir.Combine(shares)
+	if err != nil {
+		return fmt.Errorf("error recovering key: %w", err)
+	}
+	buf := secure.Copy(combined)
+	defer buf.Destroy()
+	key := buf.Bytes()
+	if len(key) != crypto.KeySize {
+		return fmt.Errorf("recovered key has invalid size: expected %d bytes, got %d", crypto.KeySize, len(key))
+	}
+	if fingerprint != "" && crypto.Fingerprint(key) != fingerprint {
+		return fmt.Errorf("recovered key does not match fingerprint %s; the shares are corrupt or incompatible", fingerprint)
+	}
+	return recoveredKey(key, opts)
+}
+
+// recoveredKey prints or stores a recovered key as opts ask
+func recoveredKey(key []byte, opts keyRecoverOpts) error {
+	if opts.Print {
+		return writeKeyHex(key)
+	}
+
+	storeType, err := storeKey(opts.KeyStore, key, opts.Force)
+	if err != nil {
+		return fmt.Errorf("error storing recovered key: %w", err)
+	}
+
+	diagf("Recovered key %s into the %s keystore\n", crypto.Fingerprint(key), storeType)
+	return nil
+}
+
+// writeKeyHex prints key as hex to stdout
+func writeKeyHex(key []byte) error {
+	// Encode directly rather than through fmt, which keeps its own buffers
+	out := make([]byte, hex.EncodedLen(len(key))+1)
+	hex.Encode(out, key)
+	out[len(out)-1] = '\n'
+	defer secure.Zero(out)
+	_, err := os.Stdout.Write(out)
+	return err
+}
+
+// readPaperKey reads the lines of a paper backup from r. When interactive,
+// it prompts for each line on w and asks again for a line with a typo
+// instead of failing.
+func readPaperKey(r io.Reader, w io.Writer, interactive bool) ([]byte, error) {
+	lines := paper.Lines(crypto.KeySize)
+	if interactive {
+		fmt.Fprintf(w, "Type the %d lines of the paper backup; the line numbers are optional.\n", lines)
+	}
+
+	scanner := bufio.NewScanner(r)
+	var data strings.Builder
+	fingerprint := ""
+	for n := 1; n <= lines; {
+		if interactive {
+			fmt.Fprintf(w, "Line %d of %d: ", n, lines)
+		}
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("error reading paper backup: %w", err)
+			}
+			return nil, fmt.Errorf("paper backup ended after %d of %d lines", n-1, lines)
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, fingerprintComment) {
+			fingerprint = strings.TrimSpace(strings.TrimPrefix(line, fingerprintComment))
+			continue
+		}
+		if !interactive && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+		chunk, err := paper.ParseLine(n, line)
+		if err != nil {
+			if !interactive {
+				return nil, err
+			}
+			fmt.Fprintf(w, "%v\n", err)
+			continue
+		}
+		data.WriteString(chunk)
+		n++
+	}
+
+	key, err := paper.Join(data.String())
+	if err != nil {
+		return nil, fmt.Errorf("error recovering key: %w", err)
+	}
+	if len(key) != crypto.KeySize {
+		return nil, fmt.Errorf("recovered key has invalid size: expected %d bytes, got %d", crypto.KeySize, len(key))
+	}
+	if fingerprint != "" && crypto.Fingerprint(key) != fingerprint {
+		return nil, fmt.Errorf("recovered key does not match fingerprint %s", fingerprint)
+	}
+	return key, nil
+}
+
+// storeKey saves key for the current account in the given keystore. An
+// existing, different key is only replaced when force is set.
+func storeKey(storeTypeStr string, key []byte, force bool) (KeyStoreType, error) {
+	storeType, password, err := resolveKeyStoreType(storeTypeStr, "")
+	if err != nil {
+		return "", err
+	}
+	account, err := currentAccount()
+	if err != nil {
+		return "", err
+	}
+	store, err := newKeyStore(storeType, password, account)
+	if err != nil {
+		return "", err
+	}
+
+	if existing, err := store.GetKey(account); err == nil && !bytes.Equal(existing, key) && !force {
+		return "", fmt.Errorf("keystore already holds a different key (fingerprint %s); use --force to replace it", crypto.Fingerprint(existing))
+	}
+	if err := store.SetKey(account, key); err != nil {
+		return "", err
+	}
+	return storeType, nil
+}
+
+// readShareFile reads a share and the optional key fingerprint from a share file
+func readShareFile(path string) (shamir.Share, string, error) {
+	file, err := os.Open(path) // #nosec G304 -- User-provided share file path is intentional
+	if err != nil {
+		return shamir.Share{}, "", fmt.Errorf("error opening share file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	fingerprint := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, fingerprintComment) {
+			fingerprint = strings.TrimSpace(strings.TrimPrefix(line, fingerprintComment))
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		share, err := shamir.ParseShare(line)
+		if err != nil {
+			return shamir.Share{}, "", fmt.Errorf("error parsing share file %s: %w", path, err)
+		}
+		return share, fingerprint, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return shamir.Share{}, "", fmt.Errorf("error reading share file %s: %w", path, err)
+	}
+	return shamir.Share{}, "", fmt.Errorf("no share found in %s", path)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/keystore"
+)
+
+func TestKeySplitRecover(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	original, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	splitOpts := keySplitOpts{KeyStore: "mock", Shares: 3, Threshold: 2, Dir: dir}
+	if err := keySplitCmdFn(context.Background(), splitOpts); err != nil {
+		t.Fatalf("keySplitCmdFn() unexpected error: %v", err)
+	}
+
+	shares, err := filepath.Glob(filepath.Join(dir, "envx-key-share-*-of-3.txt"))
+	if err != nil || len(shares) != 3 {
+		t.Fatalf("keySplitCmdFn() wrote %d share files, want 3 (err: %v)", len(shares), err)
+	}
+
+	// Splitting again must not overwrite existing shares
+	if err := keySplitCmdFn(context.Background(), splitOpts); err == nil {
+		t.Error("keySplitCmdFn() expected error when share files already exist")
+	}
+
+	// Recover into an empty keystore, as on a replacement machine
+	testKeystore = keystore.NewMockKeyStore()
+	if err := keyRecoverCmdFn(context.Background(), keyRecoverOpts{KeyStore: "mock"}, shares[0], shares[2]); err != nil {
+		t.Fatalf("keyRecoverCmdFn() unexpected error: %v", err)
+	}
+	recovered, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, original) {
+		t.Error("keyRecoverCmdFn() stored a different key than the one that was split")
+	}
+
+	if err := keyRecoverCmdFn(context.Background(), keyRecoverOpts{KeyStore: "mock"}, shares[1]); err == nil {
+		t.Error("keyRecoverCmdFn() expected error with fewer shares than the threshold")
+	}
+
+	// A keystore holding another key is only replaced with --force
+	testKeystore = keystore.NewMockKeyStore()
+	if _, err := loadKeyWithType(KeyStoreTypeMock); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyRecoverCmdFn(context.Background(), keyRecoverOpts{KeyStore: "mock"}, shares[0], shares[1]); err == nil {
+		t.Error("keyRecoverCmdFn() expected error when replacing a different key without --force")
+	}
+	if err := keyRecoverCmdFn(context.Background(), keyRecoverOpts{KeyStore: "mock", Force: true}, shares[0], shares[1]); err != nil {
+		t.Errorf("keyRecoverCmdFn() --force unexpected error: %v", err)
+	}
+}
+
+func TestReadShareFile_FingerprintMismatch(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	dir := t.TempDir()
+	if err := keySplitCmdFn(context.Background(), keySplitOpts{KeyStore: "mock", Shares: 2, Threshold: 2, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	share := filepath.Join(dir, "envx-key-share-1-of-2.txt")
+	content, err := os.ReadFile(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(content, []byte(fingerprintComment), []byte(fingerprintComment+"00"), 1)
+	if err := os.WriteFile(share, tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = keyRecoverCmdFn(context.Background(), keyRecoverOpts{Print: true}, share, filepath.Join(dir, "envx-key-share-2-of-2.txt"))
+	if err == nil {
+		t.Error("keyRecoverCmdFn() expected error for shares with mismatched fingerprints")
+	}
+}
+
+func TestKeyProfiles(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	user, err := currentUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ENVX_PROFILE", "")
+	defaultKey, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_PROFILE", "api")
+	apiKey, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(defaultKey, apiKey) {
+		t.Error("profile api shares the default key")
+	}
+	if account, _ := currentAccount(); account != user+".api" {
+		t.Errorf("currentAccount() = %q, want %q", account, user+".api")
+	}
+	if err := testKeystore.SetKey("someone.else", apiKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	accounts, err := keystore.Accounts(testKeystore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := printKeyAccounts(&out, keyAccounts(accounts, user, user+".api")); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := [][]string{
+		{"PROFILE", "KIND", "ACCOUNT"},
+		{"(default)", "key", user},
+		{"*", "api", "key", user + ".api"},
+		{"(other user)", "key", "someone.else"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("key list printed %q", out.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want fields %q", i, line, want[i])
+		}
+	}
+
+	for _, invalid := range []string{"a.b", "signing", "has space"} {
+		t.Setenv("ENVX_PROFILE", invalid)
+		if _, err := currentAccount(); err == nil {
+			t.Errorf("ENVX_PROFILE=%q expected error", invalid)
+		}
+	}
+}
+
+func TestKeyAccount(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	t.Setenv("ENVX_PROFILE", "")
+
+	ownKey, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_ACCOUNT", "deploy")
+	sharedKey, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ownKey, sharedKey) {
+		t.Error("ENVX_ACCOUNT shares the user's key")
+	}
+	stored, err := testKeystore.GetKey("deploy")
+	if err != nil || !bytes.Equal(stored, sharedKey) {
+		t.Errorf("key not stored under the deploy account: %v", err)
+	}
+
+	accountOverride = "ci"
+	defer func() { accountOverride = "" }()
+	t.Setenv("ENVX_PROFILE", "api")
+	if account, _ := currentAccount(); account != "ci.api" {
+		t.Errorf("currentAccount() = %q, want %q", account, "ci.api")
+	}
+
+	for _, invalid := range []string{"has space", "a/b", "deploy.signing"} {
+		accountOverride = invalid
+		if _, err := currentAccount(); err == nil || !strings.Contains(err.Error(), "--account") {
+			t.Errorf("--account %q error = %v", invalid, err)
+		}
+	}
+}
+
+func TestKeyPaperBackup(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	original, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keyExportCmdFn(context.Background(), keyExportOpts{KeyStore: "mock", Paper: true}); err == nil {
+		t.Error("keyExportCmdFn() expected error when stdout is not a terminal")
+	}
+	assumeYes = true
+	defer func() { assumeYes = false }()
+	backup, err := captureStdout(t, func() error {
+		return keyExportCmdFn(context.Background(), keyExportOpts{KeyStore: "mock", Paper: true})
+	})
+	if err != nil {
+		t.Fatalf("keyExportCmdFn() unexpected error: %v", err)
+	}
+
+	// The printed backup restores as is into an empty keystore
+	testKeystore = keystore.NewMockKeyStore()
+	originalStdin := stdin
+	defer func() { stdin = originalStdin }()
+	stdin = strings.NewReader(backup)
+	if err := keyRecoverCmdFn(context.Background(), keyRecoverOpts{KeyStore: "mock", Paper: true}); err != nil {
+		t.Fatalf("keyRecoverCmdFn() --paper unexpected error: %v", err)
+	}
+	recovered, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, original) {
+		t.Error("keyRecoverCmdFn() --paper stored a different key than the one exported")
+	}
+
+	// Typed in interactively, a line with a typo is asked for again
+	var lines []string
+	for _, line := range strings.Split(backup, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	typo := strings.Replace(lines[0], lines[0][3:4], "2", 1)
+	if typo == lines[0] {
+		typo = strings.Replace(lines[0], lines[0][3:4], "3", 1)
+	}
+	input := typo + "\n" + strings.Join(lines, "\n") + "\n"
+	var prompts bytes.Buffer
+	key, err := readPaperKey(strings.NewReader(input), &prompts, true)
+	if err != nil {
+		t.Fatalf("readPaperKey() unexpected error: %v", err)
+	}
+	if !bytes.Equal(key, original) {
+		t.Error("readPaperKey() returned a different key than the one exported")
+	}
+	if !strings.Contains(prompts.String(), "line 1 has a typo") {
+		t.Errorf("readPaperKey() did not report the typo: %q", prompts.String())
+	}
+
+	// Read from a file, a typo fails and so does a missing line
+	if _, err := readPaperKey(strings.NewReader(input), io.Discard, false); err == nil {
+		t.Error("readPaperKey() expected error for a typo")
+	}
+	if _, err := readPaperKey(strings.NewReader(strings.Join(lines[:len(lines)-1], "\n")), io.Discard, false); err == nil {
+		t.Error("readPaperKey() expected error for a missing line")
+	}
+}
+
+func TestKeyOverride(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	output, err := captureStdout(t, func() error {
+		return keyEphemeralCmdFn(context.Background(), struct{}{})
+	})
+	if err != nil {
+		t.Fatalf("keyEphemeralCmdFn() unexpected error: %v", err)
+	}
+	encoded := strings.TrimSpace(output)
+	want, err := hex.DecodeString(encoded)
+	if err != nil || len(want) != crypto.KeySize {
+		t.Fatalf("keyEphemeralCmdFn() printed %q, want %d hex encoded bytes", output, crypto.KeySize)
+	}
+
+	t.Setenv("ENVX_KEY", encoded)
+	key, err := loadKeyWithStringType("mock")
+	if err != nil {
+		t.Fatalf("loadKeyWithStringType() unexpected error: %v", err)
+	}
+	if !bytes.Equal(key, want) {
+		t.Error("ENVX_KEY was not used")
+	}
+	account, err := currentAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := keystore.HasKey(testKeystore, account); exists {
+		t.Error("keystore was touched despite ENVX_KEY")
+	}
+
+	rawKey = "abcd"
+	defer func() { rawKey = "" }()
+	if _, err := loadKeyWithStringType("mock"); err == nil || !strings.Contains(err.Error(), "--key") {
+		t.Errorf("loadKeyWithStringType() with a short --key error = %v", err)
+	}
+
+	rawKey = ""
+	resolutions, err := explain(explainOpts{File: ".env", KeyStore: "mock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := resolutions[len(resolutions)-1]; last.Setting != "keystore" || last.Source != "ENVX_KEY" {
+		t.Errorf("explain() keystore = %+v, want a raw key from ENVX_KEY", last)
+	}
+}
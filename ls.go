@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+type lsOpts struct {
+	Name string
+	File string
+	JSON bool
+}
+
+// envFileInfo describes one candidate env file, as printed by ls --json
+type envFileInfo struct {
+	Path string `json:"path"`
+	// Selected marks the file envx would use with the same flags
+	Selected bool  `json:"selected"`
+	Exists   bool  `json:"exists"`
+	Size     int64 `json:"size"`
+	Vars     int   `json:"vars"`
+	// Encrypted counts the encrypted values among the Values non-empty ones
+	Encrypted int `json:"encrypted"`
+	Values    int `json:"values"`
+}
+
+func lsCmdFn(ctx context.Context, opts lsOpts, args ...string) error {
+	infos, err := listEnvFiles(ctx, opts.File, opts.Name)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		return writeJSON(os.Stdout, infos)
+	}
+	return printEnvFiles(os.Stdout, infos)
+}
+
+// envFileCandidates returns candidate env files in resolution order: the base
+// file, its .local variant, the named variant and then any other variants
+// found next to the base file
+func envFileCandidates(base, name string) ([]string, error) {
+	candidates := []string{base, env.BuildFilename(base, "local")}
+	if name != "" {
+		candidates = append(candidates, env.BuildFilename(base, name))
+	}
+
+	matches, err := filepath.Glob(base + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("error listing env files: %w", err)
+	}
+	slices.Sort(matches)
+	for _, match := range matches {
+		if !slices.Contains(candidates, match) {
+			candidates = append(candidates, match)
+		}
+	}
+	return candidates, nil
+}
+
+// listEnvFiles inspects every candidate env file without decrypting anything
+func listEnvFiles(ctx context.Context, base, name string) ([]envFileInfo, error) {
+	candidates, err := envFileCandidates(base, name)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := env.BuildFilename(base, name)
+	encryptor := selectedEncryptor(ctx)
+	loader := env.NewFileLoader()
+
+	infos := make([]envFileInfo, 0, len(candidates))
+	for _, path := range candidates {
+		info := envFileInfo{Path: path, Selected: path == selected}
+
+		stat, err := os.Stat(path)
+		if err != nil || stat.IsDir() {
+			infos = append(infos, info)
+			continue
+		}
+		info.Exists = true
+		info.Size = stat.Size()
+
+		vars, _, err := loader.LoadWithWarnings(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s file: %w", path, err)
+		}
+		info.Vars = len(vars)
+		for _, v := range vars {
+			if v.Value == "" {
+				continue
+			}
+			info.Values++
+			if encryptor.IsEncrypted(v.Value) {
+				info.Encrypted++
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// printEnvFiles writes env file information as an aligned table. The file
+// that would be used is marked with "*".
+func printEnvFiles(w io.Writer, infos []envFileInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "\tFILE\tSIZE\tVARS\tENCRYPTED")
+	for _, info := range infos {
+		marker := ""
+		if info.Selected {
+			marker = "*"
+		}
+		if !info.Exists {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t-\t-\t(missing)\n", marker, info.Path)
+			continue
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d/%d\n", marker, info.Path, info.Size, info.Vars, info.Encrypted, info.Values)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestListEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+
+	encrypted, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "secret", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		base:           "API_KEY=" + encrypted + "\nPORT=8080\nEMPTY=\n",
+		base + ".prod": "PORT=80\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := listEnvFiles(context.Background(), base, "staging")
+	if err != nil {
+		t.Fatalf("listEnvFiles() unexpected error: %v", err)
+	}
+
+	want := []envFileInfo{
+		{Path: base, Exists: true, Size: int64(len(files[base])), Vars: 3, Encrypted: 1, Values: 2},
+		{Path: base + ".local"},
+		{Path: base + ".staging", Selected: true},
+		{Path: base + ".prod", Exists: true, Size: int64(len(files[base+".prod"])), Vars: 1, Values: 1},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("listEnvFiles() returned %d files, want %d: %+v", len(infos), len(want), infos)
+	}
+	for i := range want {
+		if infos[i] != want[i] {
+			t.Errorf("listEnvFiles()[%d] = %+v, want %+v", i, infos[i], want[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := printEnvFiles(&out, infos); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "(missing)") || !strings.Contains(out.String(), "1/2") {
+		t.Errorf("printEnvFiles() output missing expected columns:\n%s", out.String())
+	}
+}
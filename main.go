@@ -3,13 +3,23 @@ package main
 import (
 	"context"
 	_ "embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/almahoozi/envx/pkg/crypto"
 	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/errlog"
 	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/remote"
 )
 
 // testKeystoreConfig can be set during tests to use a different keychain item
@@ -23,21 +33,224 @@ var man string
 
 func main() {
 	if err := start(); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		code := 1
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+			err = exitErr.err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", errlog.Redact(err.Error()))
+		}
+		os.Exit(code)
 	}
 }
 
 // loadEnv loads environment variables from a file using the env package
 func loadEnv(ctx context.Context, filename string) (env.Variables, error) {
+	if remote.IsObjectURI(filename) {
+		return loadObjectEnv(filename)
+	}
+	if err := checkPermissions(filename); err != nil {
+		return nil, err
+	}
+
+	loader := env.NewFileLoader()
+	sections, warnings, err := loader.LoadSections(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(warnings)
+
+	vars, ok := sections.Get(envSection)
+	if !ok {
+		diagf("Warning: %s has no [%s] section\n", filename, envSection)
+	}
+	return vars, nil
+}
+
+// loadResolvedEnv loads environment variables from a file along with the files
+// its include directives pull in. Commands that only read variables use it;
+// commands that write the file back use loadEnv so included variables are not
+// copied into it.
+func loadResolvedEnv(ctx context.Context, filename string) (env.Variables, error) {
+	if filename == stdinFile {
+		return loadEnvContents(stdin, "stdin")
+	}
+	if remote.IsURL(filename) {
+		return loadRemoteEnv(ctx, filename)
+	}
+	if remote.IsObjectURI(filename) {
+		return loadObjectEnv(filename)
+	}
+	if err := checkPermissions(filename); err != nil {
+		return nil, err
+	}
+
 	loader := env.NewFileLoader()
-	return loader.Load(ctx, filename)
+	vars, ok, warnings, err := loader.LoadWithIncludes(ctx, filename, envSection)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(warnings)
+
+	if !ok {
+		diagf("Warning: %s has no [%s] section\n", filename, envSection)
+	}
+	return vars, nil
+}
+
+// stdinFile is the file name that reads env contents from stdin
+const stdinFile = "-"
+
+// stdin is where "-f -" reads from; tests replace it
+var stdin io.Reader = os.Stdin
+
+// loadEnvContents parses env contents that do not come from a local file,
+// such as those piped to envx or fetched from a URL, so they never have to be
+// written to one. Include directives are rejected since there is no file to
+// resolve them against.
+func loadEnvContents(r io.Reader, source string) (env.Variables, error) {
+	sections, warnings, err := env.ParseSections(r, source)
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(warnings)
+
+	if sections.HasIncludes() {
+		return nil, fmt.Errorf("include directives are not supported in env contents read from %s", source)
+	}
+	vars, ok := sections.Get(envSection)
+	if !ok {
+		diagf("Warning: %s has no [%s] section\n", source, envSection)
+	}
+	return vars, nil
 }
 
 // loadDecryptedEnv loads and decrypts environment variables from a file
 func loadDecryptedEnv(ctx context.Context, filename string, encryptor crypto.Encryptor, key []byte) (env.Variables, error) {
-	loader := env.NewFileLoader()
-	return loader.LoadWithDecryption(ctx, filename, encryptor, key)
+	vars, err := loadResolvedEnv(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vars.DecryptAll(ctx, encryptor, key); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// skipUndecryptable drops the variables listed in a *DecryptErrors from vars,
+// warning about each one, so commands can continue with the values that did
+// decrypt. Any other error is returned as is.
+func skipUndecryptable(vars env.Variables, err error) (env.Variables, error) {
+	var decryptErrs *env.DecryptErrors
+	if !errors.As(err, &decryptErrs) {
+		return vars, err
+	}
+
+	failed := make(map[string]bool, len(decryptErrs.Errors))
+	for _, e := range decryptErrs.Errors {
+		warnUndecryptable(e)
+		failed[e.Key] = true
+	}
+	kept := vars[:0]
+	for _, v := range vars {
+		if !failed[v.Key] {
+			kept = append(kept, v)
+		}
+	}
+	return kept, nil
+}
+
+// warnUndecryptable reports a variable skipped by --ignore-decrypt-errors
+func warnUndecryptable(err *env.DecryptError) {
+	diagf("Warning: skipped %v\n", err)
+}
+
+// encryptors are the encryptors ENVX_ENCRYPTOR can select by name
+var encryptors = crypto.NewRegistry()
+
+type encryptorContextKey struct{}
+
+// withEncryptor returns a copy of ctx carrying the encryptor named by
+// ENVX_ENCRYPTOR, crypto.DefaultEncryptor when unset
+func withEncryptor(ctx context.Context) (context.Context, error) {
+	name := os.Getenv("ENVX_ENCRYPTOR")
+	if name == "" {
+		name = crypto.DefaultEncryptor
+	}
+	encryptor, err := encryptors.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENVX_ENCRYPTOR: %w", err)
+	}
+	return context.WithValue(ctx, encryptorContextKey{}, encryptor), nil
+}
+
+// selectedEncryptor returns the encryptor carried by ctx, or the AES
+// encryptor when there is none
+func selectedEncryptor(ctx context.Context) crypto.Encryptor {
+	if encryptor, ok := ctx.Value(encryptorContextKey{}).(crypto.Encryptor); ok {
+		return encryptor
+	}
+	return crypto.NewAESEncryptor()
+}
+
+// newEncryptor returns the selected encryptor with its decryptions
+// remembered for the rest of the command
+func newEncryptor(ctx context.Context) crypto.Encryptor {
+	return env.CacheFrom(ctx).Encryptor(selectedEncryptor(ctx))
+}
+
+// loadLazyEnv loads environment variables from a file, decrypting values only when accessed
+func loadLazyEnv(ctx context.Context, filename string, encryptor crypto.Encryptor, key []byte) (*env.DecryptingVariables, error) {
+	vars, err := loadResolvedEnv(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return env.NewDecryptingVariables(ctx, vars, encryptor, key), nil
+}
+
+// permissionWarnings holds the files checkPermissions has warned about, so
+// commands loading a file several times warn about it once
+var permissionWarnings = struct {
+	sync.Mutex
+	files map[string]bool
+}{files: map[string]bool{}}
+
+// checkPermissions warns about files that are accessible by group or others,
+// or rejects them when strict mode is enabled
+func checkPermissions(filename string) error {
+	err := env.CheckPermissions(filename)
+	if err == nil {
+		return nil
+	}
+	if strict || !errors.Is(err, env.ErrInsecurePermissions) {
+		return err
+	}
+
+	path, absErr := filepath.Abs(filename)
+	if absErr != nil {
+		path = filename
+	}
+	permissionWarnings.Lock()
+	warned := permissionWarnings.files[path]
+	permissionWarnings.files[path] = true
+	permissionWarnings.Unlock()
+	if !warned {
+		diagf("Warning: %v (run \"envx chmod\" to fix)\n", err)
+	}
+	return nil
+}
+
+// printWarnings writes parser warnings to stderr when verbose output is enabled
+func printWarnings(warnings []env.Warning) {
+	if !verbose {
+		return
+	}
+	for _, w := range warnings {
+		diagf("Warning: %s\n", w)
+	}
 }
 
 // KeyStoreType represents the type of keystore to use
@@ -47,6 +260,9 @@ const (
 	KeyStoreTypeMacOS    KeyStoreType = "macos"
 	KeyStoreTypePassword KeyStoreType = "password"
 	KeyStoreTypeMock     KeyStoreType = "mock"
+	KeyStoreTypeSystemd  KeyStoreType = "systemd"
+	KeyStoreTypeTPM      KeyStoreType = "tpm"
+	KeyStoreTypeYubiKey  KeyStoreType = "yubikey"
 )
 
 // avoid unused lint errors
@@ -67,6 +283,23 @@ func loadKeyWithStringType(storeTypeStr string) ([]byte, error) {
 
 // loadKeyWithStringTypeAndPassword loads or creates an encryption key using the specified keystore type string and password
 func loadKeyWithStringTypeAndPassword(storeTypeStr, password string) ([]byte, error) {
+	storeType, password, err := resolveKeyStoreType(storeTypeStr, password)
+	if err != nil {
+		return nil, err
+	}
+	return loadKeyWithTypeAndPassword(storeType, password)
+}
+
+// resolveKeyStoreType applies the password flag conventions to the requested
+// keystore type and returns the effective type and password
+func resolveKeyStoreType(storeTypeStr, password string) (KeyStoreType, string, error) {
+	// An empty type means --keystore was not given, leaving the choice to
+	// the environment and then the macos default
+	explicit := storeTypeStr != ""
+	if !explicit {
+		storeTypeStr = string(KeyStoreTypeMacOS)
+	}
+
 	// As a workaround we set the password to byte(1) if it is empty using -P
 	if password == emptyPassword {
 		storeTypeStr = "password"
@@ -78,11 +311,77 @@ func loadKeyWithStringTypeAndPassword(storeTypeStr, password string) ([]byte, er
 		storeTypeStr = "password"
 	}
 
+	// A key seed selects the mock keystore deriving its key from it
+	seed, seedSource := keySeed()
+	if seed != "" && !explicit && storeTypeStr == string(KeyStoreTypeMacOS) && password == "" && os.Getenv("ENVX_PASSWORD") == "" {
+		storeTypeStr = string(KeyStoreTypeMock)
+	}
+
+	// Under a systemd service holding the envx credential, use it instead of
+	// the default keystore
+	if !explicit && storeTypeStr == string(KeyStoreTypeMacOS) && password == "" && os.Getenv("ENVX_PASSWORD") == "" {
+		if _, ok := keystore.CredentialFromEnv(); ok {
+			storeTypeStr = string(KeyStoreTypeSystemd)
+		}
+	}
+
+	// ENVX_KEYSTORE replaces the default keystore, typically with a fallback
+	// list such as "macos,tpm,password"
+	if !explicit && storeTypeStr == string(KeyStoreTypeMacOS) && os.Getenv("ENVX_KEYSTORE") != "" {
+		storeTypeStr = os.Getenv("ENVX_KEYSTORE")
+	}
+	if strings.Contains(storeTypeStr, ",") {
+		var err error
+		if storeTypeStr, err = firstAvailableKeyStore(storeTypeStr, password); err != nil {
+			return "", "", err
+		}
+	}
+
 	storeType, err := parseKeyStoreType(storeTypeStr)
 	if err != nil {
-		return nil, err
+		return "", "", err
 	}
-	return loadKeyWithTypeAndPassword(storeType, password)
+	if seed != "" && storeType != KeyStoreTypeMock {
+		return "", "", fmt.Errorf("%s only applies to the mock keystore, not %s", seedSource, storeType)
+	}
+	return storeType, password, nil
+}
+
+// probeKeyStore returns why the storeType keystore cannot be used on this
+// machine, or nil; tests replace it
+var probeKeyStore = func(storeType KeyStoreType, password, account string) error {
+	store, err := newKeyStore(storeType, password, account)
+	if err != nil {
+		return err
+	}
+	return keystore.Available(store)
+}
+
+// firstAvailableKeyStore returns the first keystore of the comma separated
+// list chain that can be used on this machine. With --verbose the reason
+// each one before it was skipped is printed.
+func firstAvailableKeyStore(chain, password string) (string, error) {
+	account, err := currentAccount()
+	if err != nil {
+		return "", err
+	}
+	var reasons []string
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.TrimSpace(name)
+		storeType, err := parseKeyStoreType(name)
+		if err != nil {
+			return "", err
+		}
+		if err := probeKeyStore(storeType, password, account); err != nil {
+			if verbose {
+				diagf("Skipping the %s keystore: %v\n", name, err)
+			}
+			reasons = append(reasons, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("no keystore of %s is available (%s)", chain, strings.Join(reasons, "; "))
 }
 
 // parseKeyStoreType converts a string to KeyStoreType
@@ -94,8 +393,14 @@ func parseKeyStoreType(storeTypeStr string) (KeyStoreType, error) {
 		return KeyStoreTypePassword, nil
 	case "mock":
 		return KeyStoreTypeMock, nil
+	case "systemd":
+		return KeyStoreTypeSystemd, nil
+	case "tpm":
+		return KeyStoreTypeTPM, nil
+	case "yubikey":
+		return KeyStoreTypeYubiKey, nil
 	default:
-		return "", fmt.Errorf("unsupported keystore type: %s (supported: macos, password, mock)", storeTypeStr)
+		return "", fmt.Errorf("unsupported keystore type: %s (supported: macos, password, systemd, tpm, yubikey, mock)", storeTypeStr)
 	}
 }
 
@@ -106,38 +411,264 @@ func loadKeyWithType(storeType KeyStoreType) ([]byte, error) {
 
 // loadKeyWithTypeAndPassword loads or creates an encryption key using the specified keystore type and optional password
 func loadKeyWithTypeAndPassword(storeType KeyStoreType, password string) ([]byte, error) {
-	user, err := user.Current()
+	if key, _, err := keyOverride(); key != nil || err != nil {
+		return key, err
+	}
+
+	account, err := currentAccount()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get current user: %w", err)
+		return nil, err
 	}
 
-	var store keystore.KeyStore
-	if testKeystore != nil {
-		// Use test keystore if set (for testing)
-		store = testKeystore
-	} else {
-		// Use production keystore based on type
-		switch storeType {
-		case KeyStoreTypePassword:
-			config := &keystore.PasswordKeyStoreConfig{
-				Password: password,
-			}
-			store = keystore.NewPasswordKeyStore(config)
-		case KeyStoreTypeMock:
-			store = keystore.NewMockKeyStore()
-		case KeyStoreTypeMacOS:
-			fallthrough
-		default:
-			// Use test config if set (for testing), otherwise use default
-			config := testKeystoreConfig
-			store = keystore.NewMacOSKeyStore(config)
+	store, err := newKeyStore(storeType, password, account)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := keystore.HasKey(store, account)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		create, err := keyCreationAllowed()
+		if err != nil {
+			return nil, err
+		}
+		if !create {
+			return nil, fmt.Errorf("no key found in the %s keystore and key creation is disabled; check --keystore and the account, or restore the key with \"envx key recover\" or \"envx bundle import\"", storeType)
 		}
 	}
 
-	key, err := store.LoadOrCreateKey(user.Username)
+	load := store.LoadOrCreateKey
+	if storeType == KeyStoreTypeTPM || storeType == KeyStoreTypeSystemd {
+		// These keystores shell out to tools that can take a while
+		load = func(account string) ([]byte, error) {
+			return withProgress(fmt.Sprintf("Loading key from the %s keystore", storeType), func() ([]byte, error) {
+				return store.LoadOrCreateKey(account)
+			})
+		}
+	}
+	key, err := load(account)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load or create key: %w", err)
 	}
+	errlog.RegisterKey(key)
+
+	if !exists {
+		diagf("Notice: created a new encryption key %s in the %s keystore. Values encrypted with any other key cannot be decrypted with it; back it up with \"envx key split\".\n", crypto.Fingerprint(key), storeType)
+	}
 
 	return key, nil
 }
+
+// keyCreationAllowed reports whether a missing key may be created, which
+// --no-create-key or ENVX_KEY_CREATE=false disables
+func keyCreationAllowed() (bool, error) {
+	if noCreateKey {
+		return false, nil
+	}
+	value := os.Getenv("ENVX_KEY_CREATE")
+	if value == "" {
+		return true, nil
+	}
+	create, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ENVX_KEY_CREATE value %q: %w", value, err)
+	}
+	return create, nil
+}
+
+// passwordKeyStoreConfig returns the password keystore configuration, with
+// the PBKDF2 iterations and retries taken from --password-iterations and
+// --password-retries or ENVX_PASSWORD_ITERATIONS and ENVX_PASSWORD_RETRIES
+func passwordKeyStoreConfig(password string) (*keystore.PasswordKeyStoreConfig, error) {
+	config := &keystore.PasswordKeyStoreConfig{
+		Password: password,
+		Progress: func(task string) func() { return startProgress(task, 0).Stop },
+	}
+
+	iterations, err := passwordSetting(passwordIterations, "--password-iterations", "ENVX_PASSWORD_ITERATIONS")
+	if err != nil {
+		return nil, err
+	}
+	if iterations >= 0 {
+		if iterations < keystore.DefaultIterations {
+			return nil, fmt.Errorf("password iterations must be at least %d, got %d", keystore.DefaultIterations, iterations)
+		}
+		config.Iterations = iterations
+	}
+
+	retries, err := passwordSetting(passwordRetries, "--password-retries", "ENVX_PASSWORD_RETRIES")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case retries == 0:
+		config.Retries = -1
+	case retries > 0:
+		config.Retries = retries
+	}
+	return config, nil
+}
+
+// keyOverride returns the key given as hex with --key or ENVX_KEY, which
+// bypasses the keystore, and where it came from. The key is nil when neither
+// is set.
+func keyOverride() ([]byte, string, error) {
+	value, source := rawKey, "--key"
+	if value == "" {
+		value, source = os.Getenv("ENVX_KEY"), "ENVX_KEY"
+	}
+	if value == "" {
+		return nil, "", nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != crypto.KeySize {
+		return nil, "", fmt.Errorf("invalid %s: expected %d hex encoded bytes", source, crypto.KeySize)
+	}
+	errlog.RegisterKey(key)
+	return key, source, nil
+}
+
+// keySeed returns the seed given with --key-seed or ENVX_KEY_SEED, and
+// where it came from. The seed is empty when neither is set.
+func keySeed() (string, string) {
+	if keySeedFlag != "" {
+		return keySeedFlag, "--key-seed"
+	}
+	return os.Getenv("ENVX_KEY_SEED"), "ENVX_KEY_SEED"
+}
+
+// passwordSetting parses the value of flag, or of the environment variable
+// name if the flag is unset, as a non-negative number; it returns -1 if
+// neither is set
+func passwordSetting(flagValue, flag, name string) (int, error) {
+	value, source := flagValue, flag
+	if value == "" {
+		value, source = os.Getenv(name), name
+	}
+	if value == "" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: expected a non-negative number", source, value)
+	}
+	return n, nil
+}
+
+// currentUser returns the name of the user running envx
+func currentUser() (string, error) {
+	user, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current user: %w", err)
+	}
+	errlog.RegisterAs(user.Username, "<account>")
+	return user.Username, nil
+}
+
+// accountName matches valid --account values
+var accountName = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// keyOwner returns the name keys are stored under: the account given with
+// --account or ENVX_ACCOUNT, so users can share a key or keep theirs under
+// sudo, or else the user name
+func keyOwner() (string, error) {
+	value, source := accountOverride, "--account"
+	if value == "" {
+		value, source = os.Getenv("ENVX_ACCOUNT"), "ENVX_ACCOUNT"
+	}
+	if value == "" {
+		return currentUser()
+	}
+	if !accountName.MatchString(value) {
+		return "", fmt.Errorf("invalid %s %q: use letters, digits, ., @, - and _", source, value)
+	}
+	if strings.HasSuffix(value, "."+signingSuffix) {
+		return "", fmt.Errorf("invalid %s %q: reserved for signing identities", source, value)
+	}
+	return value, nil
+}
+
+// currentAccount returns the keystore account used for the current user:
+// the key owner, followed by the key profile when one is selected
+func currentAccount() (string, error) {
+	user, err := keyOwner()
+	if err != nil {
+		return "", err
+	}
+	profile, err := keyProfile()
+	if err != nil || profile == "" {
+		return user, err
+	}
+	return user + "." + profile, nil
+}
+
+// profileName matches valid key profile names
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// keyProfile returns the key profile selected with ENVX_PROFILE, which gives
+// a project its own key in the keystore. Empty selects the user's default key.
+func keyProfile() (string, error) {
+	profile := os.Getenv("ENVX_PROFILE")
+	if profile == "" {
+		return "", nil
+	}
+	if !profileName.MatchString(profile) {
+		return "", fmt.Errorf("invalid ENVX_PROFILE %q: use letters, digits, - and _", profile)
+	}
+	if profile == signingSuffix {
+		return "", fmt.Errorf("invalid ENVX_PROFILE %q: reserved for signing identities", profile)
+	}
+	return profile, nil
+}
+
+// newKeyStore creates the keystore for the given type, or the test keystore if one is set
+func newKeyStore(storeType KeyStoreType, password, account string) (keystore.KeyStore, error) {
+	if testKeystore != nil {
+		// Use test keystore if set (for testing)
+		return testKeystore, nil
+	}
+
+	// Use production keystore based on type
+	switch storeType {
+	case KeyStoreTypePassword:
+		if err := checkPermissions(keystore.SaltFilePath(account)); err != nil {
+			return nil, err
+		}
+		errlog.Register(password, os.Getenv("ENVX_PASSWORD"))
+		config, err := passwordKeyStoreConfig(password)
+		if err != nil {
+			return nil, err
+		}
+		return keystore.NewPasswordKeyStore(config), nil
+	case KeyStoreTypeMock:
+		if seed, _ := keySeed(); seed != "" {
+			return keystore.NewSeededMockKeyStore(seed)
+		}
+		return keystore.NewMockKeyStore(), nil
+	case KeyStoreTypeTPM:
+		return keystore.NewTPMKeyStore(keystore.TPMConfigFromEnv())
+	case KeyStoreTypeYubiKey:
+		return keystore.NewFIDO2KeyStore(keystore.FIDO2ConfigFromEnv()), nil
+	case KeyStoreTypeSystemd:
+		store, _ := keystore.CredentialFromEnv()
+		if store == nil {
+			return nil, fmt.Errorf("CREDENTIALS_DIRECTORY is not set; run envx from a systemd service with LoadCredential= or LoadCredentialEncrypted= (see \"envx systemd unit\")")
+		}
+		return store, nil
+	case KeyStoreTypeMacOS:
+		fallthrough
+	default:
+		// Use test config if set (for testing), otherwise read keychain options from the environment
+		config := testKeystoreConfig
+		if config == nil {
+			var err error
+			config, err = keystore.ConfigFromEnv()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return keystore.NewMacOSKeyStore(config), nil
+	}
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"io"
 	"os"
 	"os/user"
+	"strings"
 	"testing"
 
 	"github.com/almahoozi/envx/pkg/crypto"
 	"github.com/almahoozi/envx/pkg/keystore"
 )
 
+func TestMain(m *testing.M) {
+	// Keep the hashes of files written by tests out of the user cache
+	dir, err := os.MkdirTemp("", "envx-written")
+	if err != nil {
+		panic(err)
+	}
+	writtenDir = func() string { return dir }
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestLoadEnv(t *testing.T) {
 	// Create a temporary file for testing
 	tempFile := createTempEnvFile(t, `KEY1=value1
@@ -47,12 +63,12 @@ func TestLoadDecryptedEnv(t *testing.T) {
 	key := generateTestKey(t)
 
 	// Create encrypted values
-	secret1, err := encryptor.Encrypt("secret_value_1", key)
+	secret1, err := encryptor.Encrypt(context.Background(), "secret_value_1", key)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	secret2, err := encryptor.Encrypt("secret_value_2", key)
+	secret2, err := encryptor.Encrypt(context.Background(), "secret_value_2", key)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,6 +99,56 @@ func TestLoadDecryptedEnv(t *testing.T) {
 	}
 }
 
+// upperEncryptor is a toy encryptor that marks values and upper-cases them
+type upperEncryptor struct{}
+
+func (upperEncryptor) Encrypt(_ context.Context, plaintext string, _ []byte) (string, error) {
+	return "upper:" + strings.ToUpper(plaintext), nil
+}
+
+func (upperEncryptor) Decrypt(_ context.Context, ciphertext string, _ []byte) (string, error) {
+	return strings.ToLower(strings.TrimPrefix(ciphertext, "upper:")), nil
+}
+
+func (upperEncryptor) IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, "upper:")
+}
+
+func TestWithEncryptor(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	encryptors.Register("test-upper", func() crypto.Encryptor { return upperEncryptor{} })
+
+	t.Setenv("ENVX_ENCRYPTOR", "nonexistent")
+	if _, err := withEncryptor(context.Background()); err == nil || !strings.Contains(err.Error(), "ENVX_ENCRYPTOR") {
+		t.Errorf("withEncryptor() with an unknown name error = %v", err)
+	}
+
+	t.Setenv("ENVX_ENCRYPTOR", "test-upper")
+	ctx, err := withEncryptor(context.Background())
+	if err != nil {
+		t.Fatalf("withEncryptor() error = %v", err)
+	}
+	tempFile := createTempEnvFile(t, "SECRET=value\n")
+	defer removeTempFile(t, tempFile)
+
+	output, err := captureStdout(t, func() error {
+		return encryptCmd(ctx, encryptOpts{File: tempFile, KeyStore: "mock", FmtOpts: &fmtOpts{}})
+	})
+	if err != nil {
+		t.Fatalf("encryptCmd() error = %v", err)
+	}
+	if output != "SECRET=upper:VALUE\n" {
+		t.Errorf("encryptCmd() with the selected encryptor output = %q", output)
+	}
+
+	// ENVX_DETERMINISTIC needs an encryptor that supports it
+	t.Setenv("ENVX_DETERMINISTIC", "true")
+	if _, err := newValueEncrypter(ctx, selectedEncryptor(ctx)); err == nil {
+		t.Error("newValueEncrypter() accepted ENVX_DETERMINISTIC for an encryptor without it")
+	}
+}
+
 func TestLoadKey(t *testing.T) {
 	// Setup test keystore to avoid interfering with production keychain
 	setupTestKeystore(t)
@@ -125,6 +191,48 @@ func TestLoadKey(t *testing.T) {
 	t.Logf("loadKey() test completed for user: %s (using test keychain item)", currentUser.Username)
 }
 
+func TestLoadKey_NoCreateKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		flag      bool
+		envValue  string
+		existing  bool
+		wantError bool
+	}{
+		{name: "creates by default"},
+		{name: "flag refuses to create", flag: true, wantError: true},
+		{name: "env refuses to create", envValue: "false", wantError: true},
+		{name: "env allows creation", envValue: "true"},
+		{name: "invalid env value", envValue: "maybe", wantError: true},
+		{name: "flag loads existing key", flag: true, existing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestKeystore(t)
+			defer teardownTestKeystore(t)
+			t.Setenv("ENVX_KEY_CREATE", tt.envValue)
+
+			if tt.existing {
+				if _, err := loadKeyWithType(KeyStoreTypeMock); err != nil {
+					t.Fatalf("creating key: %v", err)
+				}
+			}
+
+			noCreateKey = tt.flag
+			defer func() { noCreateKey = false }()
+
+			key, err := loadKeyWithType(KeyStoreTypeMock)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("loadKeyWithType() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && len(key) != crypto.KeySize {
+				t.Errorf("loadKeyWithType() returned key of size %d, want %d", len(key), crypto.KeySize)
+			}
+		})
+	}
+}
+
 // Helper functions for tests
 
 func createTempEnvFile(t *testing.T, content string) string {
@@ -146,6 +254,42 @@ func createTempEnvFile(t *testing.T, content string) string {
 	return file.Name()
 }
 
+// captureStdout runs fn with os.Stdout redirected and returns what it printed
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+func captureStderr(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, fn)
+}
+
+// captureOutput returns what fn writes to *stream, which is os.Stdout or
+// os.Stderr
+func captureOutput(t *testing.T, stream **os.File, fn func() error) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *stream
+	*stream = w
+	defer func() { *stream = original }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	fnErr := fn()
+	w.Close()
+	*stream = original
+	return string(<-done), fnErr
+}
+
 func removeTempFile(t *testing.T, filename string) {
 	t.Helper()
 
@@ -187,3 +331,134 @@ func teardownTestKeystore(t *testing.T) {
 	testKeystore = nil
 	testKeystoreConfig = nil
 }
+
+func TestParseKeyStoreType_Hardware(t *testing.T) {
+	for _, want := range []KeyStoreType{KeyStoreTypeTPM, KeyStoreTypeYubiKey} {
+		storeType, err := parseKeyStoreType(string(want))
+		if err != nil || storeType != want {
+			t.Errorf("parseKeyStoreType(%s) = %s, %v", want, storeType, err)
+		}
+	}
+
+	t.Setenv("ENVX_TPM_PCRS", "not-a-selection")
+	if _, err := newKeyStore(KeyStoreTypeTPM, "", "alice"); err == nil {
+		t.Error("newKeyStore(tpm) expected error for an invalid ENVX_TPM_PCRS")
+	}
+}
+
+func TestPasswordKeyStoreConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		flagIterations string
+		envIterations  string
+		flagRetries    string
+		envRetries     string
+		wantIterations int
+		wantRetries    int
+		wantError      bool
+	}{
+		{name: "defaults"},
+		{name: "env", envIterations: "600000", envRetries: "5", wantIterations: 600000, wantRetries: 5},
+		{name: "flags override env", flagIterations: "200000", envIterations: "600000", flagRetries: "1", envRetries: "5", wantIterations: 200000, wantRetries: 1},
+		{name: "zero retries disables them", envRetries: "0", wantRetries: -1},
+		{name: "iterations below default", flagIterations: "1000", wantError: true},
+		{name: "invalid iterations", envIterations: "many", wantError: true},
+		{name: "negative retries", flagRetries: "-1", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVX_PASSWORD_ITERATIONS", tt.envIterations)
+			t.Setenv("ENVX_PASSWORD_RETRIES", tt.envRetries)
+			passwordIterations, passwordRetries = tt.flagIterations, tt.flagRetries
+			defer func() { passwordIterations, passwordRetries = "", "" }()
+
+			config, err := passwordKeyStoreConfig("secret")
+			if (err != nil) != tt.wantError {
+				t.Fatalf("passwordKeyStoreConfig() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if config.Iterations != tt.wantIterations || config.Retries != tt.wantRetries || config.Password != "secret" {
+				t.Errorf("passwordKeyStoreConfig() = %+v, want iterations %d and retries %d", config, tt.wantIterations, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestResolveKeyStoreType_Fallback(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	original := probeKeyStore
+	defer func() { probeKeyStore = original }()
+	probeKeyStore = func(storeType KeyStoreType, password, account string) error {
+		if storeType == KeyStoreTypeMock {
+			return nil
+		}
+		return errors.New("not here")
+	}
+
+	verbose = true
+	defer func() { verbose = false }()
+	var storeType KeyStoreType
+	output, err := captureStderr(t, func() error {
+		var err error
+		storeType, _, err = resolveKeyStoreType("tpm, mock,password", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("resolveKeyStoreType() unexpected error: %v", err)
+	}
+	if storeType != KeyStoreTypeMock {
+		t.Errorf("resolveKeyStoreType() = %s, want mock", storeType)
+	}
+	if want := "Skipping the tpm keystore: not here\n"; output != want {
+		t.Errorf("resolveKeyStoreType() printed %q, want %q", output, want)
+	}
+
+	t.Setenv("ENVX_KEYSTORE", "tpm,yubikey")
+	if _, _, err := resolveKeyStoreType("", ""); err == nil || !strings.Contains(err.Error(), "yubikey: not here") {
+		t.Errorf("resolveKeyStoreType() with no keystore available error = %v", err)
+	}
+	if storeType, _, err := resolveKeyStoreType("macos", ""); err != nil || storeType != KeyStoreTypeMacOS {
+		t.Errorf("resolveKeyStoreType() with an explicit macos keystore = %s, %v; want macos", storeType, err)
+	}
+	if storeType, _, err := resolveKeyStoreType("mock", ""); err != nil || storeType != KeyStoreTypeMock {
+		t.Errorf("resolveKeyStoreType() with an explicit keystore = %s, %v; want mock", storeType, err)
+	}
+	if _, _, err := resolveKeyStoreType("mock,floppy", ""); err != nil {
+		t.Errorf("resolveKeyStoreType() stopped at an available keystore but got error %v", err)
+	}
+}
+
+func TestKeySeed(t *testing.T) {
+	t.Setenv("ENVX_KEY_SEED", "fixtures")
+	storeType, _, err := resolveKeyStoreType("", "")
+	if err != nil || storeType != KeyStoreTypeMock {
+		t.Errorf("resolveKeyStoreType() with a key seed = %s, %v; want mock", storeType, err)
+	}
+	if _, _, err := resolveKeyStoreType("tpm", ""); err == nil || !strings.Contains(err.Error(), "ENVX_KEY_SEED") {
+		t.Errorf("resolveKeyStoreType() with a key seed and tpm error = %v", err)
+	}
+	if _, _, err := resolveKeyStoreType("macos", ""); err == nil || !strings.Contains(err.Error(), "ENVX_KEY_SEED") {
+		t.Errorf("resolveKeyStoreType() with a key seed and an explicit macos keystore error = %v", err)
+	}
+
+	// Separate runs, each with a fresh mock keystore, share the key
+	key1, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatalf("loadKeyWithType() unexpected error: %v", err)
+	}
+	keySeedFlag = "fixtures"
+	defer func() { keySeedFlag = "" }()
+	t.Setenv("ENVX_KEY_SEED", "")
+	key2, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatalf("loadKeyWithType() unexpected error: %v", err)
+	}
+	want, _ := keystore.SeededKey("fixtures")
+	if !bytes.Equal(key1, want) || !bytes.Equal(key2, want) {
+		t.Errorf("loadKeyWithType() = %x, %x; want the seeded key %x", key1, key2, want)
+	}
+}
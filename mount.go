@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// mountFileSuffix is appended to the key of a mount without a path to name
+// the variable holding the path of its file
+const mountFileSuffix = "_FILE"
+
+// mountSet writes variables given with --mount to files for the program to
+// read instead of exporting them, and removes the files once it exits
+type mountSet struct {
+	mounts []mount
+	// dir holds files of mounts without a path, created on first use
+	dir string
+	// written holds files created by the set, which it may overwrite
+	written map[string]bool
+}
+
+type mount struct {
+	key  string
+	path string
+}
+
+// newMountSet parses KEY=PATH or KEY specs. It returns nil when there are none.
+func newMountSet(specs []string) (*mountSet, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	set := &mountSet{written: map[string]bool{}}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		key, path, _ := strings.Cut(spec, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid --mount %q: expected KEY=PATH or KEY", spec)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("invalid --mount %q: %s is already mounted", spec, key)
+		}
+		seen[key] = true
+		set.mounts = append(set.mounts, mount{key: key, path: path})
+	}
+	return set, nil
+}
+
+// write writes the value of every mounted variable to its file with mode
+// 0600. A mount without a path gets a file in a private directory, preferably
+// on tmpfs, whose path is exported as KEY_FILE. Existing files are never
+// overwritten, except those written by an earlier call. It returns the keys
+// that must not be exported and the variables it exported.
+func (s *mountSet) write(vars env.Variables) (map[string]bool, []string, error) {
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		values[v.Key] = v.Value
+	}
+
+	withheld := make(map[string]bool, len(s.mounts))
+	var exported []string
+	for _, m := range s.mounts {
+		value, ok := values[m.key]
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot mount %s: not in env file", m.key)
+		}
+
+		path := m.path
+		if path == "" {
+			dir, err := s.privateDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			path = filepath.Join(dir, m.key)
+			if err := os.Setenv(m.key+mountFileSuffix, path); err != nil {
+				return nil, nil, fmt.Errorf("error setting env var %s: %w", m.key+mountFileSuffix, err)
+			}
+			exported = append(exported, m.key+mountFileSuffix)
+		}
+		if err := s.writeFile(path, value); err != nil {
+			return nil, nil, fmt.Errorf("cannot mount %s: %w", m.key, err)
+		}
+		withheld[m.key] = true
+	}
+	return withheld, exported, nil
+}
+
+func (s *mountSet) writeFile(path, value string) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if s.written[path] {
+		flags = os.O_WRONLY | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600) // #nosec G304 -- Path given by the user with --mount
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err != nil {
+		return err
+	}
+	s.written[path] = true
+	if _, err := f.WriteString(value); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *mountSet) privateDir() (string, error) {
+	if s.dir != "" {
+		return s.dir, nil
+	}
+	dir, err := os.MkdirTemp(mountBaseDir(), "envx-")
+	if err != nil {
+		return "", fmt.Errorf("error creating mount directory: %w", err)
+	}
+	s.dir = dir
+	return dir, nil
+}
+
+// remove deletes the files and directory created by the set
+func (s *mountSet) remove() {
+	if s == nil {
+		return
+	}
+	for path := range s.written {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			diagf("envx: warning: cannot remove %s: %v\n", path, err)
+		}
+	}
+	if s.dir != "" {
+		_ = os.Remove(s.dir)
+	}
+}
+
+// mountBaseDir returns where files of mounts without a path are created:
+// $XDG_RUNTIME_DIR or /dev/shm, which are memory backed on most Linux
+// systems, or else the temporary directory
+func mountBaseDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
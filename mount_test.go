@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_Mount(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=s3cret\nCERT=pem\nPLAIN=visible\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("TOKEN", "")
+	t.Setenv("CERT", "")
+	t.Setenv("CERT_FILE", "")
+
+	tokenPath := filepath.Join(dir, "token")
+	out := filepath.Join(dir, "out")
+	script := `{ printf '%s|%s|' "$TOKEN" "$PLAIN"; cat "$1"; printf '|'; cat "$CERT_FILE"; printf '|%s' "$CERT_FILE"; } > "$2"`
+	opts := runOpts{File: envFile, KeyStore: "mock", Mount: []string{"TOKEN=" + tokenPath, "CERT"}}
+	if err := run(context.Background(), opts, "sh", "-c", script, "sh", tokenPath, out); err != nil {
+		t.Fatalf("run() unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(string(data), "|")
+	if len(fields) != 5 {
+		t.Fatalf("unexpected output %q", data)
+	}
+	if fields[0] != "" {
+		t.Errorf("mounted TOKEN was exported as %q", fields[0])
+	}
+	if fields[1] != "visible" {
+		t.Errorf("PLAIN = %q, want visible", fields[1])
+	}
+	if fields[2] != "s3cret" || fields[3] != "pem" {
+		t.Errorf("mounted files hold %q and %q", fields[2], fields[3])
+	}
+	if !strings.HasPrefix(fields[4], dir) {
+		t.Errorf("CERT_FILE = %q, want a file in %s", fields[4], dir)
+	}
+	for _, path := range []string{tokenPath, fields[4], filepath.Dir(fields[4])} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		existing := filepath.Join(dir, "existing")
+		if err := os.WriteFile(existing, []byte("keep"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		for _, mounts := range [][]string{
+			{"=path"},
+			{"TOKEN", "TOKEN=other"},
+			{"MISSING"},
+			{"TOKEN=" + existing},
+		} {
+			opts := runOpts{File: envFile, KeyStore: "mock", Mount: mounts}
+			if err := run(context.Background(), opts, "true"); err == nil {
+				t.Errorf("run(--mount %v) expected error", mounts)
+			}
+		}
+		if data, _ := os.ReadFile(existing); string(data) != "keep" {
+			t.Errorf("existing file was changed to %q", data)
+		}
+	})
+}
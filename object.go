@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/almahoozi/envx/pkg/remote"
+)
+
+// objectRun runs the aws and gcloud CLIs; tests replace it
+var objectRun remote.Runner
+
+// objectCopy is an env file read from object storage
+type objectCopy struct {
+	data    []byte
+	version string
+}
+
+// objectCopies holds the objects read by this process, so a command writes
+// back to the version it read and rejects the write if someone else changed
+// the object in between
+var objectCopies = map[string]objectCopy{}
+
+// readObject returns the contents of an env file in object storage, or
+// nothing when it does not exist yet, like a missing local file
+func readObject(uri string) ([]byte, error) {
+	if c, ok := objectCopies[uri]; ok {
+		return c.data, nil
+	}
+	store, err := remote.NewObjectStore(uri, objectRun)
+	if err != nil {
+		return nil, err
+	}
+	p := startProgress("Reading "+uri, 0)
+	data, version, err := store.Get(uri)
+	p.Stop()
+	if errors.Is(err, remote.ErrNotFound) {
+		data, version, err = nil, "", nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", uri, err)
+	}
+	objectCopies[uri] = objectCopy{data: data, version: version}
+	return data, nil
+}
+
+// writeObject replaces an env file in object storage if it is unchanged
+// since readObject
+func writeObject(uri string, data []byte) error {
+	c, ok := objectCopies[uri]
+	if !ok {
+		// Writing without reading first must not clobber an existing object
+		if _, err := readObject(uri); err != nil {
+			return err
+		}
+		c = objectCopies[uri]
+	}
+	store, err := remote.NewObjectStore(uri, objectRun)
+	if err != nil {
+		return err
+	}
+	p := startProgress("Writing "+uri, 0)
+	err = store.Put(uri, data, c.version)
+	p.Stop()
+	if err != nil {
+		if errors.Is(err, remote.ErrConflict) {
+			return fmt.Errorf("refusing to overwrite %s: it changed since it was read, run the command again", uri)
+		}
+		return fmt.Errorf("error writing %s: %w", uri, err)
+	}
+	delete(objectCopies, uri)
+	return nil
+}
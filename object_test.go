@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeGCS emulates gcloud storage for a single object
+type fakeGCS struct {
+	data       []byte
+	generation int
+}
+
+func (g *fakeGCS) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	current := fmt.Sprint(g.generation)
+	switch args[1] {
+	case "objects":
+		if g.generation == 0 {
+			return nil, errors.New("gcloud failed: The following URLs matched no objects or files")
+		}
+		return []byte(`{"generation": "` + current + `"}`), nil
+	case "cat":
+		return g.data, nil
+	case "cp":
+		if args[len(args)-1] != "--if-generation-match="+current {
+			return nil, errors.New("gcloud failed: HTTPError 412: pre-conditions did not hold")
+		}
+		g.data = stdin
+		g.generation++
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected command %v", args)
+}
+
+func TestObjectEnvFile(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	bucket := &fakeGCS{}
+	originalRun := objectRun
+	defer func() { objectRun = originalRun }()
+	objectRun = bucket.run
+
+	// Every command starts as a new process
+	fresh := func() { objectCopies = map[string]objectCopy{} }
+	defer fresh()
+
+	const uri = "gs://team-secrets/api/.env"
+	set := func(args ...string) error {
+		fresh()
+		return setCmdFn(context.Background(), setOpts{File: uri, KeyStore: "mock", FmtOpts: &fmtOpts{}}, args...)
+	}
+
+	if err := set("API_KEY=s3cret"); err != nil {
+		t.Fatalf("set on new object unexpected error: %v", err)
+	}
+	if err := set("PORT=8080"); err != nil {
+		t.Fatalf("set on existing object unexpected error: %v", err)
+	}
+	if bucket.generation != 2 || strings.Contains(string(bucket.data), "s3cret") {
+		t.Errorf("object at generation %d holds %q, want 2 writes with encrypted values", bucket.generation, bucket.data)
+	}
+
+	fresh()
+	output, err := captureStdout(t, func() error {
+		return getCmdFn(context.Background(), getOpts{File: uri, KeyStore: "mock", FmtOpts: &fmtOpts{}})
+	})
+	if err != nil {
+		t.Fatalf("get unexpected error: %v", err)
+	}
+	if output != "API_KEY=s3cret\nPORT=8080\n" {
+		t.Errorf("get output = %q", output)
+	}
+
+	// Someone else writes the object after it was read
+	fresh()
+	if _, err := readObject(uri); err != nil {
+		t.Fatal(err)
+	}
+	bucket.generation++
+	err = setCmdFn(context.Background(), setOpts{File: uri, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "PORT=9090")
+	if err == nil || !strings.Contains(err.Error(), "changed since it was read") {
+		t.Errorf("set after a concurrent write error = %v, want a conflict", err)
+	}
+}
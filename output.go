@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/almahoozi/envx/pkg/diff"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+	"golang.org/x/term"
+)
+
+// noColor disables colored output
+var noColor bool
+
+// quiet silences notices and warnings. Data always goes to stdout and
+// errors, prompts and diagnostics to stderr, so scripts can capture stdout
+// whether or not quiet is set.
+var quiet bool
+
+// diagf writes a notice or warning to stderr unless --quiet is set
+func diagf(format string, args ...any) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// stdoutIsTerminal reports whether stdout is attached to a terminal. Tests
+// replace it to exercise terminal output.
+var stdoutIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// terminalWidth returns the width in columns of the terminal on stdout, or
+// 0 when stdout is not a terminal. Tests replace it.
+var terminalWidth = func() int {
+	if !stdoutIsTerminal() {
+		return 0
+	}
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// ellipsis marks a line cut short by truncateLine
+const ellipsis = "…"
+
+// truncateLine shortens line to fit in width terminal columns, ending it
+// with an ellipsis, so long values such as JWTs and certificates do not
+// flood the terminal. A multi-line value is cut at its first line break.
+// Characters are never split, and wide ones take two columns. A width of 0
+// or less leaves line as is.
+func truncateLine(line string, width int) string {
+	if width <= 0 {
+		return line
+	}
+	first, _, multiline := strings.Cut(line, "\n")
+	if !multiline && displayWidth(first) <= width {
+		return first
+	}
+
+	limit := width - displayWidth(ellipsis)
+	columns := 0
+	for i, r := range first {
+		w := runeWidth(r)
+		if columns+w > limit {
+			return first[:i] + ellipsis
+		}
+		columns += w
+	}
+	return first + ellipsis
+}
+
+// displayWidth returns the number of terminal columns s takes
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth approximates the terminal columns r takes: none for combining
+// marks and control characters, two for East Asian wide characters and
+// emoji, one for the rest
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || (r >= 0x7f && r < 0xa0), unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f,              // CJK
+		r >= 0xac00 && r <= 0xd7a3,                             // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff,                             // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f,                             // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, r >= 0xffe0 && r <= 0xffe6, // fullwidth forms
+		r >= 0x1f300 && r <= 0x1f64f, r >= 0x1f900 && r <= 0x1f9ff, // emoji
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// useColor reports whether output to stdout should be colored, honoring
+// --no-color and the NO_COLOR convention (https://no-color.org)
+func useColor() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return stdoutIsTerminal()
+}
+
+// writeJSON writes v to w as a single line of JSON. Commands print the
+// documented structs of their --json output with it so the schemas stay
+// stable for scripts.
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// showDiff reports whether printed results should be shown as a diff against
+// the file rather than the full contents. Diffs are only used for env output
+// on a terminal, so piping the output still yields a complete file.
+func showDiff(format Format) bool {
+	return format == FormatEnv && stdoutIsTerminal()
+}
+
+// printDiff prints a unified diff between the current contents of file and
+// vars rendered in format, with rotations recorded
+func printDiff(ctx context.Context, file string, vars env.Variables, format Format, rotations ...env.Rotation) error {
+	content, err := renderEnvFile(ctx, file, vars, format, rotations...)
+	if err != nil {
+		return err
+	}
+	var current []byte
+	if remote.IsObjectURI(file) {
+		current, err = readObject(file)
+	} else {
+		current, err = os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s file: %w", file, err)
+	}
+
+	unified := diff.Unified(file, file, string(current), content, 3)
+	if unified == "" {
+		diagf("%s: no changes\n", file)
+		return nil
+	}
+	writeDiff(os.Stdout, unified, useColor())
+	return nil
+}
+
+// writeDiff writes a unified diff, coloring removed, added and hunk header lines
+func writeDiff(w io.Writer, unified string, color bool) {
+	if !color {
+		_, _ = io.WriteString(w, unified)
+		return
+	}
+
+	for _, line := range strings.SplitAfter(unified, "\n") {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(text, "---"), strings.HasPrefix(text, "+++"):
+			_, _ = fmt.Fprintln(w, colorBold+text+colorReset)
+		case strings.HasPrefix(text, "@@"):
+			_, _ = fmt.Fprintln(w, colorCyan+text+colorReset)
+		case strings.HasPrefix(text, "-"):
+			_, _ = fmt.Fprintln(w, colorRed+text+colorReset)
+		case strings.HasPrefix(text, "+"):
+			_, _ = fmt.Fprintln(w, colorGreen+text+colorReset)
+		default:
+			_, _ = fmt.Fprintln(w, text)
+		}
+	}
+}
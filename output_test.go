@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/policy"
+)
+
+func TestUseColor(t *testing.T) {
+	original := stdoutIsTerminal
+	defer func() { stdoutIsTerminal = original }()
+
+	tests := []struct {
+		name     string
+		terminal bool
+		noColor  bool
+		env      string
+		expected bool
+	}{
+		{name: "terminal", terminal: true, expected: true},
+		{name: "pipe", terminal: false, expected: false},
+		{name: "--no-color", terminal: true, noColor: true, expected: false},
+		{name: "NO_COLOR", terminal: true, env: "1", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdoutIsTerminal = func() bool { return tt.terminal }
+			noColor = tt.noColor
+			defer func() { noColor = false }()
+			t.Setenv("NO_COLOR", tt.env)
+
+			if got := useColor(); got != tt.expected {
+				t.Errorf("useColor() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	unified := "--- .env\n+++ .env\n@@ -1,1 +1,1 @@\n-A=1\n+A=2\n"
+
+	var plain strings.Builder
+	writeDiff(&plain, unified, false)
+	if plain.String() != unified {
+		t.Errorf("writeDiff() without color = %q, want %q", plain.String(), unified)
+	}
+
+	var colored strings.Builder
+	writeDiff(&colored, unified, true)
+	for _, want := range []string{colorRed + "-A=1" + colorReset, colorGreen + "+A=2" + colorReset, colorCyan + "@@ -1,1 +1,1 @@" + colorReset} {
+		if !strings.Contains(colored.String(), want) {
+			t.Errorf("writeDiff() with color missing %q in %q", want, colored.String())
+		}
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		width    int
+		expected string
+	}{
+		{name: "fits", line: "A=short", width: 10, expected: "A=short"},
+		{name: "exact", line: "A=12345678", width: 10, expected: "A=12345678"},
+		{name: "too long", line: "JWT=eyJhbGciOiJIUzI1NiJ9", width: 10, expected: "JWT=eyJhb…"},
+		{name: "no limit", line: "JWT=eyJhbGciOiJIUzI1NiJ9", width: 0, expected: "JWT=eyJhbGciOiJIUzI1NiJ9"},
+		{name: "multi-line", line: "CERT=-----BEGIN\nMIIB\n", width: 40, expected: "CERT=-----BEGIN…"},
+		{name: "multi-byte", line: "A=ééééééééé", width: 6, expected: "A=ééé…"},
+		{name: "wide", line: "A=日本語テキスト", width: 7, expected: "A=日本…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateLine(tt.line, tt.width)
+			if got != tt.expected {
+				t.Errorf("truncateLine(%q, %d) = %q, want %q", tt.line, tt.width, got, tt.expected)
+			}
+			if tt.width > 0 && displayWidth(got) > tt.width {
+				t.Errorf("truncateLine(%q, %d) is %d columns wide", tt.line, tt.width, displayWidth(got))
+			}
+		})
+	}
+}
+
+func TestGetTruncatesOnTerminal(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	original := terminalWidth
+	defer func() { terminalWidth = original }()
+	terminalWidth = func() int { return 12 }
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=eyJhbGciOiJIUzI1NiJ9\nPORT=80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		full     bool
+		expected string
+	}{
+		{name: "truncated", expected: "TOKEN=eyJhb…\nPORT=80\n"},
+		{name: "--full", full: true, expected: "TOKEN=eyJhbGciOiJIUzI1NiJ9\nPORT=80\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := captureStdout(t, func() error {
+				return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, Full: tt.full})
+			})
+			if err != nil {
+				t.Fatalf("getCmdFn() error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("getCmdFn() output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	rotationNow = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+	defer func() { rotationNow = time.Now }()
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	content := "# envx:rotate-after API_SECRET 2026-10-01 every 30d\nAPI_SECRET=changeme\nbroken\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policyFile := writePolicy(t, `{"rules": [{"name": "secrets", "keys": ["*_SECRET"], "encrypted": true}]}`)
+	t.Setenv("ENVX_ENCRYPT_PATTERNS", "*_SECRET")
+
+	tests := []struct {
+		name string
+		run  func() error
+		got  any
+		want any
+	}{
+		{
+			name: "ls",
+			run:  func() error { return lsCmdFn(context.Background(), lsOpts{File: envFile, JSON: true}) },
+			got:  &[]envFileInfo{},
+			want: &[]envFileInfo{
+				{Path: envFile, Selected: true, Exists: true, Size: int64(len(content)), Vars: 1, Values: 1},
+				{Path: envFile + ".local"},
+			},
+		},
+		{
+			name: "which",
+			run: func() error {
+				return whichCmdFn(context.Background(), explainOpts{File: envFile, Name: "prod", JSON: true})
+			},
+			got:  &whichReport{},
+			want: &whichReport{File: envFile + ".prod"},
+		},
+		{
+			name: "lint",
+			run: func() error {
+				return lintCmdFn(context.Background(), lintOpts{File: envFile, JSON: true, RequireEncrypted: true})
+			},
+			got: &[]lintIssue{},
+			want: &[]lintIssue{
+				{File: envFile, Line: 3, Column: 1, Message: "skipped malformed line: missing '='"},
+				{File: envFile, Key: "API_SECRET", Message: "holds a plaintext value but must be encrypted"},
+			},
+		},
+		{
+			name: "expiring",
+			run: func() error {
+				return expiringCmdFn(context.Background(), expiringOpts{File: envFile, Within: "0d", JSON: true})
+			},
+			got:  &[]rotationReport{},
+			want: &[]rotationReport{{Key: "API_SECRET", Due: "2026-10-01", Every: "30d", Days: -15}},
+		},
+		{
+			name: "policy check",
+			run: func() error {
+				return policyCheckCmdFn(context.Background(), policyCheckOpts{File: envFile, KeyStore: "mock", Policy: policyFile, JSON: true})
+			},
+			got:  &policyReport{},
+			want: &policyReport{File: envFile, Violations: []policy.Violation{{Key: "API_SECRET", Rule: "secrets", Message: "value must be encrypted"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := captureStdout(t, tt.run)
+			if err := json.Unmarshal([]byte(out), tt.got); err != nil {
+				t.Fatalf("printed invalid JSON %q: %v", out, err)
+			}
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("printed %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("A=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKeyWithType(KeyStoreTypeMock); err != nil {
+		t.Fatal(err)
+	}
+	get := func() error {
+		return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "A")
+	}
+
+	for _, q := range []bool{false, true} {
+		quiet = q
+		var stdout string
+		stderr, err := captureStderr(t, func() error {
+			var err error
+			stdout, err = captureStdout(t, get)
+			return err
+		})
+		quiet = false
+		if err != nil {
+			t.Fatalf("getCmdFn() unexpected error: %v", err)
+		}
+		if stdout != "A=1\n" {
+			t.Errorf("quiet=%v: stdout = %q, want only the data", q, stdout)
+		}
+		if warned := strings.Contains(stderr, "has mode 0644"); warned == q {
+			t.Errorf("quiet=%v: stderr = %q", q, stderr)
+		}
+	}
+}
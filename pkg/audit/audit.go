@@ -0,0 +1,133 @@
+// Package audit records which secrets were accessed, by whom and when, in an
+// append-only log of JSON lines, optionally forwarding each entry elsewhere.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is a single recorded access
+type Entry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Command  string    `json:"command"`
+	File     string    `json:"file"`
+	Keys     []string  `json:"keys"`
+	KeyStore string    `json:"keystore"`
+}
+
+// String formats the entry as a single human readable line
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %s %s %s (%s) %s", e.Time.Format(time.RFC3339), e.User, e.Command, e.File, e.KeyStore, strings.Join(e.Keys, ","))
+}
+
+// Sink receives recorded entries
+type Sink interface {
+	Record(e Entry) error
+}
+
+// FileLog appends entries as JSON lines to a file, creating it and its
+// directory with owner-only permissions. Existing entries are never rewritten.
+type FileLog struct {
+	Path string
+}
+
+// NewFileLog creates a log appending to path
+func NewFileLog(path string) *FileLog {
+	return &FileLog{Path: path}
+}
+
+// DefaultPath returns the default audit log location
+func DefaultPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".envx", "audit.log")
+	}
+	return filepath.Join(homeDir, ".config", "envx", "audit.log")
+}
+
+// Record appends e to the log
+func (l *FileLog) Record(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600) // #nosec G304 -- Audit log path is user configured
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.Path, err)
+	}
+	// A single write keeps concurrent entries from interleaving
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+// Read returns the entries in the log in the order they were recorded. A
+// missing log has no entries.
+func (l *FileLog) Read() ([]Entry, error) {
+	f, err := os.Open(l.Path) // #nosec G304 -- Audit log path is user configured
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log %s: %w", l.Path, err)
+	}
+	defer func() { _ = f.Close() }()
+	return Parse(f)
+}
+
+// Parse reads entries written as JSON lines, reporting the line of the first
+// entry that cannot be decoded
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid audit entry on line %d: %w", lineNo, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Multi records each entry to every sink, attempting all of them and joining
+// their errors
+type Multi []Sink
+
+// Record records e to every sink
+func (m Multi) Record(e Entry) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Record(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "audit.log")
+	log := NewFileLog(path)
+
+	entries, err := log.Read()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Read() of a missing log = %v, %v", entries, err)
+	}
+
+	want := []Entry{
+		{Time: time.Unix(100, 0).UTC(), User: "alice", Command: "get", File: ".env", Keys: []string{"A"}, KeyStore: "macos"},
+		{Time: time.Unix(200, 0).UTC(), User: "bob", Command: "run", File: ".env.prod", Keys: []string{"A", "B"}, KeyStore: "password"},
+	}
+	for _, e := range want {
+		if err := log.Record(e); err != nil {
+			t.Fatalf("Record() unexpected error: %v", err)
+		}
+	}
+
+	got, err := log.Read()
+	if err != nil {
+		t.Fatalf("Read() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("audit log permissions = %o, want 600", perm)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("{\"user\":\"a\"}\n\nnot json\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Parse() error = %v, want line 3", err)
+	}
+}
+
+type failingSink struct{ err error }
+
+func (f failingSink) Record(Entry) error { return f.err }
+
+func TestMulti(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	boom := errors.New("boom")
+	sinks := Multi{failingSink{boom}, NewFileLog(path)}
+
+	err := sinks.Record(Entry{User: "alice"})
+	if !errors.Is(err, boom) {
+		t.Errorf("Multi.Record() error = %v, want %v", err, boom)
+	}
+	// Later sinks still receive the entry
+	entries, _ := NewFileLog(path).Read()
+	if len(entries) != 1 {
+		t.Errorf("Multi.Record() wrote %d entries, want 1", len(entries))
+	}
+}
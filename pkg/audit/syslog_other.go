@@ -0,0 +1,20 @@
+//go:build !unix
+
+package audit
+
+import "errors"
+
+// Syslog forwards entries to the local syslog daemon, which this platform lacks
+type Syslog struct {
+	Tag string
+}
+
+// NewSyslog creates a sink logging under tag
+func NewSyslog(tag string) *Syslog {
+	return &Syslog{Tag: tag}
+}
+
+// Record always fails since syslog is not supported on this platform
+func (s *Syslog) Record(e Entry) error {
+	return errors.New("syslog is not supported on this platform")
+}
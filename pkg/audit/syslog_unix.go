@@ -0,0 +1,37 @@
+//go:build unix
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// Syslog forwards entries as JSON to the local syslog daemon
+type Syslog struct {
+	Tag string
+}
+
+// NewSyslog creates a sink logging under tag with the auth facility
+func NewSyslog(tag string) *Syslog {
+	return &Syslog{Tag: tag}
+}
+
+// Record sends e to syslog
+func (s *Syslog) Record(e Entry) error {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, s.Tag)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if err := w.Info(string(line)); err != nil {
+		return fmt.Errorf("failed to write to syslog: %w", err)
+	}
+	return nil
+}
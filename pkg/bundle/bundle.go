@@ -0,0 +1,150 @@
+// Package bundle packs keys, salts and env files into a single
+// passphrase-encrypted archive for moving envx setups between machines.
+package bundle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// Magic identifies envx bundle files
+	Magic = "ENVXBNDL"
+	// Version is the current bundle format version
+	Version = 1
+	// Iterations is the PBKDF2 iteration count used to derive the bundle key
+	Iterations = 600000
+	// minIterations and maxIterations bound the iteration count Open accepts
+	// from a bundle header, so a crafted bundle cannot make it hang
+	minIterations = 1000
+	maxIterations = 10 * Iterations
+	saltSize      = 32
+	keySize       = 32
+)
+
+// sealIterations is the iteration count used by Seal; tests lower it
+var sealIterations = Iterations
+
+// ErrWrongPassphrase is returned when a bundle cannot be opened with the given passphrase
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted bundle")
+
+// Bundle is the content of an archive
+type Bundle struct {
+	// Key is the raw encryption key, if it was exported
+	Key []byte `json:"key,omitempty"`
+	// Salts maps salt file names to their contents
+	Salts map[string][]byte `json:"salts,omitempty"`
+	// Files maps env file paths to their contents
+	Files map[string][]byte `json:"files,omitempty"`
+}
+
+// Seal serializes and encrypts the bundle with a key derived from passphrase
+func Seal(b *Bundle, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	gcm, err := newGCM(passphrase, salt, sealIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.WriteByte(Version)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(sealIterations))
+	buf.Write(salt)
+	header := bytes.Clone(buf.Bytes())
+	buf.Write(nonce)
+	buf.Write(gcm.Seal(nil, nonce, plaintext, header))
+
+	return buf.Bytes(), nil
+}
+
+// Open decrypts and deserializes a bundle produced by Seal
+func Open(data []byte, passphrase string) (*Bundle, error) {
+	headerSize := len(Magic) + 1 + 4 + saltSize
+	if len(data) < headerSize || string(data[:len(Magic)]) != Magic {
+		return nil, errors.New("not an envx bundle")
+	}
+	if version := data[len(Magic)]; version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", version)
+	}
+
+	r := bytes.NewReader(data[len(Magic)+1:])
+	var iterations uint32
+	if err := binary.Read(r, binary.BigEndian, &iterations); err != nil {
+		return nil, errors.New("truncated bundle header")
+	}
+	if iterations < minIterations || iterations > maxIterations {
+		return nil, fmt.Errorf("bundle iteration count %d is outside %d-%d", iterations, minIterations, maxIterations)
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, errors.New("truncated bundle header")
+	}
+
+	gcm, err := newGCM(passphrase, salt, int(iterations))
+	if err != nil {
+		return nil, err
+	}
+
+	rest := data[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("truncated bundle")
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, data[:headerSize])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	b := new(Bundle)
+	if err := json.Unmarshal(plaintext, b); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %w", err)
+	}
+	return b, nil
+}
+
+// newGCM derives the bundle key from the passphrase and returns an AES-GCM cipher
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, errors.New("invalid iteration count")
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive bundle key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
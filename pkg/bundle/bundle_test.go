@@ -0,0 +1,83 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	defer lowerIterations()()
+
+	original := &Bundle{
+		Key:   bytes.Repeat([]byte{7}, 32),
+		Salts: map[string][]byte{"alice.salt": bytes.Repeat([]byte{1}, 32)},
+		Files: map[string][]byte{".env": []byte("KEY=value\n")},
+	}
+
+	sealed, err := Seal(original, "correct horse")
+	if err != nil {
+		t.Fatalf("Seal() unexpected error: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("KEY=value")) {
+		t.Error("Seal() output contains plaintext file content")
+	}
+
+	opened, err := Open(sealed, "correct horse")
+	if err != nil {
+		t.Fatalf("Open() unexpected error: %v", err)
+	}
+	if !bytes.Equal(opened.Key, original.Key) {
+		t.Error("Open() key does not match")
+	}
+	if !bytes.Equal(opened.Salts["alice.salt"], original.Salts["alice.salt"]) {
+		t.Error("Open() salt does not match")
+	}
+	if string(opened.Files[".env"]) != "KEY=value\n" {
+		t.Errorf("Open() file = %q", opened.Files[".env"])
+	}
+
+	if _, err := Open(sealed, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open() with wrong passphrase error = %v, want ErrWrongPassphrase", err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(Magic)+5] ^= 0xff // the header is authenticated
+	if _, err := Open(tampered, "correct horse"); err == nil {
+		t.Error("Open() with tampered header expected error")
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":     nil,
+		"bad magic": []byte("NOTABUNDLE-------------------------------------------------"),
+		"truncated": []byte(Magic + "\x01\x00"),
+	}
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Open(data, "passphrase"); err == nil {
+				t.Error("Open() expected error but got none")
+			}
+		})
+	}
+
+	for _, iterations := range []uint32{0, 1, maxIterations + 1, 1<<32 - 1} {
+		header := binary.BigEndian.AppendUint32([]byte(Magic+"\x01"), iterations)
+		data := append(header, make([]byte, saltSize+64)...)
+		if _, err := Open(data, "passphrase"); err == nil || errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("Open() with %d iterations error = %v, want an iteration count error", iterations, err)
+		}
+	}
+
+	if _, err := Seal(&Bundle{}, ""); err == nil {
+		t.Error("Seal() with empty passphrase expected error")
+	}
+}
+
+// lowerIterations speeds up key derivation for tests and returns a restore func
+func lowerIterations() func() {
+	sealIterations = 1000
+	return func() { sealIterations = Iterations }
+}
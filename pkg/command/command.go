@@ -0,0 +1,26 @@
+// Package command runs the external CLIs envx drives, such as tpm2-tools,
+// cloud and secret manager CLIs and hosting platform CLIs.
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Run runs name with stdin, when not nil, returning stdout or an error that
+// includes stderr
+func Run(stdin []byte, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...) // #nosec G204 -- Callers run fixed executables with generated arguments
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
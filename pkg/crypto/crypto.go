@@ -1,27 +1,69 @@
 package crypto
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/almahoozi/envx/pkg/secure"
 )
 
 const (
 	MagicPrefix = "envx"
 	KeySize     = 32 // 256-bit key
+	nonceSize   = 12 // standard AES-GCM nonce
+)
+
+// Errors returned, wrapped, by Decrypt to tell apart why a value failed
+var (
+	// ErrAuthentication means the value did not authenticate: it was encrypted
+	// with a different key or modified after encryption
+	ErrAuthentication = errors.New("message authentication failed")
+	// ErrMalformed means the value has the envx prefix but is too short to
+	// hold a nonce and authentication tag
+	ErrMalformed = errors.New("ciphertext too short")
+	// ErrTruncated means the value is not valid base64 but its decodable part
+	// starts like an encrypted value, typically because it was cut off when
+	// copied
+	ErrTruncated = errors.New("invalid base64 in encrypted value")
 )
 
-// Encryptor defines the interface for encryption operations
+// Format describes a version of the encrypted value format
+type Format struct {
+	Version int
+	Cipher  string
+}
+
+// Formats lists the encrypted value formats Decrypt reads, the last being the
+// one Encrypt writes. Version 1 is MagicPrefix followed by the GCM nonce,
+// ciphertext and tag, base64 encoded.
+var Formats = []Format{{Version: 1, Cipher: "AES-256-GCM"}}
+
+// Encryptor defines the interface for encryption operations. Encrypt and
+// Decrypt take a context so encryptors backed by a remote service, such as
+// a KMS, can be cancelled and time out.
 type Encryptor interface {
-	Encrypt(plaintext string, key []byte) (string, error)
-	Decrypt(ciphertext string, key []byte) (string, error)
+	Encrypt(ctx context.Context, plaintext string, key []byte) (string, error)
+	Decrypt(ctx context.Context, ciphertext string, key []byte) (string, error)
 	IsEncrypted(value string) bool
 }
 
+// Fingerprint returns a short, non-secret identifier for a key, suitable for
+// telling keys apart in messages
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(append([]byte("envx-fingerprint:"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
 // AESEncryptor implements the Encryptor interface using AES-GCM
 type AESEncryptor struct{}
 
@@ -31,7 +73,10 @@ func NewAESEncryptor() *AESEncryptor {
 }
 
 // Encrypt encrypts a plaintext string using AES-GCM encryption
-func (e *AESEncryptor) Encrypt(plaintext string, key []byte) (string, error) {
+func (e *AESEncryptor) Encrypt(ctx context.Context, plaintext string, key []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if len(key) != KeySize {
 		return "", fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
 	}
@@ -42,6 +87,7 @@ func (e *AESEncryptor) Encrypt(plaintext string, key []byte) (string, error) {
 	}
 
 	plaintextBytes := []byte(plaintext)
+	defer secure.Zero(plaintextBytes)
 	ciphertext, err := e.encryptAES(key, plaintextBytes)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt: %w", err)
@@ -53,15 +99,67 @@ func (e *AESEncryptor) Encrypt(plaintext string, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
+// EncryptDeterministic encrypts plaintext like Encrypt, but derives the
+// nonce from the key, the variable name and the plaintext instead of picking
+// it at random. The same value of the same variable always encrypts to the
+// same ciphertext, so unchanged values do not show up in diffs; in exchange
+// anyone who can read the file can tell when values are equal or unchanged.
+// Decrypt reads the result like any other encrypted value.
+func (e *AESEncryptor) EncryptDeterministic(ctx context.Context, name, plaintext string, key []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(key) != KeySize {
+		return "", fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
+	}
+
+	if e.IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+
+	plaintextBytes := []byte(plaintext)
+	defer secure.Zero(plaintextBytes)
+	ciphertext, err := e.sealAES(key, deterministicNonce(key, name, plaintextBytes), plaintextBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	ciphertext = append([]byte(MagicPrefix), ciphertext...)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// deterministicNonce returns HMAC(key', name || 0 || plaintext) truncated to
+// the GCM nonce size, where key' is derived from key so the nonce key is not
+// the encryption key itself
+func deterministicNonce(key []byte, name string, plaintext []byte) []byte {
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("envx-deterministic-nonce"))
+	nonceKey := derive.Sum(nil)
+	defer secure.Zero(nonceKey)
+
+	mac := hmac.New(sha256.New, nonceKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(plaintext)
+	return mac.Sum(nil)[:nonceSize]
+}
+
 // Decrypt decrypts a ciphertext string using AES-GCM decryption
-func (e *AESEncryptor) Decrypt(ciphertext string, key []byte) (string, error) {
+func (e *AESEncryptor) Decrypt(ctx context.Context, ciphertext string, key []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if len(key) != KeySize {
 		return "", fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
 	}
 
-	// First try to decode the value as base64, if that fails it's not encrypted
+	// First try to decode the value as base64, if that fails it's not
+	// encrypted unless it is an encrypted value cut off mid-block
 	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
+		if isTruncated(ciphertext) {
+			return "", fmt.Errorf("failed to decrypt: %w", ErrTruncated)
+		}
 		return ciphertext, nil // Not base64, return as-is
 	}
 
@@ -75,6 +173,7 @@ func (e *AESEncryptor) Decrypt(ciphertext string, key []byte) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt: %w", err)
 	}
+	defer secure.Zero(plaintext)
 
 	return string(plaintext), nil
 }
@@ -89,8 +188,32 @@ func (e *AESEncryptor) IsEncrypted(value string) bool {
 	return len(decoded) > len(MagicPrefix) && strings.HasPrefix(string(decoded), MagicPrefix)
 }
 
-// encryptAES performs AES-GCM encryption
+// isTruncated reports whether value, which is not valid base64, is an
+// encrypted value cut off: it only uses the base64 alphabet and its longest
+// decodable prefix holds the magic prefix and a nonce. Plaintext that merely
+// starts like an encrypted value has other characters or is shorter.
+func isTruncated(value string) bool {
+	if strings.TrimLeft(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=") != "" {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value[:len(value)-len(value)%4])
+	if err != nil {
+		return false
+	}
+	return len(decoded) >= len(MagicPrefix)+nonceSize && strings.HasPrefix(string(decoded), MagicPrefix)
+}
+
+// encryptAES performs AES-GCM encryption with a random nonce
 func (e *AESEncryptor) encryptAES(key, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return e.sealAES(key, nonce, plaintext)
+}
+
+// sealAES performs AES-GCM encryption with the given nonce
+func (e *AESEncryptor) sealAES(key, nonce, plaintext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -100,14 +223,11 @@ func (e *AESEncryptor) encryptAES(key, plaintext []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size: expected %d bytes, got %d", gcm.NonceSize(), len(nonce))
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	return gcm.Seal(append([]byte{}, nonce...), nonce, plaintext, nil), nil
 }
 
 // decryptAES performs AES-GCM decryption
@@ -122,14 +242,14 @@ func (e *AESEncryptor) decryptAES(key, ciphertext []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	if len(ciphertext) < gcm.NonceSize() {
-		return nil, fmt.Errorf("ciphertext too short")
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrMalformed
 	}
 
 	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return nil, err
+		return nil, ErrAuthentication
 	}
 
 	return plaintext, nil
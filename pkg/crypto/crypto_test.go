@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -72,7 +75,7 @@ func TestAESEncryptor_Encrypt(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := encryptor.Encrypt(tt.plaintext, tt.key)
+			result, err := encryptor.Encrypt(context.Background(), tt.plaintext, tt.key)
 
 			if tt.wantErr {
 				if err == nil {
@@ -124,7 +127,7 @@ func TestAESEncryptor_Decrypt(t *testing.T) {
 			key:       key,
 			wantErr:   false,
 			setupFunc: func(plain string, k []byte) string {
-				encrypted, _ := encryptor.Encrypt(plain, k)
+				encrypted, _ := encryptor.Encrypt(context.Background(), plain, k)
 				return encrypted
 			},
 		},
@@ -134,7 +137,7 @@ func TestAESEncryptor_Decrypt(t *testing.T) {
 			key:       key,
 			wantErr:   false,
 			setupFunc: func(plain string, k []byte) string {
-				encrypted, _ := encryptor.Encrypt(plain, k)
+				encrypted, _ := encryptor.Encrypt(context.Background(), plain, k)
 				return encrypted
 			},
 		},
@@ -144,7 +147,7 @@ func TestAESEncryptor_Decrypt(t *testing.T) {
 			key:       key,
 			wantErr:   false,
 			setupFunc: func(plain string, k []byte) string {
-				encrypted, _ := encryptor.Encrypt(plain, k)
+				encrypted, _ := encryptor.Encrypt(context.Background(), plain, k)
 				return encrypted
 			},
 		},
@@ -177,7 +180,7 @@ func TestAESEncryptor_Decrypt(t *testing.T) {
 				if _, err := rand.Read(validKey); err != nil {
 					t.Fatal(err)
 				}
-				encrypted, _ := encryptor.Encrypt(plain, validKey)
+				encrypted, _ := encryptor.Encrypt(context.Background(), plain, validKey)
 				return encrypted
 			},
 		},
@@ -187,7 +190,7 @@ func TestAESEncryptor_Decrypt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ciphertext := tt.setupFunc(tt.plaintext, tt.key)
 
-			result, err := encryptor.Decrypt(ciphertext, tt.key)
+			result, err := encryptor.Decrypt(context.Background(), ciphertext, tt.key)
 
 			if tt.wantErr {
 				if err == nil {
@@ -241,7 +244,7 @@ func TestAESEncryptor_IsEncrypted(t *testing.T) {
 
 	for _, plaintext := range plaintexts {
 		t.Run("encrypted_"+plaintext, func(t *testing.T) {
-			encrypted, err := encryptor.Encrypt(plaintext, key)
+			encrypted, err := encryptor.Encrypt(context.Background(), plaintext, key)
 			if err != nil {
 				t.Fatalf("Failed to encrypt test data: %v", err)
 			}
@@ -273,7 +276,7 @@ func TestAESEncryptor_EncryptDecryptRoundTrip(t *testing.T) {
 	for _, plaintext := range testCases {
 		t.Run("roundtrip_"+plaintext, func(t *testing.T) {
 			// Encrypt
-			encrypted, err := encryptor.Encrypt(plaintext, key)
+			encrypted, err := encryptor.Encrypt(context.Background(), plaintext, key)
 			if err != nil {
 				t.Fatalf("Encrypt failed: %v", err)
 			}
@@ -284,7 +287,7 @@ func TestAESEncryptor_EncryptDecryptRoundTrip(t *testing.T) {
 			}
 
 			// Decrypt
-			decrypted, err := encryptor.Decrypt(encrypted, key)
+			decrypted, err := encryptor.Decrypt(context.Background(), encrypted, key)
 			if err != nil {
 				t.Fatalf("Decrypt failed: %v", err)
 			}
@@ -307,13 +310,13 @@ func TestAESEncryptor_EncryptTwiceSameResult(t *testing.T) {
 	plaintext := "test data"
 
 	// First encryption
-	encrypted1, err := encryptor.Encrypt(plaintext, key)
+	encrypted1, err := encryptor.Encrypt(context.Background(), plaintext, key)
 	if err != nil {
 		t.Fatalf("First encryption failed: %v", err)
 	}
 
 	// Second encryption of already encrypted data should return same result
-	encrypted2, err := encryptor.Encrypt(encrypted1, key)
+	encrypted2, err := encryptor.Encrypt(context.Background(), encrypted1, key)
 	if err != nil {
 		t.Fatalf("Second encryption failed: %v", err)
 	}
@@ -323,6 +326,62 @@ func TestAESEncryptor_EncryptTwiceSameResult(t *testing.T) {
 	}
 }
 
+func TestAESEncryptor_EncryptDeterministic(t *testing.T) {
+	encryptor := NewAESEncryptor()
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	otherKey := make([]byte, KeySize)
+	if _, err := rand.Read(otherKey); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(name, plaintext string, key []byte) string {
+		t.Helper()
+		ciphertext, err := encryptor.EncryptDeterministic(context.Background(), name, plaintext, key)
+		if err != nil {
+			t.Fatalf("EncryptDeterministic(%q) failed: %v", name, err)
+		}
+		return ciphertext
+	}
+
+	first := encrypt("API_KEY", "secret", key)
+	if again := encrypt("API_KEY", "secret", key); again != first {
+		t.Errorf("EncryptDeterministic() is not stable: %q != %q", first, again)
+	}
+	decrypted, err := encryptor.Decrypt(context.Background(), first, key)
+	if err != nil || decrypted != "secret" {
+		t.Errorf("Decrypt() = %q, %v; want secret", decrypted, err)
+	}
+
+	tests := []struct {
+		name      string
+		varName   string
+		plaintext string
+		key       []byte
+	}{
+		{"different value", "API_KEY", "secret2", key},
+		{"different variable", "OTHER_KEY", "secret", key},
+		{"different key", "API_KEY", "secret", otherKey},
+		{"name and value boundary", "API_KEYs", "ecret", key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encrypt(tt.varName, tt.plaintext, tt.key); got == first {
+				t.Errorf("EncryptDeterministic(%q, %q) matched the API_KEY ciphertext", tt.varName, tt.plaintext)
+			}
+		})
+	}
+
+	if again := encrypt("API_KEY", first, key); again != first {
+		t.Error("EncryptDeterministic() re-encrypted an encrypted value")
+	}
+	if _, err := encryptor.EncryptDeterministic(context.Background(), "API_KEY", "secret", key[:16]); err == nil {
+		t.Error("EncryptDeterministic() expected error for an invalid key size")
+	}
+}
+
 func TestAESEncryptor_DifferentKeysProduceDifferentResults(t *testing.T) {
 	encryptor := NewAESEncryptor()
 
@@ -337,12 +396,12 @@ func TestAESEncryptor_DifferentKeysProduceDifferentResults(t *testing.T) {
 
 	plaintext := "test data"
 
-	encrypted1, err := encryptor.Encrypt(plaintext, key1)
+	encrypted1, err := encryptor.Encrypt(context.Background(), plaintext, key1)
 	if err != nil {
 		t.Fatalf("Encryption with key1 failed: %v", err)
 	}
 
-	encrypted2, err := encryptor.Encrypt(plaintext, key2)
+	encrypted2, err := encryptor.Encrypt(context.Background(), plaintext, key2)
 	if err != nil {
 		t.Fatalf("Encryption with key2 failed: %v", err)
 	}
@@ -352,17 +411,97 @@ func TestAESEncryptor_DifferentKeysProduceDifferentResults(t *testing.T) {
 	}
 
 	// Verify cross-decryption fails
-	_, err = encryptor.Decrypt(encrypted1, key2)
+	_, err = encryptor.Decrypt(context.Background(), encrypted1, key2)
 	if err == nil {
 		t.Errorf("Decryption with wrong key should have failed")
 	}
 
-	_, err = encryptor.Decrypt(encrypted2, key1)
+	_, err = encryptor.Decrypt(context.Background(), encrypted2, key1)
 	if err == nil {
 		t.Errorf("Decryption with wrong key should have failed")
 	}
 }
 
+func TestFingerprint(t *testing.T) {
+	key1 := make([]byte, KeySize)
+	key2 := make([]byte, KeySize)
+	key2[0] = 1
+
+	fp := Fingerprint(key1)
+	if len(fp) != 16 {
+		t.Errorf("Fingerprint() length = %d, want 16", len(fp))
+	}
+	if fp != Fingerprint(key1) {
+		t.Error("Fingerprint() is not deterministic")
+	}
+	if fp == Fingerprint(key2) {
+		t.Error("Fingerprint() returned the same value for different keys")
+	}
+}
+
+func TestAESEncryptor_DecryptErrors(t *testing.T) {
+	encryptor := NewAESEncryptor()
+	key := make([]byte, KeySize)
+	otherKey := make([]byte, KeySize)
+	otherKey[0] = 1
+
+	ciphertext, err := encryptor.Encrypt(context.Background(), "secret value", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  error
+	}{
+		{"wrong key", ciphertext, ErrAuthentication},
+		{"truncated", ciphertext[:len(ciphertext)-3], ErrTruncated},
+		{"too short", base64.StdEncoding.EncodeToString([]byte(MagicPrefix + "abc")), ErrMalformed},
+		{"no room for the tag", base64.StdEncoding.EncodeToString([]byte(MagicPrefix + strings.Repeat("n", 20))), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decryptKey := key
+			if tt.want == ErrAuthentication {
+				decryptKey = otherKey
+			}
+			_, err := encryptor.Decrypt(context.Background(), tt.value, decryptKey)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAESEncryptor_DecryptTruncated(t *testing.T) {
+	encryptor := NewAESEncryptor()
+	key := make([]byte, KeySize)
+
+	ciphertext, err := encryptor.Encrypt(context.Background(), "secret value", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{ciphertext[:len(ciphertext)-1], ciphertext[:len(ciphertext)-3], ciphertext[:30]} {
+		if _, err := encryptor.Decrypt(context.Background(), value, key); !errors.Is(err, ErrTruncated) {
+			t.Errorf("Decrypt(%q) error = %v, want %v", value, err, ErrTruncated)
+		}
+	}
+
+	// Values that only start like an encrypted value are plaintext
+	for _, value := range []string{"ZW52eC is a word", "ZW52e", "ZW52eAAAAAAAAAA", ciphertext[:len(ciphertext)-3] + "!"} {
+		got, err := encryptor.Decrypt(context.Background(), value, key)
+		if err != nil {
+			t.Errorf("Decrypt(%q) unexpected error: %v", value, err)
+		}
+		if got != value {
+			t.Errorf("Decrypt(%q) = %q, want it unchanged", value, got)
+		}
+	}
+}
+
 func TestConstants(t *testing.T) {
 	if MagicPrefix != "envx" {
 		t.Errorf("MagicPrefix = %q, want %q", MagicPrefix, "envx")
@@ -384,7 +523,7 @@ func BenchmarkAESEncryptor_Encrypt(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := encryptor.Encrypt(plaintext, key)
+		_, err := encryptor.Encrypt(context.Background(), plaintext, key)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -399,14 +538,14 @@ func BenchmarkAESEncryptor_Decrypt(b *testing.B) {
 	}
 	plaintext := "benchmark test data"
 
-	encrypted, err := encryptor.Encrypt(plaintext, key)
+	encrypted, err := encryptor.Encrypt(context.Background(), plaintext, key)
 	if err != nil {
 		b.Fatal(err)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := encryptor.Decrypt(encrypted, key)
+		_, err := encryptor.Decrypt(context.Background(), encrypted, key)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,81 @@
+// Package cryptotest checks properties every crypto.Encryptor must have.
+// The fuzz targets of envx run them against the AES encryptor, and
+// encryptors registered with a crypto.Registry can be checked the same way.
+package cryptotest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+// CheckRoundTrip encrypts plaintext with key and returns an error describing
+// the first property broken: the ciphertext must be recognized as encrypted,
+// differ from the plaintext unless it is empty, and decrypt to the plaintext.
+func CheckRoundTrip(ctx context.Context, enc crypto.Encryptor, key []byte, plaintext string) (err error) {
+	defer recoverPanic("round trip", &err)
+
+	ciphertext, err := enc.Encrypt(ctx, plaintext, key)
+	if err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+	if !enc.IsEncrypted(ciphertext) {
+		return fmt.Errorf("ciphertext %q of %q is not recognized as encrypted", ciphertext, plaintext)
+	}
+	if plaintext != "" && ciphertext == plaintext {
+		return fmt.Errorf("ciphertext of %q is the plaintext", plaintext)
+	}
+	decrypted, err := enc.Decrypt(ctx, ciphertext, key)
+	if err != nil {
+		return fmt.Errorf("decrypt of %q failed: %w", ciphertext, err)
+	}
+	if decrypted != plaintext {
+		return fmt.Errorf("%q decrypted to %q", plaintext, decrypted)
+	}
+	return nil
+}
+
+// CheckDecrypt decrypts value, which may be anything: a plaintext value,
+// malformed base64 or a damaged ciphertext. Decrypt must not panic, and
+// must fail or return value unchanged unless value is recognized as
+// encrypted; wrong keys and tampering have to be reported, not mistaken for
+// plaintext.
+func CheckDecrypt(ctx context.Context, enc crypto.Encryptor, key []byte, value string) (err error) {
+	defer recoverPanic("decrypt", &err)
+
+	decrypted, err := enc.Decrypt(ctx, value, key)
+	if err == nil && decrypted != value && !enc.IsEncrypted(value) {
+		return fmt.Errorf("%q is not recognized as encrypted but decrypted to %q", value, decrypted)
+	}
+	return nil
+}
+
+// CheckTruncation encrypts plaintext with key and decrypts every truncation
+// of the ciphertext, as happens when a value is cut off while copied. Each
+// must fail or, when too short to look encrypted, come back unchanged: a
+// truncated value never decrypts to anything else. This holds for
+// authenticated encryption only.
+func CheckTruncation(ctx context.Context, enc crypto.Encryptor, key []byte, plaintext string) (err error) {
+	defer recoverPanic("truncation", &err)
+
+	ciphertext, err := enc.Encrypt(ctx, plaintext, key)
+	if err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+	for n := range len(ciphertext) {
+		truncated := ciphertext[:n]
+		decrypted, err := enc.Decrypt(ctx, truncated, key)
+		if err == nil && decrypted != truncated {
+			return fmt.Errorf("ciphertext of %q truncated to %q decrypted to %q", plaintext, truncated, decrypted)
+		}
+	}
+	return nil
+}
+
+// recoverPanic turns a panic of the check named by what into its error
+func recoverPanic(what string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s panicked: %v", what, r)
+	}
+}
@@ -0,0 +1,53 @@
+package cryptotest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+// key is a fixed key so failing inputs reproduce
+var key = bytes.Repeat([]byte{0x42}, crypto.KeySize)
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, seed := range []string{"", "value", "with spaces and \"quotes\"", "line\nbreak", "\x00\xff", "héllo ✓"} {
+		f.Add(seed)
+	}
+	enc := crypto.NewAESEncryptor()
+	f.Fuzz(func(t *testing.T, plaintext string) {
+		if err := CheckRoundTrip(context.Background(), enc, key, plaintext); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckTruncation(context.Background(), enc, key, plaintext); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzDecrypt(f *testing.F) {
+	enc := crypto.NewAESEncryptor()
+	valid, err := enc.Encrypt(context.Background(), "secret", key)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{
+		"",
+		"plaintext",
+		valid,
+		valid[:len(valid)-4],   // truncated, still base64
+		valid[:len(valid)-1],   // truncated, invalid base64
+		"ZW52eA==",             // the prefix alone
+		"ZW52eAAAAAAAAAAAAAAA", // the prefix and a short nonce
+		"ZW52e!!!",
+		"not base64 at all ==",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if err := CheckDecrypt(context.Background(), enc, key, value); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
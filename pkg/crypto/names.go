@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/secure"
+)
+
+// NameTokenPrefix starts the keys stored in place of encrypted variable names
+const NameTokenPrefix = "ENVX_N_"
+
+// nameTokenSize is the number of HMAC bytes kept in a token; 10 bytes encode
+// to 16 base32 characters without padding
+const nameTokenSize = 10
+
+// NameToken returns the key stored in place of name when variable names are
+// encrypted. It is an HMAC of name under a key derived from key, so the same
+// name always maps to the same token and Get can find it, while the token
+// reveals nothing about the name without the key.
+func NameToken(name string, key []byte) string {
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("envx-name-token"))
+	tokenKey := derive.Sum(nil)
+	defer secure.Zero(tokenKey)
+
+	mac := hmac.New(sha256.New, tokenKey)
+	mac.Write([]byte(name))
+	return NameTokenPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(mac.Sum(nil)[:nameTokenSize])
+}
+
+// IsNameToken reports whether key looks like a token returned by NameToken
+func IsNameToken(key string) bool {
+	return strings.HasPrefix(key, NameTokenPrefix) && len(key) == len(NameTokenPrefix)+16
+}
@@ -0,0 +1,29 @@
+package crypto
+
+import "testing"
+
+func TestNameToken(t *testing.T) {
+	key := make([]byte, KeySize)
+	otherKey := make([]byte, KeySize)
+	otherKey[0] = 1
+
+	token := NameToken("STRIPE_SECRET_KEY", key)
+	if !IsNameToken(token) {
+		t.Errorf("IsNameToken(%q) = false", token)
+	}
+	if NameToken("STRIPE_SECRET_KEY", key) != token {
+		t.Error("NameToken() is not stable")
+	}
+	if NameToken("STRIPE_PUBLIC_KEY", key) == token {
+		t.Error("NameToken() returned the same token for different names")
+	}
+	if NameToken("STRIPE_SECRET_KEY", otherKey) == token {
+		t.Error("NameToken() returned the same token for different keys")
+	}
+
+	for _, key := range []string{"STRIPE_SECRET_KEY", NameTokenPrefix, NameTokenPrefix + "ABC"} {
+		if IsNameToken(key) {
+			t.Errorf("IsNameToken(%q) = true", key)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultEncryptor is the name of the AES-256-GCM encryptor, the one used
+// unless another is selected
+const DefaultEncryptor = "aes-256-gcm"
+
+// Factory creates an Encryptor
+type Factory func() Encryptor
+
+// Registry maps names to the encryptors that can be selected by them
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry returns a registry of the built-in encryptors, currently only
+// DefaultEncryptor
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+	r.Register(DefaultEncryptor, func() Encryptor { return NewAESEncryptor() })
+	return r
+}
+
+// Register makes factory create the encryptor selected by name, replacing
+// any factory registered for it before
+func (r *Registry) Register(name string, factory Factory) {
+	r.factories[name] = factory
+}
+
+// Names returns the registered names, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the encryptor registered as name
+func (r *Registry) New(name string) (Encryptor, error) {
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryptor %q (available: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return factory(), nil
+}
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reverseEncryptor is a toy encryptor that reverses values
+type reverseEncryptor struct{}
+
+func (reverseEncryptor) Encrypt(_ context.Context, plaintext string, _ []byte) (string, error) {
+	return "rev:" + reverse(plaintext), nil
+}
+
+func (reverseEncryptor) Decrypt(_ context.Context, ciphertext string, _ []byte) (string, error) {
+	if rest, ok := strings.CutPrefix(ciphertext, "rev:"); ok {
+		return reverse(rest), nil
+	}
+	return ciphertext, nil
+}
+
+func (reverseEncryptor) IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, "rev:")
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	slices.Reverse(r)
+	return string(r)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if e, err := r.New(DefaultEncryptor); err != nil {
+		t.Fatalf("New(%q) error = %v", DefaultEncryptor, err)
+	} else if _, ok := e.(*AESEncryptor); !ok {
+		t.Errorf("New(%q) = %T, want *AESEncryptor", DefaultEncryptor, e)
+	}
+
+	if _, err := r.New("age"); err == nil || !strings.Contains(err.Error(), DefaultEncryptor) {
+		t.Errorf("New(\"age\") error = %v, want one listing the available encryptors", err)
+	}
+
+	r.Register("reverse", func() Encryptor { return reverseEncryptor{} })
+	if names := r.Names(); !slices.Equal(names, []string{DefaultEncryptor, "reverse"}) {
+		t.Errorf("Names() = %v", names)
+	}
+	e, err := r.New("reverse")
+	if err != nil {
+		t.Fatalf("New(\"reverse\") error = %v", err)
+	}
+	ciphertext, _ := e.Encrypt(context.Background(), "abc", nil)
+	if plaintext, _ := e.Decrypt(context.Background(), ciphertext, nil); ciphertext != "rev:cba" || plaintext != "abc" {
+		t.Errorf("round trip = %q, %q", ciphertext, plaintext)
+	}
+}
+
+func TestAESEncryptor_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	key := make([]byte, KeySize)
+	if _, err := NewAESEncryptor().Encrypt(ctx, "value", key); err != context.Canceled {
+		t.Errorf("Encrypt() with a cancelled context error = %v", err)
+	}
+	if _, err := NewAESEncryptor().Decrypt(ctx, "value", key); err != context.Canceled {
+		t.Errorf("Decrypt() with a cancelled context error = %v", err)
+	}
+}
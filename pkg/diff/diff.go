@@ -0,0 +1,183 @@
+// Package diff computes line-based diffs between two texts.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of change applied to a line
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is one line of a diff
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// String formats the line the way it appears in a unified diff
+func (l Line) String() string {
+	return string(l.Op) + l.Text
+}
+
+// Lines returns the line-by-line edit script that turns a into b, based on
+// the longest common subsequence of their lines
+func Lines(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]Line, 0, max(len(x), len(y)))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Op: Equal, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Op: Delete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Op: Insert, Text: y[j]})
+	}
+	return lines
+}
+
+// Hunk is a group of changed lines with surrounding context
+type Hunk struct {
+	FromLine, FromCount int
+	ToLine, ToCount     int
+	Lines               []Line
+}
+
+// Header returns the "@@ -l,s +l,s @@" header of the hunk
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.FromLine, h.FromCount, h.ToLine, h.ToCount)
+}
+
+// Hunks groups the changes between a and b into hunks with up to context
+// unchanged lines around each change. It returns nil if a and b are equal.
+func Hunks(a, b string, context int) []Hunk {
+	lines := Lines(a, b)
+
+	var hunks []Hunk
+	var current *Hunk
+	fromLine, toLine := 1, 1
+	lastChange := -1
+
+	for idx, line := range lines {
+		if line.Op != Equal {
+			// Changes separated by more than 2*context unchanged lines get their own hunk
+			if current == nil || idx-lastChange-1 > 2*context {
+				if current != nil {
+					hunks = append(hunks, closeHunk(*current, lines, lastChange, context))
+				}
+				// Start a new hunk including up to context preceding lines
+				start := max(idx-context, lastChange+1, 0)
+				h := Hunk{FromLine: fromLine, ToLine: toLine}
+				for k := start; k < idx; k++ {
+					h.Lines = append(h.Lines, lines[k])
+					h.FromLine--
+					h.ToLine--
+				}
+				current = &h
+			} else {
+				current.Lines = append(current.Lines, lines[lastChange+1:idx]...)
+			}
+			current.Lines = append(current.Lines, line)
+			lastChange = idx
+		}
+
+		if line.Op != Insert {
+			fromLine++
+		}
+		if line.Op != Delete {
+			toLine++
+		}
+	}
+
+	if current != nil {
+		hunks = append(hunks, closeHunk(*current, lines, lastChange, context))
+	}
+	return hunks
+}
+
+// closeHunk appends up to context lines following the last change and
+// computes the line counts of the hunk
+func closeHunk(h Hunk, lines []Line, lastChange, context int) Hunk {
+	end := min(lastChange+1+context, len(lines))
+	h.Lines = append(h.Lines, lines[lastChange+1:end]...)
+
+	for _, line := range h.Lines {
+		if line.Op != Insert {
+			h.FromCount++
+		}
+		if line.Op != Delete {
+			h.ToCount++
+		}
+	}
+	// An empty range starts at the line before it, as in GNU diff
+	if h.FromCount == 0 {
+		h.FromLine--
+	}
+	if h.ToCount == 0 {
+		h.ToLine--
+	}
+	return h
+}
+
+// Unified returns a unified diff between a and b, or an empty string if they are equal
+func Unified(fromName, toName, a, b string, context int) string {
+	hunks := Hunks(a, b, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		sb.WriteString(h.Header())
+		sb.WriteByte('\n')
+		for _, line := range h.Lines {
+			sb.WriteString(line.String())
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,75 @@
+package diff
+
+import "testing"
+
+func TestLines(t *testing.T) {
+	got := Lines("A=1\nB=2\nC=3\n", "A=1\nB=two\nC=3\nD=4\n")
+	want := []Line{
+		{Op: Equal, Text: "A=1"},
+		{Op: Delete, Text: "B=2"},
+		{Op: Insert, Text: "B=two"},
+		{Op: Equal, Text: "C=3"},
+		{Op: Insert, Text: "D=4"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Lines() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Lines()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		context  int
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        "A=1\n",
+			b:        "A=1\n",
+			context:  3,
+			expected: "",
+		},
+		{
+			name:     "new file",
+			a:        "",
+			b:        "A=1\nB=2\n",
+			context:  3,
+			expected: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+A=1\n+B=2\n",
+		},
+		{
+			name:     "single change with context",
+			a:        "A=1\nB=2\nC=3\nD=4\nE=5\n",
+			b:        "A=1\nB=2\nC=x\nD=4\nE=5\n",
+			context:  1,
+			expected: "--- a\n+++ b\n@@ -2,3 +2,3 @@\n B=2\n-C=3\n+C=x\n D=4\n",
+		},
+		{
+			name:     "separate hunks",
+			a:        "A=1\nB=2\nC=3\nD=4\nE=5\nF=6\n",
+			b:        "A=x\nB=2\nC=3\nD=4\nE=5\nF=y\n",
+			context:  1,
+			expected: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n-A=1\n+A=x\n B=2\n@@ -5,2 +5,2 @@\n E=5\n-F=6\n+F=y\n",
+		},
+		{
+			name:     "merged hunks",
+			a:        "A=1\nB=2\nC=3\n",
+			b:        "A=x\nB=2\nC=y\n",
+			context:  1,
+			expected: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n-A=1\n+A=x\n B=2\n-C=3\n+C=y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b, tt.context); got != tt.expected {
+				t.Errorf("Unified() =\n%q\nwant\n%q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+// Cache remembers the files parsed and the values decrypted while running a
+// single command, so code paths that load the same file again neither parse
+// nor decrypt it twice. Parsed files are keyed by the hash of their contents,
+// so a file the command rewrote is parsed afresh. A nil *Cache caches
+// nothing.
+type Cache struct {
+	mu        sync.Mutex
+	sections  map[parsing]parsedFile
+	plaintext map[decryption]string
+}
+
+// parsedFile is the result of parsing one file's contents
+type parsedFile struct {
+	sections Sections
+	warnings []Warning
+}
+
+// parsing identifies contents parsed with a set of options
+type parsing struct {
+	content [sha256.Size]byte
+	opts    LoaderOptions
+}
+
+// decryption identifies a value decrypted with a key
+type decryption struct {
+	key        [sha256.Size]byte
+	ciphertext string
+}
+
+type cacheContextKey struct{}
+
+// NewCache returns an empty cache
+func NewCache() *Cache {
+	return &Cache{
+		sections:  make(map[parsing]parsedFile),
+		plaintext: make(map[decryption]string),
+	}
+}
+
+// WithCache returns a copy of ctx that carries c
+func WithCache(ctx context.Context, c *Cache) context.Context {
+	return context.WithValue(ctx, cacheContextKey{}, c)
+}
+
+// CacheFrom returns the cache carried by ctx, or nil
+func CacheFrom(ctx context.Context) *Cache {
+	c, _ := ctx.Value(cacheContextKey{}).(*Cache)
+	return c
+}
+
+// parse returns the sections of content, parsing it only the first time it
+// is seen. Callers get their own copy they may modify.
+func (c *Cache) parse(content []byte, filename string, opts LoaderOptions) (Sections, []Warning, error) {
+	if c == nil {
+		return ParseSectionsWithOptions(bytes.NewReader(content), filename, opts)
+	}
+
+	id := parsing{content: sha256.Sum256(content), opts: opts}
+	c.mu.Lock()
+	parsed, ok := c.sections[id]
+	c.mu.Unlock()
+	if !ok {
+		sections, warnings, err := ParseSectionsWithOptions(bytes.NewReader(content), filename, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed = parsedFile{sections: sections, warnings: warnings}
+		c.mu.Lock()
+		c.sections[id] = parsed
+		c.mu.Unlock()
+	}
+	return parsed.sections.clone(), slices.Clone(parsed.warnings), nil
+}
+
+// Encryptor returns e with decryptions remembered in the cache, or e itself
+// for a nil cache
+func (c *Cache) Encryptor(e crypto.Encryptor) crypto.Encryptor {
+	if c == nil {
+		return e
+	}
+	return &cachingEncryptor{Encryptor: e, cache: c}
+}
+
+// cachingEncryptor decrypts each value at most once per key
+type cachingEncryptor struct {
+	crypto.Encryptor
+	cache *Cache
+}
+
+// Encrypt encrypts plaintext, remembering it as the decryption of the result
+func (e *cachingEncryptor) Encrypt(ctx context.Context, plaintext string, key []byte) (string, error) {
+	ciphertext, err := e.Encryptor.Encrypt(ctx, plaintext, key)
+	if err != nil {
+		return "", err
+	}
+	e.cache.remember(ciphertext, key, plaintext)
+	return ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext unless it was already decrypted with key
+func (e *cachingEncryptor) Decrypt(ctx context.Context, ciphertext string, key []byte) (string, error) {
+	id := decryption{key: sha256.Sum256(key), ciphertext: ciphertext}
+	e.cache.mu.Lock()
+	plaintext, ok := e.cache.plaintext[id]
+	e.cache.mu.Unlock()
+	if ok {
+		return plaintext, nil
+	}
+
+	plaintext, err := e.Encryptor.Decrypt(ctx, ciphertext, key)
+	if err != nil {
+		return "", err
+	}
+	e.cache.remember(ciphertext, key, plaintext)
+	return plaintext, nil
+}
+
+func (c *Cache) remember(ciphertext string, key []byte, plaintext string) {
+	c.mu.Lock()
+	c.plaintext[decryption{key: sha256.Sum256(key), ciphertext: ciphertext}] = plaintext
+	c.mu.Unlock()
+}
+
+// clone returns a copy of s that shares nothing modifiable with it
+func (s Sections) clone() Sections {
+	copied := make(Sections, len(s))
+	for i, section := range s {
+		copied[i] = Section{
+			Name:      section.Name,
+			Vars:      slices.Clone(section.Vars),
+			Includes:  slices.Clone(section.Includes),
+			Rotations: slices.Clone(section.Rotations),
+			Comments:  maps.Clone(section.Comments),
+		}
+		for key, lines := range copied[i].Comments {
+			copied[i].Comments[key] = slices.Clone(lines)
+		}
+	}
+	return copied
+}
@@ -0,0 +1,84 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestCacheLoadSections(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(file, []byte("A=1\nB=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithCache(context.Background(), NewCache())
+	first, _, err := NewFileLoader().LoadSections(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first[0].Vars[0].Value = "changed"
+
+	second, _, err := NewFileLoader().LoadSections(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := second[0].Vars[0].Value; got != "1" {
+		t.Errorf("cached sections were modified through an earlier copy: A = %q", got)
+	}
+
+	// A rewritten file is parsed again
+	if err := os.WriteFile(file, []byte("A=3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	third, _, err := NewFileLoader().LoadSections(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := third[0].Vars; len(got) != 1 || got[0].Value != "3" {
+		t.Errorf("LoadSections() after rewrite = %v, want A=3", got)
+	}
+}
+
+func TestCacheEncryptor(t *testing.T) {
+	key := make([]byte, crypto.KeySize)
+	counter := &countingEncryptor{Encryptor: crypto.NewAESEncryptor()}
+	ciphertext, err := counter.Encrypt(context.Background(), "secret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptor := NewCache().Encryptor(counter)
+	for range 3 {
+		plaintext, err := encryptor.Decrypt(context.Background(), ciphertext, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "secret" {
+			t.Fatalf("Decrypt() = %q, want %q", plaintext, "secret")
+		}
+	}
+	if got := counter.decrypts.Load(); got != 1 {
+		t.Errorf("decrypted %d times, want 1", got)
+	}
+
+	// Values it encrypted need no decrypting
+	other, err := encryptor.Encrypt(context.Background(), "other", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := encryptor.Decrypt(context.Background(), other, key); err != nil || plaintext != "other" {
+		t.Fatalf("Decrypt() = %q, %v; want %q", plaintext, err, "other")
+	}
+	if got := counter.decrypts.Load(); got != 1 {
+		t.Errorf("decrypted %d times, want 1", got)
+	}
+
+	// A nil cache passes values straight through
+	if got := (*Cache)(nil).Encryptor(counter); got != crypto.Encryptor(counter) {
+		t.Errorf("nil cache Encryptor() = %T, want the encryptor itself", got)
+	}
+}
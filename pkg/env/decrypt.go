@@ -0,0 +1,199 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/errlog"
+)
+
+// DecryptCause is the likely reason a value could not be decrypted
+type DecryptCause int
+
+const (
+	CauseUnknown DecryptCause = iota
+	// CauseWrongKey means no encrypted value decrypts with the key in use
+	CauseWrongKey
+	// CauseForeignKey means the value does not decrypt while others in the
+	// same file do: it was encrypted with another key or modified
+	CauseForeignKey
+	// CauseCorrupted means the value is too short to be valid ciphertext
+	CauseCorrupted
+	// CauseTruncated means the value looks encrypted but is cut off
+	CauseTruncated
+)
+
+// String describes the cause for error messages
+func (c DecryptCause) String() string {
+	switch c {
+	case CauseWrongKey:
+		return "wrong key"
+	case CauseForeignKey:
+		return "encrypted with another key or modified"
+	case CauseCorrupted:
+		return "corrupted value"
+	case CauseTruncated:
+		return "truncated value"
+	default:
+		return "decryption failed"
+	}
+}
+
+// DecryptError describes a variable whose value could not be decrypted
+type DecryptError struct {
+	Key   string
+	Cause DecryptCause
+	Err   error
+}
+
+// Error formats the error as KEY: cause (underlying error)
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("%s: %s (%v)", e.Key, e.Cause, e.Err)
+}
+
+// Unwrap returns the underlying decryption error
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// DecryptErrors collects every variable that failed to decrypt in one pass,
+// so all of them can be reported at once with a suggested remedy
+type DecryptErrors struct {
+	Errors []*DecryptError
+	// Encrypted is the number of encrypted values that were attempted
+	Encrypted int
+	// Fingerprint identifies the key that was used
+	Fingerprint string
+}
+
+// Keys returns the names of the variables that failed, in file order
+func (e *DecryptErrors) Keys() []string {
+	keys := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		keys[i] = err.Key
+	}
+	return keys
+}
+
+// Error lists every failed variable followed by hints for each cause found
+func (e *DecryptErrors) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d encrypted variables could not be decrypted:", len(e.Errors), e.Encrypted)
+	seen := make(map[DecryptCause]bool)
+	for _, err := range e.Errors {
+		sb.WriteString("\n  ")
+		sb.WriteString(err.Error())
+		seen[err.Cause] = true
+	}
+	for _, cause := range []DecryptCause{CauseWrongKey, CauseForeignKey, CauseTruncated, CauseCorrupted} {
+		if seen[cause] {
+			sb.WriteString("\nhint: ")
+			sb.WriteString(e.hint(cause))
+		}
+	}
+	return sb.String()
+}
+
+// Unwrap returns the individual errors so errors.Is and errors.As see them
+func (e *DecryptErrors) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// hint suggests a remedy for a cause
+func (e *DecryptErrors) hint(cause DecryptCause) string {
+	switch cause {
+	case CauseWrongKey:
+		return fmt.Sprintf("the file was encrypted with a different key than %s; check --keystore (e.g. --keystore password) and the account, or restore the key with \"envx key recover\" or \"envx bundle import\"", e.Fingerprint)
+	case CauseForeignKey:
+		return "these values were encrypted with another key than the rest of the file, or edited since; set them again with \"envx set\""
+	case CauseTruncated:
+		return "these values were cut off, often when copied; restore them from version control or set them again with \"envx set\""
+	case CauseCorrupted:
+		return "these values are too short to be ciphertext; restore them from version control or set them again with \"envx set\""
+	default:
+		return ""
+	}
+}
+
+// classifyDecryptError picks the likely cause of a decryption failure.
+// Authentication failures are blamed on the key until other values are
+// known to decrypt with it.
+func classifyDecryptError(err error) DecryptCause {
+	switch {
+	case errors.Is(err, crypto.ErrAuthentication):
+		return CauseWrongKey
+	case errors.Is(err, crypto.ErrTruncated):
+		return CauseTruncated
+	case errors.Is(err, crypto.ErrMalformed):
+		return CauseCorrupted
+	default:
+		return CauseUnknown
+	}
+}
+
+// DecryptAt decrypts the values at the given positions in place, leaving
+// plaintext values untouched. Values are decrypted concurrently, see
+// TransformAt. Unlike TransformAt, every value that decrypts is replaced even
+// when others fail; the failures are returned together as *DecryptErrors and
+// keep their encrypted value. Variables stored with HideName get their names
+// back. Cancelling ctx stops decryption with its error.
+func (vars Variables) DecryptAt(ctx context.Context, positions []int, encryptor crypto.Encryptor, key []byte) error {
+	failures := make([]error, len(vars))
+	changed := make([]bool, len(vars))
+
+	err := vars.TransformAt(positions, func(i int, v Variable) (string, error) {
+		decrypted, err := encryptor.Decrypt(ctx, v.Value, key)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		if err != nil {
+			failures[i] = err
+			return v.Value, nil
+		}
+		if decrypted != v.Value {
+			changed[i] = true
+			errlog.Register(decrypted)
+		}
+		return decrypted, nil
+	})
+	if err != nil {
+		return err
+	}
+	vars.revealNames(positions, key)
+
+	result := &DecryptErrors{Fingerprint: crypto.Fingerprint(key)}
+	for i, err := range failures {
+		if changed[i] {
+			result.Encrypted++
+		}
+		if err == nil {
+			continue
+		}
+		result.Encrypted++
+		result.Errors = append(result.Errors, &DecryptError{
+			Key:   vars[i].Key,
+			Cause: classifyDecryptError(err),
+			Err:   err,
+		})
+	}
+	if len(result.Errors) == 0 {
+		return nil
+	}
+
+	// Some values decrypted with this key, so it is not the wrong key for the file
+	if len(result.Errors) < result.Encrypted {
+		for _, err := range result.Errors {
+			if err.Cause == CauseWrongKey {
+				err.Cause = CauseForeignKey
+			}
+		}
+	}
+	return result
+}
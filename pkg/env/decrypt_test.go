@@ -0,0 +1,115 @@
+package env
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestVariables_DecryptAt_CollectsErrors(t *testing.T) {
+	encryptor := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	otherKey := make([]byte, crypto.KeySize)
+	otherKey[0] = 1
+
+	encrypt := func(value string, key []byte) string {
+		t.Helper()
+		ciphertext, err := encryptor.Encrypt(context.Background(), value, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ciphertext
+	}
+
+	good := encrypt("good", key)
+	tests := []struct {
+		name       string
+		vars       Variables
+		wantCauses map[string]DecryptCause
+		wantHint   string
+	}{
+		{
+			name: "all fail with the wrong key",
+			vars: Variables{
+				{Key: "A", Value: encrypt("a", otherKey)},
+				{Key: "B", Value: encrypt("b", otherKey)},
+				{Key: "PLAIN", Value: "plain"},
+			},
+			wantCauses: map[string]DecryptCause{"A": CauseWrongKey, "B": CauseWrongKey},
+			wantHint:   crypto.Fingerprint(key),
+		},
+		{
+			name: "mixed failures",
+			vars: Variables{
+				{Key: "GOOD", Value: good},
+				{Key: "FOREIGN", Value: encrypt("foreign", otherKey)},
+				{Key: "SHORT", Value: base64.StdEncoding.EncodeToString([]byte(crypto.MagicPrefix + "abc"))},
+			},
+			wantCauses: map[string]DecryptCause{"FOREIGN": CauseForeignKey, "SHORT": CauseCorrupted},
+			wantHint:   "too short",
+		},
+		{
+			name: "truncated",
+			vars: Variables{
+				{Key: "GOOD", Value: good},
+				{Key: "CUT", Value: good[:len(good)-3]},
+			},
+			wantCauses: map[string]DecryptCause{"CUT": CauseTruncated},
+			wantHint:   "cut off",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.vars.DecryptAll(context.Background(), encryptor, key)
+
+			var decryptErrs *DecryptErrors
+			if !errors.As(err, &decryptErrs) {
+				t.Fatalf("DecryptAll() error = %v, want *DecryptErrors", err)
+			}
+			if len(decryptErrs.Errors) != len(tt.wantCauses) {
+				t.Fatalf("DecryptAll() reported %v, want %d failures", decryptErrs.Keys(), len(tt.wantCauses))
+			}
+			for _, e := range decryptErrs.Errors {
+				if want, ok := tt.wantCauses[e.Key]; !ok || e.Cause != want {
+					t.Errorf("%s cause = %v, want %v", e.Key, e.Cause, want)
+				}
+			}
+			if !strings.Contains(err.Error(), tt.wantHint) {
+				t.Errorf("DecryptAll() error = %q, want it to mention %q", err, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestVariables_DecryptAt_KeepsSuccesses(t *testing.T) {
+	encryptor := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	otherKey := make([]byte, crypto.KeySize)
+	otherKey[0] = 1
+
+	good, _ := encryptor.Encrypt(context.Background(), "good", key)
+	bad, _ := encryptor.Encrypt(context.Background(), "bad", otherKey)
+	vars := Variables{{Key: "GOOD", Value: good}, {Key: "BAD", Value: bad}}
+
+	err := vars.DecryptAll(context.Background(), encryptor, key)
+	if !errors.Is(err, crypto.ErrAuthentication) {
+		t.Fatalf("DecryptAll() error = %v, want crypto.ErrAuthentication", err)
+	}
+	if vars[0].Value != "good" {
+		t.Errorf("GOOD = %q, want %q", vars[0].Value, "good")
+	}
+	if vars[1].Value != bad {
+		t.Errorf("BAD = %q, want its ciphertext kept", vars[1].Value)
+	}
+
+	var decryptErrs *DecryptErrors
+	if errors.As(err, &decryptErrs) && !slices.Equal(decryptErrs.Keys(), []string{"BAD"}) {
+		t.Errorf("Keys() = %v, want [BAD]", decryptErrs.Keys())
+	}
+}
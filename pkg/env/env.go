@@ -3,12 +3,15 @@ package env
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/almahoozi/envx/pkg/crypto"
-	"github.com/almahoozi/envx/pkg/errlog"
 )
 
 // Variable represents an environment variable key-value pair
@@ -17,7 +20,8 @@ type Variable struct {
 	Value string
 }
 
-// Variables is a slice of Variable
+// Variables is a slice of Variable in file order. Its Get, Set and Remove
+// methods scan the slice; use an Index for repeated lookups on large files.
 type Variables []Variable
 
 // ToMap converts Variables to a map[string]string
@@ -61,6 +65,39 @@ func (vars *Variables) Remove(key string) bool {
 	return false
 }
 
+// Sort orders variables alphabetically by key. When groups are given, keys are
+// first ordered by the first group prefix they match, in the order the groups
+// are listed; keys matching no group come last. The sort is stable.
+func (vars Variables) Sort(groups ...string) {
+	rank := func(key string) int {
+		for i, prefix := range groups {
+			if strings.HasPrefix(key, prefix) {
+				return i
+			}
+		}
+		return len(groups)
+	}
+
+	sort.SliceStable(vars, func(i, j int) bool {
+		ri, rj := rank(vars[i].Key), rank(vars[j].Key)
+		if ri != rj {
+			return ri < rj
+		}
+		return vars[i].Key < vars[j].Key
+	})
+}
+
+// DecryptAll decrypts every value in place, leaving plaintext values
+// untouched. Failures are collected rather than stopping at the first one,
+// see DecryptAt.
+func (vars Variables) DecryptAll(ctx context.Context, encryptor crypto.Encryptor, key []byte) error {
+	positions := make([]int, len(vars))
+	for i := range positions {
+		positions[i] = i
+	}
+	return vars.DecryptAt(ctx, positions, encryptor, key)
+}
+
 // Loader defines the interface for loading environment variables
 type Loader interface {
 	Load(ctx context.Context, filename string) (Variables, error)
@@ -79,66 +116,262 @@ const (
 	FormatEnv  Format = "env"
 	FormatJSON Format = "json"
 	FormatYAML Format = "yaml"
+	// FormatHelm is a Helm values YAML fragment
+	FormatHelm Format = "helm"
+	// FormatKustomize is a Kustomize secretGenerator entry
+	FormatKustomize Format = "kustomize"
+	// FormatProperties is a Java properties file
+	FormatProperties Format = "properties"
+	// FormatINI is an INI file
+	FormatINI Format = "ini"
+	// FormatCSV is comma separated values, for spreadsheets and reports
+	FormatCSV Format = "csv"
+	// FormatTSV is tab separated values
+	FormatTSV Format = "tsv"
 )
 
 // FileLoader implements Loader for loading from files
-type FileLoader struct{}
+type FileLoader struct {
+	opts LoaderOptions
+}
 
-// NewFileLoader creates a new file loader
+// NewFileLoader creates a new file loader with the default LoaderOptions
 func NewFileLoader() *FileLoader {
 	return &FileLoader{}
 }
 
+// Warning describes a recoverable problem found while parsing an env file
+type Warning struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// String formats the warning as file:line:column: message
+func (w Warning) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", w.File, w.Line, w.Column, w.Message)
+}
+
 // Load loads environment variables from a file
 func (l *FileLoader) Load(ctx context.Context, filename string) (Variables, error) {
-	file, err := os.Open(filename) // #nosec G304 -- User-provided filename is intentional for env file loading
+	vars, _, err := l.LoadWithWarnings(ctx, filename)
+	return vars, err
+}
+
+// LoadWithWarnings loads environment variables from a file and reports every
+// line that was skipped or only partially understood. In a sectioned file only
+// the variables before the first section header are returned, see LoadSections.
+func (l *FileLoader) LoadWithWarnings(ctx context.Context, filename string) (Variables, []Warning, error) {
+	sections, warnings, err := l.LoadSections(ctx, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, _ := sections.Get("")
+	return vars, warnings, nil
+}
+
+// LoadSections loads a file that may hold several environments, each under a
+// [name] header. Variables before the first header form the unnamed section,
+// which is always the first one returned. With a Cache in ctx, contents that
+// were already parsed during the command are not parsed again.
+func (l *FileLoader) LoadSections(ctx context.Context, filename string) (Sections, []Warning, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(filename) // #nosec G304 -- User-provided filename is intentional for env file loading
 	if err != nil {
 		if os.IsNotExist(err) {
-			return Variables{}, nil // Return empty variables if file doesn't exist
+			return Sections{{Name: ""}}, nil, nil // Return empty variables if file doesn't exist
 		}
-		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+		return nil, nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+
+	sections, warnings, err := CacheFrom(ctx).parse(content, filename, l.opts)
+	if err != nil {
+		return nil, nil, err
 	}
-	defer errlog.FnLog(ctx, file.Close)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return sections, warnings, nil
+}
 
+// ParseSections parses env file contents read from r, like LoadSections.
+// filename is only used in warnings and errors.
+func ParseSections(r io.Reader, filename string) (Sections, []Warning, error) {
+	return ParseSectionsWithOptions(r, filename, LoaderOptions{})
+}
+
+// ParseSectionsWithOptions parses env file contents read from r with the
+// semantics chosen by opts
+func ParseSectionsWithOptions(r io.Reader, filename string, opts LoaderOptions) (Sections, []Warning, error) {
 	// Pre-allocate with reasonable capacity to reduce reallocations
-	vars := make(Variables, 0, 32)
-	scanner := bufio.NewScanner(file)
+	sections := Sections{{Name: "", Vars: make(Variables, 0, 32)}}
+
+	current := 0
+	var warnings []Warning
+	scanner := bufio.NewScanner(r)
+	// seen holds the position of each key in each section, for opts.Duplicates
+	seen := map[int]map[string]int{0: {}}
+	var comments []string
+	attachComments := func(key string) {
+		if len(comments) == 0 {
+			return
+		}
+		if sections[current].Comments == nil {
+			sections[current].Comments = make(map[string][]string)
+		}
+		sections[current].Comments[key] = append(sections[current].Comments[key], comments...)
+		comments = nil
+	}
+
+	warn := func(line, column int, format string, args ...any) {
+		warnings = append(warnings, Warning{
+			File:    filename,
+			Line:    line,
+			Column:  column,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
 
+	// Lines are read up front since a quoted value may span several
+	var lines []string
 	for scanner.Scan() {
-		line := scanner.Text()
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading file %s: %w", filename, err)
+	}
+	// CRLF line endings are dropped by the scanner, a byte order mark here
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], ByteOrderMark)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := lines[i]
+
+		if path, ok := includeDirective(line); ok {
+			sections[current].Includes = append(sections[current].Includes, path)
+			continue
+		}
+		if r, ok, err := rotationDirective(line); ok {
+			if err != nil {
+				warn(lineNo, 1, "skipped rotation directive: %v", err)
+			} else {
+				sections = sections.SetRotation(sections[current].Name, r)
+			}
+			continue
+		}
 
 		// Skip empty lines and comments without trimming first
 		if len(line) == 0 || line[0] == '#' {
+			if opts.Comments && len(line) > 0 {
+				comments = append(comments, line)
+			}
+			continue
+		}
+
+		if name, ok := sectionHeader(line); ok {
+			// Comments above a header end the previous section
+			attachComments("")
+			if i := sections.index(name); i >= 0 {
+				warn(lineNo, 1, "duplicate section [%s]; merged with the earlier one", name)
+				current = i
+			} else {
+				sections = append(sections, Section{Name: name})
+				current = len(sections) - 1
+				seen[current] = map[string]int{}
+			}
 			continue
 		}
 
 		// Find the first '=' character
 		eqIndex := strings.IndexByte(line, '=')
 		if eqIndex == -1 {
+			if strings.TrimSpace(line) != "" {
+				warn(lineNo, firstNonSpace(line)+1, "skipped malformed line: missing '='")
+			}
 			continue // Skip malformed lines
 		}
 
 		// Extract key and value with minimal allocations
 		key := strings.TrimSpace(line[:eqIndex])
 		if len(key) == 0 {
+			warn(lineNo, firstNonSpace(line)+1, "skipped line with empty key")
 			continue // Skip lines with empty keys
 		}
 
-		value := strings.TrimSpace(line[eqIndex+1:])
-
-		// Remove quotes if present (optimized check)
-		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
-			value = value[1 : len(value)-1]
+		raw := line[eqIndex+1:]
+		value := strings.TrimSpace(raw)
+		valueColumn := eqIndex + 2 + firstNonSpace(raw)
+
+		var unknown []string
+		if quoted := strings.TrimLeft(raw, " \t"); quoted != "" && (quoted[0] == '\'' || quoted[0] == '"') {
+			var lookup func(string) (string, bool)
+			if opts.Expand {
+				lookup = latest(sections[current].Vars)
+			}
+			// A single quote opening the value may close on a later line;
+			// the value only changes once a line holding a quote is added
+			end := i
+			word, names, err := unquoteValue(quoted, lookup)
+			for errors.Is(err, ErrUnterminatedQuote) {
+				if open, ok := singleQuoted(quoted); !open || !ok {
+					break
+				}
+				if end+1 == len(lines) {
+					return nil, nil, fmt.Errorf("error parsing file %s: line %d: %w in value for %s", filename, lineNo, ErrUnterminatedQuote, key)
+				}
+				end++
+				quoted += "\n" + lines[end]
+				if strings.ContainsAny(lines[end], "'\"") {
+					word, names, err = unquoteValue(quoted, lookup)
+				}
+			}
+			// Text right after the quote closing a value that spans lines
+			// means the quote closed a stray one on a later variable
+			if _, ok := singleQuoted(quoted); err == nil && end > i && !ok {
+				err = errTrailing
+			}
+			if err != nil {
+				warn(lineNo, valueColumn, "%v in value for %s; kept quotes as-is", err, key)
+			} else {
+				value, unknown, i = word, names, end
+			}
+		} else {
+			if strings.HasSuffix(value, `"`) {
+				warn(lineNo, valueColumn, "unbalanced quote in value for %s; kept quotes as-is", key)
+			}
+			if opts.Expand {
+				value, unknown = expand(value, sections[current].Vars)
+			}
+		}
+		for _, name := range unknown {
+			warn(lineNo, valueColumn, "unknown variable %s in value for %s; expanded to nothing", name, key)
 		}
 
-		vars = append(vars, Variable{Key: key, Value: value})
+		attachComments(key)
+		if err := opts.addVariable(&sections[current], seen[current], Variable{Key: key, Value: value}, lineNo); err != nil {
+			return nil, nil, fmt.Errorf("error parsing file %s: %w", filename, err)
+		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file %s: %w", filename, err)
+	attachComments("")
+
+	if opts.Strict && len(warnings) > 0 {
+		w := warnings[0]
+		return nil, nil, fmt.Errorf("error parsing file %s: line %d: %s", filename, w.Line, w.Message)
 	}
+	return sections, warnings, nil
+}
 
-	return vars, nil
+// firstNonSpace returns the byte offset of the first non-whitespace character
+func firstNonSpace(s string) int {
+	trimmed := strings.TrimLeft(s, " \t")
+	return len(s) - len(trimmed)
 }
 
 // LoadWithDecryption loads and decrypts environment variables from a file
@@ -148,13 +381,8 @@ func (l *FileLoader) LoadWithDecryption(ctx context.Context, filename string, en
 		return nil, err
 	}
 
-	// Decrypt all values
-	for i, v := range vars {
-		decrypted, err := encryptor.Decrypt(v.Value, key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt variable %s: %w", v.Key, err)
-		}
-		vars[i].Value = decrypted
+	if err := vars.DecryptAll(ctx, encryptor, key); err != nil {
+		return nil, err
 	}
 
 	return vars, nil
@@ -168,19 +396,36 @@ func NewFileWriter() *FileWriter {
 	return &FileWriter{}
 }
 
-// Write writes environment variables to a file in the specified format
-func (w *FileWriter) Write(filename string, vars Variables, format Format) error {
-	var content string
+// Render returns environment variables formatted as they would be written
+func (w *FileWriter) Render(vars Variables, format Format) (string, error) {
 	switch format {
 	case FormatJSON:
-		content = w.formatJSON(vars)
+		return w.formatJSON(vars), nil
 	case FormatYAML:
-		return fmt.Errorf("YAML format not yet implemented")
+		return "", fmt.Errorf("YAML format not yet implemented")
+	case FormatHelm:
+		return RenderHelmValues(vars, ""), nil
+	case FormatKustomize:
+		return RenderKustomizeSecret(vars, DefaultSecretName), nil
+	case FormatProperties:
+		return RenderProperties(vars), nil
+	case FormatINI:
+		return RenderINI(vars, "")
+	case FormatCSV, FormatTSV:
+		return RenderTable(vars, format, TableOptions{})
 	default:
-		content = w.formatEnv(vars)
+		return w.formatEnv(vars), nil
+	}
+}
+
+// Write writes environment variables to a file in the specified format
+func (w *FileWriter) Write(filename string, vars Variables, format Format) error {
+	content, err := w.Render(vars, format)
+	if err != nil {
+		return err
 	}
 
-	err := os.WriteFile(filename, []byte(content), 0o600)
+	err = os.WriteFile(filename, []byte(content), SecureFileMode)
 	if err != nil {
 		return fmt.Errorf("failed to write file %s: %w", filename, err)
 	}
@@ -188,27 +433,61 @@ func (w *FileWriter) Write(filename string, vars Variables, format Format) error
 	return nil
 }
 
-// formatEnv formats variables as .env format
+// RenderSections returns sectioned variables in env format: the unnamed
+// section first, then each named section under its [name] header. Include
+// and rotation directives are written at the top of their section.
+func (w *FileWriter) RenderSections(sections Sections) string {
+	var sb strings.Builder
+	for _, section := range sections {
+		if section.Name != "" {
+			if sb.Len() > 0 {
+				sb.WriteByte('\n')
+			}
+			sb.WriteByte('[')
+			sb.WriteString(section.Name)
+			sb.WriteString("]\n")
+		}
+		for _, path := range section.Includes {
+			sb.WriteString(includePrefix)
+			sb.WriteString(path)
+			sb.WriteByte('\n')
+		}
+		for _, r := range section.Rotations {
+			sb.WriteString(r.String())
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(w.formatEnv(section.Vars))
+	}
+	return sb.String()
+}
+
+// formatEnv formats variables as .env format. Values are written without
+// going through fmt so plaintext secrets do not linger in its buffers.
 func (w *FileWriter) formatEnv(vars Variables) string {
 	var sb strings.Builder
 	for _, v := range vars {
-		// Quote values that contain spaces or special characters
-		value := v.Value
-		if strings.ContainsAny(value, " \t\n\"") {
-			value = fmt.Sprintf("%q", value)
-		}
-		sb.WriteString(fmt.Sprintf("%s=%s\n", v.Key, value))
+		sb.WriteString(v.Key)
+		sb.WriteByte('=')
+		sb.WriteString(quoteValue(v.Value))
+		sb.WriteByte('\n')
 	}
 	return sb.String()
 }
 
 // formatJSON formats variables as JSON
 func (w *FileWriter) formatJSON(vars Variables) string {
-	var parts []string
-	for _, v := range vars {
-		parts = append(parts, fmt.Sprintf("%q:%q", v.Key, v.Value))
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range vars {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Quote(v.Key))
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Quote(v.Value))
 	}
-	return fmt.Sprintf("{%s}", strings.Join(parts, ","))
+	sb.WriteByte('}')
+	return sb.String()
 }
 
 // BuildFilename constructs a filename based on base file and optional name suffix
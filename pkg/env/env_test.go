@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/errlog"
 )
 
 func TestVariable(t *testing.T) {
@@ -132,6 +133,44 @@ func TestVariables_Remove(t *testing.T) {
 	}
 }
 
+func TestVariables_Sort(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []string
+		expected []string
+	}{
+		{
+			name:     "alphabetical",
+			expected: []string{"API_KEY", "DB_HOST", "DB_PASSWORD", "LOG_LEVEL", "PORT"},
+		},
+		{
+			name:     "grouped by prefix",
+			groups:   []string{"DB_", "LOG_"},
+			expected: []string{"DB_HOST", "DB_PASSWORD", "LOG_LEVEL", "API_KEY", "PORT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := Variables{
+				{Key: "PORT", Value: "8080"},
+				{Key: "DB_PASSWORD", Value: "secret"},
+				{Key: "LOG_LEVEL", Value: "debug"},
+				{Key: "API_KEY", Value: "key"},
+				{Key: "DB_HOST", Value: "localhost"},
+			}
+
+			vars.Sort(tt.groups...)
+
+			for i, key := range tt.expected {
+				if vars[i].Key != key {
+					t.Errorf("Sort() position %d = %q, want %q", i, vars[i].Key, key)
+				}
+			}
+		})
+	}
+}
+
 func TestBuildFilename(t *testing.T) {
 	tests := []struct {
 		baseFile string
@@ -293,6 +332,79 @@ KEY3=value!@#$%^&*()`,
 	}
 }
 
+func TestFileLoader_LoadWithWarnings(t *testing.T) {
+	loader := NewFileLoader()
+
+	tempDir, err := os.MkdirTemp("", "envx_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := `KEY1=value1
+MALFORMED_LINE
+  =value_without_key
+KEY2="unterminated
+KEY3="quoted"
+# comment
+KEY4=  trailing"
+`
+	filename := filepath.Join(tempDir, "warnings.env")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, warnings, err := loader.LoadWithWarnings(context.Background(), filename)
+	if err != nil {
+		t.Fatalf("LoadWithWarnings() unexpected error: %v", err)
+	}
+
+	if len(vars) != 4 {
+		t.Errorf("LoadWithWarnings() returned %d variables, want 4", len(vars))
+	}
+
+	expected := []Warning{
+		{File: filename, Line: 2, Column: 1},
+		{File: filename, Line: 3, Column: 3},
+		{File: filename, Line: 4, Column: 6},
+		{File: filename, Line: 7, Column: 8},
+	}
+
+	if len(warnings) != len(expected) {
+		t.Fatalf("LoadWithWarnings() returned %d warnings, want %d: %v", len(warnings), len(expected), warnings)
+	}
+
+	for i, want := range expected {
+		got := warnings[i]
+		if got.File != want.File || got.Line != want.Line || got.Column != want.Column {
+			t.Errorf("warning %d = %s, want %s:%d:%d", i, got, want.File, want.Line, want.Column)
+		}
+		if got.Message == "" {
+			t.Errorf("warning %d has an empty message", i)
+		}
+	}
+
+	// Clean files produce no warnings
+	clean := filepath.Join(tempDir, "clean.env")
+	if err := os.WriteFile(clean, []byte("A=1\nB=\"two\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, warnings, err = loader.LoadWithWarnings(context.Background(), clean)
+	if err != nil {
+		t.Fatalf("LoadWithWarnings() unexpected error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("LoadWithWarnings() on clean file returned warnings: %v", warnings)
+	}
+}
+
+func TestWarning_String(t *testing.T) {
+	w := Warning{File: ".env", Line: 3, Column: 7, Message: "skipped"}
+	if got, want := w.String(), ".env:3:7: skipped"; got != want {
+		t.Errorf("Warning.String() = %q, want %q", got, want)
+	}
+}
+
 func TestFileLoader_LoadWithDecryption(t *testing.T) {
 	loader := NewFileLoader()
 	encryptor := crypto.NewAESEncryptor()
@@ -320,7 +432,7 @@ func TestFileLoader_LoadWithDecryption(t *testing.T) {
 	var contentLines []string
 	for k, v := range plainValues {
 		if strings.HasPrefix(k, "SECRET") {
-			encrypted, err := encryptor.Encrypt(v, key)
+			encrypted, err := encryptor.Encrypt(context.Background(), v, key)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -352,6 +464,27 @@ func TestFileLoader_LoadWithDecryption(t *testing.T) {
 	}
 }
 
+func TestVariables_DecryptAll_RegistersPlaintext(t *testing.T) {
+	defer errlog.Reset()
+
+	encryptor := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	ciphertext, err := encryptor.Encrypt(context.Background(), "correct-horse", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := Variables{{Key: "SECRET", Value: ciphertext}, {Key: "PLAIN", Value: "visible-value"}}
+	if err := vars.DecryptAll(context.Background(), encryptor, key); err != nil {
+		t.Fatal(err)
+	}
+
+	got := errlog.Redact("SECRET=correct-horse PLAIN=visible-value")
+	if want := "SECRET=[REDACTED] PLAIN=visible-value"; got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
+
 func TestFileWriter_Write(t *testing.T) {
 	writer := NewFileWriter()
 
@@ -379,8 +512,8 @@ func TestFileWriter_Write(t *testing.T) {
 			name:   "env format",
 			format: FormatEnv,
 			expectedEnv: `KEY1=value1
-KEY2="value with spaces"
-KEY3="value\"with\"quotes"
+KEY2='value with spaces'
+KEY3='value"with"quotes'
 `,
 			wantErr: false,
 		},
@@ -460,7 +593,7 @@ func TestFileWriter_formatEnv(t *testing.T) {
 				{Key: "KEY1", Value: "value with spaces"},
 				{Key: "KEY2", Value: "normal"},
 			},
-			expected: "KEY1=\"value with spaces\"\nKEY2=normal\n",
+			expected: "KEY1='value with spaces'\nKEY2=normal\n",
 		},
 		{
 			name: "values with special characters",
@@ -468,8 +601,20 @@ func TestFileWriter_formatEnv(t *testing.T) {
 				{Key: "KEY1", Value: "value\nwith\nnewlines"},
 				{Key: "KEY2", Value: "value\twith\ttabs"},
 				{Key: "KEY3", Value: "value\"with\"quotes"},
+				{Key: "KEY4", Value: "it's $HOME `id` #1"},
+				{Key: "KEY5", Value: "crlf\r\nline"},
+			},
+			expected: "KEY1='value\nwith\nnewlines'\nKEY2='value\twith\ttabs'\nKEY3='value\"with\"quotes'\nKEY4='it'\\''s $HOME `id` #1'\nKEY5='crlf\r''\nline'\n",
+		},
+		{
+			name: "shell safe values",
+			vars: Variables{
+				{Key: "URL", Value: "https://user@host:5432/db?x=1"},
+				{Key: "ENCRYPTED", Value: "ZW52eHkwh89GerpnTS1m6hMKfqRlY0hfTvAHf5CVh4PgoLKxmwI="},
+				{Key: "PATH_LIKE", Value: "/usr/bin:/bin,a+b%c_d-e.f"},
+				{Key: "EMPTY", Value: ""},
 			},
-			expected: "KEY1=\"value\\nwith\\nnewlines\"\nKEY2=\"value\\twith\\ttabs\"\nKEY3=\"value\\\"with\\\"quotes\"\n",
+			expected: "URL='https://user@host:5432/db?x=1'\nENCRYPTED=ZW52eHkwh89GerpnTS1m6hMKfqRlY0hfTvAHf5CVh4PgoLKxmwI=\nPATH_LIKE=/usr/bin:/bin,a+b%c_d-e.f\nEMPTY=\n",
 		},
 		{
 			name:     "empty variables",
@@ -676,7 +821,7 @@ func TestIntegration_EncryptionRoundTrip(t *testing.T) {
 
 	for i, v := range encrypted {
 		if strings.HasPrefix(v.Key, "SECRET") {
-			encryptedValue, err := encryptor.Encrypt(v.Value, key)
+			encryptedValue, err := encryptor.Encrypt(context.Background(), v.Value, key)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,124 @@
+// Package envtest checks properties every env file parse and write must
+// have. The fuzz targets of envx use it, and code building on the env
+// package can run the same checks over its own inputs.
+package envtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// CheckParse parses data as an env file and returns an error describing the
+// first property the parse breaks:
+//
+//   - parsing does not panic, and only fails on a line too long to read or
+//     a single quote still open at the end of the file
+//   - keys are not empty and have no surrounding whitespace or '='
+//   - every line holding more than whitespace becomes a variable, comment,
+//     directive or section header, or produces a warning: none is dropped
+//     silently
+//   - a strict parse fails exactly when the lenient one warns, and otherwise
+//     gives the same variables
+func CheckParse(data []byte) (err error) {
+	defer recoverPanic("parse", &err)
+
+	sections, warnings, err := env.ParseSectionsWithOptions(bytes.NewReader(data), "fuzz", env.LoaderOptions{})
+	if errors.Is(err, bufio.ErrTooLong) || errors.Is(err, env.ErrUnterminatedQuote) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("parse failed: %w", err)
+	}
+
+	for _, section := range sections {
+		for _, v := range section.Vars {
+			if v.Key == "" || strings.TrimSpace(v.Key) != v.Key || strings.Contains(v.Key, "=") {
+				return fmt.Errorf("invalid key %q in section [%s]", v.Key, section.Name)
+			}
+		}
+	}
+	if err := checkLines(data); err != nil {
+		return err
+	}
+
+	strict, _, err := env.ParseSectionsWithOptions(bytes.NewReader(data), "fuzz", env.LoaderOptions{Strict: true})
+	switch {
+	case len(warnings) > 0 && err == nil:
+		return fmt.Errorf("strict parse accepted content with warnings %v", warnings)
+	case len(warnings) == 0 && err != nil:
+		return fmt.Errorf("strict parse failed without warnings: %w", err)
+	case err == nil && !reflect.DeepEqual(strict, sections):
+		return fmt.Errorf("strict parse gave %v, lenient parse %v", strict, sections)
+	}
+	return nil
+}
+
+// checkLines parses every line of data holding more than whitespace on its
+// own, split the way the parser reads them, and returns an error for the
+// first that yields nothing and no warning either
+func checkLines(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sections, warnings, err := env.ParseSectionsWithOptions(strings.NewReader(line), "fuzz", env.LoaderOptions{Comments: true})
+		if errors.Is(err, env.ErrUnterminatedQuote) {
+			continue // part of a value spanning lines, or reported as an error
+		}
+		if err != nil {
+			return fmt.Errorf("parse of line %q failed: %w", line, err)
+		}
+		yielded := len(warnings) + len(sections) - 1
+		for _, section := range sections {
+			yielded += len(section.Vars) + len(section.Includes) + len(section.Rotations) + len(section.Comments)
+		}
+		if yielded == 0 {
+			return fmt.Errorf("line %q was dropped without a warning", line)
+		}
+	}
+	return nil
+}
+
+// CheckRoundTrip writes vars in env format and parses them back, returning
+// an error if any variable does not come back the same, in the same order.
+// Keys must be valid variable names.
+func CheckRoundTrip(vars env.Variables) (err error) {
+	defer recoverPanic("round trip", &err)
+
+	content, err := env.NewFileWriter().Render(vars, env.FormatEnv)
+	if err != nil {
+		return fmt.Errorf("render failed: %w", err)
+	}
+	sections, warnings, err := env.ParseSections(strings.NewReader(content), "fuzz")
+	if err != nil {
+		return fmt.Errorf("parse of %q failed: %w", content, err)
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("parse of %q warned: %v", content, warnings)
+	}
+	got, _ := sections.Get("")
+	if len(got) != len(vars) {
+		return fmt.Errorf("wrote %d variables as %q, read back %d", len(vars), content, len(got))
+	}
+	for i, v := range vars {
+		if got[i] != v {
+			return fmt.Errorf("wrote %s=%q as %q, read back %s=%q", v.Key, v.Value, content, got[i].Key, got[i].Value)
+		}
+	}
+	return nil
+}
+
+// recoverPanic turns a panic of the check named by what into its error
+func recoverPanic(what string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s panicked: %v", what, r)
+	}
+}
@@ -0,0 +1,42 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ByteOrderMark is the UTF-8 byte order mark some Windows editors start
+// files with. The parser ignores it.
+const ByteOrderMark = "\ufeff"
+
+// Encoding is how an env file is laid out on disk beyond its contents: a
+// leading byte order mark and CRLF line endings, as files saved on Windows
+// often have. The zero value is plain LF without a byte order mark.
+type Encoding struct {
+	BOM  bool
+	CRLF bool
+}
+
+// DetectEncoding returns the encoding of content. A file mixing line endings
+// is taken to use the more common one.
+func DetectEncoding(content []byte) Encoding {
+	crlf := bytes.Count(content, []byte("\r\n"))
+	lf := bytes.Count(content, []byte("\n")) - crlf
+	return Encoding{
+		BOM:  bytes.HasPrefix(content, []byte(ByteOrderMark)),
+		CRLF: crlf > lf,
+	}
+}
+
+// Apply returns content, written with LF line endings, in the encoding.
+// Values survive the conversion: the env format never puts a carriage return
+// of a value right before a line break.
+func (e Encoding) Apply(content string) string {
+	if e.CRLF {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	if e.BOM {
+		content = ByteOrderMark + content
+	}
+	return content
+}
@@ -0,0 +1,74 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Encoding
+	}{
+		{name: "empty", content: ""},
+		{name: "lf", content: "A=1\nB=2\n"},
+		{name: "crlf", content: "A=1\r\nB=2\r\n", want: Encoding{CRLF: true}},
+		{name: "bom", content: ByteOrderMark + "A=1\n", want: Encoding{BOM: true}},
+		{name: "mostly crlf", content: "A=1\r\nB=2\nC=3\r\n", want: Encoding{CRLF: true}},
+		{name: "mostly lf", content: "A=1\r\nB=2\nC=3\n"},
+		{name: "windows", content: ByteOrderMark + "A=1\r\n", want: Encoding{BOM: true, CRLF: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectEncoding([]byte(tt.content)); got != tt.want {
+				t.Errorf("DetectEncoding() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWindowsFile(t *testing.T) {
+	// A byte order mark, CRLF and LF line endings, a comment on the first line
+	// and values spanning lines
+	content := ByteOrderMark + "# settings\r\nKEY=value\r\nQUOTED='a b'\r\nLF=plain\nMULTI='one\r\ntwo'\r\nLAST=end"
+	sections, warnings, err := ParseSectionsWithOptions(strings.NewReader(content), "test", LoaderOptions{Comments: true})
+	if err != nil {
+		t.Fatalf("ParseSectionsWithOptions() unexpected error: %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("ParseSectionsWithOptions() warnings = %v", warnings)
+	}
+	want := Variables{{"KEY", "value"}, {"QUOTED", "a b"}, {"LF", "plain"}, {"MULTI", "one\ntwo"}, {"LAST", "end"}}
+	if got := sections[0].Vars; len(got) != len(want) {
+		t.Fatalf("ParseSectionsWithOptions() = %q, want %q", got, want)
+	}
+	for i, v := range want {
+		if sections[0].Vars[i] != v {
+			t.Errorf("variable %d = %q, want %q", i, sections[0].Vars[i], v)
+		}
+	}
+	if comments := sections[0].Comments["KEY"]; len(comments) != 1 || comments[0] != "# settings" {
+		t.Errorf("comments = %q, want the first line", comments)
+	}
+}
+
+func TestEncodingApplyRoundTrip(t *testing.T) {
+	vars := Variables{{"A", "1"}, {"B", "two words"}, {"C", "line\r\nbreaks\nand\r"}}
+	rendered := NewFileWriter().formatEnv(vars)
+	for _, encoding := range []Encoding{{}, {CRLF: true}, {BOM: true}, {BOM: true, CRLF: true}} {
+		content := encoding.Apply(rendered)
+		if got := DetectEncoding([]byte(content)); got != encoding {
+			t.Errorf("DetectEncoding(Apply()) = %+v, want %+v", got, encoding)
+		}
+		sections, warnings, err := ParseSections(strings.NewReader(content), "test")
+		if err != nil || len(warnings) > 0 {
+			t.Fatalf("ParseSections() = %v, %v", warnings, err)
+		}
+		for i, v := range vars {
+			if sections[0].Vars[i] != v {
+				t.Errorf("%+v: variable %d = %q, want %q", encoding, i, sections[0].Vars[i], v)
+			}
+		}
+	}
+}
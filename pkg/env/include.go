@@ -0,0 +1,94 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includePrefix starts a comment line that pulls another env file into the
+// section it appears in
+const includePrefix = "# envx:include "
+
+// includeDirective parses a "# envx:include PATH" line, returning the path
+func includeDirective(line string) (string, bool) {
+	if len(line) == 0 || line[0] != '#' {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line[1:]), "envx:include")
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	path := strings.TrimSpace(rest)
+	return path, path != ""
+}
+
+// LoadWithIncludes loads the named section of a file ("" for the variables
+// before any [name] header) together with the files its "# envx:include PATH"
+// directives pull in. Include paths are relative to the including file, and
+// included files contribute their unnamed section and their own includes.
+// Included variables come first and are overridden by later includes and then
+// by the including file itself. Values are returned as stored, still
+// encrypted where they are. The bool reports whether the section exists.
+func (l *FileLoader) LoadWithIncludes(ctx context.Context, filename, section string) (Variables, bool, []Warning, error) {
+	return l.loadIncluding(ctx, filename, section, nil)
+}
+
+// loadIncluding resolves includes recursively; stack holds the files being
+// loaded so cycles are reported instead of recursing forever
+func (l *FileLoader) loadIncluding(ctx context.Context, filename, section string, stack []string) (Variables, bool, []Warning, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to resolve %s: %w", filename, err)
+	}
+	for i, seen := range stack {
+		if seen == abs {
+			cycle := append(append([]string(nil), stack[i:]...), abs)
+			return nil, false, nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	sections, warnings, err := l.LoadSections(ctx, filename)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	own, found := sections.Get(section)
+	if !found {
+		return own, false, warnings, nil
+	}
+
+	var includes []string
+	for _, s := range sections {
+		if s.Name == section {
+			includes = s.Includes
+		}
+	}
+	if len(includes) == 0 {
+		return own, true, warnings, nil
+	}
+
+	index := NewIndex(nil)
+	for _, path := range includes {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, false, nil, fmt.Errorf("failed to include %s from %s: %w", path, filename, err)
+		}
+		included, _, includedWarnings, err := l.loadIncluding(ctx, path, "", stack)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		warnings = append(warnings, includedWarnings...)
+		for _, v := range included {
+			index.Set(v.Key, v.Value)
+		}
+	}
+	for _, v := range own {
+		index.Set(v.Key, v.Value)
+	}
+	return index.Variables(), true, warnings, nil
+}
@@ -0,0 +1,144 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeEnvFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileLoader_LoadWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeEnvFiles(t, dir, map[string]string{
+		"shared/base.env":   "LOG_LEVEL=info\nREGION=us-east-1\n",
+		"shared/common.env": "# envx:include base.env\nREGION=eu-west-1\nTIMEOUT=30\n",
+		"service/.env":      "# envx:include ../shared/common.env\nTIMEOUT=10\nNAME=api\n\n[production]\n# envx:include ../shared/base.env\nNAME=api-prod\n",
+	})
+
+	tests := []struct {
+		section string
+		want    Variables
+	}{
+		{
+			section: "",
+			want: Variables{
+				{Key: "LOG_LEVEL", Value: "info"},
+				{Key: "REGION", Value: "eu-west-1"},
+				{Key: "TIMEOUT", Value: "10"},
+				{Key: "NAME", Value: "api"},
+			},
+		},
+		{
+			section: "production",
+			want: Variables{
+				{Key: "LOG_LEVEL", Value: "info"},
+				{Key: "REGION", Value: "us-east-1"},
+				{Key: "NAME", Value: "api-prod"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("section "+tt.section, func(t *testing.T) {
+			vars, ok, _, err := NewFileLoader().LoadWithIncludes(context.Background(), filepath.Join(dir, "service/.env"), tt.section)
+			if err != nil {
+				t.Fatalf("LoadWithIncludes() unexpected error: %v", err)
+			}
+			if !ok {
+				t.Fatal("LoadWithIncludes() did not find the section")
+			}
+			if !slices.Equal(vars, tt.want) {
+				t.Errorf("LoadWithIncludes() = %v, want %v", vars, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileLoader_LoadWithIncludes_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				".env":  "# envx:include a.env\n",
+				"a.env": "# envx:include b.env\n",
+				"b.env": "# envx:include a.env\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name:    "self include",
+			files:   map[string]string{".env": "# envx:include .env\n"},
+			wantErr: "include cycle",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{".env": "# envx:include missing.env\n"},
+			wantErr: "failed to include",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeEnvFiles(t, dir, tt.files)
+
+			_, _, _, err := NewFileLoader().LoadWithIncludes(context.Background(), filepath.Join(dir, ".env"), "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadWithIncludes() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileLoader_LoadWithIncludes_Diamond(t *testing.T) {
+	dir := t.TempDir()
+	writeEnvFiles(t, dir, map[string]string{
+		"base.env":  "A=1\n",
+		"left.env":  "# envx:include base.env\n",
+		"right.env": "# envx:include base.env\n",
+		".env":      "# envx:include left.env\n# envx:include right.env\n",
+	})
+
+	vars, _, _, err := NewFileLoader().LoadWithIncludes(context.Background(), filepath.Join(dir, ".env"), "")
+	if err != nil {
+		t.Fatalf("LoadWithIncludes() unexpected error for a file included twice: %v", err)
+	}
+	if !slices.Equal(vars, Variables{{Key: "A", Value: "1"}}) {
+		t.Errorf("LoadWithIncludes() = %v, want [A=1]", vars)
+	}
+}
+
+func TestFileWriter_RenderSections_KeepsIncludes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".env")
+	content := "# envx:include shared.env\nA=1\n\n[production]\n# envx:include prod.env\nB=2\n"
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sections, _, err := NewFileLoader().LoadSections(context.Background(), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := NewFileWriter().RenderSections(sections); got != content {
+		t.Errorf("RenderSections() = %q, want %q", got, content)
+	}
+}
@@ -0,0 +1,100 @@
+package env
+
+// Index is an order-preserving view of Variables with constant time lookups
+// by key. Use it instead of Variables.Get/Set or ToMap when working with many
+// keys at once; the zero value is not usable, create one with NewIndex.
+type Index struct {
+	vars Variables
+	pos  map[string]int
+}
+
+// NewIndex indexes vars. The index takes ownership of the slice: callers must
+// use Variables to read the result instead of the original slice.
+// Duplicate keys are kept; like Variables.Get, lookups and updates apply to
+// the first occurrence.
+func NewIndex(vars Variables) *Index {
+	idx := &Index{vars: vars, pos: make(map[string]int, len(vars))}
+	idx.reindex(0)
+	return idx
+}
+
+// reindex recomputes the positions of the variables from start onwards,
+// keeping earlier first occurrences
+func (idx *Index) reindex(start int) {
+	for i := start; i < len(idx.vars); i++ {
+		if p, ok := idx.pos[idx.vars[i].Key]; ok && p >= start {
+			delete(idx.pos, idx.vars[i].Key)
+		}
+	}
+	for i := start; i < len(idx.vars); i++ {
+		if _, ok := idx.pos[idx.vars[i].Key]; !ok {
+			idx.pos[idx.vars[i].Key] = i
+		}
+	}
+}
+
+// Len returns the number of variables
+func (idx *Index) Len() int {
+	return len(idx.vars)
+}
+
+// Has reports whether key is present
+func (idx *Index) Has(key string) bool {
+	_, ok := idx.pos[key]
+	return ok
+}
+
+// Get returns the variable with the given key, or nil if not found. The
+// pointer is valid until the next Set or Remove.
+func (idx *Index) Get(key string) *Variable {
+	i, ok := idx.pos[key]
+	if !ok {
+		return nil
+	}
+	return &idx.vars[i]
+}
+
+// Lookup returns the value of key and whether it is present
+func (idx *Index) Lookup(key string) (string, bool) {
+	i, ok := idx.pos[key]
+	if !ok {
+		return "", false
+	}
+	return idx.vars[i].Value, true
+}
+
+// Set updates an existing variable in place or appends a new one
+func (idx *Index) Set(key, value string) {
+	if i, ok := idx.pos[key]; ok {
+		idx.vars[i].Value = value
+		return
+	}
+	idx.pos[key] = len(idx.vars)
+	idx.vars = append(idx.vars, Variable{Key: key, Value: value})
+}
+
+// Remove removes a variable by key, keeping the order of the others
+func (idx *Index) Remove(key string) bool {
+	i, ok := idx.pos[key]
+	if !ok {
+		return false
+	}
+	delete(idx.pos, key)
+	idx.vars = append(idx.vars[:i], idx.vars[i+1:]...)
+	idx.reindex(i)
+	return true
+}
+
+// Sort orders the variables like Variables.Sort and updates the index
+func (idx *Index) Sort(groups ...string) {
+	idx.vars.Sort(groups...)
+	clear(idx.pos)
+	idx.reindex(0)
+}
+
+// Variables returns the indexed variables in order. The slice is shared with
+// the index: values may be changed in place, but keys and order must only be
+// changed through the index.
+func (idx *Index) Variables() Variables {
+	return idx.vars
+}
@@ -0,0 +1,111 @@
+package env
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex(Variables{
+		{Key: "A", Value: "1"},
+		{Key: "B", Value: "2"},
+		{Key: "A", Value: "dup"},
+		{Key: "C", Value: "3"},
+	})
+
+	if idx.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", idx.Len())
+	}
+	if v, ok := idx.Lookup("A"); !ok || v != "1" {
+		t.Errorf("Lookup(A) = %q, %v, want first occurrence", v, ok)
+	}
+	if _, ok := idx.Lookup("MISSING"); ok || idx.Has("MISSING") || idx.Get("MISSING") != nil {
+		t.Error("lookups of a missing key should fail")
+	}
+
+	idx.Set("B", "two")
+	idx.Set("D", "4")
+	if v := idx.Get("B"); v == nil || v.Value != "two" {
+		t.Errorf("Get(B) = %v, want two", v)
+	}
+
+	// Removing the first A exposes the duplicate
+	if !idx.Remove("A") {
+		t.Fatal("Remove(A) = false, want true")
+	}
+	if v, ok := idx.Lookup("A"); !ok || v != "dup" {
+		t.Errorf("Lookup(A) after Remove = %q, %v, want dup", v, ok)
+	}
+	if idx.Remove("MISSING") {
+		t.Error("Remove(MISSING) = true, want false")
+	}
+
+	want := Variables{{Key: "B", Value: "two"}, {Key: "A", Value: "dup"}, {Key: "C", Value: "3"}, {Key: "D", Value: "4"}}
+	assertVariables(t, idx.Variables(), want)
+	for i, v := range want {
+		if got := idx.Get(v.Key); got != &idx.Variables()[i] {
+			t.Errorf("Get(%s) does not point at position %d", v.Key, i)
+		}
+	}
+
+	idx.Sort()
+	assertVariables(t, idx.Variables(), Variables{{Key: "A", Value: "dup"}, {Key: "B", Value: "two"}, {Key: "C", Value: "3"}, {Key: "D", Value: "4"}})
+	if v, _ := idx.Lookup("D"); v != "4" {
+		t.Errorf("Lookup(D) after Sort = %q, want 4", v)
+	}
+}
+
+func assertVariables(t *testing.T, got, want Variables) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func benchmarkVariables(n int) Variables {
+	vars := make(Variables, n)
+	for i := range vars {
+		vars[i] = Variable{Key: fmt.Sprintf("KEY_%d", i), Value: "value"}
+	}
+	return vars
+}
+
+func BenchmarkVariables_Get(b *testing.B) {
+	vars := benchmarkVariables(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = vars.Get(vars[i%len(vars)].Key)
+	}
+}
+
+func BenchmarkIndex_Get(b *testing.B) {
+	vars := benchmarkVariables(5000)
+	idx := NewIndex(vars)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = idx.Get(vars[i%len(vars)].Key)
+	}
+}
+
+func BenchmarkVariables_Set(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		vars := benchmarkVariables(1000)
+		for _, v := range benchmarkVariables(1000) {
+			vars.Set(v.Key, "updated")
+		}
+	}
+}
+
+func BenchmarkIndex_Set(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		idx := NewIndex(benchmarkVariables(1000))
+		for _, v := range benchmarkVariables(1000) {
+			idx.Set(v.Key, "updated")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package env
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultSecretName names the Kustomize secretGenerator entry when none is given
+const DefaultSecretName = "env"
+
+// plainYAMLKey matches keys that need no quoting in YAML
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// RenderHelmValues returns vars as a Helm values YAML fragment mapping keys
+// to values, nested under path when given (e.g. "secrets.env"). Values are
+// always double quoted so YAML never reinterprets them.
+func RenderHelmValues(vars Variables, path string) string {
+	var sb strings.Builder
+	indent := ""
+	if path != "" {
+		for _, part := range strings.Split(path, ".") {
+			sb.WriteString(indent + yamlKey(part) + ":\n")
+			indent += "  "
+		}
+	}
+	if len(vars) == 0 {
+		if path == "" {
+			return "{}\n"
+		}
+		// The innermost key maps to an empty map
+		out := strings.TrimSuffix(sb.String(), "\n")
+		return out + " {}\n"
+	}
+	for _, v := range vars {
+		sb.WriteString(indent + yamlKey(v.Key) + ": " + strconv.Quote(v.Value) + "\n")
+	}
+	return sb.String()
+}
+
+// RenderKustomizeSecret returns a Kustomize secretGenerator entry named name
+// holding vars as literals
+func RenderKustomizeSecret(vars Variables, name string) string {
+	if name == "" {
+		name = DefaultSecretName
+	}
+	var sb strings.Builder
+	sb.WriteString("secretGenerator:\n")
+	sb.WriteString("- name: " + strconv.Quote(name) + "\n")
+	if len(vars) == 0 {
+		sb.WriteString("  literals: []\n")
+		return sb.String()
+	}
+	sb.WriteString("  literals:\n")
+	for _, v := range vars {
+		sb.WriteString("  - " + strconv.Quote(v.Key+"="+v.Value) + "\n")
+	}
+	return sb.String()
+}
+
+func yamlKey(key string) string {
+	if plainYAMLKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
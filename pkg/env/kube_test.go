@@ -0,0 +1,67 @@
+package env
+
+import "testing"
+
+func TestRenderHelmValues(t *testing.T) {
+	vars := Variables{
+		{Key: "DATABASE_URL", Value: "postgres://db:5432/app"},
+		{Key: "PORT", Value: "8080"},
+		{Key: "MULTI", Value: "a\nb \"c\""},
+		{Key: "with space", Value: "yes"},
+	}
+
+	tests := []struct {
+		name string
+		vars Variables
+		path string
+		want string
+	}{
+		{
+			name: "top level",
+			vars: vars,
+			want: "DATABASE_URL: \"postgres://db:5432/app\"\nPORT: \"8080\"\nMULTI: \"a\\nb \\\"c\\\"\"\n\"with space\": \"yes\"\n",
+		},
+		{
+			name: "nested",
+			vars: vars[:2],
+			path: "secrets.env",
+			want: "secrets:\n  env:\n    DATABASE_URL: \"postgres://db:5432/app\"\n    PORT: \"8080\"\n",
+		},
+		{name: "empty", want: "{}\n"},
+		{name: "empty nested", path: "env", want: "env: {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderHelmValues(tt.vars, tt.path); got != tt.want {
+				t.Errorf("RenderHelmValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderKustomizeSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		vars       Variables
+		secretName string
+		want       string
+	}{
+		{
+			name:       "literals",
+			vars:       Variables{{Key: "API_KEY", Value: "k=v"}, {Key: "EMPTY", Value: ""}},
+			secretName: "api",
+			want:       "secretGenerator:\n- name: \"api\"\n  literals:\n  - \"API_KEY=k=v\"\n  - \"EMPTY=\"\n",
+		},
+		{
+			name: "default name without variables",
+			want: "secretGenerator:\n- name: \"env\"\n  literals: []\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderKustomizeSecret(tt.vars, tt.secretName); got != tt.want {
+				t.Errorf("RenderKustomizeSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package env
+
+import (
+	"context"
+	"sync"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/errlog"
+)
+
+// DecryptingVariables holds variables whose values are decrypted only when
+// they are accessed, with the context it was created with. Decrypted values
+// are cached, and the type is safe for concurrent use.
+type DecryptingVariables struct {
+	ctx       context.Context
+	index     *Index
+	encryptor crypto.Encryptor
+	key       []byte
+
+	mu        sync.Mutex
+	decrypted map[string]string
+}
+
+// NewDecryptingVariables wraps raw, possibly encrypted variables for lazy decryption
+func NewDecryptingVariables(ctx context.Context, vars Variables, encryptor crypto.Encryptor, key []byte) *DecryptingVariables {
+	return &DecryptingVariables{
+		ctx:       ctx,
+		index:     NewIndex(vars),
+		encryptor: encryptor,
+		key:       key,
+		decrypted: make(map[string]string),
+	}
+}
+
+// LoadWithLazyDecryption loads variables from a file, deferring decryption
+// until values are accessed
+func (l *FileLoader) LoadWithLazyDecryption(ctx context.Context, filename string, encryptor crypto.Encryptor, key []byte) (*DecryptingVariables, error) {
+	vars, err := l.Load(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecryptingVariables(ctx, vars, encryptor, key), nil
+}
+
+// Len returns the number of variables
+func (d *DecryptingVariables) Len() int {
+	return d.index.Len()
+}
+
+// Keys returns the variable keys in file order without decrypting anything
+func (d *DecryptingVariables) Keys() []string {
+	vars := d.index.Variables()
+	keys := make([]string, len(vars))
+	for i, v := range vars {
+		keys[i] = v.Key
+	}
+	return keys
+}
+
+// Has reports whether key is present, by name or by the token of a hidden
+// name, without decrypting anything
+func (d *DecryptingVariables) Has(key string) bool {
+	return d.index.Has(key) || d.index.Has(crypto.NameToken(key, d.key))
+}
+
+// Get returns the decrypted value of key and whether it is present. A key
+// stored with HideName is found by its name.
+func (d *DecryptingVariables) Get(key string) (string, bool, error) {
+	stored := key
+	raw, ok := d.index.Lookup(key)
+	if !ok {
+		stored = crypto.NameToken(key, d.key)
+		if raw, ok = d.index.Lookup(stored); !ok {
+			return "", false, nil
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if value, ok := d.decrypted[key]; ok {
+		return value, true, nil
+	}
+	value, err := d.encryptor.Decrypt(d.ctx, raw, d.key)
+	if ctxErr := d.ctx.Err(); ctxErr != nil {
+		return "", true, ctxErr
+	}
+	if err != nil {
+		return "", true, &DecryptErrors{
+			Errors:      []*DecryptError{{Key: key, Cause: classifyDecryptError(err), Err: err}},
+			Encrypted:   1,
+			Fingerprint: crypto.Fingerprint(d.key),
+		}
+	}
+	if value != raw {
+		errlog.Register(value)
+	}
+	if stored != key {
+		name, hidden, ok := RevealName(stored, value, d.key)
+		if !ok || name != key {
+			return "", false, nil
+		}
+		value = hidden
+	}
+	d.decrypted[key] = value
+	return value, true, nil
+}
+
+// Raw returns the variables as loaded, without decrypting them
+func (d *DecryptingVariables) Raw() Variables {
+	return d.index.Variables()
+}
+
+// All decrypts every variable and returns them in file order. If some values
+// fail, the variables are still returned, with those values left encrypted,
+// alongside the *DecryptErrors.
+func (d *DecryptingVariables) All() (Variables, error) {
+	vars := append(Variables(nil), d.index.Variables()...)
+	if err := vars.DecryptAll(d.ctx, d.encryptor, d.key); err != nil {
+		return vars, err
+	}
+	return vars, nil
+}
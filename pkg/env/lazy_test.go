@@ -0,0 +1,78 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+// countingEncryptor counts Decrypt calls made through the wrapped encryptor
+type countingEncryptor struct {
+	crypto.Encryptor
+	decrypts atomic.Int32
+}
+
+func (c *countingEncryptor) Decrypt(ctx context.Context, ciphertext string, key []byte) (string, error) {
+	c.decrypts.Add(1)
+	return c.Encryptor.Decrypt(ctx, ciphertext, key)
+}
+
+func TestLoadWithLazyDecryption(t *testing.T) {
+	aes := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+
+	secret, err := aes.Encrypt(context.Background(), "s3cret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), ".env")
+	content := "API_KEY=" + secret + "\nPORT=8080\nBROKEN=ZW52eGJyb2tlbg==\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptor := &countingEncryptor{Encryptor: aes}
+	lazy, err := NewFileLoader().LoadWithLazyDecryption(context.Background(), file, encryptor, key)
+	if err != nil {
+		t.Fatalf("LoadWithLazyDecryption() unexpected error: %v", err)
+	}
+
+	if lazy.Len() != 3 || !lazy.Has("PORT") || lazy.Has("MISSING") {
+		t.Errorf("Len/Has mismatch: len=%d", lazy.Len())
+	}
+	if keys := lazy.Keys(); len(keys) != 3 || keys[0] != "API_KEY" || keys[2] != "BROKEN" {
+		t.Errorf("Keys() = %v", keys)
+	}
+	if n := encryptor.decrypts.Load(); n != 0 {
+		t.Errorf("decrypted %d values before any access", n)
+	}
+
+	// A broken value elsewhere in the file does not affect other keys
+	for range 2 {
+		value, ok, err := lazy.Get("API_KEY")
+		if err != nil || !ok || value != "s3cret" {
+			t.Errorf("Get(API_KEY) = %q, %v, %v", value, ok, err)
+		}
+	}
+	if n := encryptor.decrypts.Load(); n != 1 {
+		t.Errorf("decrypted %d times, want 1 with caching", n)
+	}
+
+	if _, ok, err := lazy.Get("MISSING"); ok || err != nil {
+		t.Errorf("Get(MISSING) = %v, %v, want not found", ok, err)
+	}
+	if _, ok, err := lazy.Get("BROKEN"); !ok || err == nil {
+		t.Errorf("Get(BROKEN) = %v, %v, want decryption error", ok, err)
+	}
+	if _, err := lazy.All(); err == nil {
+		t.Error("All() expected error for the broken value")
+	}
+	if raw := lazy.Raw(); raw[0].Value != secret {
+		t.Error("Raw() returned decrypted values")
+	}
+}
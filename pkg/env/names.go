@@ -0,0 +1,46 @@
+package env
+
+import (
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/errlog"
+)
+
+// HideName returns v stored under the lookup token for its name, with the
+// name encrypted into the value alongside the plaintext value. encrypt
+// receives the token as the variable name.
+func HideName(v Variable, key []byte, encrypt func(name, value string, key []byte) (string, error)) (Variable, error) {
+	token := crypto.NameToken(v.Key, key)
+	ciphertext, err := encrypt(token, v.Key+"="+v.Value, key)
+	if err != nil {
+		return Variable{}, err
+	}
+	return Variable{Key: token, Value: ciphertext}, nil
+}
+
+// RevealName returns the name and value in plaintext, the decrypted value of
+// a variable stored under token by HideName, and whether it is one. The
+// value is registered with errlog on its own, since only NAME=value was when
+// plaintext was decrypted.
+func RevealName(token, plaintext string, key []byte) (name, value string, ok bool) {
+	if !crypto.IsNameToken(token) {
+		return "", "", false
+	}
+	name, value, ok = strings.Cut(plaintext, "=")
+	if !ok || crypto.NameToken(name, key) != token {
+		return "", "", false
+	}
+	errlog.Register(value)
+	return name, value, true
+}
+
+// revealNames restores the names of the variables at positions that were
+// stored by HideName and have been decrypted
+func (vars Variables) revealNames(positions []int, key []byte) {
+	for _, i := range positions {
+		if name, value, ok := RevealName(vars[i].Key, vars[i].Value, key); ok {
+			vars[i] = Variable{Key: name, Value: value}
+		}
+	}
+}
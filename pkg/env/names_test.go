@@ -0,0 +1,73 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/errlog"
+)
+
+func TestHideName(t *testing.T) {
+	aes := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	encrypt := func(_, value string, key []byte) (string, error) {
+		return aes.Encrypt(context.Background(), value, key)
+	}
+
+	hidden, err := HideName(Variable{Key: "STRIPE_SECRET_KEY", Value: "sk=live"}, key, encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hidden.Key != crypto.NameToken("STRIPE_SECRET_KEY", key) || strings.Contains(hidden.Value, "STRIPE") {
+		t.Fatalf("HideName() = %+v, want the name hidden", hidden)
+	}
+
+	vars := Variables{hidden, {Key: "PORT", Value: "8080"}}
+	lazy := NewDecryptingVariables(context.Background(), append(Variables(nil), vars...), aes, key)
+	if !lazy.Has("STRIPE_SECRET_KEY") {
+		t.Error("Has() did not find the hidden name")
+	}
+	if value, ok, err := lazy.Get("STRIPE_SECRET_KEY"); err != nil || !ok || value != "sk=live" {
+		t.Errorf("Get() = %q, %v, %v; want sk=live", value, ok, err)
+	}
+
+	if err := vars.DecryptAll(context.Background(), aes, key); err != nil {
+		t.Fatal(err)
+	}
+	want := Variables{{Key: "STRIPE_SECRET_KEY", Value: "sk=live"}, {Key: "PORT", Value: "8080"}}
+	for i := range want {
+		if vars[i] != want[i] {
+			t.Errorf("DecryptAll()[%d] = %+v, want %+v", i, vars[i], want[i])
+		}
+	}
+
+	// A value that merely looks like a hidden entry keeps its key
+	token := crypto.NameToken("OTHER", key)
+	if _, _, ok := RevealName(token, "STRIPE_SECRET_KEY=sk", key); ok {
+		t.Error("RevealName() accepted a name that does not match the token")
+	}
+}
+
+func TestRevealName_RegistersValue(t *testing.T) {
+	defer errlog.Reset()
+
+	aes := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	encrypt := func(_, value string, key []byte) (string, error) {
+		return aes.Encrypt(context.Background(), value, key)
+	}
+	hidden, err := HideName(Variable{Key: "API_SECRET", Value: "correct-horse"}, key, encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := Variables{hidden}
+	if err := vars.DecryptAll(context.Background(), aes, key); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := errlog.Redact("failed: correct-horse"), "failed: [REDACTED]"; got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DuplicatePolicy says what a FileLoader does with a key set more than once
+// in the same section
+type DuplicatePolicy int
+
+const (
+	// DuplicatesKeep keeps every occurrence; lookups find the first
+	DuplicatesKeep DuplicatePolicy = iota
+	// DuplicatesFirst keeps the first occurrence and drops the others
+	DuplicatesFirst
+	// DuplicatesLast keeps the value of the last occurrence, in the place
+	// of the first, as a shell sourcing the file would
+	DuplicatesLast
+	// DuplicatesError fails to load the file
+	DuplicatesError
+)
+
+// LoaderOptions choose the parsing semantics of a FileLoader. The zero value
+// is what NewFileLoader uses: lenient parsing, no expansion, duplicates kept
+// and comments dropped.
+type LoaderOptions struct {
+	// Strict fails on any line that would otherwise only produce a Warning
+	Strict bool
+	// Expand replaces ${VAR} and $VAR in values with the value of a variable
+	// set earlier in the same section; \$ is a literal $. Unknown variables
+	// expand to nothing, with a Warning.
+	Expand bool
+	// Duplicates is the policy for keys set more than once in a section
+	Duplicates DuplicatePolicy
+	// Comments keeps comment lines in Section.Comments
+	Comments bool
+}
+
+// NewFileLoaderWithOptions creates a file loader parsing with opts
+func NewFileLoaderWithOptions(opts LoaderOptions) *FileLoader {
+	return &FileLoader{opts: opts}
+}
+
+// reference matches the variable references Expand replaces, and escaped
+// dollar signs
+var reference = regexp.MustCompile(`\\\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expand replaces the variable references in value with values from vars,
+// returning the names of those not found
+func expand(value string, vars Variables) (string, []string) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+	var unknown []string
+	expanded := reference.ReplaceAllStringFunc(value, func(match string) string {
+		if match == `\$` {
+			return "$"
+		}
+		groups := reference.FindStringSubmatch(match)
+		name := groups[1] + groups[2]
+		if value, ok := latest(vars)(name); ok {
+			return value
+		}
+		unknown = append(unknown, name)
+		return ""
+	})
+	return expanded, unknown
+}
+
+// latest returns a lookup of the value of a variable in vars. The latest
+// assignment is the one in effect at the line being parsed.
+func latest(vars Variables) func(name string) (string, bool) {
+	return func(name string) (string, bool) {
+		for i := len(vars) - 1; i >= 0; i-- {
+			if vars[i].Key == name {
+				return vars[i].Value, true
+			}
+		}
+		return "", false
+	}
+}
+
+// addVariable adds v to section following the duplicate policy. seen maps
+// the keys of the section to their positions.
+func (opts LoaderOptions) addVariable(section *Section, seen map[string]int, v Variable, line int) error {
+	i, duplicate := seen[v.Key]
+	switch {
+	case !duplicate || opts.Duplicates == DuplicatesKeep:
+		if !duplicate {
+			seen[v.Key] = len(section.Vars)
+		}
+		section.Vars = append(section.Vars, v)
+	case opts.Duplicates == DuplicatesLast:
+		section.Vars[i].Value = v.Value
+	case opts.Duplicates == DuplicatesError:
+		return fmt.Errorf("line %d: duplicate key %s", line, v.Key)
+	}
+	return nil
+}
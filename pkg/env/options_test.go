@@ -0,0 +1,102 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileLoader_Options(t *testing.T) {
+	content := `# database
+HOST=db
+URL=postgres://${HOST}:$PORT/app
+PRICE=\$5
+HOST=replica
+malformed
+# end
+`
+	filename := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     LoaderOptions
+		expected Variables
+		comments map[string][]string
+		warnings int
+		wantErr  string
+	}{
+		{
+			name:     "defaults",
+			expected: Variables{{"HOST", "db"}, {"URL", "postgres://${HOST}:$PORT/app"}, {"PRICE", `\$5`}, {"HOST", "replica"}},
+			warnings: 1,
+		},
+		{
+			name:     "expand",
+			opts:     LoaderOptions{Expand: true},
+			expected: Variables{{"HOST", "db"}, {"URL", "postgres://db:/app"}, {"PRICE", "$5"}, {"HOST", "replica"}},
+			warnings: 2,
+		},
+		{
+			name:     "first duplicate",
+			opts:     LoaderOptions{Duplicates: DuplicatesFirst},
+			expected: Variables{{"HOST", "db"}, {"URL", "postgres://${HOST}:$PORT/app"}, {"PRICE", `\$5`}},
+			warnings: 1,
+		},
+		{
+			name:     "last duplicate",
+			opts:     LoaderOptions{Duplicates: DuplicatesLast},
+			expected: Variables{{"HOST", "replica"}, {"URL", "postgres://${HOST}:$PORT/app"}, {"PRICE", `\$5`}},
+			warnings: 1,
+		},
+		{
+			name:    "duplicate error",
+			opts:    LoaderOptions{Duplicates: DuplicatesError},
+			wantErr: "line 5: duplicate key HOST",
+		},
+		{
+			name:    "strict",
+			opts:    LoaderOptions{Strict: true},
+			wantErr: "line 6: skipped malformed line",
+		},
+		{
+			name:     "comments",
+			opts:     LoaderOptions{Comments: true},
+			expected: Variables{{"HOST", "db"}, {"URL", "postgres://${HOST}:$PORT/app"}, {"PRICE", `\$5`}, {"HOST", "replica"}},
+			comments: map[string][]string{"HOST": {"# database"}, "": {"# end"}},
+			warnings: 1,
+		},
+	}
+
+	// One cache for all, which must keep results apart per options
+	ctx := WithCache(context.Background(), NewCache())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader := NewFileLoaderWithOptions(tt.opts)
+			sections, warnings, err := loader.LoadSections(ctx, filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadSections() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSections() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(sections[0].Vars, tt.expected) {
+				t.Errorf("LoadSections() vars = %v, want %v", sections[0].Vars, tt.expected)
+			}
+			if !reflect.DeepEqual(sections[0].Comments, tt.comments) {
+				t.Errorf("LoadSections() comments = %v, want %v", sections[0].Comments, tt.comments)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("LoadSections() warnings = %v, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
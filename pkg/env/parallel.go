@@ -0,0 +1,74 @@
+package env
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers bounds the number of goroutines used by TransformAt. Values below 1
+// mean runtime.GOMAXPROCS(0).
+var Workers = 0
+
+// minParallel is the number of values below which TransformAt runs serially,
+// since starting workers costs more than it saves for small files
+const minParallel = 16
+
+// Transform replaces the value of every variable with the result of fn, see TransformAt
+func (vars Variables) Transform(fn func(i int, v Variable) (string, error)) error {
+	positions := make([]int, len(vars))
+	for i := range positions {
+		positions[i] = i
+	}
+	return vars.TransformAt(positions, fn)
+}
+
+// TransformAt replaces the value of the variables at the given positions with
+// the result of fn, which receives the position and the variable. Calls to fn
+// run concurrently, but results are stored at their original positions so the
+// order of vars is unchanged. If any call fails, vars is left untouched and the
+// error for the lowest position is returned.
+func (vars Variables) TransformAt(positions []int, fn func(i int, v Variable) (string, error)) error {
+	if len(positions) == 0 {
+		return nil
+	}
+
+	results := make([]string, len(positions))
+	errs := make([]error, len(positions))
+
+	workers := Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if len(positions) < minParallel {
+		workers = 1
+	}
+	workers = min(workers, len(positions))
+
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				i := positions[j]
+				results[j], errs[j] = fn(i, vars[i])
+			}
+		}()
+	}
+	for j := range positions {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	for j, i := range positions {
+		vars[i].Value = results[j]
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestTransformAt(t *testing.T) {
+	vars := make(Variables, 100)
+	for i := range vars {
+		vars[i] = Variable{Key: fmt.Sprintf("KEY_%d", i), Value: fmt.Sprint(i)}
+	}
+
+	if err := vars.Transform(func(i int, v Variable) (string, error) {
+		return v.Key + "=" + v.Value, nil
+	}); err != nil {
+		t.Fatalf("Transform() unexpected error: %v", err)
+	}
+	for i, v := range vars {
+		if want := fmt.Sprintf("KEY_%d=%d", i, i); v.Value != want {
+			t.Fatalf("Transform() [%d] = %q, want %q", i, v.Value, want)
+		}
+	}
+
+	// Only the selected positions change
+	if err := vars.TransformAt([]int{1, 3}, func(i int, v Variable) (string, error) {
+		return "changed", nil
+	}); err != nil {
+		t.Fatalf("TransformAt() unexpected error: %v", err)
+	}
+	if vars[0].Value == "changed" || vars[1].Value != "changed" || vars[3].Value != "changed" {
+		t.Errorf("TransformAt() changed the wrong positions: %v", vars[:4])
+	}
+
+	if err := vars.TransformAt(nil, func(i int, v Variable) (string, error) {
+		return "", errors.New("should not be called")
+	}); err != nil {
+		t.Errorf("TransformAt(nil) unexpected error: %v", err)
+	}
+}
+
+func TestTransformAt_Error(t *testing.T) {
+	vars := make(Variables, 50)
+	for i := range vars {
+		vars[i] = Variable{Key: fmt.Sprintf("KEY_%d", i), Value: "original"}
+	}
+
+	err := vars.Transform(func(i int, v Variable) (string, error) {
+		if i == 10 || i == 40 {
+			return "", fmt.Errorf("failed at %d", i)
+		}
+		return "changed", nil
+	})
+	if err == nil || err.Error() != "failed at 10" {
+		t.Errorf("Transform() error = %v, want the error for the lowest position", err)
+	}
+	for _, v := range vars {
+		if v.Value != "original" {
+			t.Fatal("Transform() modified variables despite an error")
+		}
+	}
+}
+
+func BenchmarkVariables_DecryptAll(b *testing.B) {
+	encryptor := crypto.NewAESEncryptor()
+	key := make([]byte, crypto.KeySize)
+	vars := benchmarkVariables(1000)
+	for i := range vars {
+		ciphertext, err := encryptor.Encrypt(context.Background(), vars[i].Value, key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vars[i].Value = ciphertext
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		work := append(Variables(nil), vars...)
+		if err := work.DecryptAll(context.Background(), encryptor, key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package env
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultSecretPatterns are glob patterns for keys that usually hold secrets
+var DefaultSecretPatterns = []string{
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*TOKEN*",
+	"*CREDENTIAL*",
+	"*PRIVATE*",
+	"*API_KEY*",
+	"*APIKEY*",
+	"*_KEY",
+}
+
+// MatchesAny reports whether key matches any of the glob patterns.
+// Matching is case-insensitive; malformed patterns never match.
+func MatchesAny(key string, patterns []string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range patterns {
+		if ok, err := path.Match(strings.ToUpper(pattern), key); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSecretKey reports whether key looks like it holds a secret
+func IsSecretKey(key string) bool {
+	return MatchesAny(key, DefaultSecretPatterns)
+}
+
+// Policy decides which variables are encrypted. Plaintext patterns win over
+// Encrypt patterns, so non-secret settings can stay readable in diffs.
+type Policy struct {
+	// Encrypt lists patterns for keys that must be encrypted. When empty,
+	// encrypt covers every key and checks fall back to DefaultSecretPatterns.
+	Encrypt []string
+	// Plaintext lists patterns for keys that are left unencrypted
+	Plaintext []string
+}
+
+// Encrypts reports whether encrypting a file without naming keys should
+// encrypt key
+func (p Policy) Encrypts(key string) bool {
+	if MatchesAny(key, p.Plaintext) {
+		return false
+	}
+	return len(p.Encrypt) == 0 || MatchesAny(key, p.Encrypt)
+}
+
+// Requires reports whether key must hold an encrypted value, for checks that
+// refuse or report plaintext secrets
+func (p Policy) Requires(key string) bool {
+	if MatchesAny(key, p.Plaintext) {
+		return false
+	}
+	if len(p.Encrypt) == 0 {
+		return IsSecretKey(key)
+	}
+	return MatchesAny(key, p.Encrypt)
+}
+
+// ParsePatterns splits a comma separated list of glob patterns, dropping
+// empty entries
+func ParsePatterns(list string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,80 @@
+package env
+
+import "testing"
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		key      string
+		patterns []string
+		expected bool
+	}{
+		{key: "DB_PASSWORD", patterns: []string{"DB_PASSWORD"}, expected: true},
+		{key: "STRIPE_SECRET", patterns: []string{"*_SECRET"}, expected: true},
+		{key: "stripe_secret", patterns: []string{"*_SECRET"}, expected: true},
+		{key: "LOG_LEVEL", patterns: []string{"*_SECRET", "*_TOKEN"}, expected: false},
+		{key: "PORT", patterns: nil, expected: false},
+		{key: "ANY", patterns: []string{"[invalid"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := MatchesAny(tt.key, tt.patterns); got != tt.expected {
+				t.Errorf("MatchesAny(%q, %v) = %v, want %v", tt.key, tt.patterns, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsSecretKey(t *testing.T) {
+	secrets := []string{"API_KEY", "GITHUB_TOKEN", "DB_PASSWORD", "JWT_SECRET", "AWS_SECRET_ACCESS_KEY", "PRIVATE_PEM"}
+	for _, key := range secrets {
+		if !IsSecretKey(key) {
+			t.Errorf("IsSecretKey(%q) = false, want true", key)
+		}
+	}
+
+	plain := []string{"PORT", "LOG_LEVEL", "DATABASE_HOST", "KEYBOARD_LAYOUT"}
+	for _, key := range plain {
+		if IsSecretKey(key) {
+			t.Errorf("IsSecretKey(%q) = true, want false", key)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       Policy
+		key          string
+		wantEncrypts bool
+		wantRequires bool
+	}{
+		{name: "default secret", policy: Policy{}, key: "API_TOKEN", wantEncrypts: true, wantRequires: true},
+		{name: "default plain", policy: Policy{}, key: "PORT", wantEncrypts: true, wantRequires: false},
+		{name: "plaintext pattern", policy: Policy{Plaintext: []string{"PORT"}}, key: "PORT", wantEncrypts: false, wantRequires: false},
+		{name: "encrypt pattern", policy: Policy{Encrypt: []string{"DB_*"}}, key: "DB_HOST", wantEncrypts: true, wantRequires: true},
+		{name: "outside encrypt patterns", policy: Policy{Encrypt: []string{"DB_*"}}, key: "API_TOKEN", wantEncrypts: false, wantRequires: false},
+		{name: "plaintext wins", policy: Policy{Encrypt: []string{"*"}, Plaintext: []string{"LOG_*"}}, key: "LOG_LEVEL", wantEncrypts: false, wantRequires: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Encrypts(tt.key); got != tt.wantEncrypts {
+				t.Errorf("Encrypts(%q) = %v, want %v", tt.key, got, tt.wantEncrypts)
+			}
+			if got := tt.policy.Requires(tt.key); got != tt.wantRequires {
+				t.Errorf("Requires(%q) = %v, want %v", tt.key, got, tt.wantRequires)
+			}
+		})
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	got := ParsePatterns(" *_SECRET, ,DB_PASSWORD,")
+	if len(got) != 2 || got[0] != "*_SECRET" || got[1] != "DB_PASSWORD" {
+		t.Errorf("ParsePatterns() = %q, want [*_SECRET DB_PASSWORD]", got)
+	}
+	if got := ParsePatterns(""); got != nil {
+		t.Errorf("ParsePatterns(\"\") = %q, want nil", got)
+	}
+}
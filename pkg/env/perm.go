@@ -0,0 +1,36 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// SecureFileMode is the permission envx uses for every file it creates
+const SecureFileMode os.FileMode = 0o600
+
+// ErrInsecurePermissions is returned when a file is accessible by group or others
+var ErrInsecurePermissions = errors.New("file is readable or writable by group or others")
+
+// CheckPermissions returns ErrInsecurePermissions (wrapped with the file name
+// and mode) if the file grants any access to group or others. Missing files
+// and platforms without POSIX permissions are not considered insecure.
+func CheckPermissions(filename string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat %s: %w", filename, err)
+	}
+
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return fmt.Errorf("%s has mode %04o: %w", filename, mode, ErrInsecurePermissions)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permissions are not enforced on Windows")
+	}
+
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		wantErr bool
+	}{
+		{name: "owner only", mode: 0o600, wantErr: false},
+		{name: "owner read only", mode: 0o400, wantErr: false},
+		{name: "group readable", mode: 0o640, wantErr: true},
+		{name: "world readable", mode: 0o644, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.name)
+			if err := os.WriteFile(filename, []byte("KEY=value\n"), tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filename, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			err := CheckPermissions(filename)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInsecurePermissions) {
+					t.Errorf("CheckPermissions() = %v, want ErrInsecurePermissions", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("CheckPermissions() unexpected error: %v", err)
+			}
+		})
+	}
+
+	if err := CheckPermissions(filepath.Join(tempDir, "missing")); err != nil {
+		t.Errorf("CheckPermissions() missing file unexpected error: %v", err)
+	}
+}
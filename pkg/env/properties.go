@@ -0,0 +1,95 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// RenderProperties returns vars as a Java properties file. Characters with a
+// meaning in properties files are escaped and non-ASCII characters written
+// as \uXXXX, as java.util.Properties.store does, so the file reads the same
+// in any encoding.
+func RenderProperties(vars Variables) string {
+	var sb strings.Builder
+	for _, v := range vars {
+		sb.WriteString(escapeProperty(v.Key, true))
+		sb.WriteByte('=')
+		sb.WriteString(escapeProperty(v.Value, false))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func escapeProperty(s string, isKey bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch r {
+		case ' ':
+			// Spaces separate keys from values and leading ones are trimmed
+			if isKey || i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(' ')
+		case '\\', '=', ':', '#', '!':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if r < 0x20 || r > 0x7e {
+				for _, unit := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&sb, `\u%04X`, unit)
+				}
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+var (
+	// plainINIValue matches values that need no quoting in INI files
+	plainINIValue = regexp.MustCompile(`^[A-Za-z0-9_./@+,-]+$`)
+	// iniKey matches keys INI parsers read the same way
+	iniKey = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// RenderINI returns vars as an INI file, under a [section] header when
+// section is given. Values other than simple words are double quoted with
+// backslash escapes. Keys INI parsers would misread are an error.
+func RenderINI(vars Variables, section string) (string, error) {
+	var sb strings.Builder
+	if section != "" {
+		if !iniKey.MatchString(section) {
+			return "", fmt.Errorf("section %q cannot be written in INI format", section)
+		}
+		sb.WriteString("[" + section + "]\n")
+	}
+	for _, v := range vars {
+		if !iniKey.MatchString(v.Key) {
+			return "", fmt.Errorf("key %q cannot be written in INI format", v.Key)
+		}
+		sb.WriteString(v.Key)
+		sb.WriteString(" = ")
+		sb.WriteString(quoteINI(v.Value))
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+func quoteINI(value string) string {
+	if plainINIValue.MatchString(value) {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
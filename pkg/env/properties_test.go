@@ -0,0 +1,60 @@
+package env
+
+import "testing"
+
+func TestRenderProperties(t *testing.T) {
+	tests := []struct {
+		name string
+		vars Variables
+		want string
+	}{
+		{name: "plain", vars: Variables{{Key: "db.url", Value: "jdbc:postgresql://db/app"}}, want: "db.url=jdbc\\:postgresql\\://db/app\n"},
+		{name: "separators and comments", vars: Variables{{Key: "a=b:c", Value: "#!x=y"}}, want: "a\\=b\\:c=\\#\\!x\\=y\n"},
+		{name: "spaces", vars: Variables{{Key: "my key", Value: "  lead and inner"}}, want: "my\\ key=\\  lead and inner\n"},
+		{name: "control characters", vars: Variables{{Key: "K", Value: "a\\b\tc\nd\re\ff\x01"}}, want: "K=a\\\\b\\tc\\nd\\re\\ff\\u0001\n"},
+		{name: "unicode", vars: Variables{{Key: "GREETING", Value: "héllo 😀"}}, want: "GREETING=h\\u00E9llo \\uD83D\\uDE00\n"},
+		{name: "empty", vars: Variables{{Key: "EMPTY", Value: ""}}, want: "EMPTY=\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderProperties(tt.vars); got != tt.want {
+				t.Errorf("RenderProperties() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderINI(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    Variables
+		section string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "section",
+			vars:    Variables{{Key: "PORT", Value: "8080"}, {Key: "HOST", Value: "db.example.com"}},
+			section: "production",
+			want:    "[production]\nPORT = 8080\nHOST = db.example.com\n",
+		},
+		{
+			name: "quoted values",
+			vars: Variables{{Key: "URL", Value: "postgres://u:p@db/app?x=1"}, {Key: "MSG", Value: `say "hi" ; \ok` + "\n"}, {Key: "EMPTY", Value: ""}, {Key: "NAME", Value: "héllo"}},
+			want: "URL = \"postgres://u:p@db/app?x=1\"\nMSG = \"say \\\"hi\\\" ; \\\\ok\\n\"\nEMPTY = \"\"\nNAME = \"héllo\"\n",
+		},
+		{name: "invalid key", vars: Variables{{Key: "A=B", Value: "x"}}, wantErr: true},
+		{name: "invalid section", section: "a]b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderINI(tt.vars, tt.section)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderINI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderINI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
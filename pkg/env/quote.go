@@ -0,0 +1,169 @@
+package env
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// quoteValue returns value as written in env files: bare when no POSIX
+// shell would interpret any of its characters, single quoted otherwise, so
+// sourcing the file in a shell gives the same value as loading it.
+func quoteValue(value string) string {
+	if shellSafe(value) {
+		return value
+	}
+	// A carriage return right before a line break would be taken for a
+	// CRLF line ending, so the quotes are closed and reopened between them
+	return strings.ReplaceAll(quotePOSIX(value), "\r\n", "\r''\n")
+}
+
+// shellSafe reports whether value can be written unquoted: it is made of
+// letters, digits and punctuation shells treat as ordinary characters. An
+// encrypted value always is.
+func shellSafe(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("%+,-./:=@_", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ErrUnterminatedQuote is returned, wrapped, when a single quoted value
+// is still open at the end of the file. Within a line it means the value may
+// go on over the next lines.
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+var (
+	// errUnbalanced means a double quote in the value is not closed. Only
+	// single quoted values, as envx writes them, may span lines, so a stray
+	// double quote cannot swallow the variables after it.
+	errUnbalanced = errors.New("unbalanced quote")
+	// errTrailing means the value has more than a comment after its quotes
+	errTrailing = errors.New("unexpected text after quoted value")
+)
+
+// singleQuoted scans value, which starts with a single quote, for the shape
+// envx writes: single quoted runs joined only by the \' or nothing that put
+// a quote or a CRLF in the value, up to whitespace or the end. It reports
+// whether value ends inside the quotes, and whether it has that shape, so a
+// stray quote after the opening one cannot continue the value over the
+// lines after it.
+func singleQuoted(value string) (open, ok bool) {
+	if !strings.HasPrefix(value, "'") {
+		return false, false
+	}
+	i := 1
+	for {
+		end := strings.IndexByte(value[i:], '\'')
+		if end < 0 {
+			return true, true
+		}
+		rest := value[i+end+1:]
+		if escaped, found := strings.CutPrefix(rest, `\'`); found {
+			rest = escaped
+		}
+		switch {
+		case rest == "" || strings.IndexByte(" \t\r", rest[0]) >= 0:
+			return false, true
+		case rest[0] != '\'':
+			return false, false
+		}
+		i = len(value) - len(rest) + 1
+	}
+}
+
+// variableName matches the variable name of a $NAME or ${NAME} reference
+// at the start of a string, after the $
+var variableName = regexp.MustCompile(`^(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// unquoteValue reads value, starting with a quote, as a POSIX shell word:
+// single quoted text is literal, double quoted text undoes backslash escapes
+// of $, `, " and \, and a backslash outside quotes escapes the character
+// after it. The word may be followed by whitespace and a # comment.
+//
+// With lookup set, $NAME and ${NAME} outside single quotes are replaced with
+// what it returns, and the names it does not know are returned.
+func unquoteValue(value string, lookup func(name string) (string, bool)) (string, []string, error) {
+	var sb strings.Builder
+	var unknown []string
+	reference := func(rest string) int {
+		m := variableName.FindStringSubmatch(rest)
+		if lookup == nil || m == nil {
+			sb.WriteByte('$')
+			return 0
+		}
+		name := m[1] + m[2]
+		if v, ok := lookup(name); ok {
+			sb.WriteString(v)
+		} else {
+			unknown = append(unknown, name)
+		}
+		return len(m[0])
+	}
+
+	i := 0
+	for i < len(value) {
+		switch c := value[i]; c {
+		case '\'':
+			end := strings.IndexByte(value[i+1:], '\'')
+			if end < 0 {
+				return "", nil, ErrUnterminatedQuote
+			}
+			sb.WriteString(value[i+1 : i+1+end])
+			i += end + 2
+		case '"':
+			i++
+			for {
+				if i >= len(value) {
+					return "", nil, errUnbalanced
+				}
+				c := value[i]
+				if c == '"' {
+					i++
+					break
+				}
+				switch {
+				case c == '\\' && i+1 < len(value) && strings.IndexByte("$`\"\\\n", value[i+1]) >= 0:
+					if value[i+1] != '\n' {
+						sb.WriteByte(value[i+1])
+					}
+					i += 2
+				case c == '$':
+					i += 1 + reference(value[i+1:])
+				default:
+					sb.WriteByte(c)
+					i++
+				}
+			}
+		case '\\':
+			if i+1 < len(value) {
+				if value[i+1] != '\n' {
+					sb.WriteByte(value[i+1])
+				}
+				i += 2
+			} else {
+				sb.WriteByte(c)
+				i++
+			}
+		case '$':
+			i += 1 + reference(value[i+1:])
+		case ' ', '\t', '\r':
+			// A carriage return is left over from a stray CRLF line ending
+			rest := strings.TrimLeft(value[i:], " \t\r")
+			if rest != "" && rest[0] != '#' {
+				return "", nil, errTrailing
+			}
+			return sb.String(), unknown, nil
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), unknown, nil
+}
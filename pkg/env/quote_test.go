@@ -0,0 +1,183 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseQuotedValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		opts     LoaderOptions
+		expected Variables
+		warnings int
+	}{
+		{
+			name:     "single quotes are literal",
+			content:  `A='$HOME "x" \n'` + "\n",
+			expected: Variables{{"A", `$HOME "x" \n`}},
+		},
+		{
+			name:     "escaped single quote",
+			content:  `A='it'\''s'` + "\n",
+			expected: Variables{{"A", "it's"}},
+		},
+		{
+			name:     "double quote escapes",
+			content:  `A="a \"b\" \\ \$ \n"` + "\n",
+			expected: Variables{{"A", `a "b" \ $ \n`}},
+		},
+		{
+			name:     "concatenated words and comment",
+			content:  `A='a'"b"\ c  # comment` + "\n",
+			expected: Variables{{"A", "ab c"}},
+		},
+		{
+			name:     "multi-line single quotes",
+			content:  "A='one\n# not a comment\ntwo\r''\nthree'\nB=2\n",
+			expected: Variables{{"A", "one\n# not a comment\ntwo\r\nthree"}, {"B", "2"}},
+		},
+		{
+			name:     "stray quote after the opening one",
+			content:  "A='x'y's\nB=2\n",
+			expected: Variables{{"A", "'x'y's"}, {"B", "2"}},
+			warnings: 1,
+		},
+		{
+			name:     "quote closing on a later variable",
+			content:  "A='open\nB=1\nC='x'\n",
+			expected: Variables{{"A", "'open"}, {"B", "1"}, {"C", "x"}},
+			warnings: 1,
+		},
+		{
+			name:     "double quotes stay on their line",
+			content:  "A=\"open\nB=\"2\"\n",
+			expected: Variables{{"A", `"open`}, {"B", "2"}},
+			warnings: 1,
+		},
+		{
+			name:     "text after quotes",
+			content:  `A='a' b` + "\n",
+			expected: Variables{{"A", "'a' b"}},
+			warnings: 1,
+		},
+		{
+			name:     "expansion outside single quotes",
+			content:  "HOST=db\nA=\"${HOST}:\\$HOST\"'$HOST'$HOST\n",
+			opts:     LoaderOptions{Expand: true},
+			expected: Variables{{"HOST", "db"}, {"A", "db:$HOST$HOSTdb"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, warnings, err := ParseSectionsWithOptions(strings.NewReader(tt.content), "test", tt.opts)
+			if err != nil {
+				t.Fatalf("ParseSectionsWithOptions() unexpected error: %v", err)
+			}
+			got, _ := sections.Get("")
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("ParseSectionsWithOptions() = %q, want %q", got, tt.expected)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("ParseSectionsWithOptions() warnings = %v, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestParseUnterminatedQuote(t *testing.T) {
+	_, _, err := ParseSectionsWithOptions(strings.NewReader("A=1\nB='open\nC=2\n"), "test", LoaderOptions{})
+	if !errors.Is(err, ErrUnterminatedQuote) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseSectionsWithOptions() error = %v, want %v on line 2", err, ErrUnterminatedQuote)
+	}
+}
+
+// roundTripValues returns every byte alone, at the start, middle and end of
+// a value and doubled, along with values mixing the characters shells and
+// the parser treat specially
+func roundTripValues() []string {
+	values := []string{
+		"", " ", "  padded  ", "'", "''", `"`, `\`, `\'`, `'\''`, "\r\n", "\n\r", "\r''\n",
+		"$HOME ${HOME} $(id) `id`", "a # b", "#", "=", "==", "~/path", "x=~", "*?[a]",
+		"line one\nline two\n", "tab\there", "héllo ✓", "\xff\xfe",
+		"# envx:include other.env", "[section]", "\n[section]\nKEY=value",
+	}
+	for b := 1; b < 256; b++ {
+		c := string([]byte{byte(b)})
+		values = append(values, c, c+"x", "x"+c+"x", "x"+c, c+c)
+	}
+	return values
+}
+
+func TestFormatEnvRoundTrip(t *testing.T) {
+	values := roundTripValues()
+	vars := make(Variables, 0, len(values)+1)
+	for i, value := range values {
+		vars = append(vars, Variable{Key: fmt.Sprintf("V%d", i), Value: value})
+	}
+	vars = append(vars, Variable{Key: "NUL", Value: "a\x00b"})
+
+	content := NewFileWriter().formatEnv(vars)
+	sections, warnings, err := ParseSections(strings.NewReader(content), "test")
+	if err != nil {
+		t.Fatalf("ParseSections() unexpected error: %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("ParseSections() warnings = %v", warnings)
+	}
+	got, _ := sections.Get("")
+	if len(got) != len(vars) {
+		t.Fatalf("ParseSections() read %d variables, want %d", len(got), len(vars))
+	}
+	for i, v := range vars {
+		if got[i] != v {
+			t.Errorf("%s=%q read back as %s=%q", v.Key, v.Value, got[i].Key, got[i].Value)
+		}
+	}
+}
+
+func TestFormatEnvSourceable(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	// Shell variables cannot hold NUL bytes
+	values := roundTripValues()
+	vars := make(Variables, 0, len(values))
+	script := []string{`. "$1"`, `printf '%s\0'`}
+	for i, value := range values {
+		key := fmt.Sprintf("V%d", i)
+		vars = append(vars, Variable{Key: key, Value: value})
+		script = append(script, `"$`+key+`"`)
+	}
+
+	file := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(file, []byte(NewFileWriter().formatEnv(vars)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(sh, "-c", script[0]+"\n"+strings.Join(script[1:], " "), "sh", file)
+	cmd.Env = []string{"LC_ALL=C"}
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("sourcing the file failed: %v", err)
+	}
+
+	got := bytes.Split(bytes.TrimSuffix(output, []byte{0}), []byte{0})
+	if len(got) != len(vars) {
+		t.Fatalf("sourcing the file gave %d values, want %d", len(got), len(vars))
+	}
+	for i, v := range vars {
+		if string(got[i]) != v.Value {
+			t.Errorf("sourced %s = %q, want %q", v.Key, got[i], v.Value)
+		}
+	}
+}
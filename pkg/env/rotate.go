@@ -0,0 +1,109 @@
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatePrefix starts a comment line recording when a variable of the
+// section it appears in is due for rotation
+const rotatePrefix = "# envx:rotate-after "
+
+// DateLayout is how rotation due dates are written
+const DateLayout = "2006-01-02"
+
+// Rotation records when a variable is due for rotation. It is kept in the
+// file as "# envx:rotate-after KEY DATE", followed by "every INTERVAL" when
+// setting the variable again moves the date forward.
+type Rotation struct {
+	Key string
+	// Due is the day the value should be rotated by
+	Due time.Time
+	// Every is the rotation interval, or 0 for a one-off date
+	Every time.Duration
+}
+
+// String returns the directive line for r, without a newline
+func (r Rotation) String() string {
+	line := rotatePrefix + r.Key + " " + r.Due.Format(DateLayout)
+	if r.Every > 0 {
+		line += " every " + FormatDuration(r.Every)
+	}
+	return line
+}
+
+// DueWithin reports whether r is due on or before the day d after now
+func (r Rotation) DueWithin(now time.Time, d time.Duration) bool {
+	return !r.Due.After(Day(now.Add(d)))
+}
+
+// Reschedule returns r due one interval after now, or r unchanged if it has
+// no interval
+func (r Rotation) Reschedule(now time.Time) Rotation {
+	if r.Every > 0 {
+		r.Due = Day(now.Add(r.Every))
+	}
+	return r
+}
+
+// Day returns the calendar date of t as midnight UTC, as rotation dates are
+// kept
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// rotationDirective parses a "# envx:rotate-after KEY DATE [every INTERVAL]"
+// line. The error is set for lines that are rotation directives but
+// malformed.
+func rotationDirective(line string) (Rotation, bool, error) {
+	if len(line) == 0 || line[0] != '#' {
+		return Rotation{}, false, nil
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line[1:]), "envx:rotate-after")
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return Rotation{}, false, nil
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) != 2 && (len(fields) != 4 || fields[2] != "every") {
+		return Rotation{}, true, fmt.Errorf("expected KEY DATE [every INTERVAL]")
+	}
+	due, err := time.Parse(DateLayout, fields[1])
+	if err != nil {
+		return Rotation{}, true, fmt.Errorf("invalid date %q", fields[1])
+	}
+	r := Rotation{Key: fields[0], Due: due}
+	if len(fields) == 4 {
+		if r.Every, err = ParseDuration(fields[3]); err != nil {
+			return Rotation{}, true, err
+		}
+	}
+	return r, true, nil
+}
+
+// ParseDuration parses a time.Duration or a whole number of days such as "90d"
+func ParseDuration(text string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", text)
+	}
+	return d, nil
+}
+
+// FormatDuration writes d as ParseDuration reads it, in days when it is a
+// whole number of them
+func FormatDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
@@ -0,0 +1,79 @@
+package env
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotationDirective(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Rotation
+		ok      bool
+		wantErr bool
+	}{
+		{line: "# envx:rotate-after API_TOKEN 2027-01-31", want: Rotation{Key: "API_TOKEN", Due: time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)}, ok: true},
+		{line: "#envx:rotate-after DB_PASSWORD 2027-01-31 every 90d", want: Rotation{Key: "DB_PASSWORD", Due: time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), Every: 90 * 24 * time.Hour}, ok: true},
+		{line: "# envx:rotate-after API_TOKEN soon", ok: true, wantErr: true},
+		{line: "# envx:rotate-after API_TOKEN 2027-01-31 every", ok: true, wantErr: true},
+		{line: "# envx:rotate-after API_TOKEN 2027-01-31 every often", ok: true, wantErr: true},
+		{line: "# envx:rotate-afterwards API_TOKEN 2027-01-31"},
+		{line: "# rotate API_TOKEN soon"},
+		{line: "API_TOKEN=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok, err := rotationDirective(tt.line)
+			if ok != tt.ok || (err != nil) != tt.wantErr {
+				t.Fatalf("rotationDirective() ok = %v, error = %v; want ok %v, wantErr %v", ok, err, tt.ok, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("rotationDirective() = %+v, want %+v", got, tt.want)
+			}
+			if tt.ok && !tt.wantErr {
+				if again, _, _ := rotationDirective(got.String()); again != got {
+					t.Errorf("rotationDirective(%q) = %+v, want %+v", got.String(), again, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRotation_DueWithin(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, time.Local)
+	r := Rotation{Key: "API_TOKEN", Due: time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)}
+	if r.DueWithin(now, 0) {
+		t.Error("DueWithin(0) = true for a rotation due in four days")
+	}
+	if !r.DueWithin(now, 4*24*time.Hour) {
+		t.Error("DueWithin(4d) = false for a rotation due in four days")
+	}
+	if !r.DueWithin(now.AddDate(0, 0, 4), 0) {
+		t.Error("DueWithin(0) = false on the due date")
+	}
+
+	r.Every = 30 * 24 * time.Hour
+	if got, want := r.Reschedule(now).Due, time.Date(2026, 11, 15, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Reschedule() due = %v, want %v", got, want)
+	}
+}
+
+func TestRenderSections_KeepsRotations(t *testing.T) {
+	content := "# envx:rotate-after API_TOKEN 2027-01-31 every 90d\nAPI_TOKEN=abc\nPORT=8080\n\n[production]\nAPI_TOKEN=def\n# envx:rotate-after API_TOKEN 2027-02-01\n"
+	sections, warnings, err := ParseSections(strings.NewReader(content), ".env")
+	if err != nil || len(warnings) > 0 {
+		t.Fatalf("ParseSections() warnings = %v, error = %v", warnings, err)
+	}
+	if r, ok := sections.Rotation("production", "API_TOKEN"); !ok || r.Due.Format(DateLayout) != "2027-02-01" {
+		t.Errorf("Rotation(production, API_TOKEN) = %+v, %v", r, ok)
+	}
+
+	sections = sections.Set("", Variables{{Key: "PORT", Value: "8080"}})
+	got := NewFileWriter().RenderSections(sections)
+	want := "PORT=8080\n\n[production]\n# envx:rotate-after API_TOKEN 2027-02-01\nAPI_TOKEN=def\n"
+	if got != want {
+		t.Errorf("RenderSections() = %q, want %q", got, want)
+	}
+}
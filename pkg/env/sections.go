@@ -0,0 +1,140 @@
+package env
+
+import "strings"
+
+// Section is a named group of variables in a file holding several
+// environments. The section before the first [name] header has an empty name.
+type Section struct {
+	Name string
+	Vars Variables
+	// Includes lists the paths of "# envx:include" directives in the section
+	Includes []string
+	// Rotations lists the "# envx:rotate-after" directives in the section
+	Rotations []Rotation
+	// Comments maps each key to the comment lines directly above it, and ""
+	// to those ending the section. It is only set with LoaderOptions.Comments.
+	Comments map[string][]string
+}
+
+// Sections lists the sections of a file in file order
+type Sections []Section
+
+// Get returns the variables of the named section and whether it exists
+func (s Sections) Get(name string) (Variables, bool) {
+	if i := s.index(name); i >= 0 {
+		return s[i].Vars, true
+	}
+	return Variables{}, false
+}
+
+// HasIncludes reports whether any section has include directives
+func (s Sections) HasIncludes() bool {
+	for _, section := range s {
+		if len(section.Includes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRotations reports whether any section has rotation directives
+func (s Sections) HasRotations() bool {
+	for _, section := range s {
+		if len(section.Rotations) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Set replaces the variables of the named section, adding the section at the
+// end if it does not exist, and returns the updated sections. Rotations of
+// keys that are no longer in vars are dropped.
+func (s Sections) Set(name string, vars Variables) Sections {
+	i := s.index(name)
+	if i < 0 {
+		return append(s, Section{Name: name, Vars: vars})
+	}
+	s[i].Vars = vars
+	rotations := s[i].Rotations[:0]
+	for _, r := range s[i].Rotations {
+		if vars.Get(r.Key) != nil {
+			rotations = append(rotations, r)
+		}
+	}
+	s[i].Rotations = rotations
+	return s
+}
+
+// Rotations returns the rotations of the named section
+func (s Sections) Rotations(name string) []Rotation {
+	if i := s.index(name); i >= 0 {
+		return s[i].Rotations
+	}
+	return nil
+}
+
+// Rotation returns the rotation of key in the named section
+func (s Sections) Rotation(name, key string) (Rotation, bool) {
+	if i := s.index(name); i >= 0 {
+		for _, r := range s[i].Rotations {
+			if r.Key == key {
+				return r, true
+			}
+		}
+	}
+	return Rotation{}, false
+}
+
+// SetRotation records r in the named section, replacing any rotation of the
+// same key, adding the section at the end if it does not exist, and returns
+// the updated sections
+func (s Sections) SetRotation(name string, r Rotation) Sections {
+	i := s.index(name)
+	if i < 0 {
+		s = append(s, Section{Name: name})
+		i = len(s) - 1
+	}
+	for j, existing := range s[i].Rotations {
+		if existing.Key == r.Key {
+			s[i].Rotations[j] = r
+			return s
+		}
+	}
+	s[i].Rotations = append(s[i].Rotations, r)
+	return s
+}
+
+// Names returns the names of the named sections in file order
+func (s Sections) Names() []string {
+	var names []string
+	for _, section := range s {
+		if section.Name != "" {
+			names = append(names, section.Name)
+		}
+	}
+	return names
+}
+
+// index returns the position of the named section, or -1
+func (s Sections) index(name string) int {
+	for i, section := range s {
+		if section.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// sectionHeader parses a [name] line, returning the trimmed name
+func sectionHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if len(line) < 3 || line[0] != '[' || line[len(line)-1] != ']' {
+		return "", false
+	}
+	name := strings.TrimSpace(line[1 : len(line)-1])
+	if name == "" || strings.ContainsAny(name, "[]=") {
+		return "", false
+	}
+	return name, true
+}
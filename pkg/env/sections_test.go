@@ -0,0 +1,91 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileLoader_LoadSections(t *testing.T) {
+	content := `SHARED=1
+
+[production]
+DB_HOST=prod.example.com
+PORT=443
+
+[ staging ]
+DB_HOST=staging.example.com
+
+[production]
+EXTRA=yes
+`
+	filename := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sections, warnings, err := NewFileLoader().LoadSections(context.Background(), filename)
+	if err != nil {
+		t.Fatalf("LoadSections() unexpected error: %v", err)
+	}
+
+	if got := sections.Names(); !slices.Equal(got, []string{"production", "staging"}) {
+		t.Errorf("Names() = %v, want [production staging]", got)
+	}
+
+	tests := []struct {
+		section string
+		want    Variables
+	}{
+		{"", Variables{{Key: "SHARED", Value: "1"}}},
+		{"production", Variables{{Key: "DB_HOST", Value: "prod.example.com"}, {Key: "PORT", Value: "443"}, {Key: "EXTRA", Value: "yes"}}},
+		{"staging", Variables{{Key: "DB_HOST", Value: "staging.example.com"}}},
+	}
+	for _, tt := range tests {
+		got, ok := sections.Get(tt.section)
+		if !ok || !slices.Equal(got, tt.want) {
+			t.Errorf("Get(%q) = %v, %v, want %v", tt.section, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := sections.Get("development"); ok {
+		t.Error("Get() found a section that does not exist")
+	}
+	if len(warnings) != 1 || warnings[0].Line != 10 {
+		t.Errorf("LoadSections() warnings = %v, want one duplicate section warning on line 10", warnings)
+	}
+
+	vars, _, err := NewFileLoader().LoadWithWarnings(context.Background(), filename)
+	if err != nil || !slices.Equal(vars, tests[0].want) {
+		t.Errorf("LoadWithWarnings() = %v, %v, want only the unnamed section", vars, err)
+	}
+}
+
+func TestFileWriter_RenderSections(t *testing.T) {
+	sections := Sections{
+		{Name: "", Vars: Variables{{Key: "SHARED", Value: "1"}}},
+		{Name: "production", Vars: Variables{{Key: "PORT", Value: "443"}}},
+	}
+	sections = sections.Set("staging", Variables{{Key: "PORT", Value: "8443"}})
+	sections = sections.Set("production", Variables{{Key: "PORT", Value: "80"}})
+
+	got := NewFileWriter().RenderSections(sections)
+	want := "SHARED=1\n\n[production]\nPORT=80\n\n[staging]\nPORT=8443\n"
+	if got != want {
+		t.Errorf("RenderSections() = %q, want %q", got, want)
+	}
+
+	filename := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(filename, []byte(got), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err := NewFileLoader().LoadSections(context.Background(), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NewFileWriter().RenderSections(loaded) != want {
+		t.Error("RenderSections() output does not round trip through LoadSections()")
+	}
+}
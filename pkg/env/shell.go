@@ -0,0 +1,85 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Shell dialects RenderShell writes
+const (
+	ShellPOSIX      = "posix"
+	ShellFish       = "fish"
+	ShellPowerShell = "powershell"
+	ShellCmd        = "cmd"
+)
+
+// ShellDialects lists the supported shell dialects; sh, bash and zsh are
+// accepted for posix and pwsh for powershell
+var ShellDialects = []string{ShellPOSIX, ShellFish, ShellPowerShell, ShellCmd}
+
+// shellAliases maps other names of shells to their dialect
+var shellAliases = map[string]string{
+	"sh":   ShellPOSIX,
+	"bash": ShellPOSIX,
+	"zsh":  ShellPOSIX,
+	"pwsh": ShellPowerShell,
+}
+
+// shellIdentifier matches variable names every dialect accepts unquoted
+var shellIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RenderShell returns statements setting vars in the given shell dialect,
+// for evaluating in a shell or, for cmd, running as a batch file. Values are
+// quoted so the shell never expands them.
+func RenderShell(vars Variables, dialect string) (string, error) {
+	if alias, ok := shellAliases[dialect]; ok {
+		dialect = alias
+	}
+	if !slices.Contains(ShellDialects, dialect) {
+		return "", fmt.Errorf("unsupported shell %q (supported: %s)", dialect, strings.Join(ShellDialects, ", "))
+	}
+	var sb strings.Builder
+	for _, v := range vars {
+		if !shellIdentifier.MatchString(v.Key) {
+			return "", fmt.Errorf("key %q is not a valid shell variable name", v.Key)
+		}
+		switch dialect {
+		case ShellPOSIX:
+			sb.WriteString("export " + v.Key + "=" + quotePOSIX(v.Value) + "\n")
+		case ShellFish:
+			sb.WriteString("set -gx " + v.Key + " " + quoteFish(v.Value) + "\n")
+		case ShellPowerShell:
+			sb.WriteString("$env:" + v.Key + " = " + quotePowerShell(v.Value) + "\n")
+		case ShellCmd:
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return "", fmt.Errorf("cannot set %s in cmd: values cannot span lines", v.Key)
+			}
+			// The quotes around the assignment keep &, |, < and > literal
+			sb.WriteString(`set "` + v.Key + "=" + strings.ReplaceAll(v.Value, "%", "%%") + "\"\r\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+// quotePOSIX single quotes s, which POSIX shells never expand
+func quotePOSIX(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteFish single quotes s; fish only interprets \\ and \' inside them
+func quoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// quotePowerShell double quotes s with backtick escapes, keeping each
+// statement on one line. PowerShell also treats typographic quotes as quotes.
+func quotePowerShell(s string) string {
+	r := strings.NewReplacer(
+		"`", "``", "$", "`$", `"`, "`\"",
+		"“", "`“", "”", "`”", "„", "`„",
+		"\n", "`n", "\r", "`r", "\t", "`t", "\x00", "`0",
+	)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,55 @@
+package env
+
+import "testing"
+
+func TestRenderShell(t *testing.T) {
+	vars := Variables{
+		{Key: "PLAIN", Value: "hello"},
+		{Key: "TRICKY", Value: "it's $HOME `id` \"q\" 100% & a\\b"},
+		{Key: "EMPTY", Value: ""},
+	}
+
+	tests := []struct {
+		dialect string
+		vars    Variables
+		want    string
+		wantErr bool
+	}{
+		{
+			dialect: ShellPOSIX,
+			vars:    vars,
+			want:    "export PLAIN='hello'\nexport TRICKY='it'\\''s $HOME `id` \"q\" 100% & a\\b'\nexport EMPTY=''\n",
+		},
+		{
+			dialect: ShellFish,
+			vars:    vars,
+			want:    "set -gx PLAIN 'hello'\nset -gx TRICKY 'it\\'s $HOME `id` \"q\" 100% & a\\\\b'\nset -gx EMPTY ''\n",
+		},
+		{
+			dialect: ShellPowerShell,
+			vars:    append(vars, Variable{Key: "LINES", Value: "a\nb “c”"}),
+			want:    "$env:PLAIN = \"hello\"\n$env:TRICKY = \"it's `$HOME ``id`` `\"q`\" 100% & a\\b\"\n$env:EMPTY = \"\"\n$env:LINES = \"a`nb `“c`”\"\n",
+		},
+		{
+			dialect: ShellCmd,
+			vars:    vars,
+			want:    "set \"PLAIN=hello\"\r\nset \"TRICKY=it's $HOME `id` \"q\" 100%% & a\\b\"\r\nset \"EMPTY=\"\r\n",
+		},
+		{dialect: "zsh", vars: vars[:1], want: "export PLAIN='hello'\n"},
+		{dialect: "pwsh", vars: vars[:1], want: "$env:PLAIN = \"hello\"\n"},
+		{dialect: ShellCmd, vars: Variables{{Key: "MULTI", Value: "a\nb"}}, wantErr: true},
+		{dialect: ShellPOSIX, vars: Variables{{Key: "NOT-VALID", Value: "x"}}, wantErr: true},
+		{dialect: "tcsh", vars: vars, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			got, err := RenderShell(tt.vars, tt.dialect)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderShell() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderShell() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package env
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+)
+
+// TableOptions control the rows and columns RenderTable writes
+type TableOptions struct {
+	// Header adds a first row naming the columns
+	Header bool
+	// Encrypted, when set, adds an "encrypted" column holding whether the
+	// variable with the given key is encrypted in its file
+	Encrypted func(key string) bool
+}
+
+// RenderTable returns vars as a table with a key and a value column: CSV as
+// in RFC 4180 but with \n line endings, or tab separated values for
+// FormatTSV. Fields holding the separator, quotes or line breaks are quoted
+// in either format, so every value survives a spreadsheet import.
+func RenderTable(vars Variables, format Format, opts TableOptions) (string, error) {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	if format == FormatTSV {
+		w.Comma = '\t'
+	}
+
+	if opts.Header {
+		header := []string{"key", "value"}
+		if opts.Encrypted != nil {
+			header = append(header, "encrypted")
+		}
+		if err := w.Write(header); err != nil {
+			return "", err
+		}
+	}
+	for _, v := range vars {
+		record := []string{v.Key, v.Value}
+		if opts.Encrypted != nil {
+			record = append(record, strconv.FormatBool(opts.Encrypted(v.Key)))
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return sb.String(), w.Error()
+}
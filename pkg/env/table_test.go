@@ -0,0 +1,39 @@
+package env
+
+import "testing"
+
+func TestRenderTable(t *testing.T) {
+	encrypted := func(key string) bool { return key == "SECRET" }
+	tests := []struct {
+		name   string
+		vars   Variables
+		format Format
+		opts   TableOptions
+		want   string
+	}{
+		{name: "plain", vars: Variables{{Key: "PORT", Value: "8080"}}, format: FormatCSV, want: "PORT,8080\n"},
+		{name: "quotes separators", vars: Variables{{Key: "LIST", Value: "a,b"}, {Key: "QUOTE", Value: `say "hi"`}}, format: FormatCSV, want: "LIST,\"a,b\"\nQUOTE,\"say \"\"hi\"\"\"\n"},
+		{name: "quotes line breaks", vars: Variables{{Key: "PEM", Value: "line1\nline2"}}, format: FormatCSV, want: "PEM,\"line1\nline2\"\n"},
+		{name: "tsv quotes tabs", vars: Variables{{Key: "T", Value: "a\tb"}, {Key: "C", Value: "a,b"}}, format: FormatTSV, want: "T\t\"a\tb\"\nC\ta,b\n"},
+		{name: "empty value", vars: Variables{{Key: "EMPTY", Value: ""}}, format: FormatCSV, want: "EMPTY,\n"},
+		{
+			name:   "header and encryption state",
+			vars:   Variables{{Key: "SECRET", Value: "s3cret"}, {Key: "PORT", Value: "8080"}},
+			format: FormatTSV,
+			opts:   TableOptions{Header: true, Encrypted: encrypted},
+			want:   "key\tvalue\tencrypted\nSECRET\ts3cret\ttrue\nPORT\t8080\tfalse\n",
+		},
+		{name: "header only", format: FormatCSV, opts: TableOptions{Header: true}, want: "key,value\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderTable(tt.vars, tt.format, tt.opts)
+			if err != nil {
+				t.Fatalf("RenderTable() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderTable() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
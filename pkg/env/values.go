@@ -0,0 +1,205 @@
+package env
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadValues reads variables from a flat JSON object, a flat YAML mapping or
+// env contents, in the order they appear, so other tools can hand envx many
+// values at once. JSON numbers and booleans, and plain YAML scalars, are
+// taken as written. Nested values, lists and nulls are rejected rather than
+// flattened.
+func ReadValues(r io.Reader, format Format) (Variables, error) {
+	var vars Variables
+	var err error
+	switch format {
+	case FormatJSON:
+		vars, err = readJSONValues(r)
+	case FormatYAML:
+		vars, err = readYAMLValues(r)
+	case FormatEnv:
+		vars, err = readEnvValues(r)
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		if seen[v.Key] {
+			return nil, fmt.Errorf("duplicate key %s", v.Key)
+		}
+		seen[v.Key] = true
+	}
+	return vars, nil
+}
+
+// readEnvValues reads env contents, failing on lines the parser would skip
+// since there is no file to go back to and fix
+func readEnvValues(r io.Reader) (Variables, error) {
+	sections, warnings, err := ParseSections(r, "stdin")
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		return nil, fmt.Errorf("line %d: %s", warnings[0].Line, warnings[0].Message)
+	}
+	if len(sections) > 1 {
+		return nil, fmt.Errorf("sections are not supported")
+	}
+	return sections[0].Vars, nil
+}
+
+func readJSONValues(r io.Reader) (Variables, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	} else if token != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object of keys to values")
+	}
+
+	var vars Variables
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		key := token.(string) // object keys are always strings
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid JSON value for %s: %w", key, err)
+		}
+		switch value := value.(type) {
+		case string:
+			vars = append(vars, Variable{Key: key, Value: value})
+		case json.Number:
+			vars = append(vars, Variable{Key: key, Value: value.String()})
+		case bool:
+			vars = append(vars, Variable{Key: key, Value: strconv.FormatBool(value)})
+		default:
+			return nil, fmt.Errorf("value of %s must be a string, number or boolean", key)
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the object")
+	}
+	return vars, nil
+}
+
+// readYAMLValues reads a single level YAML mapping of scalars, the subset
+// RenderHelmValues writes without a values key
+func readYAMLValues(r io.Reader) (Variables, error) {
+	var vars Variables
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" || trimmed == "..." || trimmed == "{}" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values are not supported", lineNo)
+		}
+
+		var key, rest string
+		var err error
+		if line[0] == '"' || line[0] == '\'' {
+			if key, rest, err = yamlQuoted(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if !strings.HasPrefix(rest, ":") {
+				return nil, fmt.Errorf("line %d: expected KEY: VALUE", lineNo)
+			}
+			rest = rest[1:]
+		} else {
+			i := strings.Index(line, ": ")
+			if i < 0 && strings.HasSuffix(line, ":") {
+				i = len(line) - 1
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected KEY: VALUE", lineNo)
+			}
+			key, rest = strings.TrimSpace(line[:i]), line[i+1:]
+		}
+		if key == "" || strings.HasPrefix(key, "- ") {
+			return nil, fmt.Errorf("line %d: expected KEY: VALUE", lineNo)
+		}
+
+		value, err := yamlScalar(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: value of %s: %w", lineNo, key, err)
+		}
+		vars = append(vars, Variable{Key: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// yamlScalar parses a single line YAML scalar, dropping a trailing comment
+func yamlScalar(s string) (string, error) {
+	if s == "" || s[0] == '#' {
+		return "", fmt.Errorf("null values are not supported")
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		value, rest, err := yamlQuoted(s)
+		if err != nil {
+			return "", err
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %q after quoted value", rest)
+		}
+		return value, nil
+	}
+	if strings.ContainsRune("[{|>&*!%@`", rune(s[0])) {
+		return "", fmt.Errorf("only single line scalars are supported")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "~" || s == "null" || s == "Null" || s == "NULL" {
+		return "", fmt.Errorf("null values are not supported")
+	}
+	return s, nil
+}
+
+// yamlQuoted parses the quoted scalar s starts with, returning it and the
+// text after the closing quote
+func yamlQuoted(s string) (string, string, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(s[1:i], "''", "'"), s[i+1:], nil
+			}
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid double quoted value %s", s[:i+1])
+			}
+			return value, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted value")
+}
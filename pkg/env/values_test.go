@@ -0,0 +1,58 @@
+package env
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		input   string
+		want    Variables
+		wantErr bool
+	}{
+		{
+			name:   "json in order",
+			format: FormatJSON,
+			input:  `{"B": "two", "A": 1.50, "C": false, "D": ""}`,
+			want:   Variables{{Key: "B", Value: "two"}, {Key: "A", Value: "1.50"}, {Key: "C", Value: "false"}, {Key: "D", Value: ""}},
+		},
+		{name: "json null", format: FormatJSON, input: `{"A": null}`, wantErr: true},
+		{name: "json list", format: FormatJSON, input: `{"A": [1]}`, wantErr: true},
+		{name: "json not an object", format: FormatJSON, input: `["A"]`, wantErr: true},
+		{name: "json trailing data", format: FormatJSON, input: `{"A": "1"} {}`, wantErr: true},
+		{name: "json duplicate key", format: FormatJSON, input: `{"A": "1", "A": "2"}`, wantErr: true},
+		{
+			name:   "yaml scalars",
+			format: FormatYAML,
+			input:  "---\n# comment\nA: plain value # note\nB: \"tab\\there\"\n'C': 'it''s'\nD: 'a # b'\nE: http://x:1\n",
+			want: Variables{
+				{Key: "A", Value: "plain value"}, {Key: "B", Value: "tab\there"}, {Key: "C", Value: "it's"},
+				{Key: "D", Value: "a # b"}, {Key: "E", Value: "http://x:1"},
+			},
+		},
+		{name: "yaml written by RenderHelmValues", format: FormatYAML, input: RenderHelmValues(Variables{{Key: "K", Value: "line\n\"q\""}}, ""), want: Variables{{Key: "K", Value: "line\n\"q\""}}},
+		{name: "yaml nested", format: FormatYAML, input: "A:\n  B: c\n", wantErr: true},
+		{name: "yaml list", format: FormatYAML, input: "- A\n", wantErr: true},
+		{name: "yaml block scalar", format: FormatYAML, input: "A: |\n", wantErr: true},
+		{name: "yaml null", format: FormatYAML, input: "A: ~\n", wantErr: true},
+		{name: "yaml unterminated", format: FormatYAML, input: "A: \"b\n", wantErr: true},
+		{name: "env", format: FormatEnv, input: "A=1\nB=\"two\"\n", want: Variables{{Key: "A", Value: "1"}, {Key: "B", Value: "two"}}},
+		{name: "env malformed", format: FormatEnv, input: "A=1\nnot a variable\n", wantErr: true},
+		{name: "unsupported", format: FormatCSV, input: "A,1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadValues(strings.NewReader(tt.input), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ func Log(ctx context.Context, err error) {
 		return
 	}
 
-	LogFunc(ctx, DefaultMessage, ErrorKey, err)
+	LogFunc(ctx, DefaultMessage, ErrorKey, RedactError(err))
 }
 
 func Logm(ctx context.Context, err error, msg string) {
@@ -27,7 +27,7 @@ func Logm(ctx context.Context, err error, msg string) {
 		return
 	}
 
-	LogFunc(ctx, msg, ErrorKey, err)
+	LogFunc(ctx, Redact(msg), ErrorKey, RedactError(err))
 }
 
 func Logf(ctx context.Context, err error, msg string, args ...any) {
@@ -35,7 +35,7 @@ func Logf(ctx context.Context, err error, msg string, args ...any) {
 		return
 	}
 
-	LogFunc(ctx, fmt.Sprintf(msg, args...), ErrorKey, err)
+	LogFunc(ctx, Redact(fmt.Sprintf(msg, args...)), ErrorKey, RedactError(err))
 }
 
 func FnLog(ctx context.Context, fn ErrFunc) {
@@ -47,7 +47,7 @@ func FnLog(ctx context.Context, fn ErrFunc) {
 		return
 	}
 
-	LogFunc(ctx, DefaultMessage, ErrorKey, err)
+	LogFunc(ctx, DefaultMessage, ErrorKey, RedactError(err))
 }
 
 func FnLogm(ctx context.Context, fn ErrFunc, msg string) {
@@ -59,7 +59,7 @@ func FnLogm(ctx context.Context, fn ErrFunc, msg string) {
 		return
 	}
 
-	LogFunc(ctx, msg, ErrorKey, err)
+	LogFunc(ctx, Redact(msg), ErrorKey, RedactError(err))
 }
 
 func FnLogf(ctx context.Context, fn ErrFunc, msg string, args ...any) {
@@ -71,5 +71,5 @@ func FnLogf(ctx context.Context, fn ErrFunc, msg string, args ...any) {
 		return
 	}
 
-	LogFunc(ctx, fmt.Sprintf(msg, args...), ErrorKey, err)
+	LogFunc(ctx, Redact(fmt.Sprintf(msg, args...)), ErrorKey, RedactError(err))
 }
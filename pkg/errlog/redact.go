@@ -0,0 +1,131 @@
+package errlog
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces registered secrets in redacted text
+const Redacted = "[REDACTED]"
+
+// MinSecretLength is the shortest value that is redacted. Shorter values,
+// such as "1" or "on", would mangle unrelated text without protecting much.
+const MinSecretLength = 4
+
+var redactor = struct {
+	sync.RWMutex
+	replacements map[string]string
+	replacer     *strings.Replacer
+}{replacements: make(map[string]string)}
+
+// Register marks values as secret so they are replaced with Redacted in
+// anything passed through Redact, RedactError or the Log functions
+func Register(values ...string) {
+	for _, value := range values {
+		RegisterAs(value, Redacted)
+	}
+}
+
+// RegisterKey marks key material as secret in its raw, hex and base64 forms
+func RegisterKey(key []byte) {
+	if len(key) == 0 {
+		return
+	}
+	Register(string(key), hex.EncodeToString(key), strings.ToUpper(hex.EncodeToString(key)), base64.StdEncoding.EncodeToString(key))
+}
+
+// RegisterAs replaces value with label instead of Redacted, for identifying
+// but non-secret data such as account names
+func RegisterAs(value, label string) {
+	if len(value) < MinSecretLength {
+		return
+	}
+
+	redactor.Lock()
+	defer redactor.Unlock()
+	if redactor.replacements[value] == label {
+		return
+	}
+	redactor.replacements[value] = label
+	redactor.replacer = nil
+}
+
+// Reset forgets all registered values
+func Reset() {
+	redactor.Lock()
+	defer redactor.Unlock()
+	clear(redactor.replacements)
+	redactor.replacer = nil
+}
+
+// Redact replaces every registered value in s
+func Redact(s string) string {
+	redactor.RLock()
+	replacer := redactor.replacer
+	empty := len(redactor.replacements) == 0
+	redactor.RUnlock()
+	if empty {
+		return s
+	}
+
+	if replacer == nil {
+		replacer = buildReplacer()
+	}
+	return replacer.Replace(s)
+}
+
+// buildReplacer creates and caches a replacer that prefers longer values, so
+// a secret containing another secret is replaced as a whole
+func buildReplacer() *strings.Replacer {
+	redactor.Lock()
+	defer redactor.Unlock()
+	if redactor.replacer != nil {
+		return redactor.replacer
+	}
+
+	values := make([]string, 0, len(redactor.replacements))
+	for value := range redactor.replacements {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+
+	pairs := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		pairs = append(pairs, value, redactor.replacements[value])
+	}
+	redactor.replacer = strings.NewReplacer(pairs...)
+	return redactor.replacer
+}
+
+// redactedError redacts the message of the wrapped error while keeping it
+// available to errors.Is and errors.As
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactError returns err with registered values redacted from its message
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*redactedError); ok {
+		return err
+	}
+	return &redactedError{err: err}
+}
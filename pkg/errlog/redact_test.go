@@ -0,0 +1,94 @@
+package errlog
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	defer Reset()
+
+	Register("hunter2hunter2", "abc", "hunter2")
+	RegisterAs("alice", "<account>")
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{in: "password hunter2hunter2 rejected", expected: "password [REDACTED] rejected"},
+		{in: "value hunter2 leaked", expected: "value [REDACTED] leaked"},
+		{in: "/home/alice/.config/envx/salts/alice.salt", expected: "/home/<account>/.config/envx/salts/<account>.salt"},
+		{in: "abc is too short to redact", expected: "abc is too short to redact"},
+		{in: "nothing to see", expected: "nothing to see"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.expected {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegisterKey(t *testing.T) {
+	defer Reset()
+
+	key := []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02}
+	RegisterKey(key)
+
+	msg := fmt.Sprintf("bad key %x / %X / %s", key, key, hex.EncodeToString(key))
+	if got := Redact(msg); strings.Contains(strings.ToLower(got), "deadbeef") {
+		t.Errorf("Redact() leaked key material: %q", got)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	defer Reset()
+
+	sentinel := errors.New("decryption failed")
+	err := fmt.Errorf("value s3cr3t-value: %w", sentinel)
+	Register("s3cr3t-value")
+
+	redacted := RedactError(err)
+	if strings.Contains(redacted.Error(), "s3cr3t-value") {
+		t.Errorf("RedactError() leaked plaintext: %q", redacted.Error())
+	}
+	if !errors.Is(redacted, sentinel) {
+		t.Error("RedactError() broke errors.Is")
+	}
+	if RedactError(redacted) != redacted {
+		t.Error("RedactError() wrapped an already redacted error")
+	}
+	if RedactError(nil) != nil {
+		t.Error("RedactError(nil) != nil")
+	}
+}
+
+func TestLog_Redacts(t *testing.T) {
+	defer Reset()
+	original := LogFunc
+	defer func() { LogFunc = original }()
+
+	var logged []string
+	LogFunc = func(ctx context.Context, msg string, args ...any) {
+		logged = append(logged, msg)
+		for _, arg := range args {
+			logged = append(logged, fmt.Sprint(arg))
+		}
+	}
+
+	Register("topsecret")
+	Logf(context.Background(), errors.New("cannot decrypt topsecret"), "loading %s", "topsecret")
+	FnLog(context.Background(), func() error { return errors.New("topsecret leaked") })
+
+	for _, line := range logged {
+		if strings.Contains(line, "topsecret") {
+			t.Errorf("logged plaintext: %q", line)
+		}
+	}
+}
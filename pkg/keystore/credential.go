@@ -0,0 +1,104 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+// DefaultCredentialName is the systemd credential envx reads its key from
+const DefaultCredentialName = "envx-key"
+
+// ErrReadOnly is returned when writing to a keystore that can only be read
+var ErrReadOnly = errors.New("keystore is read-only")
+
+// CredentialKeyStore reads the key from a systemd credential, i.e. a file in
+// $CREDENTIALS_DIRECTORY put there by LoadCredential= or
+// LoadCredentialEncrypted=. The file holds the raw key or its hex encoding.
+// Keys cannot be created or changed through it.
+type CredentialKeyStore struct {
+	Dir  string
+	Name string
+}
+
+// NewCredentialKeyStore creates a keystore reading the credential name from
+// dir; an empty name uses DefaultCredentialName
+func NewCredentialKeyStore(dir, name string) *CredentialKeyStore {
+	if name == "" {
+		name = DefaultCredentialName
+	}
+	return &CredentialKeyStore{Dir: dir, Name: name}
+}
+
+// CredentialFromEnv returns the credential keystore for the directory systemd
+// passes in $CREDENTIALS_DIRECTORY, and whether the envx credential is there
+func CredentialFromEnv() (*CredentialKeyStore, bool) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, false
+	}
+	store := NewCredentialKeyStore(dir, os.Getenv("ENVX_CREDENTIAL"))
+	_, err := os.Stat(store.path())
+	return store, err == nil
+}
+
+func (c *CredentialKeyStore) path() string {
+	return filepath.Join(c.Dir, c.Name)
+}
+
+// GetKey reads the key from the credential file; the account is ignored since
+// a service has a single credential. Callers needing another key for another
+// purpose derive it, see SharedKeyStore.
+func (c *CredentialKeyStore) GetKey(account string) ([]byte, error) {
+	data, err := os.ReadFile(c.path()) // #nosec G304 -- Path comes from systemd's credentials directory
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential %s: %w", c.Name, err)
+	}
+	if len(data) == crypto.KeySize {
+		return data, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	key, err := hex.DecodeString(text)
+	if err != nil || len(key) != crypto.KeySize {
+		return nil, fmt.Errorf("invalid key in credential %s: expected %d raw or hex encoded bytes", c.Name, crypto.KeySize)
+	}
+	return key, nil
+}
+
+// SharesKey reports that every account gets the credential's key
+func (c *CredentialKeyStore) SharesKey() bool {
+	return true
+}
+
+// HasKey reports whether the credential file exists
+func (c *CredentialKeyStore) HasKey(account string) (bool, error) {
+	_, err := os.Stat(c.path())
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check credential %s: %w", c.Name, err)
+}
+
+// SetKey fails since credentials are provided by systemd
+func (c *CredentialKeyStore) SetKey(account string, key []byte) error {
+	return fmt.Errorf("cannot store key in systemd credential %s: %w", c.Name, ErrReadOnly)
+}
+
+// CreateKey fails since credentials are provided by systemd
+func (c *CredentialKeyStore) CreateKey(account string) ([]byte, error) {
+	return nil, fmt.Errorf("cannot create key in systemd credential %s: %w", c.Name, ErrReadOnly)
+}
+
+// LoadOrCreateKey reads the key; a missing credential is an error
+func (c *CredentialKeyStore) LoadOrCreateKey(account string) ([]byte, error) {
+	return c.GetKey(account)
+}
@@ -0,0 +1,279 @@
+package keystore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/command"
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/secure"
+)
+
+// fido2RelyingParty is the relying party id of the credentials envx creates
+const fido2RelyingParty = "envx"
+
+// FIDO2KeyStore implements KeyStore with a hardware token such as a YubiKey,
+// using the FIDO2 hmac-secret extension through libfido2's command line
+// tools. The key is stored wrapped with a secret only the token can compute,
+// and the token must be touched for every unwrap.
+type FIDO2KeyStore struct {
+	dir    string
+	device string
+	run    CommandRunner
+}
+
+// FIDO2KeyStoreConfig holds configuration for the FIDO2 keystore
+type FIDO2KeyStoreConfig struct {
+	// Dir holds the wrapped keys (default ~/.config/envx/fido2)
+	Dir string
+	// Device is the token's device path; empty uses the first token found
+	Device string
+	// Run executes the libfido2 tools; for dependency injection in tests
+	Run CommandRunner
+}
+
+// fido2Wrapped is the on-disk form of a key wrapped by a token
+type fido2Wrapped struct {
+	CredentialID string `json:"credential_id"`
+	Salt         string `json:"salt"`
+	Key          string `json:"key"`
+}
+
+// NewFIDO2KeyStore creates a new FIDO2 keystore
+func NewFIDO2KeyStore(config *FIDO2KeyStoreConfig) KeyStore {
+	store := &FIDO2KeyStore{dir: getFIDO2Dir(), run: command.Run}
+	if config != nil {
+		if config.Dir != "" {
+			store.dir = config.Dir
+		}
+		if config.Run != nil {
+			store.run = config.Run
+		}
+		store.device = config.Device
+	}
+	return store
+}
+
+// Available reports whether the libfido2 tools are installed
+func (f *FIDO2KeyStore) Available() error {
+	for _, tool := range []string{"fido2-cred", "fido2-assert", "fido2-token"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s is not installed", tool)
+		}
+	}
+	return nil
+}
+
+// FIDO2ConfigFromEnv returns the FIDO2 keystore configuration with the device
+// taken from ENVX_FIDO2_DEVICE and the directory from ENVX_FIDO2_DIR
+func FIDO2ConfigFromEnv() *FIDO2KeyStoreConfig {
+	return &FIDO2KeyStoreConfig{Dir: os.Getenv("ENVX_FIDO2_DIR"), Device: os.Getenv("ENVX_FIDO2_DEVICE")}
+}
+
+// getFIDO2Dir returns the directory for wrapped keys
+var getFIDO2Dir = func() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".envx/fido2"
+	}
+	return fmt.Sprintf("%s/.config/envx/fido2", homeDir)
+}
+
+func (f *FIDO2KeyStore) path(account string) string {
+	return filepath.Join(f.dir, account+".json")
+}
+
+// Accounts lists the accounts with a wrapped key
+func (f *FIDO2KeyStore) Accounts() ([]string, error) {
+	return accountFiles(f.dir, ".json")
+}
+
+// GetKey unwraps the key for account, which requires touching the token
+func (f *FIDO2KeyStore) GetKey(account string) ([]byte, error) {
+	data, err := os.ReadFile(f.path(account)) // #nosec G304 -- Path is built from the keystore directory
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no wrapped key for account: %s", account)
+		}
+		return nil, fmt.Errorf("failed to read wrapped key: %w", err)
+	}
+	var wrapped fido2Wrapped
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("invalid wrapped key for account %s: %w", account, err)
+	}
+
+	secret, err := f.hmacSecret(wrapped.CredentialID, wrapped.Salt)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Zero(secret)
+
+	encoded, err := crypto.NewAESEncryptor().Decrypt(context.Background(), wrapped.Key, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key (wrong token?): %w", err)
+	}
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) != crypto.KeySize {
+		return nil, fmt.Errorf("invalid wrapped key for account %s", account)
+	}
+	return key, nil
+}
+
+// HasKey reports whether a wrapped key exists for account
+func (f *FIDO2KeyStore) HasKey(account string) (bool, error) {
+	_, err := os.Stat(f.path(account))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check wrapped key: %w", err)
+}
+
+// SetKey creates a credential on the token and stores key wrapped with its
+// hmac-secret. Both steps require touching the token.
+func (f *FIDO2KeyStore) SetKey(account string, key []byte) error {
+	if len(key) != crypto.KeySize {
+		return fmt.Errorf("invalid key size: expected %d bytes, got %d", crypto.KeySize, len(key))
+	}
+
+	credentialID, err := f.makeCredential(account)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	wrapped := fido2Wrapped{CredentialID: credentialID, Salt: base64.StdEncoding.EncodeToString(salt)}
+
+	secret, err := f.hmacSecret(wrapped.CredentialID, wrapped.Salt)
+	if err != nil {
+		return err
+	}
+	defer secure.Zero(secret)
+	if wrapped.Key, err = crypto.NewAESEncryptor().Encrypt(context.Background(), hex.EncodeToString(key), secret); err != nil {
+		return fmt.Errorf("failed to wrap key: %w", err)
+	}
+
+	data, err := json.MarshalIndent(wrapped, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode wrapped key: %w", err)
+	}
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create FIDO2 directory: %w", err)
+	}
+	if err := os.WriteFile(f.path(account), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to store wrapped key: %w", err)
+	}
+	return nil
+}
+
+// CreateKey generates a new key and wraps it with the token
+func (f *FIDO2KeyStore) CreateKey(account string) ([]byte, error) {
+	key := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate random key: %w", err)
+	}
+	if err := f.SetKey(account, key); err != nil {
+		secure.Zero(key)
+		return nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return key, nil
+}
+
+// LoadOrCreateKey unwraps the key for account, or creates one if none exists
+func (f *FIDO2KeyStore) LoadOrCreateKey(account string) ([]byte, error) {
+	exists, err := f.HasKey(account)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return f.GetKey(account)
+	}
+	return f.CreateKey(account)
+}
+
+// makeCredential creates a non-resident hmac-secret credential for account
+// and returns its base64 credential id
+func (f *FIDO2KeyStore) makeCredential(account string) (string, error) {
+	device, err := f.findDevice()
+	if err != nil {
+		return "", err
+	}
+	userID := sha256.Sum256([]byte(account))
+	input := strings.Join([]string{
+		clientDataHash(),
+		fido2RelyingParty,
+		account,
+		base64.StdEncoding.EncodeToString(userID[:]),
+	}, "\n") + "\n"
+
+	out, err := f.run([]byte(input), "fido2-cred", "-M", "-h", device)
+	if err != nil {
+		return "", fmt.Errorf("failed to create credential on the token: %w", err)
+	}
+	// Output: client data hash, rp id, format, authenticator data, credential id, ...
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 5 || lines[4] == "" {
+		return "", fmt.Errorf("unexpected fido2-cred output")
+	}
+	return lines[4], nil
+}
+
+// hmacSecret asks the token for the hmac-secret of credentialID over salt
+func (f *FIDO2KeyStore) hmacSecret(credentialID, salt string) ([]byte, error) {
+	device, err := f.findDevice()
+	if err != nil {
+		return nil, err
+	}
+	input := strings.Join([]string{clientDataHash(), fido2RelyingParty, credentialID, salt}, "\n") + "\n"
+
+	out, err := f.run([]byte(input), "fido2-assert", "-G", "-h", "-p", device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assertion from the token: %w", err)
+	}
+	// The hmac-secret is the last line of the output
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	secret, err := base64.StdEncoding.DecodeString(lines[len(lines)-1])
+	if err != nil || len(secret) != crypto.KeySize {
+		return nil, fmt.Errorf("token returned no hmac-secret; does it support the hmac-secret extension?")
+	}
+	return secret, nil
+}
+
+// findDevice returns the configured device, or the first token listed
+func (f *FIDO2KeyStore) findDevice() (string, error) {
+	if f.device != "" {
+		return f.device, nil
+	}
+	out, err := f.run(nil, "fido2-token", "-L")
+	if err != nil {
+		return "", fmt.Errorf("failed to list FIDO2 tokens: %w", err)
+	}
+	// Lines look like "/dev/hidraw3: vendor=0x1050, product=0x0407 (Yubico YubiKey OTP+FIDO+CCID)"
+	for _, line := range strings.Split(string(out), "\n") {
+		if device, _, ok := strings.Cut(line, ": "); ok && device != "" {
+			return device, nil
+		}
+	}
+	return "", fmt.Errorf("no FIDO2 token found; insert a YubiKey or set ENVX_FIDO2_DEVICE")
+}
+
+// clientDataHash returns a random base64 client data hash; envx only uses
+// the hmac-secret, not the signature over it
+func clientDataHash() string {
+	hash := make([]byte, sha256.Size)
+	_, _ = rand.Read(hash)
+	return base64.StdEncoding.EncodeToString(hash)
+}
@@ -0,0 +1,85 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeToken simulates libfido2's tools for a token whose hmac-secret is an
+// HMAC of the salt under a per-token secret
+type fakeToken struct {
+	secret  []byte
+	devices string
+	touches int
+}
+
+func (f *fakeToken) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(string(stdin)), "\n")
+	switch name {
+	case "fido2-token":
+		return []byte(f.devices), nil
+	case "fido2-cred":
+		f.touches++
+		if len(lines) != 4 || lines[1] != "envx" {
+			return nil, errors.New("bad fido2-cred input")
+		}
+		return []byte(strings.Join([]string{lines[0], lines[1], "packed", "YXV0aA==", "Y3JlZC1pZA==", "c2ln"}, "\n") + "\n"), nil
+	case "fido2-assert":
+		f.touches++
+		if len(lines) != 4 || lines[2] != "Y3JlZC1pZA==" {
+			return nil, errors.New("bad fido2-assert input")
+		}
+		salt, _ := base64.StdEncoding.DecodeString(lines[3])
+		mac := hmac.New(sha256.New, f.secret)
+		mac.Write(salt)
+		out := []string{lines[0], lines[1], "YXV0aA==", "c2ln", base64.StdEncoding.EncodeToString(mac.Sum(nil))}
+		return []byte(strings.Join(out, "\n") + "\n"), nil
+	}
+	return nil, errors.New("unexpected command " + name)
+}
+
+func TestFIDO2KeyStore(t *testing.T) {
+	dir := t.TempDir()
+	token := &fakeToken{secret: []byte("token-1"), devices: "/dev/hidraw3: vendor=0x1050, product=0x0407 (Yubico YubiKey)\n"}
+	store := NewFIDO2KeyStore(&FIDO2KeyStoreConfig{Dir: dir, Run: token.run})
+
+	if ok, err := HasKey(store, "alice"); ok || err != nil {
+		t.Fatalf("HasKey() before creating = %v, %v", ok, err)
+	}
+	key, err := store.LoadOrCreateKey("alice")
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() unexpected error: %v", err)
+	}
+
+	token.touches = 0
+	loaded, err := store.LoadOrCreateKey("alice")
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() unexpected error: %v", err)
+	}
+	if !bytes.Equal(loaded, key) {
+		t.Error("LoadOrCreateKey() did not unwrap the stored key")
+	}
+	if token.touches != 1 {
+		t.Errorf("unwrapping took %d touches, want 1", token.touches)
+	}
+
+	// Another token cannot unwrap the key
+	other := &fakeToken{secret: []byte("token-2"), devices: token.devices}
+	otherStore := NewFIDO2KeyStore(&FIDO2KeyStoreConfig{Dir: dir, Run: other.run})
+	if _, err := otherStore.GetKey("alice"); err == nil {
+		t.Error("GetKey() with another token expected error")
+	}
+}
+
+func TestFIDO2KeyStore_NoToken(t *testing.T) {
+	token := &fakeToken{secret: []byte("token-1")}
+	store := NewFIDO2KeyStore(&FIDO2KeyStoreConfig{Dir: t.TempDir(), Run: token.run})
+	if _, err := store.CreateKey("alice"); err == nil || !strings.Contains(err.Error(), "no FIDO2 token") {
+		t.Errorf("CreateKey() without a token error = %v", err)
+	}
+}
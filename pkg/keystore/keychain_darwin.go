@@ -15,49 +15,99 @@ import (
 	"unsafe"
 )
 
-// setGenericPassword stores a password in the macOS Keychain
-func setGenericPassword(label, service, account string, password []byte) error {
-	allocator := C.kCFAllocatorDefault
-	query := C.CFDictionaryCreateMutable(allocator, 0, nil, nil)
+// cfString creates a CFString from a Go string
+func cfString(s string) C.CFStringRef {
+	cs := C.CString(s)
+	defer C.free(unsafe.Pointer(cs))
+	return C.CFStringCreateWithCString(C.kCFAllocatorDefault, cs, C.kCFStringEncodingUTF8)
+}
+
+// itemQuery returns a dictionary identifying the generic password item for account
+func itemQuery(config *Config, account string) C.CFMutableDictionaryRef {
+	query := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, nil, nil)
 
 	C.CFDictionaryAddValue(query,
 		unsafe.Pointer(C.kSecClass),
 		unsafe.Pointer(C.kSecClassGenericPassword))
-
-	ca := C.CString(account)
-	defer C.free(unsafe.Pointer(ca))
-	cfAccount := C.CFStringCreateWithCString(allocator, ca, C.kCFStringEncodingUTF8)
 	C.CFDictionaryAddValue(query,
 		unsafe.Pointer(C.kSecAttrAccount),
-		unsafe.Pointer(cfAccount))
-
-	cs := C.CString(service)
-	defer C.free(unsafe.Pointer(cs))
-	cfService := C.CFStringCreateWithCString(allocator, cs, C.kCFStringEncodingUTF8)
+		unsafe.Pointer(cfString(account)))
 	C.CFDictionaryAddValue(query,
 		unsafe.Pointer(C.kSecAttrService),
-		unsafe.Pointer(cfService))
+		unsafe.Pointer(cfString(config.Service)))
 
-	cl := C.CString(label)
-	defer C.free(unsafe.Pointer(cl))
-	cfLabel := C.CFStringCreateWithCString(allocator, cl, C.kCFStringEncodingUTF8)
-	C.CFDictionaryAddValue(query,
-		unsafe.Pointer(C.kSecAttrLabel),
-		unsafe.Pointer(cfLabel))
+	if config.AccessGroup != "" {
+		C.CFDictionaryAddValue(query,
+			unsafe.Pointer(C.kSecAttrAccessGroup),
+			unsafe.Pointer(cfString(config.AccessGroup)))
+	}
+	return query
+}
+
+// addItemOptions adds the sync and accessibility attributes from config
+func addItemOptions(dict C.CFMutableDictionaryRef, config *Config) {
+	synchronizable := C.kCFBooleanFalse
+	if config.Synchronizable {
+		synchronizable = C.kCFBooleanTrue
+	}
+	C.CFDictionaryAddValue(dict,
+		unsafe.Pointer(C.kSecAttrSynchronizable),
+		unsafe.Pointer(synchronizable))
+
+	if accessible, ok := accessibleValue(config.Accessible); ok {
+		C.CFDictionaryAddValue(dict,
+			unsafe.Pointer(C.kSecAttrAccessible),
+			unsafe.Pointer(accessible))
+	}
+}
 
+// accessibleValue maps an Accessible* setting to its kSecAttrAccessible value
+func accessibleValue(accessible string) (C.CFStringRef, bool) {
+	switch accessible {
+	case AccessibleWhenUnlocked:
+		return C.kSecAttrAccessibleWhenUnlocked, true
+	case AccessibleAfterFirstUnlock:
+		return C.kSecAttrAccessibleAfterFirstUnlock, true
+	case AccessibleWhenUnlockedThisDeviceOnly:
+		return C.kSecAttrAccessibleWhenUnlockedThisDeviceOnly, true
+	case AccessibleAfterFirstUnlockThisDeviceOnly:
+		return C.kSecAttrAccessibleAfterFirstUnlockThisDeviceOnly, true
+	case AccessibleWhenPasscodeSetThisDeviceOnly:
+		return C.kSecAttrAccessibleWhenPasscodeSetThisDeviceOnly, true
+	default:
+		return 0, false
+	}
+}
+
+// setGenericPassword stores a password in the macOS Keychain, updating an
+// existing item (synced or not) before adding a new one so changing the sync
+// option never leaves two copies of the key behind
+func setGenericPassword(config *Config, account string, password []byte) error {
+	allocator := C.kCFAllocatorDefault
 	cfPassword := C.CFDataCreate(allocator, (*C.UInt8)(unsafe.Pointer(&password[0])), C.CFIndex(len(password)))
+
+	query := itemQuery(config, account)
 	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecAttrSynchronizable),
+		unsafe.Pointer(C.kSecAttrSynchronizableAny))
+
+	update := C.CFDictionaryCreateMutable(allocator, 0, nil, nil)
+	C.CFDictionaryAddValue(update,
 		unsafe.Pointer(C.kSecValueData),
 		unsafe.Pointer(cfPassword))
+	addItemOptions(update, config)
 
-	status := C.SecItemAdd(C.CFDictionaryRef(query), nil)
-	if status == C.errSecDuplicateItem {
-		// Update instead
-		update := C.CFDictionaryCreateMutable(allocator, 0, nil, nil)
-		C.CFDictionaryAddValue(update,
+	status := C.SecItemUpdate(C.CFDictionaryRef(query), C.CFDictionaryRef(update))
+	if status == C.errSecItemNotFound {
+		item := itemQuery(config, account)
+		C.CFDictionaryAddValue(item,
+			unsafe.Pointer(C.kSecAttrLabel),
+			unsafe.Pointer(cfString(config.App)))
+		C.CFDictionaryAddValue(item,
 			unsafe.Pointer(C.kSecValueData),
 			unsafe.Pointer(cfPassword))
-		status = C.SecItemUpdate(C.CFDictionaryRef(query), C.CFDictionaryRef(update))
+		addItemOptions(item, config)
+		status = C.SecItemAdd(C.CFDictionaryRef(item), nil)
 	}
 
 	if status != C.errSecSuccess {
@@ -66,29 +116,14 @@ func setGenericPassword(label, service, account string, password []byte) error {
 	return nil
 }
 
-// getGenericPassword retrieves a password from the macOS Keychain
-func getGenericPassword(service, account string) (username string, password []byte, err error) {
-	allocator := C.kCFAllocatorDefault
-	query := C.CFDictionaryCreateMutable(allocator, 0, nil, nil)
+// getGenericPassword retrieves a password from the macOS Keychain, whether or
+// not the item is synced through iCloud Keychain
+func getGenericPassword(config *Config, account string) (username string, password []byte, err error) {
+	query := itemQuery(config, account)
 
 	C.CFDictionaryAddValue(query,
-		unsafe.Pointer(C.kSecClass),
-		unsafe.Pointer(C.kSecClassGenericPassword))
-
-	ca := C.CString(account)
-	defer C.free(unsafe.Pointer(ca))
-	cfAccount := C.CFStringCreateWithCString(allocator, ca, C.kCFStringEncodingUTF8)
-	C.CFDictionaryAddValue(query,
-		unsafe.Pointer(C.kSecAttrAccount),
-		unsafe.Pointer(cfAccount))
-
-	cs := C.CString(service)
-	defer C.free(unsafe.Pointer(cs))
-	cfService := C.CFStringCreateWithCString(allocator, cs, C.kCFStringEncodingUTF8)
-	C.CFDictionaryAddValue(query,
-		unsafe.Pointer(C.kSecAttrService),
-		unsafe.Pointer(cfService))
-
+		unsafe.Pointer(C.kSecAttrSynchronizable),
+		unsafe.Pointer(C.kSecAttrSynchronizableAny))
 	C.CFDictionaryAddValue(query,
 		unsafe.Pointer(C.kSecMatchLimit),
 		unsafe.Pointer(C.kSecMatchLimitOne))
@@ -123,3 +158,87 @@ func getGenericPassword(service, account string) (username string, password []by
 
 	return
 }
+
+// hasGenericPassword reports whether the macOS Keychain holds a password for
+// account, whether or not the item is synced. Only attributes are requested,
+// so the password is never read and no access prompt is shown.
+func hasGenericPassword(config *Config, account string) (bool, error) {
+	query := itemQuery(config, account)
+
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecAttrSynchronizable),
+		unsafe.Pointer(C.kSecAttrSynchronizableAny))
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecMatchLimit),
+		unsafe.Pointer(C.kSecMatchLimitOne))
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecReturnAttributes),
+		unsafe.Pointer(C.kCFBooleanTrue))
+
+	var item C.CFTypeRef
+	status := C.SecItemCopyMatching(C.CFDictionaryRef(query), &item)
+	switch status {
+	case C.errSecSuccess:
+		C.CFRelease(item)
+		return true, nil
+	case C.errSecItemNotFound:
+		return false, nil
+	default:
+		return false, errors.New("unhandled error")
+	}
+}
+
+// listGenericPasswordAccounts returns the accounts of all generic password
+// items of the service, whether or not they are synced
+func listGenericPasswordAccounts(config *Config) ([]string, error) {
+	query := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, nil, nil)
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecClass),
+		unsafe.Pointer(C.kSecClassGenericPassword))
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecAttrService),
+		unsafe.Pointer(cfString(config.Service)))
+	if config.AccessGroup != "" {
+		C.CFDictionaryAddValue(query,
+			unsafe.Pointer(C.kSecAttrAccessGroup),
+			unsafe.Pointer(cfString(config.AccessGroup)))
+	}
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecAttrSynchronizable),
+		unsafe.Pointer(C.kSecAttrSynchronizableAny))
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecMatchLimit),
+		unsafe.Pointer(C.kSecMatchLimitAll))
+	C.CFDictionaryAddValue(query,
+		unsafe.Pointer(C.kSecReturnAttributes),
+		unsafe.Pointer(C.kCFBooleanTrue))
+
+	var result C.CFTypeRef
+	status := C.SecItemCopyMatching(C.CFDictionaryRef(query), &result)
+	if status == C.errSecItemNotFound {
+		return nil, nil
+	} else if status != C.errSecSuccess {
+		return nil, errors.New("unhandled error")
+	}
+
+	items := C.CFArrayRef(result)
+	count := C.CFArrayGetCount(items)
+	accounts := make([]string, 0, int(count))
+	for i := C.CFIndex(0); i < count; i++ {
+		dict := C.CFDictionaryRef(C.CFArrayGetValueAtIndex(items, i))
+		accountVal := C.CFDictionaryGetValue(dict, unsafe.Pointer(C.kSecAttrAccount))
+		var accountCStr [1024]byte
+		C.CFStringGetCString((C.CFStringRef)(accountVal), (*C.char)(unsafe.Pointer(&accountCStr[0])), 1024, C.kCFStringEncodingUTF8)
+		accounts = append(accounts, C.GoString((*C.char)(unsafe.Pointer(&accountCStr[0]))))
+	}
+	return accounts, nil
+}
+
+// KeychainSupported reports whether this build can use the keychain
+const KeychainSupported = true
+
+// keychainAvailable reports whether the keychain can be used; it always can
+// on macOS, where a locked keychain is unlocked on demand
+func keychainAvailable() error {
+	return nil
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // setGenericPassword is a fallback implementation for non-macOS systems
-func setGenericPassword(label, service, account string, password []byte) error {
+func setGenericPassword(config *Config, account string, password []byte) error {
 	// For non-macOS systems, we can't use the Keychain
 	// This is a placeholder that returns an error
 	if os.Getenv("CI") == "" {
@@ -18,7 +18,7 @@ func setGenericPassword(label, service, account string, password []byte) error {
 }
 
 // getGenericPassword is a fallback implementation for non-macOS systems
-func getGenericPassword(service, account string) (username string, password []byte, err error) {
+func getGenericPassword(config *Config, account string) (username string, password []byte, err error) {
 	// For non-macOS systems, we can't use the Keychain
 	// This is a placeholder that returns an error
 	if os.Getenv("CI") == "" {
@@ -26,3 +26,21 @@ func getGenericPassword(service, account string) (username string, password []by
 	}
 	return "", nil, errors.New("keychain storage not available on this platform")
 }
+
+// hasGenericPassword is a fallback implementation for non-macOS systems
+func hasGenericPassword(config *Config, account string) (bool, error) {
+	return false, errors.New("keychain storage not available on this platform")
+}
+
+// listGenericPasswordAccounts is a fallback implementation for non-macOS systems
+func listGenericPasswordAccounts(config *Config) ([]string, error) {
+	return nil, errors.New("keychain storage not available on this platform")
+}
+
+// KeychainSupported reports whether this build can use the keychain
+const KeychainSupported = false
+
+// keychainAvailable reports that there is no keychain on non-macOS systems
+func keychainAvailable() error {
+	return errors.New("keychain storage not available on this platform")
+}
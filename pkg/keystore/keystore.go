@@ -3,6 +3,10 @@ package keystore
 import (
 	"crypto/rand"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/almahoozi/envx/pkg/crypto"
 )
@@ -15,10 +19,148 @@ type KeyStore interface {
 	LoadOrCreateKey(account string) ([]byte, error)
 }
 
+// KeyChecker is implemented by keystores that can tell whether a key exists
+// without loading it, e.g. without prompting for a password
+type KeyChecker interface {
+	HasKey(account string) (bool, error)
+}
+
+// SharedKeyStore is implemented by keystores that may hold a single key for
+// every account, such as a systemd credential
+type SharedKeyStore interface {
+	// SharesKey reports whether every account gets the same key
+	SharesKey() bool
+}
+
+// KeyLister is implemented by keystores that can list the accounts they hold
+// keys for
+type KeyLister interface {
+	Accounts() ([]string, error)
+}
+
+// Accounts returns the accounts store holds keys for, sorted
+func Accounts(store KeyStore) ([]string, error) {
+	lister, ok := store.(KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("keystore cannot list its keys")
+	}
+	accounts, err := lister.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// accountFiles returns the accounts of the files in dir named <account><suffix>
+func accountFiles(dir, suffix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	var accounts []string
+	for _, entry := range entries {
+		if account, ok := strings.CutSuffix(entry.Name(), suffix); ok && !entry.IsDir() && account != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// Prober is implemented by keystores that can tell whether they work on
+// this machine without loading a key, e.g. whether the tools they need are
+// installed
+type Prober interface {
+	Available() error
+}
+
+// Available returns why store cannot be used on this machine, or nil when it
+// can or cannot tell
+func Available(store KeyStore) error {
+	if prober, ok := store.(Prober); ok {
+		return prober.Available()
+	}
+	return nil
+}
+
+// HasKey reports whether store already holds a key for account, i.e. whether
+// LoadOrCreateKey would load a key rather than create one
+func HasKey(store KeyStore, account string) (bool, error) {
+	if checker, ok := store.(KeyChecker); ok {
+		return checker.HasKey(account)
+	}
+
+	// Mirror LoadOrCreateKey: any lookup failure means a key would be created
+	key, err := store.GetKey(account)
+	return err == nil && len(key) == crypto.KeySize, nil
+}
+
+// Accessibility settings for Config.Accessible, mirroring kSecAttrAccessible
+const (
+	AccessibleWhenUnlocked                   = "when-unlocked"
+	AccessibleAfterFirstUnlock               = "after-first-unlock"
+	AccessibleWhenUnlockedThisDeviceOnly     = "when-unlocked-this-device-only"
+	AccessibleAfterFirstUnlockThisDeviceOnly = "after-first-unlock-this-device-only"
+	AccessibleWhenPasscodeSetThisDeviceOnly  = "when-passcode-set-this-device-only"
+)
+
 // Config holds keystore configuration
 type Config struct {
 	App     string
 	Service string
+
+	// Synchronizable stores the key in iCloud Keychain so it syncs to the
+	// user's other devices
+	Synchronizable bool
+	// Accessible controls when the key can be read (one of the Accessible*
+	// constants); empty uses the system default, when-unlocked
+	Accessible string
+	// AccessGroup shares the key with other apps in the same keychain access group
+	AccessGroup string
+}
+
+// Validate checks that the keychain options are known and compatible
+func (c *Config) Validate() error {
+	switch c.Accessible {
+	case "", AccessibleWhenUnlocked, AccessibleAfterFirstUnlock:
+	case AccessibleWhenUnlockedThisDeviceOnly, AccessibleAfterFirstUnlockThisDeviceOnly, AccessibleWhenPasscodeSetThisDeviceOnly:
+		if c.Synchronizable {
+			return fmt.Errorf("keychain accessibility %q cannot be combined with iCloud sync", c.Accessible)
+		}
+	default:
+		return fmt.Errorf("unsupported keychain accessibility: %s (supported: %s, %s, %s, %s, %s)", c.Accessible,
+			AccessibleWhenUnlocked, AccessibleAfterFirstUnlock, AccessibleWhenUnlockedThisDeviceOnly,
+			AccessibleAfterFirstUnlockThisDeviceOnly, AccessibleWhenPasscodeSetThisDeviceOnly)
+	}
+	return nil
+}
+
+// ConfigFromEnv returns the default configuration with keychain options taken
+// from ENVX_KEYCHAIN_SERVICE, ENVX_KEYCHAIN_SYNC, ENVX_KEYCHAIN_ACCESSIBLE and
+// ENVX_KEYCHAIN_ACCESS_GROUP
+func ConfigFromEnv() (*Config, error) {
+	config := DefaultConfig()
+	if service := os.Getenv("ENVX_KEYCHAIN_SERVICE"); service != "" {
+		config.Service = service
+	}
+
+	if sync := os.Getenv("ENVX_KEYCHAIN_SYNC"); sync != "" {
+		enabled, err := strconv.ParseBool(sync)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ENVX_KEYCHAIN_SYNC value %q: %w", sync, err)
+		}
+		config.Synchronizable = enabled
+	}
+	config.Accessible = os.Getenv("ENVX_KEYCHAIN_ACCESSIBLE")
+	config.AccessGroup = os.Getenv("ENVX_KEYCHAIN_ACCESS_GROUP")
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // DefaultConfig returns the default keystore configuration
@@ -34,6 +176,11 @@ type macOSKeyStore struct {
 	config *Config
 }
 
+// Available reports whether the platform has a keychain
+func (k *macOSKeyStore) Available() error {
+	return keychainAvailable()
+}
+
 // NewMacOSKeyStore creates a new macOS keystore instance
 func NewMacOSKeyStore(config *Config) KeyStore {
 	if config == nil {
@@ -44,7 +191,7 @@ func NewMacOSKeyStore(config *Config) KeyStore {
 
 // GetKey retrieves a key from the macOS Keychain
 func (k *macOSKeyStore) GetKey(account string) ([]byte, error) {
-	_, key, err := getGenericPassword(k.config.Service, account)
+	_, key, err := getGenericPassword(k.config, account)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get key from keychain: %w", err)
 	}
@@ -57,13 +204,33 @@ func (k *macOSKeyStore) SetKey(account string, key []byte) error {
 		return fmt.Errorf("invalid key size: expected %d bytes, got %d", crypto.KeySize, len(key))
 	}
 
-	err := setGenericPassword(k.config.App, k.config.Service, account, key)
+	err := setGenericPassword(k.config, account, key)
 	if err != nil {
 		return fmt.Errorf("failed to set key in keychain: %w", err)
 	}
 	return nil
 }
 
+// HasKey reports whether the keychain holds a key for the account. It looks
+// the item up by its attributes alone, so the key is not read and no access
+// prompt is shown, which keeps it cheap enough for shell prompts.
+func (k *macOSKeyStore) HasKey(account string) (bool, error) {
+	exists, err := hasGenericPassword(k.config, account)
+	if err != nil {
+		return false, nil
+	}
+	return exists, nil
+}
+
+// Accounts lists the accounts with an envx item in the keychain
+func (k *macOSKeyStore) Accounts() ([]string, error) {
+	accounts, err := listGenericPasswordAccounts(k.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keychain items: %w", err)
+	}
+	return accounts, nil
+}
+
 // CreateKey generates a new random key and stores it in the keychain
 func (k *macOSKeyStore) CreateKey(account string) ([]byte, error) {
 	key := make([]byte, crypto.KeySize)
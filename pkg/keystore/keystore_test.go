@@ -1,8 +1,13 @@
 package keystore
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/almahoozi/envx/pkg/crypto"
@@ -93,6 +98,142 @@ func TestDefaultConfig(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"defaults", Config{}, false},
+		{"sync", Config{Synchronizable: true}, false},
+		{"sync when unlocked", Config{Synchronizable: true, Accessible: AccessibleWhenUnlocked}, false},
+		{"this device only", Config{Accessible: AccessibleAfterFirstUnlockThisDeviceOnly}, false},
+		{"sync this device only", Config{Synchronizable: true, Accessible: AccessibleWhenUnlockedThisDeviceOnly}, true},
+		{"unknown accessibility", Config{Accessible: "always"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    string
+		sync       string
+		accessible string
+		group      string
+		want       Config
+		wantErr    bool
+	}{
+		{
+			name: "unset",
+			want: *DefaultConfig(),
+		},
+		{
+			name:       "all options",
+			service:    "com.example.envx",
+			sync:       "true",
+			accessible: AccessibleAfterFirstUnlock,
+			group:      "TEAMID.com.example.shared",
+			want: Config{
+				App:            "envx",
+				Service:        "com.example.envx",
+				Synchronizable: true,
+				Accessible:     AccessibleAfterFirstUnlock,
+				AccessGroup:    "TEAMID.com.example.shared",
+			},
+		},
+		{
+			name:    "invalid sync",
+			sync:    "sometimes",
+			wantErr: true,
+		},
+		{
+			name:       "incompatible options",
+			sync:       "1",
+			accessible: AccessibleWhenPasscodeSetThisDeviceOnly,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVX_KEYCHAIN_SERVICE", tt.service)
+			t.Setenv("ENVX_KEYCHAIN_SYNC", tt.sync)
+			t.Setenv("ENVX_KEYCHAIN_ACCESSIBLE", tt.accessible)
+			t.Setenv("ENVX_KEYCHAIN_ACCESS_GROUP", tt.group)
+
+			config, err := ConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *config != tt.want {
+				t.Errorf("ConfigFromEnv() = %+v, want %+v", *config, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasKey(t *testing.T) {
+	originalGetSaltDir := getSaltDir
+	defer func() { getSaltDir = originalGetSaltDir }()
+	tempDir := t.TempDir()
+	getSaltDir = func() string { return tempDir }
+
+	prompted := false
+	passwordStore := NewPasswordKeyStore(&PasswordKeyStoreConfig{
+		Iterations: 1000,
+		PromptFunc: func(string) (string, error) {
+			prompted = true
+			return "testpassword", nil
+		},
+	})
+
+	stores := map[string]KeyStore{
+		"fallback": newMockKeyStore(),
+		"mock":     NewMockKeyStore(),
+		"password": passwordStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			exists, err := HasKey(store, "account")
+			if err != nil {
+				t.Fatalf("HasKey() unexpected error: %v", err)
+			}
+			if exists {
+				t.Error("HasKey() = true before a key was created")
+			}
+
+			if _, err := store.CreateKey("account"); err != nil {
+				t.Fatalf("CreateKey() failed: %v", err)
+			}
+
+			prompted = false
+			exists, err = HasKey(store, "account")
+			if err != nil {
+				t.Fatalf("HasKey() unexpected error: %v", err)
+			}
+			if !exists {
+				t.Error("HasKey() = false after a key was created")
+			}
+			if prompted {
+				t.Error("HasKey() prompted for a password")
+			}
+		})
+	}
+}
+
 func TestNewMacOSKeyStore(t *testing.T) {
 	// Test with nil config
 	store := NewMacOSKeyStore(nil)
@@ -449,3 +590,142 @@ func BenchmarkMockKeyStore_GetKey(b *testing.B) {
 		}
 	}
 }
+
+func TestCredentialKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{0xab}, crypto.KeySize)
+
+	store := NewCredentialKeyStore(dir, "")
+	if ok, err := store.HasKey("ignored"); ok || err != nil {
+		t.Errorf("HasKey() on a missing credential = %v, %v", ok, err)
+	}
+	if _, err := store.LoadOrCreateKey("ignored"); err == nil {
+		t.Error("LoadOrCreateKey() expected error for a missing credential")
+	}
+
+	for name, content := range map[string][]byte{
+		"raw": key,
+		"hex": []byte(hex.EncodeToString(key) + "\n"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, DefaultCredentialName), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetKey("ignored")
+		if err != nil {
+			t.Fatalf("GetKey() %s unexpected error: %v", name, err)
+		}
+		if !bytes.Equal(got, key) {
+			t.Errorf("GetKey() %s = %x, want %x", name, got, key)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, DefaultCredentialName), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetKey("ignored"); err == nil {
+		t.Error("GetKey() expected error for an invalid credential")
+	}
+
+	if err := store.SetKey("ignored", key); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetKey() error = %v, want ErrReadOnly", err)
+	}
+	if _, err := store.CreateKey("ignored"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateKey() error = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestCredentialFromEnv(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, ok := CredentialFromEnv(); ok {
+		t.Error("CredentialFromEnv() found a credential without CREDENTIALS_DIRECTORY")
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	t.Setenv("ENVX_CREDENTIAL", "app-key")
+	if _, ok := CredentialFromEnv(); ok {
+		t.Error("CredentialFromEnv() found a credential that does not exist")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app-key"), bytes.Repeat([]byte{1}, crypto.KeySize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, ok := CredentialFromEnv()
+	if !ok || store.Name != "app-key" {
+		t.Errorf("CredentialFromEnv() = %+v, %v", store, ok)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetSaltDir := getSaltDir
+	defer func() { getSaltDir = originalGetSaltDir }()
+	getSaltDir = func() string { return tempDir }
+
+	for _, name := range []string{"alice.salt", "alice.api.salt", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "dir.salt"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := Accounts(NewPasswordKeyStore(nil))
+	if err != nil {
+		t.Fatalf("Accounts() unexpected error: %v", err)
+	}
+	if want := []string{"alice", "alice.api"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("Accounts() = %v, want %v", accounts, want)
+	}
+
+	getSaltDir = func() string { return filepath.Join(tempDir, "missing") }
+	if accounts, err := Accounts(NewPasswordKeyStore(nil)); err != nil || len(accounts) != 0 {
+		t.Errorf("Accounts() without salt directory = %v, %v", accounts, err)
+	}
+
+	if _, err := Accounts(&CredentialKeyStore{}); err == nil {
+		t.Error("Accounts() expected error for a keystore that cannot list keys")
+	}
+}
+
+func TestSeededMockKeyStore(t *testing.T) {
+	if _, err := NewSeededMockKeyStore(""); err == nil {
+		t.Error("NewSeededMockKeyStore(\"\") expected error but got none")
+	}
+
+	store, err := NewSeededMockKeyStore("fixtures")
+	if err != nil {
+		t.Fatalf("NewSeededMockKeyStore() unexpected error: %v", err)
+	}
+	if exists, err := HasKey(store, "anyone"); err != nil || !exists {
+		t.Errorf("HasKey() = %v, %v, want true", exists, err)
+	}
+
+	// Every store with the seed hands out the same key, to every account
+	key1, err := store.LoadOrCreateKey("alice")
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() unexpected error: %v", err)
+	}
+	other, _ := NewSeededMockKeyStore("fixtures")
+	key2, err := other.GetKey("bob")
+	if err != nil {
+		t.Fatalf("GetKey() unexpected error: %v", err)
+	}
+	if !bytes.Equal(key1, key2) || len(key1) != crypto.KeySize {
+		t.Errorf("seeded keys differ: %x, %x", key1, key2)
+	}
+
+	different, _ := SeededKey("other")
+	if bytes.Equal(key1, different) {
+		t.Error("SeededKey() gives the same key for different seeds")
+	}
+
+	// A key set explicitly takes precedence over the seeded one
+	if err := store.SetKey("alice", different); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := store.GetKey("alice"); !bytes.Equal(key, different) {
+		t.Errorf("GetKey() = %x, want the key set", key)
+	}
+}
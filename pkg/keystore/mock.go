@@ -1,7 +1,10 @@
 package keystore
 
 import (
+	"bytes"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"sync"
 
@@ -10,8 +13,9 @@ import (
 
 // MockKeyStore is an in-memory keystore for testing
 type MockKeyStore struct {
-	keys map[string][]byte
-	mu   sync.RWMutex
+	keys   map[string][]byte
+	seeded []byte // the key of every account without one of its own
+	mu     sync.RWMutex
 }
 
 // NewMockKeyStore creates a new mock keystore
@@ -21,17 +25,75 @@ func NewMockKeyStore() KeyStore {
 	}
 }
 
+// NewSeededMockKeyStore creates a mock keystore holding a key derived from
+// seed for every account, the same on every machine and in every process,
+// so encrypted fixtures can be committed and decrypted anywhere. The key is
+// only as secret as the seed.
+func NewSeededMockKeyStore(seed string) (KeyStore, error) {
+	key, err := SeededKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &MockKeyStore{
+		keys:   make(map[string][]byte),
+		seeded: key,
+	}, nil
+}
+
+// SeededKey derives the key of a seeded mock keystore from seed with HKDF
+func SeededKey(seed string) ([]byte, error) {
+	if seed == "" {
+		return nil, fmt.Errorf("key seed must not be empty")
+	}
+	key, err := hkdf.Key(sha256.New, []byte(seed), nil, "envx mock keystore", crypto.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from seed: %w", err)
+	}
+	return key, nil
+}
+
 // GetKey retrieves a key from the mock store
 func (m *MockKeyStore) GetKey(account string) ([]byte, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	key, exists := m.keys[account]
+	if !exists && m.seeded != nil {
+		key, exists = m.seeded, true
+	}
 	if !exists {
 		return nil, fmt.Errorf("key not found for account: %s", account)
 	}
 
-	return key, nil
+	// Return a copy so callers can zero their key without affecting the store
+	return bytes.Clone(key), nil
+}
+
+// SharesKey reports whether the store is seeded, giving every account
+// without a key of its own the seeded key
+func (m *MockKeyStore) SharesKey() bool {
+	return m.seeded != nil
+}
+
+// HasKey reports whether the mock store holds a key for the account
+func (m *MockKeyStore) HasKey(account string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, exists := m.keys[account]
+	return m.seeded != nil || exists && len(key) == crypto.KeySize, nil
+}
+
+// Accounts lists the accounts in the mock store
+func (m *MockKeyStore) Accounts() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := make([]string, 0, len(m.keys))
+	for account := range m.keys {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
 }
 
 // SetKey stores a key in the mock store
@@ -49,15 +111,17 @@ func (m *MockKeyStore) SetKey(account string, key []byte) error {
 	return nil
 }
 
-// CreateKey generates a new random key and stores it
+// CreateKey generates a new random key, or the seeded one, and stores it
 func (m *MockKeyStore) CreateKey(account string) ([]byte, error) {
-	key := make([]byte, crypto.KeySize)
-	_, err := rand.Read(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate random key: %w", err)
+	key := bytes.Clone(m.seeded)
+	if key == nil {
+		key = make([]byte, crypto.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate random key: %w", err)
+		}
 	}
 
-	err = m.SetKey(account, key)
+	err := m.SetKey(account, key)
 	if err != nil {
 		return nil, err
 	}
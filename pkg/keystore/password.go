@@ -1,14 +1,19 @@
 package keystore
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"crypto/pbkdf2"
 
 	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/secure"
 	"golang.org/x/term"
 )
 
@@ -16,66 +21,131 @@ const (
 	// PBKDF2 parameters
 	DefaultIterations = 100000 // OWASP recommended minimum
 	SaltSize          = 32     // 256-bit salt
+
+	// DefaultRetries is how many more times a wrong password is prompted for
+	DefaultRetries = 2
 )
 
+// ErrWrongPassword means the password does not derive the key the account
+// was created with
+var ErrWrongPassword = errors.New("incorrect password")
+
+// passwordParams are recorded next to the salt when a key is created, so the
+// key is derived with the same iterations later and a wrong password is
+// detected instead of silently deriving a different key
+type passwordParams struct {
+	Iterations int    `json:"iterations"`
+	Check      string `json:"check"`
+}
+
 // PasswordKeyStore implements KeyStore using password-based key derivation
 // Keys are derived from passwords on-demand and never stored
 type PasswordKeyStore struct {
 	iterations int
+	retries    int
 	promptFunc func(string) (string, error) // For dependency injection in tests
+	prompts    bool                         // Whether promptFunc prompts on the terminal
 	password   string                       // Optional: password for non-interactive use
+	progress   func(task string) (done func())
 }
 
 // PasswordKeyStoreConfig holds configuration for password-based keystore
 type PasswordKeyStoreConfig struct {
-	Iterations int
+	Iterations int // Used for new keys; existing keys keep the iterations they were created with
+	Retries    int // Re-prompts after a wrong password; negative disables retries
 	PromptFunc func(string) (string, error)
 	Password   string // Optional: password for non-interactive use
+	// Progress is called with a description before each key derivation and
+	// returns the function to call once it is done; optional
+	Progress func(task string) (done func())
 }
 
 // NewPasswordKeyStore creates a new password-based keystore
 func NewPasswordKeyStore(config *PasswordKeyStoreConfig) KeyStore {
 	iterations := DefaultIterations
+	retries := DefaultRetries
 	promptFunc := promptForPassword
 	password := ""
+	var progress func(string) func()
 
 	if config != nil {
 		if config.Iterations > 0 {
 			iterations = config.Iterations
 		}
+		if config.Retries > 0 {
+			retries = config.Retries
+		} else if config.Retries < 0 {
+			retries = 0
+		}
 		if config.PromptFunc != nil {
 			promptFunc = config.PromptFunc
 		}
 		if config.Password != "" {
 			password = config.Password
 		}
+		progress = config.Progress
 	}
 
 	return &PasswordKeyStore{
 		iterations: iterations,
+		retries:    retries,
 		promptFunc: promptFunc,
+		prompts:    config == nil || config.PromptFunc == nil,
 		password:   password,
+		progress:   progress,
 	}
 }
 
-// GetKey derives a key from password (password is prompted from user or taken from config)
+// GetKey derives a key from password (password is prompted from user or taken
+// from config). A prompted password that is wrong is asked for again, up to
+// the configured number of retries.
 func (p *PasswordKeyStore) GetKey(account string) ([]byte, error) {
-	password, err := p.getPassword(fmt.Sprintf("Enter password for %s", account))
-	if err != nil {
-		return nil, fmt.Errorf("failed to get password: %w", err)
-	}
-
 	salt, err := p.getSalt(account)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get salt: %w", err)
 	}
-
-	key, err := pbkdf2.Key(sha256.New, password, salt, p.iterations, crypto.KeySize)
+	params, err := p.getParams(account)
 	if err != nil {
-		return nil, fmt.Errorf("failed to derive key: %w", err)
+		return nil, fmt.Errorf("failed to get password parameters: %w", err)
 	}
 
-	return key, nil
+	prompt := fmt.Sprintf("Enter password for %s", account)
+	for attempt := 0; ; attempt++ {
+		password, prompted, err := p.getPassword(prompt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get password: %w", err)
+		}
+
+		key, err := p.deriveKey(password, salt, params.Iterations)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		if params.Check == "" || hmac.Equal([]byte(params.Check), []byte(passwordCheck(key))) {
+			return key, nil
+		}
+		secure.Zero(key)
+
+		if !prompted || attempt >= p.retries {
+			return nil, ErrWrongPassword
+		}
+		prompt = fmt.Sprintf("Incorrect password; enter password for %s", account)
+	}
+}
+
+// deriveKey derives the key from password with PBKDF2, reporting progress
+// since it takes noticeable time by design
+func (p *PasswordKeyStore) deriveKey(password string, salt []byte, iterations int) ([]byte, error) {
+	if p.progress != nil {
+		done := p.progress("Deriving key from password")
+		defer done()
+	}
+	return DeriveKey(password, salt, iterations)
+}
+
+// DeriveKey derives an encryption key from password the way the password
+// keystore does: PBKDF2 with SHA-256 over the given salt and iterations
+func DeriveKey(password string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, password, salt, iterations, crypto.KeySize)
 }
 
 // SetKey is not applicable for password-based keystore - passwords are not stored
@@ -99,16 +169,21 @@ func (p *PasswordKeyStore) CreateKey(account string) ([]byte, error) {
 	}
 
 	// Get password (from env var, config, or prompt)
-	password, err := p.getPassword(fmt.Sprintf("Create password for %s", account))
+	password, _, err := p.getPassword(fmt.Sprintf("Create password for %s", account))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get password: %w", err)
 	}
 
-	key, err := pbkdf2.Key(sha256.New, password, salt, p.iterations, crypto.KeySize)
+	key, err := p.deriveKey(password, salt, p.iterations)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
+	if err := p.setParams(account, passwordParams{Iterations: p.iterations, Check: passwordCheck(key)}); err != nil {
+		secure.Zero(key)
+		return nil, fmt.Errorf("failed to store password parameters: %w", err)
+	}
+
 	return key, nil
 }
 
@@ -132,6 +207,19 @@ func (p *PasswordKeyStore) LoadOrCreateKey(account string) ([]byte, error) {
 	return nil, fmt.Errorf("salt file exists but cannot be read: %w", err)
 }
 
+// HasKey reports whether a salt exists for the account; the key itself is
+// derived from the password, so this does not prompt for one
+func (p *PasswordKeyStore) HasKey(account string) (bool, error) {
+	_, err := os.Stat(p.getSaltFilePath(account))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check salt file: %w", err)
+	}
+	return true, nil
+}
+
 // getSalt retrieves the salt for an account from a file
 func (p *PasswordKeyStore) getSalt(account string) ([]byte, error) {
 	saltFile := p.getSaltFilePath(account)
@@ -170,8 +258,67 @@ func (p *PasswordKeyStore) setSalt(account string, salt []byte) error {
 	return nil
 }
 
+// getParams returns the parameters recorded for account. Accounts created
+// before parameters were recorded used the default iterations and have no
+// password check.
+func (p *PasswordKeyStore) getParams(account string) (passwordParams, error) {
+	data, err := os.ReadFile(p.getParamsFilePath(account))
+	if os.IsNotExist(err) {
+		return passwordParams{Iterations: DefaultIterations}, nil
+	}
+	if err != nil {
+		return passwordParams{}, err
+	}
+
+	var params passwordParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return passwordParams{}, fmt.Errorf("invalid parameters file: %w", err)
+	}
+	if params.Iterations <= 0 {
+		return passwordParams{}, fmt.Errorf("invalid iterations %d in parameters file", params.Iterations)
+	}
+	return params, nil
+}
+
+// setParams records the parameters a key for account was created with
+func (p *PasswordKeyStore) setParams(account string, params passwordParams) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.getParamsFilePath(account), data, 0600)
+}
+
+// passwordCheck returns a value that identifies key without revealing it,
+// to tell a wrong password from the right one
+func passwordCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("envx-password-check"))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Accounts lists the accounts with a salt file
+func (p *PasswordKeyStore) Accounts() ([]string, error) {
+	return accountFiles(getSaltDir(), ".salt")
+}
+
 // getSaltFilePath returns the file path for storing the salt
 func (p *PasswordKeyStore) getSaltFilePath(account string) string {
+	return SaltFilePath(account)
+}
+
+// getParamsFilePath returns the file path for storing the key parameters
+func (p *PasswordKeyStore) getParamsFilePath(account string) string {
+	return fmt.Sprintf("%s/%s.params", getSaltDir(), account)
+}
+
+// SaltDir returns the directory where password keystore salts are stored
+func SaltDir() string {
+	return getSaltDir()
+}
+
+// SaltFilePath returns the path of the salt file for an account
+func SaltFilePath(account string) string {
 	return fmt.Sprintf("%s/%s.salt", getSaltDir(), account)
 }
 
@@ -186,9 +333,20 @@ var getSaltDir = func() string {
 	return fmt.Sprintf("%s/.config/envx/salts", homeDir)
 }
 
+// Available reports whether a password is given or can be prompted for
+func (p *PasswordKeyStore) Available() error {
+	if p.password != "" || os.Getenv("ENVX_PASSWORD") != "" || !p.prompts {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("no password given and stdin is not a terminal to prompt on")
+	}
+	return nil
+}
+
 // promptForPassword prompts the user for a password without echoing to terminal
 func promptForPassword(prompt string) (string, error) {
-	fmt.Printf("%s: ", prompt)
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
 
 	// Read password without echoing to terminal
 	bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
@@ -196,22 +354,25 @@ func promptForPassword(prompt string) (string, error) {
 		return "", fmt.Errorf("failed to read password: %w", err)
 	}
 
-	fmt.Println() // Print newline after password input
+	fmt.Fprintln(os.Stderr) // Print newline after password input
+	defer secure.Zero(bytePassword)
 	return string(bytePassword), nil
 }
 
-// getPassword returns the configured password or prompts for one
-func (p *PasswordKeyStore) getPassword(prompt string) (string, error) {
+// getPassword returns the configured password or prompts for one, and
+// whether it was prompted for
+func (p *PasswordKeyStore) getPassword(prompt string) (string, bool, error) {
 	// Check environment variable first
 	if envPassword := os.Getenv("ENVX_PASSWORD"); envPassword != "" {
-		return envPassword, nil
+		return envPassword, false, nil
 	}
 
 	// Use configured password if available
 	if p.password != "" {
-		return p.password, nil
+		return p.password, false, nil
 	}
 
 	// Fall back to prompting
-	return p.promptFunc(prompt)
+	password, err := p.promptFunc(prompt)
+	return password, true, err
 }
@@ -0,0 +1,222 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/almahoozi/envx/pkg/command"
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/secure"
+)
+
+// CommandRunner runs an external program with stdin and returns its stdout
+type CommandRunner func(stdin []byte, name string, args ...string) ([]byte, error)
+
+// TPMKeyStore implements KeyStore by sealing keys to the machine's TPM 2.0
+// with tpm2-tools. Only the sealed blobs are stored on disk; they can only be
+// unsealed by the same TPM and, when PCRs are set, only while those PCRs hold
+// the values they had at sealing time.
+type TPMKeyStore struct {
+	dir  string
+	pcrs string
+	run  CommandRunner
+}
+
+// TPMKeyStoreConfig holds configuration for the TPM keystore
+type TPMKeyStoreConfig struct {
+	// Dir holds the sealed blobs (default ~/.config/envx/tpm)
+	Dir string
+	// PCRs binds keys to PCR state, as a tpm2-tools selection such as
+	// "sha256:0,7"; empty seals without a PCR policy
+	PCRs string
+	// Run executes tpm2-tools; for dependency injection in tests
+	Run CommandRunner
+}
+
+// pcrSelection matches tpm2-tools PCR selections like "sha256:0,2,7"
+var pcrSelection = regexp.MustCompile(`^(sha1|sha256|sha384|sha512):[0-9]+(,[0-9]+)*$`)
+
+// NewTPMKeyStore creates a new TPM keystore
+func NewTPMKeyStore(config *TPMKeyStoreConfig) (KeyStore, error) {
+	store := &TPMKeyStore{dir: getTPMDir(), run: command.Run}
+	if config != nil {
+		if config.Dir != "" {
+			store.dir = config.Dir
+		}
+		if config.Run != nil {
+			store.run = config.Run
+		}
+		store.pcrs = config.PCRs
+	}
+	if store.pcrs != "" && !pcrSelection.MatchString(store.pcrs) {
+		return nil, fmt.Errorf("invalid PCR selection %q (expected e.g. sha256:0,7)", store.pcrs)
+	}
+	return store, nil
+}
+
+// Available reports whether tpm2-tools are installed and the kernel exposes
+// a TPM
+func (t *TPMKeyStore) Available() error {
+	if _, err := exec.LookPath("tpm2_unseal"); err != nil {
+		return errors.New("tpm2-tools are not installed")
+	}
+	for _, device := range []string{"/dev/tpmrm0", "/dev/tpm0"} {
+		if _, err := os.Stat(device); err == nil {
+			return nil
+		}
+	}
+	return errors.New("no TPM device found")
+}
+
+// TPMConfigFromEnv returns the TPM keystore configuration with the PCR
+// selection taken from ENVX_TPM_PCRS and the directory from ENVX_TPM_DIR
+func TPMConfigFromEnv() *TPMKeyStoreConfig {
+	return &TPMKeyStoreConfig{Dir: os.Getenv("ENVX_TPM_DIR"), PCRs: os.Getenv("ENVX_TPM_PCRS")}
+}
+
+// getTPMDir returns the directory for sealed key blobs
+var getTPMDir = func() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".envx/tpm"
+	}
+	return fmt.Sprintf("%s/.config/envx/tpm", homeDir)
+}
+
+// blobPaths returns the public and private parts of the sealed object for account
+func (t *TPMKeyStore) blobPaths(account string) (string, string) {
+	base := filepath.Join(t.dir, account)
+	return base + ".pub", base + ".priv"
+}
+
+// Accounts lists the accounts with sealed blobs
+func (t *TPMKeyStore) Accounts() ([]string, error) {
+	return accountFiles(t.dir, ".pub")
+}
+
+// GetKey unseals the key for account
+func (t *TPMKeyStore) GetKey(account string) ([]byte, error) {
+	pub, priv := t.blobPaths(account)
+	if exists, err := t.HasKey(account); err != nil || !exists {
+		if err == nil {
+			err = fmt.Errorf("no sealed key for account: %s", account)
+		}
+		return nil, err
+	}
+
+	work, err := os.MkdirTemp("", "envx-tpm-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TPM work directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(work) }()
+
+	primary := filepath.Join(work, "primary.ctx")
+	sealed := filepath.Join(work, "sealed.ctx")
+	if _, err := t.run(nil, "tpm2_createprimary", "-Q", "-C", "o", "-c", primary); err != nil {
+		return nil, err
+	}
+	if _, err := t.run(nil, "tpm2_load", "-Q", "-C", primary, "-u", pub, "-r", priv, "-c", sealed); err != nil {
+		return nil, err
+	}
+	args := []string{"-c", sealed}
+	if t.pcrs != "" {
+		args = append(args, "-p", "pcr:"+t.pcrs)
+	}
+	key, err := t.run(nil, "tpm2_unseal", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal key (PCR state may have changed): %w", err)
+	}
+	if len(key) != crypto.KeySize {
+		secure.Zero(key)
+		return nil, fmt.Errorf("invalid unsealed key size: expected %d bytes, got %d", crypto.KeySize, len(key))
+	}
+	return key, nil
+}
+
+// HasKey reports whether a sealed key exists for account
+func (t *TPMKeyStore) HasKey(account string) (bool, error) {
+	pub, priv := t.blobPaths(account)
+	for _, path := range []string{pub, priv} {
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to check sealed key: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// SetKey seals key to the TPM and stores the sealed blobs for account
+func (t *TPMKeyStore) SetKey(account string, key []byte) error {
+	if len(key) != crypto.KeySize {
+		return fmt.Errorf("invalid key size: expected %d bytes, got %d", crypto.KeySize, len(key))
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create TPM directory: %w", err)
+	}
+
+	work, err := os.MkdirTemp("", "envx-tpm-")
+	if err != nil {
+		return fmt.Errorf("failed to create TPM work directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(work) }()
+
+	primary := filepath.Join(work, "primary.ctx")
+	if _, err := t.run(nil, "tpm2_createprimary", "-Q", "-C", "o", "-c", primary); err != nil {
+		return err
+	}
+
+	// Write the new blobs next to the old ones and swap them in only once
+	// sealing succeeded
+	pub, priv := t.blobPaths(account)
+	args := []string{"-Q", "-C", primary, "-i", "-", "-u", pub + ".new", "-r", priv + ".new"}
+	if t.pcrs != "" {
+		policy := filepath.Join(work, "pcr.policy")
+		if _, err := t.run(nil, "tpm2_createpolicy", "-Q", "--policy-pcr", "-l", t.pcrs, "-L", policy); err != nil {
+			return err
+		}
+		args = append(args, "-L", policy)
+	}
+	if _, err := t.run(key, "tpm2_create", args...); err != nil {
+		return err
+	}
+	for _, path := range []string{pub, priv} {
+		if err := os.Rename(path+".new", path); err != nil {
+			return fmt.Errorf("failed to store sealed key: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateKey generates a new key and seals it for account
+func (t *TPMKeyStore) CreateKey(account string) ([]byte, error) {
+	key := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate random key: %w", err)
+	}
+	if err := t.SetKey(account, key); err != nil {
+		secure.Zero(key)
+		return nil, fmt.Errorf("failed to seal key: %w", err)
+	}
+	return key, nil
+}
+
+// LoadOrCreateKey unseals the key for account, or creates and seals one if
+// none exists. A sealed key that cannot be unsealed is an error, not a reason
+// to replace it.
+func (t *TPMKeyStore) LoadOrCreateKey(account string) ([]byte, error) {
+	exists, err := t.HasKey(account)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return t.GetKey(account)
+	}
+	return t.CreateKey(account)
+}
@@ -0,0 +1,138 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTPM simulates tpm2-tools: sealed objects are stored in the clear, and
+// a PCR policy records the PCR value at sealing time, which unsealing checks
+type fakeTPM struct {
+	pcr   string
+	calls []string
+}
+
+func (f *fakeTPM) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, name)
+	flag := func(name string) string {
+		for i := 0; i < len(args)-1; i++ {
+			if args[i] == name {
+				return args[i+1]
+			}
+		}
+		return ""
+	}
+
+	switch name {
+	case "tpm2_createprimary":
+		return nil, os.WriteFile(flag("-c"), []byte("primary"), 0600)
+	case "tpm2_createpolicy":
+		return nil, os.WriteFile(flag("-L"), []byte(f.pcr), 0600)
+	case "tpm2_create":
+		var policy []byte
+		if path := flag("-L"); path != "" {
+			policy, _ = os.ReadFile(path)
+		}
+		if err := os.WriteFile(flag("-u"), policy, 0600); err != nil {
+			return nil, err
+		}
+		return nil, os.WriteFile(flag("-r"), stdin, 0600)
+	case "tpm2_load":
+		pub, err := os.ReadFile(flag("-u"))
+		if err != nil {
+			return nil, err
+		}
+		priv, err := os.ReadFile(flag("-r"))
+		if err != nil {
+			return nil, err
+		}
+		return nil, os.WriteFile(flag("-c"), append(append(pub, '|'), priv...), 0600)
+	case "tpm2_unseal":
+		sealed, err := os.ReadFile(flag("-c"))
+		if err != nil {
+			return nil, err
+		}
+		policy, key, _ := bytes.Cut(sealed, []byte("|"))
+		if len(policy) > 0 && (string(policy) != f.pcr || !strings.HasPrefix(flag("-p"), "pcr:")) {
+			return nil, errors.New("policy check failed")
+		}
+		return key, nil
+	}
+	return nil, errors.New("unexpected command " + name)
+}
+
+func TestTPMKeyStore(t *testing.T) {
+	tests := []struct {
+		name string
+		pcrs string
+	}{
+		{"without PCR policy", ""},
+		{"bound to PCRs", "sha256:0,7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tpm := &fakeTPM{pcr: "boot-1"}
+			store, err := NewTPMKeyStore(&TPMKeyStoreConfig{Dir: dir, PCRs: tt.pcrs, Run: tpm.run})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok, err := HasKey(store, "alice"); ok || err != nil {
+				t.Fatalf("HasKey() before sealing = %v, %v", ok, err)
+			}
+			key, err := store.LoadOrCreateKey("alice")
+			if err != nil {
+				t.Fatalf("LoadOrCreateKey() unexpected error: %v", err)
+			}
+			if ok, _ := HasKey(store, "alice"); !ok {
+				t.Error("HasKey() after sealing = false")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "alice.priv.new")); !os.IsNotExist(err) {
+				t.Error("temporary sealed blob left behind")
+			}
+
+			loaded, err := store.LoadOrCreateKey("alice")
+			if err != nil {
+				t.Fatalf("LoadOrCreateKey() unexpected error: %v", err)
+			}
+			if !bytes.Equal(loaded, key) {
+				t.Error("LoadOrCreateKey() did not unseal the sealed key")
+			}
+
+			// A changed PCR state only matters for PCR bound keys, and never
+			// causes the sealed key to be replaced
+			tpm.pcr = "boot-2"
+			_, err = store.LoadOrCreateKey("alice")
+			if (err != nil) != (tt.pcrs != "") {
+				t.Errorf("LoadOrCreateKey() after PCR change error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNewTPMKeyStore_InvalidPCRs(t *testing.T) {
+	for _, pcrs := range []string{"0,7", "sha256:", "sha256:0;7", "md5:1"} {
+		if _, err := NewTPMKeyStore(&TPMKeyStoreConfig{PCRs: pcrs}); err == nil {
+			t.Errorf("NewTPMKeyStore(%q) expected error", pcrs)
+		}
+	}
+}
+
+func TestTPMKeyStore_GetKeyMissing(t *testing.T) {
+	tpm := &fakeTPM{}
+	store, err := NewTPMKeyStore(&TPMKeyStoreConfig{Dir: t.TempDir(), Run: tpm.run})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetKey("nobody"); err == nil {
+		t.Error("GetKey() expected error for a missing sealed key")
+	}
+	if len(tpm.calls) != 0 {
+		t.Errorf("GetKey() ran %v for a missing sealed key", tpm.calls)
+	}
+}
@@ -0,0 +1,148 @@
+// Package paper encodes keys as short lines of base32 for printing on paper
+// and typing back in. Every line ends in a check character that catches a
+// mistyped or swapped character on that line, and the key as a whole is
+// followed by a checksum so a complete restore is known to be correct.
+package paper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	alphabet      = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	groupSize     = 4
+	groupsPerLine = 4
+	lineSize      = groupSize * groupsPerLine
+	checksumSize  = 2
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrChecksum means every line was valid but the key as a whole was not,
+// which happens when lines are missing or come from different keys
+var ErrChecksum = errors.New("key checksum mismatch")
+
+// Lines returns the number of lines Encode produces for a key of size bytes
+func Lines(size int) int {
+	return (encoding.EncodedLen(size+checksumSize) + lineSize - 1) / lineSize
+}
+
+// Encode returns key as numbered lines of four-character groups, each line
+// ending in its check character, e.g. "01 ABCD EFGH IJKL MNOP  Q"
+func Encode(key []byte) []string {
+	sum := sha256.Sum256(key)
+	data := encoding.EncodeToString(append(append([]byte{}, key...), sum[:checksumSize]...))
+
+	var lines []string
+	for n := 1; len(data) > 0; n++ {
+		chunk := data[:min(lineSize, len(data))]
+		data = data[len(chunk):]
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%02d", n)
+		for i := 0; i < len(chunk); i += groupSize {
+			b.WriteByte(' ')
+			b.WriteString(chunk[i:min(i+groupSize, len(chunk))])
+		}
+		b.WriteString("  ")
+		b.WriteByte(check(n, chunk))
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// ParseLine validates line n (counting from 1) as typed by the user and
+// returns its data characters. The line number is optional; spaces, dashes
+// and case are ignored, and the digits 0, 1 and 8 are read as O, I and B.
+func ParseLine(n int, line string) (string, error) {
+	fields := strings.Fields(strings.ReplaceAll(line, "-", " "))
+	if len(fields) > 0 && len(fields[0]) <= 2 && isNumber(fields[0]) {
+		if fields[0] != fmt.Sprint(n) && fields[0] != fmt.Sprintf("%02d", n) {
+			return "", fmt.Errorf("expected line %d, got line %s", n, fields[0])
+		}
+		fields = fields[1:]
+	}
+
+	text := normalize(strings.Join(fields, ""))
+	if len(text) < 2 {
+		return "", fmt.Errorf("line %d is too short", n)
+	}
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte(alphabet, text[i]) < 0 {
+			return "", fmt.Errorf("line %d: invalid character %q", n, text[i])
+		}
+	}
+
+	data, want := text[:len(text)-1], text[len(text)-1]
+	if len(data) > lineSize {
+		return "", fmt.Errorf("line %d is too long", n)
+	}
+	if check(n, data) != want {
+		return "", fmt.Errorf("line %d has a typo; check it against the paper", n)
+	}
+	return data, nil
+}
+
+// Decode returns the key encoded in lines, which must all be present and in
+// order
+func Decode(lines []string) ([]byte, error) {
+	var data strings.Builder
+	for i, line := range lines {
+		chunk, err := ParseLine(i+1, line)
+		if err != nil {
+			return nil, err
+		}
+		data.WriteString(chunk)
+	}
+	return Join(data.String())
+}
+
+// Join decodes the data characters of all lines returned by ParseLine and
+// verifies the key checksum
+func Join(data string) ([]byte, error) {
+	raw, err := encoding.DecodeString(data)
+	if err != nil || len(raw) <= checksumSize {
+		return nil, ErrChecksum
+	}
+	key, sum := raw[:len(raw)-checksumSize], raw[len(raw)-checksumSize:]
+	want := sha256.Sum256(key)
+	if !bytes.Equal(sum, want[:checksumSize]) {
+		return nil, ErrChecksum
+	}
+	return key, nil
+}
+
+// check computes the Luhn mod 32 check character of data prefixed by the
+// line number, so single-character typos, most transpositions and lines
+// entered in the wrong place are detected
+func check(n int, data string) byte {
+	input := string(alphabet[n%len(alphabet)]) + data
+	factor, sum := 2, 0
+	for i := len(input) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, input[i])
+		addend = addend/len(alphabet) + addend%len(alphabet)
+		sum += addend
+		factor = 3 - factor
+	}
+	return alphabet[(len(alphabet)-sum%len(alphabet))%len(alphabet)]
+}
+
+// normalize upper-cases text and maps digits that base32 does not use to the
+// letters they are mistaken for
+func normalize(text string) string {
+	return strings.NewReplacer("0", "O", "1", "I", "8", "B").Replace(strings.ToUpper(text))
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
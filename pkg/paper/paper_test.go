@@ -0,0 +1,84 @@
+package paper
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i * 7)
+	}
+
+	lines := Encode(key)
+	if len(lines) != Lines(len(key)) {
+		t.Fatalf("Encode() returned %d lines, Lines() = %d", len(lines), Lines(len(key)))
+	}
+	if !strings.HasPrefix(lines[0], "01 ") {
+		t.Errorf("Encode() first line = %q, want it numbered", lines[0])
+	}
+
+	got, err := Decode(lines)
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("Decode() = %x, want %x", got, key)
+	}
+
+	// Typed back loosely: lower case, dashes, no line numbers, 0 for O
+	typed := make([]string, len(lines))
+	for i, line := range lines {
+		typed[i] = strings.ReplaceAll(strings.ToLower(line[3:]), " ", "-")
+		typed[i] = strings.ReplaceAll(typed[i], "o", "0")
+	}
+	if got, err := Decode(typed); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("Decode(typed) = %x, %v; want the key", got, err)
+	}
+}
+
+func TestParseLine_Errors(t *testing.T) {
+	key := bytes.Repeat([]byte{0xa5}, 32)
+	lines := Encode(key)
+	first := strings.Fields(lines[0])
+
+	typo := []byte(lines[0])
+	typo[3] = next(typo[3])
+
+	swapped := append([]string{}, first...)
+	swapped[1] = swapped[1][1:2] + swapped[1][:1] + swapped[1][2:]
+
+	tests := []struct {
+		name string
+		n    int
+		line string
+	}{
+		{"typo", 1, string(typo)},
+		{"transposition", 1, strings.Join(swapped, " ")},
+		{"wrong line number", 2, lines[0]},
+		{"wrong place", 2, strings.Join(first[1:], " ")},
+		{"invalid character", 1, "01 AB!D"},
+		{"too short", 1, "01 A"},
+		{"too long", 1, "01 " + strings.Repeat("A", 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseLine(tt.n, tt.line); err == nil {
+				t.Errorf("ParseLine(%d, %q) expected error", tt.n, tt.line)
+			}
+		})
+	}
+
+	if _, err := Decode(lines[:len(lines)-1]); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Decode() with a missing line = %v, want ErrChecksum", err)
+	}
+}
+
+// next returns the alphabet character after c
+func next(c byte) byte {
+	i := strings.IndexByte(alphabet, c)
+	return alphabet[(i+1)%len(alphabet)]
+}
@@ -0,0 +1,253 @@
+// Package policy checks env files against rules kept in a policy file, so a
+// security team can require encryption, strong secrets and regular rotation
+// without wrapping envx in scripts.
+//
+// A policy file is JSON:
+//
+//	{
+//	  "rules": [
+//	    {"name": "secrets", "keys": ["*_SECRET", "*_TOKEN"], "encrypted": true, "min_entropy": 64, "max_age": "90d"},
+//	    {"name": "no aws keys", "forbid_plaintext": ["AKIA[0-9A-Z]{16}"]}
+//	  ]
+//	}
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// DefaultFile is the policy file looked for in the working directory
+const DefaultFile = ".envx-policy.json"
+
+// Policy is a set of rules every variable is checked against
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule constrains the variables whose keys match Keys (every key when empty)
+// and none of Except
+type Rule struct {
+	// Name identifies the rule in violations; defaults to its position
+	Name   string   `json:"name,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+	Except []string `json:"except,omitempty"`
+	// Encrypted requires values to be encrypted
+	Encrypted bool `json:"encrypted,omitempty"`
+	// MinEntropy is the minimum estimated entropy of values, in bits
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+	// ForbidPlaintext lists regular expressions unencrypted values must not match
+	ForbidPlaintext []string `json:"forbid_plaintext,omitempty"`
+	// MaxAge is how long a value may go unchanged, e.g. "90d" or "720h"
+	MaxAge Duration `json:"max_age,omitempty"`
+
+	forbid []*regexp.Regexp
+}
+
+// Duration is a time.Duration that also accepts a number of days, e.g. "90d"
+type Duration time.Duration
+
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"90d\": %w", err)
+	}
+	parsed, err := env.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads the policy file at path
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- User-provided policy file path is intentional
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy %s: %w", path, err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a policy
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return nil, err
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if !rule.Encrypted && rule.MinEntropy <= 0 && len(rule.ForbidPlaintext) == 0 && rule.MaxAge <= 0 {
+			return nil, fmt.Errorf("%s has no constraints", rule.Name)
+		}
+		for _, pattern := range rule.ForbidPlaintext {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %w", rule.Name, pattern, err)
+			}
+			rule.forbid = append(rule.forbid, re)
+		}
+	}
+	return &p, nil
+}
+
+// NeedsValues reports whether checking the policy needs decrypted values
+func (p *Policy) NeedsValues() bool {
+	for _, rule := range p.Rules {
+		if rule.MinEntropy > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsAge reports whether checking the policy needs the age of values
+func (p *Policy) NeedsAge() bool {
+	for _, rule := range p.Rules {
+		if rule.MaxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Value is a variable as the policy sees it
+type Value struct {
+	Key string
+	// Value is the plaintext value, or empty if it is encrypted and was not
+	// decrypted
+	Value     string
+	Encrypted bool
+	// Decrypted reports whether Value holds the plaintext of an encrypted value
+	Decrypted bool
+	// Age is how long the value has been unchanged, when known
+	Age      time.Duration
+	AgeKnown bool
+}
+
+// Violation is a variable breaking a rule
+type Violation struct {
+	Key     string `json:"key"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Key, v.Message, v.Rule)
+}
+
+// ErrViolations is wrapped by the error Enforce returns for violations
+var ErrViolations = errors.New("policy violation")
+
+// Check returns the violations of the policy by values, in the order of the
+// values and then of the rules
+func (p *Policy) Check(values []Value) []Violation {
+	var violations []Violation
+	for _, v := range values {
+		for _, rule := range p.Rules {
+			if !rule.matches(v.Key) {
+				continue
+			}
+			for _, message := range rule.check(v) {
+				violations = append(violations, Violation{Key: v.Key, Rule: rule.Name, Message: message})
+			}
+		}
+	}
+	return violations
+}
+
+// Enforce returns an error listing the violations, or nil if there are none
+func Enforce(violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	lines := make([]string, len(violations))
+	for i, v := range violations {
+		lines[i] = "  " + v.String()
+	}
+	return fmt.Errorf("%w: %d variable(s) break the policy:\n%s", ErrViolations, len(violations), strings.Join(lines, "\n"))
+}
+
+func (r Rule) matches(key string) bool {
+	if len(r.Keys) > 0 && !env.MatchesAny(key, r.Keys) {
+		return false
+	}
+	return !env.MatchesAny(key, r.Except)
+}
+
+func (r Rule) check(v Value) []string {
+	var messages []string
+	if r.Encrypted && !v.Encrypted {
+		messages = append(messages, "value must be encrypted")
+	}
+	if !v.Encrypted {
+		for _, re := range r.forbid {
+			if re.MatchString(v.Value) {
+				messages = append(messages, fmt.Sprintf("plaintext value matches forbidden pattern %q", re.String()))
+			}
+		}
+	}
+	if r.MinEntropy > 0 && (!v.Encrypted || v.Decrypted) {
+		if bits := Entropy(v.Value); bits < r.MinEntropy {
+			messages = append(messages, fmt.Sprintf("value has about %.0f bits of entropy, less than %.0f", bits, r.MinEntropy))
+		}
+	}
+	if r.MaxAge > 0 && v.AgeKnown && v.Age > time.Duration(r.MaxAge) {
+		messages = append(messages, fmt.Sprintf("value unchanged for %s, longer than %s", formatAge(v.Age), formatAge(time.Duration(r.MaxAge))))
+	}
+	return messages
+}
+
+// Entropy estimates the entropy of s in bits as its length times the Shannon
+// entropy of its characters. It overestimates structured values, but catches
+// short, repetitive and placeholder secrets.
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	perChar := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(n)
+}
+
+// formatAge prints d in days when it is at least a day
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	return d.Round(time.Second).String()
+}
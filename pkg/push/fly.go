@@ -0,0 +1,59 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fly pushes with flyctl. Values are piped to "secrets import", so they
+// never appear in the process list. Fly.io never reveals secret values.
+type fly struct {
+	Config
+}
+
+func (f *fly) List() (Remote, error) {
+	out, err := f.Run(nil, "flyctl", append([]string{"secrets", "list", "--json"}, appArgs(f.App)...)...)
+	if err != nil {
+		return Remote{}, err
+	}
+	var secrets []struct {
+		Name string
+	}
+	if err := json.Unmarshal(out, &secrets); err != nil {
+		return Remote{}, fmt.Errorf("error reading fly secrets: %w", err)
+	}
+	values := make(map[string]string, len(secrets))
+	for _, s := range secrets {
+		values[s.Name] = ""
+	}
+	return Remote{Values: values}, nil
+}
+
+func (f *fly) Apply(plan Plan) error {
+	set, unset := plan.split()
+	if len(set) > 0 {
+		var sb strings.Builder
+		for _, v := range set {
+			// Multi-line values are wrapped in triple quotes
+			if strings.Contains(v.Value, "\n") {
+				if strings.Contains(v.Value, `"""`) {
+					return fmt.Errorf("cannot push %s: flyctl cannot import multi-line values containing \"\"\"", v.Key)
+				}
+				fmt.Fprintf(&sb, "%s=\"\"\"%s\"\"\"\n", v.Key, v.Value)
+				continue
+			}
+			fmt.Fprintf(&sb, "%s=%s\n", v.Key, v.Value)
+		}
+		if _, err := f.Run([]byte(sb.String()), "flyctl", append([]string{"secrets", "import"}, appArgs(f.App)...)...); err != nil {
+			return err
+		}
+	}
+	if len(unset) > 0 {
+		args := append([]string{"secrets", "unset"}, unset...)
+		if _, err := f.Run(nil, "flyctl", append(args, appArgs(f.App)...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// heroku pushes with the Heroku CLI. Values are passed to config:set as
+// arguments, since it cannot read them from stdin.
+type heroku struct {
+	Config
+}
+
+func (h *heroku) List() (Remote, error) {
+	out, err := h.Run(nil, "heroku", append([]string{"config", "--json"}, appArgs(h.App)...)...)
+	if err != nil {
+		return Remote{}, err
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(out, &values); err != nil {
+		return Remote{}, fmt.Errorf("error reading heroku config: %w", err)
+	}
+	return Remote{Values: values, ValuesKnown: true}, nil
+}
+
+func (h *heroku) Apply(plan Plan) error {
+	set, unset := plan.split()
+	if len(set) > 0 {
+		args := []string{"config:set"}
+		for _, v := range set {
+			args = append(args, v.Key+"="+v.Value)
+		}
+		if _, err := h.Run(nil, "heroku", append(args, appArgs(h.App)...)...); err != nil {
+			return err
+		}
+	}
+	if len(unset) > 0 {
+		args := append([]string{"config:unset"}, unset...)
+		if _, err := h.Run(nil, "heroku", append(args, appArgs(h.App)...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package push sets config vars on hosting platforms through their CLIs.
+package push
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/command"
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// Runner runs a platform CLI with stdin and returns its stdout
+type Runner func(stdin []byte, name string, args ...string) ([]byte, error)
+
+// Provider sets config vars on a platform
+type Provider interface {
+	// List returns the config vars set on the platform
+	List() (Remote, error)
+	// Apply makes the changes in plan
+	Apply(plan Plan) error
+}
+
+// Config selects where a provider pushes to
+type Config struct {
+	// App is the Heroku or Fly.io app; empty uses the CLI's default
+	App string
+	// Environment is the Vercel environment (default production)
+	Environment string
+	// Run executes the platform CLI; for dependency injection in tests
+	Run Runner
+}
+
+// Providers lists the supported provider names
+var Providers = []string{"flyctl", "heroku", "vercel"}
+
+// New returns the provider with the given name
+func New(name string, config Config) (Provider, error) {
+	if config.Run == nil {
+		config.Run = command.Run
+	}
+	switch name {
+	case "flyctl", "fly":
+		return &fly{config}, nil
+	case "heroku":
+		return &heroku{config}, nil
+	case "vercel":
+		if config.Environment == "" {
+			config.Environment = "production"
+		}
+		return &vercel{config}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (supported: %s)", name, strings.Join(Providers, ", "))
+	}
+}
+
+// Remote holds the config vars set on a platform. Platforms that never
+// reveal values only report the keys.
+type Remote struct {
+	Values      map[string]string
+	ValuesKnown bool
+}
+
+// ChangeKind is how a push changes a config var
+type ChangeKind int
+
+const (
+	// Add sets a config var the platform does not have
+	Add ChangeKind = iota
+	// Update overwrites a config var whose value differs or is unknown
+	Update
+	// Remove unsets a config var missing from the env file
+	Remove
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Add:
+		return "+"
+	case Update:
+		return "~"
+	default:
+		return "-"
+	}
+}
+
+// Change is a single change to a config var
+type Change struct {
+	Kind  ChangeKind
+	Key   string
+	Value string
+}
+
+// Plan lists the changes a push makes, removals last
+type Plan struct {
+	Changes []Change
+	// Kept lists config vars only the platform has, which are left alone
+	// without prune
+	Kept []string
+}
+
+// NewPlan compares local variables with those on the platform. Variables
+// with the same known value are left out. With prune, config vars missing
+// locally are removed.
+func NewPlan(local env.Variables, remote Remote, prune bool) Plan {
+	var plan Plan
+	seen := make(map[string]bool, len(local))
+	for _, v := range local {
+		seen[v.Key] = true
+		current, exists := remote.Values[v.Key]
+		switch {
+		case !exists:
+			plan.Changes = append(plan.Changes, Change{Kind: Add, Key: v.Key, Value: v.Value})
+		case !remote.ValuesKnown || current != v.Value:
+			plan.Changes = append(plan.Changes, Change{Kind: Update, Key: v.Key, Value: v.Value})
+		}
+	}
+
+	var extra []string
+	for key := range remote.Values {
+		if !seen[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	if !prune {
+		plan.Kept = extra
+		return plan
+	}
+	for _, key := range extra {
+		plan.Changes = append(plan.Changes, Change{Kind: Remove, Key: key})
+	}
+	return plan
+}
+
+// String returns the changes as a preview without values, one per line
+func (p Plan) String() string {
+	var sb strings.Builder
+	for _, c := range p.Changes {
+		fmt.Fprintf(&sb, "%s %s\n", c.Kind, c.Key)
+	}
+	return sb.String()
+}
+
+// split returns the keys and values to set and the keys to unset
+func (p Plan) split() (set env.Variables, unset []string) {
+	for _, c := range p.Changes {
+		if c.Kind == Remove {
+			unset = append(unset, c.Key)
+		} else {
+			set = append(set, env.Variable{Key: c.Key, Value: c.Value})
+		}
+	}
+	return set, unset
+}
+
+// appArgs returns the flag selecting app, if any
+func appArgs(app string) []string {
+	if app == "" {
+		return nil
+	}
+	return []string{"--app", app}
+}
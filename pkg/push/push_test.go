@@ -0,0 +1,147 @@
+package push
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// call is an invocation recorded by fakeRunner
+type call struct {
+	stdin string
+	args  string
+}
+
+// fakeRunner records invocations and answers list commands with out
+func fakeRunner(out string, calls *[]call) Runner {
+	return func(stdin []byte, name string, args ...string) ([]byte, error) {
+		*calls = append(*calls, call{stdin: string(stdin), args: name + " " + strings.Join(args, " ")})
+		return []byte(out), nil
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	local := env.Variables{{Key: "SAME", Value: "1"}, {Key: "CHANGED", Value: "new"}, {Key: "NEW", Value: "x"}}
+
+	tests := []struct {
+		name     string
+		remote   Remote
+		prune    bool
+		want     string
+		wantKept []string
+	}{
+		{
+			name:     "known values",
+			remote:   Remote{Values: map[string]string{"SAME": "1", "CHANGED": "old", "OLD": "y"}, ValuesKnown: true},
+			want:     "~ CHANGED\n+ NEW\n",
+			wantKept: []string{"OLD"},
+		},
+		{
+			name:   "unknown values with prune",
+			remote: Remote{Values: map[string]string{"SAME": "", "OLD": "", "ALSO_OLD": ""}},
+			prune:  true,
+			want:   "~ SAME\n+ CHANGED\n+ NEW\n- ALSO_OLD\n- OLD\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := NewPlan(local, tt.remote, tt.prune)
+			if got := plan.String(); got != tt.want {
+				t.Errorf("NewPlan() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(plan.Kept, tt.wantKept) {
+				t.Errorf("NewPlan() kept %v, want %v", plan.Kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestProviders(t *testing.T) {
+	plan := Plan{Changes: []Change{
+		{Kind: Add, Key: "NEW", Value: "a b"},
+		{Kind: Update, Key: "CERT", Value: "line1\nline2"},
+		{Kind: Remove, Key: "OLD"},
+	}}
+
+	tests := []struct {
+		provider  string
+		config    Config
+		listOut   string
+		wantKeys  []string
+		wantCalls []call
+	}{
+		{
+			provider: "heroku",
+			config:   Config{App: "api"},
+			listOut:  `{"CERT":"old","OLD":"x"}`,
+			wantKeys: []string{"CERT", "OLD"},
+			wantCalls: []call{
+				{args: "heroku config --json --app api"},
+				{args: "heroku config:set NEW=a b CERT=line1\nline2 --app api"},
+				{args: "heroku config:unset OLD --app api"},
+			},
+		},
+		{
+			provider: "flyctl",
+			listOut:  `[{"Name":"CERT","Digest":"abc"},{"name":"OLD"}]`,
+			wantKeys: []string{"CERT", "OLD"},
+			wantCalls: []call{
+				{args: "flyctl secrets list --json"},
+				{stdin: "NEW=a b\nCERT=\"\"\"line1\nline2\"\"\"\n", args: "flyctl secrets import"},
+				{args: "flyctl secrets unset OLD"},
+			},
+		},
+		{
+			provider: "vercel",
+			config:   Config{Environment: "preview"},
+			listOut:  "Vercel CLI 39.0.0\n\n name   value       environments   created\n CERT   Encrypted   Preview        2d ago\n OLD    Encrypted   Preview        3d ago\n",
+			wantKeys: []string{"CERT", "OLD"},
+			wantCalls: []call{
+				{args: "vercel env ls preview"},
+				{stdin: "a b", args: "vercel env add NEW preview"},
+				{stdin: "line1\nline2", args: "vercel env add CERT preview --force"},
+				{args: "vercel env rm OLD preview --yes"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			var calls []call
+			tt.config.Run = fakeRunner(tt.listOut, &calls)
+			provider, err := New(tt.provider, tt.config)
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+
+			remote, err := provider.List()
+			if err != nil {
+				t.Fatalf("List() unexpected error: %v", err)
+			}
+			var keys []string
+			for key := range remote.Values {
+				keys = append(keys, key)
+			}
+			if len(keys) != len(tt.wantKeys) {
+				t.Errorf("List() keys = %v, want %v", keys, tt.wantKeys)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := remote.Values[key]; !ok {
+					t.Errorf("List() is missing %s", key)
+				}
+			}
+
+			if err := provider.Apply(plan); err != nil {
+				t.Fatalf("Apply() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", calls, tt.wantCalls)
+			}
+		})
+	}
+
+	if _, err := New("netlify", Config{}); err == nil {
+		t.Error("New() expected error for unknown provider")
+	}
+}
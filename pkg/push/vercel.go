@@ -0,0 +1,59 @@
+package push
+
+import (
+	"strings"
+)
+
+// vercel pushes with the Vercel CLI to a single environment. Values are
+// piped to "env add" one variable at a time, overwriting existing variables
+// with --force so a failed push never leaves a variable removed. Vercel
+// never reveals the values of encrypted variables.
+type vercel struct {
+	Config
+}
+
+func (v *vercel) List() (Remote, error) {
+	out, err := v.Run(nil, "vercel", "env", "ls", v.Environment)
+	if err != nil {
+		return Remote{}, err
+	}
+	return Remote{Values: parseVercelList(string(out))}, nil
+}
+
+// parseVercelList reads variable names from the first column of the table
+// "vercel env ls" prints, below its "name" header
+func parseVercelList(out string) map[string]string {
+	values := map[string]string{}
+	inTable := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !inTable {
+			inTable = strings.EqualFold(fields[0], "name")
+			continue
+		}
+		values[fields[0]] = ""
+	}
+	return values
+}
+
+func (v *vercel) Apply(plan Plan) error {
+	for _, c := range plan.Changes {
+		if c.Kind == Remove {
+			if _, err := v.Run(nil, "vercel", "env", "rm", c.Key, v.Environment, "--yes"); err != nil {
+				return err
+			}
+			continue
+		}
+		args := []string{"env", "add", c.Key, v.Environment}
+		if c.Kind == Update {
+			args = append(args, "--force")
+		}
+		if _, err := v.Run([]byte(c.Value), "vercel", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,569 @@
+// Package qr encodes short byte strings as QR codes (ISO/IEC 18004) and
+// renders them for terminals. It supports byte mode at error correction
+// levels M and L for versions 1 to 10, enough for secrets and keys.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Level is an error correction level
+type Level int
+
+const (
+	// LevelL recovers about 7% of the code
+	LevelL Level = iota
+	// LevelM recovers about 15% of the code
+	LevelM
+)
+
+// MaxVersion is the largest supported version (57x57 modules)
+const MaxVersion = 10
+
+// ErrTooLong means the data does not fit in the largest supported version
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// Error correction codewords per block and number of blocks, indexed by
+// level and then version (index 0 unused)
+var (
+	eccPerBlock = [2][MaxVersion + 1]int{
+		LevelL: {0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18},
+		LevelM: {0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26},
+	}
+	numBlocks = [2][MaxVersion + 1]int{
+		LevelL: {0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4},
+		LevelM: {0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5},
+	}
+	// formatBits are the two level bits of the format information
+	formatBits = [2]int{LevelL: 1, LevelM: 0}
+)
+
+// Code is an encoded QR symbol
+type Code struct {
+	version  int
+	size     int
+	level    Level
+	mask     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode encodes data at level M, falling back to level L when it would not
+// otherwise fit, in the smallest version that holds it
+func Encode(data []byte) (*Code, error) {
+	code, err := EncodeLevel(data, LevelM)
+	if errors.Is(err, ErrTooLong) {
+		return EncodeLevel(data, LevelL)
+	}
+	return code, err
+}
+
+// EncodeLevel encodes data at the given level in the smallest version that holds it
+func EncodeLevel(data []byte, level Level) (*Code, error) {
+	version := 0
+	for v := 1; v <= MaxVersion; v++ {
+		if len(data) <= capacity(v, level) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLong, len(data), capacity(MaxVersion, LevelL))
+	}
+
+	c := &Code{version: version, size: version*4 + 17, level: level}
+	c.modules = newGrid(c.size)
+	c.function = newGrid(c.size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.interleave(c.dataCodewords(data)))
+
+	// Pick the mask with the lowest penalty, as the standard recommends
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // masks are their own inverse
+	}
+	c.mask = best
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// Version returns the symbol version, 1 to MaxVersion
+func (c *Code) Version() int {
+	return c.version
+}
+
+// Size returns the width and height in modules, without the quiet zone
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.size && y < c.size && c.modules[y][x]
+}
+
+// quietZone is the light border required around the symbol, in modules
+const quietZone = 4
+
+// Render writes the code using half block characters, two rows of modules
+// per line, with explicit black on white colors so it scans on dark
+// terminal themes too
+func (c *Code) Render(w io.Writer) error {
+	var sb strings.Builder
+	for y := -quietZone; y < c.size+quietZone; y += 2 {
+		sb.WriteString("\x1b[30;47m")
+		for x := -quietZone; x < c.size+quietZone; x++ {
+			top, bottom := c.Dark(x, y), c.Dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// rawCodewords returns the number of codewords a version holds
+func rawCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		modules -= (25*align-10)*align - 55
+		if version >= 7 {
+			modules -= 36
+		}
+	}
+	return modules / 8
+}
+
+// dataCapacity returns the number of data codewords for a version and level
+func dataCapacity(version int, level Level) int {
+	return rawCodewords(version) - eccPerBlock[level][version]*numBlocks[level][version]
+}
+
+// countBits returns the width of the byte mode character count field
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// capacity returns the number of bytes a version and level can hold
+func capacity(version int, level Level) int {
+	return (dataCapacity(version, level)*8 - 4 - countBits(version)) / 8
+}
+
+// dataCodewords encodes data in byte mode with terminator and padding
+func (c *Code) dataCodewords(data []byte) []byte {
+	var bits []bool
+	appendBits := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	appendBits(0b0100, 4)
+	appendBits(len(data), countBits(c.version))
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacityBits := dataCapacity(c.version, c.level) * 8
+	appendBits(0, min(4, capacityBits-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacityBits/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := range 8 {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacityBits/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits data into blocks, appends error correction to each and
+// interleaves the blocks
+func (c *Code) interleave(data []byte) []byte {
+	blocks := numBlocks[c.level][c.version]
+	eccLen := eccPerBlock[c.level][c.version]
+	raw := rawCodewords(c.version)
+	shortBlocks := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	divisor := rsDivisor(eccLen)
+	var all [][]byte
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0)
+		}
+		all = append(all, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, raw)
+	for i := range all[0] {
+		for j, block := range all {
+			// Short blocks have a placeholder byte where long blocks have data
+			if i != shortLen-eccLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := range c.size {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	positions := alignmentPositions(c.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the bits are drawn once a mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.size || y >= c.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the row and column centers of alignment patterns
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	size := version*4 + 17
+	step := ((version*4+4)/(count*2-2) + btoi((version*4+4)%(count*2-2) != 0)) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatInfo returns the 15 format bits for a level and mask
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for range 10 {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInfo(c.level, mask)
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := range 6 {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		c.setFunction(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.size-15+i, bit(i))
+	}
+	c.setFunction(8, c.size-8, true) // always dark
+}
+
+// versionInfo returns the 18 version bits for versions 7 and up
+func versionInfo(version int) int {
+	rem := version
+	for range 12 {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+	bits := versionInfo(c.version)
+	for i := range 18 {
+		dark := (bits>>i)&1 == 1
+		a, b := c.size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := range c.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert // upward column
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := range c.size {
+		for x := range c.size {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// Penalty weights from the standard
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+)
+
+// penalty scores the current symbol; lower is easier to scan
+func (c *Code) penalty() int {
+	result := 0
+	for _, horizontal := range []bool{true, false} {
+		for a := range c.size {
+			runDark := false
+			run := 0
+			var history [7]int
+			for b := range c.size {
+				dark := c.modules[a][b]
+				if !horizontal {
+					dark = c.modules[b][a]
+				}
+				if dark == runDark {
+					run++
+					if run == 5 {
+						result += penaltyRun
+					} else if run > 5 {
+						result++
+					}
+					continue
+				}
+				c.addHistory(run, &history)
+				if !runDark {
+					result += countFinderLike(&history) * penaltyFinder
+				}
+				runDark = dark
+				run = 1
+			}
+			if runDark {
+				c.addHistory(run, &history)
+				run = 0
+			}
+			c.addHistory(run+c.size, &history)
+			result += countFinderLike(&history) * penaltyFinder
+		}
+	}
+
+	dark := 0
+	for y := range c.size {
+		for x := range c.size {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x < c.size-1 && y < c.size-1 {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+
+	total := c.size * c.size
+	deviation := abs(dark*20 - total*10)
+	k := (deviation+total-1)/total - 1
+	return result + k*penaltyBalance
+}
+
+// addHistory pushes a run length, treating the area before the first run as
+// light quiet zone
+func (c *Code) addHistory(run int, history *[7]int) {
+	if history[0] == 0 {
+		run += c.size
+	}
+	copy(history[1:], history[:6])
+	history[0] = run
+}
+
+// countFinderLike counts 1:1:3:1:1 patterns with light space on either side
+func countFinderLike(history *[7]int) int {
+	n := history[1]
+	core := n > 0 && history[2] == n && history[3] == n*3 && history[4] == n && history[5] == n
+	return btoi(core && history[0] >= n*4 && history[6] >= n) + btoi(core && history[6] >= n*4 && history[0] >= n)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, highest coefficient first and the leading 1 omitted
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords for data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
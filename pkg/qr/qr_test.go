@@ -0,0 +1,210 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example in the standard's tutorials
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	if got := formatInfo(LevelM, 0); got != 0b101010000010010 {
+		t.Errorf("formatInfo(M, 0) = %015b", got)
+	}
+	if got := formatInfo(LevelL, 4); got != 0b110011000101111 {
+		t.Errorf("formatInfo(L, 4) = %015b", got)
+	}
+	if got := versionInfo(7); got != 0x07C94 {
+		t.Errorf("versionInfo(7) = %#x, want 0x7c94", got)
+	}
+	if got := versionInfo(10); got != 0x0A4D3 {
+		t.Errorf("versionInfo(10) = %#x, want 0xa4d3", got)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		6:  {6, 34},
+		7:  {6, 22, 38},
+		8:  {6, 24, 42},
+		10: {6, 28, 50},
+	}
+	for version, want := range tests {
+		if got := alignmentPositions(version); !slices.Equal(got, want) {
+			t.Errorf("alignmentPositions(%d) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		version int
+		level   Level
+		want    int
+	}{
+		{1, LevelM, 14},
+		{1, LevelL, 17},
+		{5, LevelM, 84},
+		{9, LevelM, 180},
+		{10, LevelM, 213},
+		{10, LevelL, 271},
+	}
+	for _, tt := range tests {
+		if got := capacity(tt.version, tt.level); got != tt.want {
+			t.Errorf("capacity(%d, %d) = %d, want %d", tt.version, tt.level, got, tt.want)
+		}
+	}
+}
+
+// readCodewords reverses drawCodewords and the mask to recover the codewords
+func readCodewords(c *Code) []byte {
+	saved := c.modules
+	c.modules = newGrid(c.size)
+	for y := range c.size {
+		copy(c.modules[y], saved[y])
+	}
+	c.applyMask(c.mask)
+	defer func() { c.modules = saved }()
+
+	var data []byte
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range c.size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if c.function[y][x] {
+					continue
+				}
+				if i%8 == 0 {
+					data = append(data, 0)
+				}
+				if c.modules[y][x] {
+					data[i/8] |= 1 << (7 - i%8)
+				}
+				i++
+			}
+		}
+	}
+	return data[:rawCodewords(c.version)]
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"hello",
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		strings.Repeat("envx", 50),
+		strings.Repeat("x", 271),
+	}
+
+	for _, input := range inputs {
+		code, err := Encode([]byte(input))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) unexpected error: %v", len(input), err)
+		}
+		if code.Size() != code.Version()*4+17 {
+			t.Errorf("Size() = %d for version %d", code.Size(), code.Version())
+		}
+
+		// The format information must decode to the level and mask used
+		bits := 0
+		for i := range 6 {
+			bits |= btoi(code.Dark(8, i)) << i
+		}
+		bits |= btoi(code.Dark(8, 7))<<6 | btoi(code.Dark(8, 8))<<7 | btoi(code.Dark(7, 8))<<8
+		for i := 9; i < 15; i++ {
+			bits |= btoi(code.Dark(14-i, 8)) << i
+		}
+		if want := formatInfo(code.level, code.mask); bits != want {
+			t.Errorf("format bits = %015b, want %015b", bits, want)
+		}
+
+		// De-interleave, check each block's error correction and decode the data
+		raw := readCodewords(code)
+		blocks := numBlocks[code.level][code.version]
+		eccLen := eccPerBlock[code.level][code.version]
+		total := rawCodewords(code.version)
+		shortBlocks := blocks - total%blocks
+		shortLen := total / blocks
+
+		perBlock := make([][]byte, blocks)
+		k := 0
+		for i := range shortLen + 1 {
+			for j := range blocks {
+				// Short blocks have no codeword in this position
+				if i == shortLen-eccLen && j < shortBlocks {
+					continue
+				}
+				perBlock[j] = append(perBlock[j], raw[k])
+				k++
+			}
+		}
+		var data []byte
+		for j, block := range perBlock {
+			n := len(block) - eccLen
+			if !bytes.Equal(rsRemainder(block[:n], rsDivisor(eccLen)), block[n:]) {
+				t.Errorf("block %d error correction does not match", j)
+			}
+			data = append(data, block[:n]...)
+		}
+
+		if mode := data[0] >> 4; mode != 0b0100 {
+			t.Fatalf("mode = %04b, want byte mode", mode)
+		}
+		var length, offset int
+		if countBits(code.version) == 8 {
+			length = int(data[0]&0x0f)<<4 | int(data[1]>>4)
+			offset = 1
+		} else {
+			length = int(data[0]&0x0f)<<12 | int(data[1])<<4 | int(data[2]>>4)
+			offset = 2
+		}
+		decoded := make([]byte, length)
+		for i := range decoded {
+			decoded[i] = data[offset+i]<<4 | data[offset+i+1]>>4
+		}
+		if string(decoded) != input {
+			t.Errorf("decoded %q, want %q", decoded, input)
+		}
+	}
+}
+
+func TestEncode_TooLong(t *testing.T) {
+	_, err := Encode(make([]byte, 272))
+	if !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode() error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestCode_Render(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := code.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if want := (code.Size() + 2*quietZone + 1) / 2; len(lines) != want {
+		t.Errorf("Render() wrote %d lines, want %d", len(lines), want)
+	}
+}
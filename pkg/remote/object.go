@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/command"
+)
+
+var (
+	// ErrNotFound is returned when an object does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrConflict is returned when an object changed since it was read
+	ErrConflict = errors.New("object changed since it was read")
+)
+
+// Runner runs a cloud CLI with stdin and returns its stdout
+type Runner func(stdin []byte, name string, args ...string) ([]byte, error)
+
+// ObjectStore reads and writes env files kept in object storage through the
+// provider's CLI, so no credentials are handled by envx
+type ObjectStore interface {
+	// Get returns the contents of the object and the version they belong to
+	Get(uri string) ([]byte, string, error)
+	// Put writes the object only if it is still at version, or does not exist
+	// when version is empty, returning ErrConflict otherwise
+	Put(uri string, data []byte, version string) error
+}
+
+// IsObjectURI reports whether name is an s3:// or gs:// URI
+func IsObjectURI(name string) bool {
+	return strings.HasPrefix(name, "s3://") || strings.HasPrefix(name, "gs://")
+}
+
+// NewObjectStore returns the store for the scheme of uri. A nil run uses the
+// aws or gcloud CLI.
+func NewObjectStore(uri string, run Runner) (ObjectStore, error) {
+	if run == nil {
+		run = command.Run
+	}
+	switch {
+	case strings.HasPrefix(uri, "s3://"):
+		return &s3Store{run: run}, nil
+	case strings.HasPrefix(uri, "gs://"):
+		return &gcsStore{run: run}, nil
+	default:
+		return nil, fmt.Errorf("unsupported object URI %s (expected s3:// or gs://)", uri)
+	}
+}
+
+// splitURI returns the bucket and key of scheme://bucket/key
+func splitURI(uri string) (string, string, error) {
+	_, rest, _ := strings.Cut(uri, "://")
+	bucket, key, ok := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("invalid object URI %s (expected scheme://bucket/path)", uri)
+	}
+	return bucket, key, nil
+}
+
+// classify maps CLI failures to ErrNotFound and ErrConflict by the error
+// codes the CLIs print
+func classify(err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "NoSuchKey"), strings.Contains(msg, "(404)"), strings.Contains(msg, "NotFound"), strings.Contains(msg, "matched no objects"):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case strings.Contains(msg, "PreconditionFailed"), strings.Contains(msg, "(412)"), strings.Contains(msg, "HTTPError 412"), strings.Contains(msg, "ConditionalRequestConflict"):
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	default:
+		return err
+	}
+}
+
+// s3Store uses "aws s3api", versioning objects by ETag. Conditional writes
+// need a recent aws CLI.
+type s3Store struct {
+	run Runner
+}
+
+func (s *s3Store) Get(uri string) ([]byte, string, error) {
+	bucket, key, err := splitURI(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	// get-object only writes the body to a file
+	dir, err := os.MkdirTemp("", "envx-s3-")
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "object")
+
+	out, err := s.run(nil, "aws", "s3api", "get-object", "--bucket", bucket, "--key", key, path)
+	if err != nil {
+		return nil, "", classify(err)
+	}
+	var meta struct {
+		ETag string
+	}
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return nil, "", fmt.Errorf("error reading object metadata: %w", err)
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- Temp file created above
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading object: %w", err)
+	}
+	return data, meta.ETag, nil
+}
+
+func (s *s3Store) Put(uri string, data []byte, version string) error {
+	bucket, key, err := splitURI(uri)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "envx-s3-")
+	if err != nil {
+		return fmt.Errorf("error creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "object")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+
+	args := []string{"s3api", "put-object", "--bucket", bucket, "--key", key, "--body", path}
+	if version == "" {
+		args = append(args, "--if-none-match", "*")
+	} else {
+		args = append(args, "--if-match", version)
+	}
+	if _, err := s.run(nil, "aws", args...); err != nil {
+		return classify(err)
+	}
+	return nil
+}
+
+// gcsStore uses "gcloud storage", versioning objects by generation
+type gcsStore struct {
+	run Runner
+}
+
+func (g *gcsStore) Get(uri string) ([]byte, string, error) {
+	if _, _, err := splitURI(uri); err != nil {
+		return nil, "", err
+	}
+	out, err := g.run(nil, "gcloud", "storage", "objects", "describe", uri, "--format=json")
+	if err != nil {
+		return nil, "", classify(err)
+	}
+	var meta struct {
+		Generation json.RawMessage
+	}
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return nil, "", fmt.Errorf("error reading object metadata: %w", err)
+	}
+	generation := strings.Trim(string(meta.Generation), `"`)
+	if generation == "" {
+		return nil, "", fmt.Errorf("error reading object metadata: no generation")
+	}
+	// Reading that generation keeps contents and version consistent
+	data, err := g.run(nil, "gcloud", "storage", "cat", uri+"#"+generation)
+	if err != nil {
+		return nil, "", classify(err)
+	}
+	return data, generation, nil
+}
+
+func (g *gcsStore) Put(uri string, data []byte, version string) error {
+	if _, _, err := splitURI(uri); err != nil {
+		return err
+	}
+	// Generation 0 only matches an object that does not exist
+	if version == "" {
+		version = "0"
+	}
+	if _, err := g.run(data, "gcloud", "storage", "cp", "-", uri, "--if-generation-match="+version); err != nil {
+		return classify(err)
+	}
+	return nil
+}
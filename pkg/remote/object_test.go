@@ -0,0 +1,123 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeBucket emulates the aws and gcloud CLIs for a single object
+type fakeBucket struct {
+	data    []byte
+	version int
+	exists  bool
+	calls   []string
+}
+
+func (b *fakeBucket) run(stdin []byte, name string, args ...string) ([]byte, error) {
+	b.calls = append(b.calls, name+" "+strings.Join(args[:2], " "))
+	current := fmt.Sprint(b.version)
+	switch {
+	case name == "aws" && args[1] == "get-object":
+		if !b.exists {
+			return nil, errors.New("aws failed: An error occurred (NoSuchKey) when calling the GetObject operation")
+		}
+		if err := os.WriteFile(args[len(args)-1], b.data, 0600); err != nil {
+			return nil, err
+		}
+		return []byte(`{"ETag": "\"` + current + `\"", "ContentLength": 3}`), nil
+	case name == "aws" && args[1] == "put-object":
+		cond := args[len(args)-1]
+		if (args[len(args)-2] == "--if-none-match" && b.exists) || (args[len(args)-2] == "--if-match" && cond != `"`+current+`"`) {
+			return nil, errors.New("aws failed: An error occurred (PreconditionFailed) when calling the PutObject operation")
+		}
+		data, err := os.ReadFile(args[7])
+		if err != nil {
+			return nil, err
+		}
+		b.data, b.exists = data, true
+		b.version++
+		return []byte(`{}`), nil
+	case name == "gcloud" && args[1] == "objects":
+		if !b.exists {
+			return nil, errors.New("gcloud failed: ERROR: The following URLs matched no objects or files")
+		}
+		return []byte(`{"generation": "` + current + `"}`), nil
+	case name == "gcloud" && args[1] == "cat":
+		if !strings.HasSuffix(args[2], "#"+current) {
+			return nil, errors.New("gcloud failed: NotFoundError")
+		}
+		return b.data, nil
+	case name == "gcloud" && args[1] == "cp":
+		want := "0"
+		if b.exists {
+			want = current
+		}
+		if args[len(args)-1] != "--if-generation-match="+want {
+			return nil, errors.New("gcloud failed: HTTPError 412: At least one of the pre-conditions you specified did not hold. (412)")
+		}
+		b.data, b.exists = stdin, true
+		b.version++
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected command %s %v", name, args)
+}
+
+func TestObjectStore(t *testing.T) {
+	for _, uri := range []string{"s3://team/app/.env", "gs://team/app/.env"} {
+		t.Run(uri, func(t *testing.T) {
+			bucket := &fakeBucket{version: 1}
+			store, err := NewObjectStore(uri, bucket.run)
+			if err != nil {
+				t.Fatalf("NewObjectStore() unexpected error: %v", err)
+			}
+
+			if _, _, err := store.Get(uri); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get() of missing object error = %v, want ErrNotFound", err)
+			}
+			if err := store.Put(uri, []byte("A=1\n"), ""); err != nil {
+				t.Fatalf("Put() of new object unexpected error: %v", err)
+			}
+			if err := store.Put(uri, []byte("A=2\n"), ""); !errors.Is(err, ErrConflict) {
+				t.Errorf("Put() over existing object error = %v, want ErrConflict", err)
+			}
+
+			data, version, err := store.Get(uri)
+			if err != nil || string(data) != "A=1\n" {
+				t.Fatalf("Get() = %q, %v, want A=1", data, err)
+			}
+			// Another writer updates the object in between
+			bucket.version++
+			if err := store.Put(uri, []byte("A=3\n"), version); !errors.Is(err, ErrConflict) {
+				t.Errorf("Put() of stale version error = %v, want ErrConflict", err)
+			}
+			_, version, _ = store.Get(uri)
+			if err := store.Put(uri, []byte("A=3\n"), version); err != nil {
+				t.Errorf("Put() of current version unexpected error: %v", err)
+			}
+			if string(bucket.data) != "A=3\n" {
+				t.Errorf("object holds %q, want A=3", bucket.data)
+			}
+		})
+	}
+
+	for _, uri := range []string{"s3://bucket", "gs://bucket/dir/", "file:///tmp/.env"} {
+		store, err := NewObjectStore(uri, nil)
+		if err == nil {
+			_, _, err = store.Get(uri)
+		}
+		if err == nil {
+			t.Errorf("Get(%q) expected error", uri)
+		}
+	}
+}
+
+func TestSplitURI(t *testing.T) {
+	bucket, key, err := splitURI("s3://team-secrets/services/api/.env")
+	if err != nil || !reflect.DeepEqual([]string{bucket, key}, []string{"team-secrets", "services/api/.env"}) {
+		t.Errorf("splitURI() = %q, %q, %v", bucket, key, err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package remote fetches env files over HTTP(S), caching them for offline use.
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSize limits how much of a response is read
+const maxSize = 10 << 20
+
+// ErrNotCached is returned when offline and the URL has not been fetched before
+var ErrNotCached = errors.New("not cached")
+
+// IsURL reports whether name is an http or https URL
+func IsURL(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// Fetcher fetches env files, keeping the last copy of each URL with its ETag
+// so unchanged files are not downloaded again and can be used offline
+type Fetcher struct {
+	client   *http.Client
+	cacheDir string
+	headers  http.Header
+	offline  bool
+}
+
+// FetcherConfig holds configuration for a Fetcher
+type FetcherConfig struct {
+	// CacheDir holds fetched files (default the user cache directory's envx/remote)
+	CacheDir string
+	// Headers are sent with every request, e.g. Authorization
+	Headers http.Header
+	// Offline only uses cached copies
+	Offline bool
+	// Client sends requests (default http.DefaultClient)
+	Client *http.Client
+}
+
+// NewFetcher creates a new fetcher
+func NewFetcher(config *FetcherConfig) *Fetcher {
+	f := &Fetcher{client: http.DefaultClient, cacheDir: defaultCacheDir()}
+	if config != nil {
+		if config.CacheDir != "" {
+			f.cacheDir = config.CacheDir
+		}
+		if config.Client != nil {
+			f.client = config.Client
+		}
+		f.headers = config.Headers
+		f.offline = config.Offline
+	}
+	return f
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "envx", "remote")
+}
+
+// Fetch returns the contents at url. A cached copy is revalidated with its
+// ETag and used when the server reports it unchanged, or directly when
+// offline.
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	body, etag, cacheErr := f.readCache(url)
+	if f.offline {
+		if cacheErr != nil {
+			return nil, fmt.Errorf("cannot use %s offline: %w", url, cacheErr)
+		}
+		return body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", url, err)
+	}
+	for name, values := range f.headers {
+		req.Header[name] = values
+	}
+	if cacheErr == nil && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cacheErr == nil:
+		return body, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("error fetching %s: %s", url, resp.Status)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	if len(body) > maxSize {
+		return nil, fmt.Errorf("error fetching %s: larger than %d bytes", url, maxSize)
+	}
+	if err := f.writeCache(url, body, resp.Header.Get("ETag")); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// cachePaths returns where the contents and ETag of url are cached
+func (f *Fetcher) cachePaths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	base := filepath.Join(f.cacheDir, hex.EncodeToString(sum[:]))
+	return base + ".env", base + ".etag"
+}
+
+func (f *Fetcher) readCache(url string) ([]byte, string, error) {
+	bodyPath, etagPath := f.cachePaths(url)
+	body, err := os.ReadFile(bodyPath) // #nosec G304 -- Path derived from a hash in the cache directory
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotCached
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading cached copy: %w", err)
+	}
+	etag, err := os.ReadFile(etagPath) // #nosec G304 -- Path derived from a hash in the cache directory
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("error reading cached copy: %w", err)
+	}
+	return body, string(etag), nil
+}
+
+func (f *Fetcher) writeCache(url string, body []byte, etag string) error {
+	if err := os.MkdirAll(f.cacheDir, 0700); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+	bodyPath, etagPath := f.cachePaths(url)
+	if err := os.WriteFile(bodyPath, body, 0600); err != nil {
+		return fmt.Errorf("error caching %s: %w", url, err)
+	}
+	if etag == "" {
+		if err := os.Remove(etagPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error caching %s: %w", url, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(etagPath, []byte(etag), 0600); err != nil {
+		return fmt.Errorf("error caching %s: %w", url, err)
+	}
+	return nil
+}
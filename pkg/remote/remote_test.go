@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsURL(t *testing.T) {
+	for name, want := range map[string]bool{
+		"https://example.com/.env": true,
+		"http://localhost/.env":    true,
+		".env":                     false,
+		"-":                        false,
+		"/srv/https://x":           false,
+	} {
+		if got := IsURL(name); got != want {
+			t.Errorf("IsURL(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	content := "A=1\n"
+	etag := `"v1"`
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	headers := http.Header{"Authorization": {"Bearer token"}}
+	fetcher := NewFetcher(&FetcherConfig{CacheDir: cacheDir, Headers: headers})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		body, err := fetcher.Fetch(ctx, server.URL+"/.env")
+		if err != nil {
+			t.Fatalf("Fetch() unexpected error: %v", err)
+		}
+		if string(body) != content {
+			t.Errorf("Fetch() = %q, want %q", body, content)
+		}
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("got %d requests with %d not modified, want 2 with 1", requests, notModified)
+	}
+
+	// A changed file replaces the cached copy
+	content, etag = "A=2\n", `"v2"`
+	if body, err := fetcher.Fetch(ctx, server.URL+"/.env"); err != nil || string(body) != content {
+		t.Errorf("Fetch() = %q, %v, want %q", body, err, content)
+	}
+
+	offline := NewFetcher(&FetcherConfig{CacheDir: cacheDir, Offline: true})
+	server.Close()
+	if body, err := offline.Fetch(ctx, server.URL+"/.env"); err != nil || string(body) != content {
+		t.Errorf("offline Fetch() = %q, %v, want %q", body, err, content)
+	}
+	if _, err := offline.Fetch(ctx, server.URL+"/other"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("offline Fetch() of uncached URL error = %v, want ErrNotCached", err)
+	}
+	if _, err := fetcher.Fetch(ctx, server.URL+"/.env"); err == nil {
+		t.Error("Fetch() expected error when the server is unreachable")
+	}
+}
+
+func TestFetcher_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(&FetcherConfig{CacheDir: t.TempDir()})
+	if _, err := fetcher.Fetch(context.Background(), server.URL); err == nil {
+		t.Error("Fetch() expected error for 401")
+	}
+}
@@ -0,0 +1,114 @@
+// Package schema describes the variables an env file is expected to hold, so
+// their documentation can be generated from it and kept in sync with the file.
+//
+// A schema file is JSON:
+//
+//	{
+//	  "vars": [
+//	    {"key": "DATABASE_URL", "description": "Primary database", "required": true, "example": "postgres://localhost/app"},
+//	    {"key": "LOG_LEVEL", "description": "debug, info or warn", "pattern": "^(debug|info|warn)$"}
+//	  ]
+//	}
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// DefaultFile is the schema file looked for in the working directory
+const DefaultFile = ".envx-schema.json"
+
+// Schema lists the variables an env file is expected to hold
+type Schema struct {
+	Vars []Var `json:"vars"`
+}
+
+// Var describes one variable
+type Var struct {
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"`
+	// Required marks variables that must be set
+	Required bool `json:"required,omitempty"`
+	// Example is a value safe to show in documentation
+	Example string `json:"example,omitempty"`
+	// Pattern is a regular expression values must match
+	Pattern string `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Load reads the schema file at path
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- User-provided schema file path is intentional
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema %s: %w", path, err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse decodes and validates a schema
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&s); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(s.Vars))
+	for i := range s.Vars {
+		v := &s.Vars[i]
+		if v.Key == "" {
+			return nil, fmt.Errorf("variable %d has no key", i+1)
+		}
+		if seen[v.Key] {
+			return nil, fmt.Errorf("variable %s is described more than once", v.Key)
+		}
+		seen[v.Key] = true
+		if v.Pattern != "" {
+			re, err := regexp.Compile(v.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %w", v.Key, v.Pattern, err)
+			}
+			v.pattern = re
+		}
+	}
+	return &s, nil
+}
+
+// Check returns an error if value breaks the constraints of v. An empty
+// value is only an error for required variables.
+func (v Var) Check(value string) error {
+	if value == "" {
+		if v.Required {
+			return fmt.Errorf("%s is required", v.Key)
+		}
+		return nil
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return fmt.Errorf("%s must match %s", v.Key, v.Pattern)
+	}
+	return nil
+}
+
+// Get returns the description of the variable with key, or nil. A nil
+// schema describes nothing.
+func (s *Schema) Get(key string) *Var {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Vars {
+		if s.Vars[i].Key == key {
+			return &s.Vars[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package schema
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(`{"vars": [{"key": "DATABASE_URL", "description": "Primary database", "required": true}, {"key": "LOG_LEVEL", "pattern": "^(debug|info)$"}]}`))
+	if err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+	if v := s.Get("DATABASE_URL"); v == nil || !v.Required || v.Description != "Primary database" {
+		t.Errorf("Get(DATABASE_URL) = %+v", v)
+	}
+	if v := s.Get("MISSING"); v != nil {
+		t.Errorf("Get(MISSING) = %+v, want nil", v)
+	}
+	var none *Schema
+	if v := none.Get("LOG_LEVEL"); v != nil {
+		t.Errorf("nil schema Get() = %+v, want nil", v)
+	}
+
+	checks := []struct {
+		key, value string
+		wantErr    bool
+	}{
+		{"DATABASE_URL", "postgres://db/app", false},
+		{"DATABASE_URL", "", true},
+		{"LOG_LEVEL", "", false},
+		{"LOG_LEVEL", "info", false},
+		{"LOG_LEVEL", "trace", true},
+	}
+	for _, c := range checks {
+		if err := s.Get(c.key).Check(c.value); (err != nil) != c.wantErr {
+			t.Errorf("Check(%s=%q) error = %v, wantErr %v", c.key, c.value, err, c.wantErr)
+		}
+	}
+
+	invalid := []string{
+		`{"vars": [{"key": "A", "pattern": "("}]}`,
+		`{"vars": [{"description": "no key"}]}`,
+		`{"vars": [{"key": "A"}, {"key": "A"}]}`,
+		`{"vars": [{"key": "A", "unknown": 1}]}`,
+		`not json`,
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) expected error", data)
+		}
+	}
+}
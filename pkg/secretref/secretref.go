@@ -0,0 +1,175 @@
+// Package secretref resolves values that refer to secrets kept in other
+// secret managers, such as op://vault/item/field, through the managers'
+// CLIs, so no credentials are handled by envx.
+package secretref
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/command"
+)
+
+// Runner runs a secret manager CLI and returns its stdout
+type Runner func(name string, args ...string) ([]byte, error)
+
+// Resolver returns the secret a reference points to
+type Resolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(ref string) (string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// Registry maps URI schemes to the resolvers of their references
+type Registry struct {
+	resolvers map[string]Resolver
+}
+
+// NewRegistry returns a registry of the built-in resolvers: op:// (1Password),
+// aws-sm:// (AWS Secrets Manager), gcp-sm:// (Google Secret Manager) and
+// vault:// (HashiCorp Vault KV). A nil run uses the managers' CLIs.
+func NewRegistry(run Runner) *Registry {
+	if run == nil {
+		run = func(name string, args ...string) ([]byte, error) {
+			return command.Run(nil, name, args...)
+		}
+	}
+	r := &Registry{resolvers: make(map[string]Resolver)}
+	r.Register("op", ResolverFunc(func(ref string) (string, error) {
+		return output(run("op", "read", "--no-newline", ref))
+	}))
+	r.Register("aws-sm", ResolverFunc(func(ref string) (string, error) {
+		return resolveAWS(run, ref)
+	}))
+	r.Register("gcp-sm", ResolverFunc(func(ref string) (string, error) {
+		return resolveGCP(run, ref)
+	}))
+	r.Register("vault", ResolverFunc(func(ref string) (string, error) {
+		return resolveVault(run, ref)
+	}))
+	return r
+}
+
+// Register makes r resolve references with scheme, replacing any resolver
+// registered for it before
+func (r *Registry) Register(scheme string, resolver Resolver) {
+	r.resolvers[scheme] = resolver
+}
+
+// Schemes returns the registered schemes, sorted
+func (r *Registry) Schemes() []string {
+	schemes := make([]string, 0, len(r.resolvers))
+	for scheme := range r.resolvers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsReference reports whether value is a reference with a registered scheme
+func (r *Registry) IsReference(value string) bool {
+	scheme, rest, ok := strings.Cut(value, "://")
+	return ok && rest != "" && r.resolvers[scheme] != nil
+}
+
+// Resolve returns the secret ref points to. Values that are not references
+// are returned unchanged.
+func (r *Registry) Resolve(ref string) (string, error) {
+	if !r.IsReference(ref) {
+		return ref, nil
+	}
+	scheme, _, _ := strings.Cut(ref, "://")
+	value, err := r.resolvers[scheme].Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %w", ref, err)
+	}
+	return value, nil
+}
+
+// resolveAWS reads aws-sm://NAME, or aws-sm://NAME#FIELD for a field of a
+// JSON secret
+func resolveAWS(run Runner, ref string) (string, error) {
+	name, field := splitRef(ref)
+	if name == "" || isFlag(name) {
+		return "", fmt.Errorf("expected aws-sm://NAME[#FIELD]")
+	}
+	value, err := output(run("aws", "secretsmanager", "get-secret-value", "--secret-id="+name, "--query", "SecretString", "--output", "text"))
+	if err != nil || field == "" {
+		return strings.TrimSuffix(value, "\n"), err
+	}
+	return jsonField(value, field)
+}
+
+// resolveGCP reads gcp-sm://PROJECT/SECRET[/VERSION], the latest version
+// unless one is given
+func resolveGCP(run Runner, ref string) (string, error) {
+	path, _ := splitRef(ref)
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("expected gcp-sm://PROJECT/SECRET[/VERSION]")
+	}
+	version := "latest"
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	if isFlag(version) {
+		return "", fmt.Errorf("expected gcp-sm://PROJECT/SECRET[/VERSION]")
+	}
+	return output(run("gcloud", "secrets", "versions", "access", version, "--secret="+parts[1], "--project="+parts[0]))
+}
+
+// resolveVault reads vault://PATH#FIELD from a KV secrets engine
+func resolveVault(run Runner, ref string) (string, error) {
+	path, field := splitRef(ref)
+	if path == "" || field == "" || isFlag(path) {
+		return "", fmt.Errorf("expected vault://PATH#FIELD")
+	}
+	return output(run("vault", "kv", "get", "-field="+field, path))
+}
+
+// isFlag reports whether arg, taken from a reference, would be read as a
+// flag when passed to a CLI as a positional argument or flag value
+func isFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-")
+}
+
+// splitRef returns the part of ref after its scheme and before any #, and
+// the part after the #
+func splitRef(ref string) (string, string) {
+	_, rest, _ := strings.Cut(ref, "://")
+	path, field, _ := strings.Cut(rest, "#")
+	return path, field
+}
+
+// jsonField returns the string, number or boolean field of a JSON object
+func jsonField(secret, field string) (string, error) {
+	var values map[string]any
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object")
+	}
+	switch v := values[field].(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", fmt.Errorf("secret has no field %q", field)
+	default:
+		return "", fmt.Errorf("field %q is not a string, number or boolean", field)
+	}
+}
+
+func output(stdout []byte, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return string(stdout), nil
+}
@@ -0,0 +1,83 @@
+package secretref
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	var calls [][]string
+	run := func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		switch name {
+		case "op":
+			return []byte("op-secret"), nil
+		case "aws":
+			return []byte(`{"user":"admin","port":5432}` + "\n"), nil
+		case "gcloud":
+			return []byte("gcp-secret"), nil
+		case "vault":
+			return nil, errors.New("vault failed: permission denied")
+		}
+		return nil, errors.New("unexpected command")
+	}
+	r := NewRegistry(run)
+
+	tests := []struct {
+		ref  string
+		want string
+		cmd  []string
+	}{
+		{"op://vault/item/field", "op-secret", []string{"op", "read", "--no-newline", "op://vault/item/field"}},
+		{"aws-sm://prod/db#port", "5432", []string{"aws", "secretsmanager", "get-secret-value", "--secret-id=prod/db", "--query", "SecretString", "--output", "text"}},
+		{"aws-sm://prod/db", `{"user":"admin","port":5432}`, nil},
+		{"gcp-sm://my-project/api-key", "gcp-secret", []string{"gcloud", "secrets", "versions", "access", "latest", "--secret=api-key", "--project=my-project"}},
+		{"gcp-sm://my-project/api-key/3", "gcp-secret", []string{"gcloud", "secrets", "versions", "access", "3", "--secret=api-key", "--project=my-project"}},
+		{"https://example.com", "https://example.com", nil},
+		{"plain value", "plain value", nil},
+	}
+	for _, tt := range tests {
+		calls = nil
+		got, err := r.Resolve(tt.ref)
+		if err != nil {
+			t.Errorf("Resolve(%q) error = %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+		if tt.cmd != nil && (len(calls) != 1 || !slices.Equal(calls[0], tt.cmd)) {
+			t.Errorf("Resolve(%q) ran %v, want %v", tt.ref, calls, tt.cmd)
+		}
+	}
+
+	for _, ref := range []string{"vault://secret/app#password", "vault://secret/app", "aws-sm://prod/db#missing", "gcp-sm://only-project"} {
+		if _, err := r.Resolve(ref); err == nil || !strings.Contains(err.Error(), ref) {
+			t.Errorf("Resolve(%q) error = %v, want one naming the reference", ref, err)
+		}
+	}
+
+	// Parts of references never reach the CLIs as flags
+	for _, ref := range []string{"vault://-address=https://evil.example#password", "aws-sm://--endpoint-url=https://evil.example", "gcp-sm://project/secret/--log-http"} {
+		calls = nil
+		if _, err := r.Resolve(ref); err == nil || len(calls) != 0 {
+			t.Errorf("Resolve(%q) error = %v, ran %v; want it rejected", ref, err, calls)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry(func(string, ...string) ([]byte, error) { return nil, errors.New("no CLI") })
+	r.Register("test", ResolverFunc(func(ref string) (string, error) { return strings.ToUpper(ref), nil }))
+	if !r.IsReference("test://x") || r.IsReference("test://") || r.IsReference("other://x") {
+		t.Error("IsReference() does not match the registered schemes")
+	}
+	if got, err := r.Resolve("test://x"); err != nil || got != "TEST://X" {
+		t.Errorf("Resolve() = %q, %v", got, err)
+	}
+	if want := []string{"aws-sm", "gcp-sm", "op", "test", "vault"}; !slices.Equal(r.Schemes(), want) {
+		t.Errorf("Schemes() = %v, want %v", r.Schemes(), want)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package secure
+
+import "errors"
+
+// lock is not supported on this platform
+func lock(b []byte) error {
+	return errors.New("memory locking not supported on this platform")
+}
+
+// unlock is not supported on this platform
+func unlock(b []byte) error {
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package secure
+
+import "golang.org/x/sys/unix"
+
+// lock prevents the memory backing b from being swapped to disk
+func lock(b []byte) error {
+	return unix.Mlock(b)
+}
+
+// unlock releases a lock taken by lock
+func unlock(b []byte) error {
+	return unix.Munlock(b)
+}
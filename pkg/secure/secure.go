@@ -0,0 +1,67 @@
+// Package secure provides helpers for keeping keys and plaintext secrets in
+// memory for as short a time as possible.
+package secure
+
+import "runtime"
+
+// Zero overwrites b with zeros
+func Zero(b []byte) {
+	clear(b)
+	// Keep the writes from being optimized away
+	runtime.KeepAlive(b)
+}
+
+// Buffer holds secret bytes in memory that is locked against swapping where
+// the platform allows it, and zeroed by Destroy
+type Buffer struct {
+	b      []byte
+	locked bool
+}
+
+// New allocates a zeroed buffer of the given size. Locking the memory is best
+// effort: it can fail due to resource limits, in which case the buffer still
+// works but may be swapped to disk; see Locked.
+func New(size int) *Buffer {
+	buf := &Buffer{b: make([]byte, size)}
+	if size > 0 {
+		buf.locked = lock(buf.b) == nil
+	}
+	return buf
+}
+
+// Copy returns a buffer holding a copy of b and zeroes b
+func Copy(b []byte) *Buffer {
+	buf := New(len(b))
+	copy(buf.b, b)
+	Zero(b)
+	return buf
+}
+
+// Bytes returns the secret. The slice is only valid until Destroy is called
+// and must not be retained.
+func (buf *Buffer) Bytes() []byte {
+	return buf.b
+}
+
+// Len returns the size of the secret
+func (buf *Buffer) Len() int {
+	return len(buf.b)
+}
+
+// Locked reports whether the buffer memory is locked against swapping
+func (buf *Buffer) Locked() bool {
+	return buf.locked
+}
+
+// Destroy zeroes and unlocks the buffer. It is safe to call more than once.
+func (buf *Buffer) Destroy() {
+	if buf == nil || buf.b == nil {
+		return
+	}
+	Zero(buf.b)
+	if buf.locked {
+		_ = unlock(buf.b)
+		buf.locked = false
+	}
+	buf.b = nil
+}
@@ -0,0 +1,36 @@
+package secure
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestZero(t *testing.T) {
+	b := []byte("secret")
+	Zero(b)
+	if !bytes.Equal(b, make([]byte, 6)) {
+		t.Errorf("Zero() left %q", b)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	src := []byte("0123456789abcdef")
+	buf := Copy(src)
+
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Error("Copy() did not zero the source")
+	}
+	if buf.Len() != 16 || string(buf.Bytes()) != "0123456789abcdef" {
+		t.Errorf("Bytes() = %q", buf.Bytes())
+	}
+
+	b := buf.Bytes()
+	buf.Destroy()
+	if !bytes.Equal(b, make([]byte, 16)) {
+		t.Error("Destroy() did not zero the buffer")
+	}
+	if buf.Bytes() != nil || buf.Locked() {
+		t.Error("Destroy() left the buffer usable")
+	}
+	buf.Destroy()
+}
@@ -0,0 +1,184 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+package shamir
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxShares is the maximum number of shares a secret can be split into
+	MaxShares   = 255
+	sharePrefix = "envx-share:v1"
+)
+
+// Share is one piece of a split secret
+type Share struct {
+	Threshold int
+	X         byte
+	Y         []byte
+}
+
+// String encodes the share as envx-share:v1:<threshold>:<x>:<hex>
+func (s Share) String() string {
+	return fmt.Sprintf("%s:%d:%d:%s", sharePrefix, s.Threshold, s.X, hex.EncodeToString(s.Y))
+}
+
+// ParseShare decodes a share produced by Share.String
+func ParseShare(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, sharePrefix+":") {
+		return Share{}, errors.New("not an envx share")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(text, sharePrefix+":"), ":")
+	if len(parts) != 3 {
+		return Share{}, errors.New("malformed share")
+	}
+
+	threshold, err := strconv.Atoi(parts[0])
+	if err != nil || threshold < 2 || threshold > MaxShares {
+		return Share{}, fmt.Errorf("invalid share threshold %q", parts[0])
+	}
+	x, err := strconv.Atoi(parts[1])
+	if err != nil || x < 1 || x > MaxShares {
+		return Share{}, fmt.Errorf("invalid share index %q", parts[1])
+	}
+	y, err := hex.DecodeString(parts[2])
+	if err != nil || len(y) == 0 {
+		return Share{}, errors.New("invalid share data")
+	}
+
+	return Share{Threshold: threshold, X: byte(x), Y: y}, nil
+}
+
+// Split divides secret into n shares, any threshold of which can recover it
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret must not be empty")
+	}
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < threshold {
+		return nil, fmt.Errorf("number of shares (%d) must be at least the threshold (%d)", n, threshold)
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("number of shares must not exceed %d", MaxShares)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Threshold: threshold, X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	// One random polynomial of degree threshold-1 per secret byte, with the
+	// secret byte as the constant term
+	coefficients := make([]byte, threshold)
+	for b, secretByte := range secret {
+		coefficients[0] = secretByte
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients: %w", err)
+		}
+		for i := range shares {
+			shares[i].Y[b] = evaluate(coefficients, shares[i].X)
+		}
+	}
+	clear(coefficients)
+
+	return shares, nil
+}
+
+// Combine recovers the secret from at least threshold distinct shares
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+
+	threshold, size := shares[0].Threshold, len(shares[0].Y)
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.Threshold != threshold || len(s.Y) != size {
+			return nil, errors.New("shares belong to different secrets")
+		}
+		if s.X == 0 {
+			return nil, errors.New("invalid share index 0")
+		}
+		if seen[s.X] {
+			return nil, fmt.Errorf("duplicate share %d", s.X)
+		}
+		seen[s.X] = true
+	}
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("need at least %d shares, got %d", threshold, len(shares))
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			basis = mul(basis, div(sj.X, sj.X^si.X))
+		}
+		for b := range secret {
+			secret[b] ^= mul(si.Y[b], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// evaluate computes the polynomial at x using Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// GF(2^8) arithmetic using the AES polynomial x^8 + x^4 + x^3 + x + 1
+var expTable, logTable = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		// multiply by the generator 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if b == 0 {
+		panic("shamir: division by zero")
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,100 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split() unexpected error: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Split() returned %d shares, want 5", len(shares))
+	}
+
+	subsets := [][]int{{0, 1, 2}, {0, 2, 4}, {4, 3, 1}, {0, 1, 2, 3, 4}}
+	for _, subset := range subsets {
+		var picked []Share
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		recovered, err := Combine(picked)
+		if err != nil {
+			t.Fatalf("Combine(%v) unexpected error: %v", subset, err)
+		}
+		if !bytes.Equal(recovered, secret) {
+			t.Errorf("Combine(%v) did not recover the secret", subset)
+		}
+	}
+
+	if _, err := Combine(shares[:2]); err == nil {
+		t.Error("Combine() with fewer shares than the threshold expected error")
+	}
+	if _, err := Combine([]Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Error("Combine() with duplicate shares expected error")
+	}
+}
+
+func TestSplit_InvalidParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    []byte
+		n         int
+		threshold int
+	}{
+		{name: "empty secret", secret: nil, n: 3, threshold: 2},
+		{name: "threshold too low", secret: []byte("s"), n: 3, threshold: 1},
+		{name: "fewer shares than threshold", secret: []byte("s"), n: 2, threshold: 3},
+		{name: "too many shares", secret: []byte("s"), n: 256, threshold: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Split(tt.secret, tt.n, tt.threshold); err == nil {
+				t.Error("Split() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestShare_StringParse(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, share := range shares {
+		parsed, err := ParseShare(share.String() + "\n")
+		if err != nil {
+			t.Fatalf("ParseShare() unexpected error: %v", err)
+		}
+		if parsed.Threshold != share.Threshold || parsed.X != share.X || !bytes.Equal(parsed.Y, share.Y) {
+			t.Errorf("ParseShare() = %+v, want %+v", parsed, share)
+		}
+	}
+
+	invalid := []string{"", "hello", "envx-share:v1:3:1", "envx-share:v1:1:1:00", "envx-share:v1:3:0:00", "envx-share:v1:3:1:zz"}
+	for _, text := range invalid {
+		if _, err := ParseShare(text); err == nil {
+			t.Errorf("ParseShare(%q) expected error but got none", text)
+		}
+	}
+}
+
+func TestGF256(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got := div(mul(byte(a), byte(b)), byte(b)); got != byte(a) {
+				t.Fatalf("div(mul(%d, %d), %d) = %d", a, b, b, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package signature signs env files with ed25519 and verifies them. The
+// signature is embedded in the file as a comment line, which env parsers
+// ignore, so a signed file can be used like any other.
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix starts the comment line holding the signature, followed by the
+// signer's public key and the signature, both base64 encoded
+const Prefix = "# envx:signature ed25519 "
+
+// domain is prepended to the signed content so signatures over env files
+// cannot be confused with ed25519 signatures made for other purposes
+const domain = "envx-signature-v1\n"
+
+var (
+	// ErrUnsigned means the content has no signature line
+	ErrUnsigned = errors.New("file is not signed")
+	// ErrInvalid means the signature does not match the content, i.e. the
+	// file was changed after it was signed or the signature line was damaged
+	ErrInvalid = errors.New("signature does not match the file contents")
+)
+
+// PublicKey returns the public key of the identity derived from seed
+func PublicKey(seed []byte) (ed25519.PublicKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid identity size: expected %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey), nil
+}
+
+// EncodeKey formats a public key the way it appears in signature lines
+func EncodeKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// DecodeKey parses a public key formatted by EncodeKey
+func DecodeKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: %w", s, err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key %q: expected %d bytes, got %d", s, ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Sign returns content with any existing signature replaced by one made with
+// the identity derived from seed. The signature line is appended at the end.
+func Sign(content, seed []byte) ([]byte, error) {
+	pub, err := PublicKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	defer clear(priv)
+
+	body, _ := Strip(content)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		body = append(body, '\n')
+	}
+	sig := ed25519.Sign(priv, message(body))
+
+	var out bytes.Buffer
+	out.Write(body)
+	out.WriteString(Prefix)
+	out.WriteString(EncodeKey(pub))
+	out.WriteByte(' ')
+	out.WriteString(base64.StdEncoding.EncodeToString(sig))
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// Verify checks the signature embedded in content and returns the public key
+// that made it. It only proves the file is unchanged since that key signed
+// it; callers decide whether they trust the key.
+func Verify(content []byte) (ed25519.PublicKey, error) {
+	body, lines := Strip(content)
+	if len(lines) == 0 {
+		return nil, ErrUnsigned
+	}
+	if len(lines) > 1 {
+		return nil, fmt.Errorf("file has %d signature lines, expected one", len(lines))
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(lines[0], Prefix))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("malformed signature line: %w", ErrInvalid)
+	}
+	pub, err := DecodeKey(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature line: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("malformed signature line: %w", ErrInvalid)
+	}
+	if !ed25519.Verify(pub, message(body), sig) {
+		return nil, ErrInvalid
+	}
+	return pub, nil
+}
+
+// Strip returns content without its signature lines, along with those lines
+func Strip(content []byte) ([]byte, []string) {
+	var body []byte
+	var lines []string
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		line := content[:end]
+		content = content[end:]
+		if text := string(bytes.TrimRight(line, "\r\n")); strings.HasPrefix(text, Prefix) {
+			lines = append(lines, text)
+			continue
+		}
+		body = append(body, line...)
+	}
+	return body, lines
+}
+
+// message returns the bytes that are actually signed for body
+func message(body []byte) []byte {
+	return append([]byte(domain), body...)
+}
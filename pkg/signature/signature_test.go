@@ -0,0 +1,116 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testSeed(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestSignVerify(t *testing.T) {
+	content := []byte("# comment\nA=1\nB=ZW52eA==\n")
+	signed, err := Sign(content, testSeed(1))
+	if err != nil {
+		t.Fatalf("Sign() unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(signed, content) {
+		t.Errorf("Sign() changed the content:\n%s", signed)
+	}
+
+	pub, err := Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify() unexpected error: %v", err)
+	}
+	want, _ := PublicKey(testSeed(1))
+	if !pub.Equal(want) {
+		t.Errorf("Verify() key = %s, want %s", EncodeKey(pub), EncodeKey(want))
+	}
+
+	// Signing again replaces the signature instead of adding another one
+	resigned, err := Sign(signed, testSeed(2))
+	if err != nil {
+		t.Fatalf("Sign() unexpected error: %v", err)
+	}
+	if n := strings.Count(string(resigned), Prefix); n != 1 {
+		t.Errorf("Sign() left %d signature lines, want 1", n)
+	}
+	pub, err = Verify(resigned)
+	if err != nil {
+		t.Fatalf("Verify() unexpected error: %v", err)
+	}
+	if pub.Equal(want) {
+		t.Error("Verify() returned the old signer after re-signing")
+	}
+}
+
+func TestSign_MissingTrailingNewline(t *testing.T) {
+	signed, err := Sign([]byte("A=1"), testSeed(1))
+	if err != nil {
+		t.Fatalf("Sign() unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(signed), "A=1\n"+Prefix) {
+		t.Errorf("Sign() = %q", signed)
+	}
+	if _, err := Verify(signed); err != nil {
+		t.Errorf("Verify() unexpected error: %v", err)
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	signed, err := Sign([]byte("A=1\n"), testSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(signed[len("A=1\n"):])
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{"unsigned", "A=1\n", ErrUnsigned},
+		{"value changed", "A=2\n" + line, ErrInvalid},
+		{"line added", "A=1\nB=2\n" + line, ErrInvalid},
+		{"comment added", "# note\nA=1\n" + line, ErrInvalid},
+		{"truncated signature", "A=1\n" + line[:len(line)-10] + "\n", ErrInvalid},
+		{"missing fields", "A=1\n" + Prefix + "\n", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify([]byte(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := Verify([]byte("A=1\n" + line + line)); err == nil {
+		t.Error("Verify() expected error for two signature lines")
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	pub, _ := PublicKey(testSeed(3))
+	got, err := DecodeKey(" " + EncodeKey(pub) + "\n")
+	if err != nil {
+		t.Fatalf("DecodeKey() unexpected error: %v", err)
+	}
+	if !got.Equal(pub) {
+		t.Error("DecodeKey() did not round-trip")
+	}
+	for _, bad := range []string{"", "not base64!", "AAAA"} {
+		if _, err := DecodeKey(bad); err == nil {
+			t.Errorf("DecodeKey(%q) expected error", bad)
+		}
+	}
+}
+
+func TestPublicKey_InvalidSeed(t *testing.T) {
+	if _, err := PublicKey([]byte("short")); err == nil {
+		t.Error("PublicKey() expected error for a short seed")
+	}
+}
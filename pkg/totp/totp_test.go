@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors
+func TestConfig_Code_RFC6238(t *testing.T) {
+	secrets := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	tests := []struct {
+		unix      int64
+		algorithm string
+		want      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{20000000000, "SHA256", "77737706"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			config := &Config{Secret: secrets[tt.algorithm], Digits: 8, Period: DefaultPeriod, Algorithm: tt.algorithm}
+			got, err := config.Code(time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatalf("Code() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+			}
+		})
+	}
+}
+
+// RFC 4226 appendix D test vectors
+func TestHOTP(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314"}
+	for counter, code := range want {
+		if got := HOTP([]byte("12345678901234567890"), uint64(counter), 6, sha1.New); got != code {
+			t.Errorf("HOTP(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	// base32 of "12345678901234567890"
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		name       string
+		value      string
+		wantDigits int
+		wantPeriod time.Duration
+		wantAlg    string
+		wantErr    string
+	}{
+		{name: "base32", value: secret, wantDigits: 6, wantPeriod: 30 * time.Second, wantAlg: "SHA1"},
+		{name: "lowercase with spaces", value: "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", wantDigits: 6, wantPeriod: 30 * time.Second, wantAlg: "SHA1"},
+		{name: "uri", value: "otpauth://totp/Example:alice?secret=" + secret + "&issuer=Example&digits=8&period=60&algorithm=sha256", wantDigits: 8, wantPeriod: time.Minute, wantAlg: "SHA256"},
+		{name: "hotp uri", value: "otpauth://hotp/Example?secret=" + secret, wantErr: "unsupported otpauth type"},
+		{name: "bad algorithm", value: "otpauth://totp/Example?secret=" + secret + "&algorithm=MD5", wantErr: "unsupported algorithm"},
+		{name: "not base32", value: "not-a-secret!", wantErr: "invalid TOTP secret"},
+		{name: "empty", value: "", wantErr: "empty TOTP secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			if string(config.Secret) != "12345678901234567890" {
+				t.Errorf("Parse() secret = %q", config.Secret)
+			}
+			if config.Digits != tt.wantDigits || config.Period != tt.wantPeriod || config.Algorithm != tt.wantAlg {
+				t.Errorf("Parse() = %d digits, %v, %s; want %d, %v, %s", config.Digits, config.Period, config.Algorithm, tt.wantDigits, tt.wantPeriod, tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestConfig_Remaining(t *testing.T) {
+	config := &Config{Period: DefaultPeriod}
+	if got := config.Remaining(time.Unix(61, 0)); got != 29*time.Second {
+		t.Errorf("Remaining() = %v, want 29s", got)
+	}
+}
@@ -0,0 +1,122 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exposure describes whether a file could end up committed to a git repository
+type Exposure int
+
+const (
+	// NotInRepository means the file is outside any git work tree (or git is unavailable)
+	NotInRepository Exposure = iota
+	// Ignored means the file is covered by a .gitignore rule
+	Ignored
+	// Untracked means the file is not ignored and would be picked up by "git add"
+	Untracked
+	// Tracked means the file is already committed or staged
+	Tracked
+)
+
+// String returns a human readable description of the exposure
+func (e Exposure) String() string {
+	switch e {
+	case NotInRepository:
+		return "not in a git repository"
+	case Ignored:
+		return "ignored by git"
+	case Untracked:
+		return "not covered by .gitignore"
+	case Tracked:
+		return "tracked by git"
+	default:
+		return "unknown"
+	}
+}
+
+// Exposed reports whether the file could be committed
+func (e Exposure) Exposed() bool {
+	return e == Untracked || e == Tracked
+}
+
+// CheckExposure determines whether path is tracked, ignored or would be picked
+// up by git. The file does not need to exist.
+func CheckExposure(path string) (Exposure, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return NotInRepository, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return NotInRepository, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	dir, base := filepath.Dir(abs), filepath.Base(abs)
+
+	if err := git(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return NotInRepository, nil
+	}
+
+	if err := git(dir, "ls-files", "--error-unmatch", "--", base); err == nil {
+		return Tracked, nil
+	}
+
+	err = git(dir, "check-ignore", "-q", "--", base)
+	if err == nil {
+		return Ignored, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return Untracked, nil
+	}
+	return NotInRepository, fmt.Errorf("failed to check git status of %s: %w", path, err)
+}
+
+// git runs a git command in dir, discarding its output
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...) // #nosec G204 -- Fixed git subcommands with file path arguments
+	return cmd.Run()
+}
+
+// LineTimes returns, for each line of the committed or staged file at path,
+// when it was last changed according to git blame. Lines changed in the work
+// tree get the current time.
+func LineTimes(path string) ([]time.Time, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	cmd := exec.Command("git", "-C", filepath.Dir(abs), "blame", "--porcelain", "--", filepath.Base(abs)) // #nosec G204 -- Fixed git subcommand with a file path argument
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to blame %s: %w", path, err)
+	}
+
+	commits := make(map[string]time.Time)
+	var times []time.Time
+	commit := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			times = append(times, commits[commit])
+		case strings.HasPrefix(line, "committer-time "):
+			seconds, err := strconv.ParseInt(strings.TrimPrefix(line, "committer-time "), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse blame of %s: %w", path, err)
+			}
+			commits[commit] = time.Unix(seconds, 0)
+		default:
+			// Each line starts with a header naming its commit
+			if fields := strings.Fields(line); len(fields) >= 3 && len(fields[0]) >= 40 {
+				commit = fields[0]
+			}
+		}
+	}
+	return times, nil
+}
@@ -0,0 +1,121 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExposure(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	outside := t.TempDir()
+	exposure, err := CheckExposure(filepath.Join(outside, ".env"))
+	if err != nil {
+		t.Fatalf("CheckExposure() outside repository unexpected error: %v", err)
+	}
+	if exposure != NotInRepository {
+		t.Errorf("CheckExposure() outside repository = %v, want %v", exposure, NotInRepository)
+	}
+
+	repo := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", ".env.local\n")
+	write(".env", "KEY=value\n")
+	write(".env.local", "KEY=value\n")
+	write(".env.tracked", "KEY=value\n")
+	run("add", ".env.tracked")
+
+	tests := []struct {
+		file     string
+		expected Exposure
+	}{
+		{file: ".env.local", expected: Ignored},
+		{file: ".env", expected: Untracked},
+		{file: ".env.missing", expected: Untracked},
+		{file: ".env.tracked", expected: Tracked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			exposure, err := CheckExposure(filepath.Join(repo, tt.file))
+			if err != nil {
+				t.Fatalf("CheckExposure() unexpected error: %v", err)
+			}
+			if exposure != tt.expected {
+				t.Errorf("CheckExposure() = %v, want %v", exposure, tt.expected)
+			}
+			if exposure.Exposed() != (tt.expected == Untracked || tt.expected == Tracked) {
+				t.Errorf("Exposed() = %v for %v", exposure.Exposed(), exposure)
+			}
+		})
+	}
+}
+
+func TestLineTimes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	run := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), env...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run(nil, "init", "-q")
+	run(nil, "config", "user.email", "test@example.com")
+	run(nil, "config", "user.name", "test")
+
+	file := filepath.Join(repo, ".env")
+	if err := os.WriteFile(file, []byte("OLD=1\nKEPT=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := []string{"GIT_COMMITTER_DATE=2020-01-01T00:00:00Z", "GIT_AUTHOR_DATE=2020-01-01T00:00:00Z"}
+	run(old, "add", ".env")
+	run(old, "commit", "-q", "-m", "old")
+
+	if err := os.WriteFile(file, []byte("OLD=changed\nKEPT=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	recent := []string{"GIT_COMMITTER_DATE=2024-06-01T00:00:00Z", "GIT_AUTHOR_DATE=2024-06-01T00:00:00Z"}
+	run(recent, "commit", "-q", "-am", "recent")
+
+	times, err := LineTimes(file)
+	if err != nil {
+		t.Fatalf("LineTimes() unexpected error: %v", err)
+	}
+	want := []string{"2024-06-01", "2020-01-01"}
+	if len(times) != len(want) {
+		t.Fatalf("LineTimes() returned %d times, want %d", len(times), len(want))
+	}
+	for i, day := range want {
+		if got := times[i].UTC().Format("2006-01-02"); got != day {
+			t.Errorf("LineTimes()[%d] = %s, want %s", i, got, day)
+		}
+	}
+
+	if _, err := LineTimes(filepath.Join(t.TempDir(), ".env")); err == nil {
+		t.Error("LineTimes() expected error outside a repository")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/policy"
+	"github.com/almahoozi/envx/pkg/remote"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/vcs"
+	flag "github.com/spf13/pflag"
+)
+
+type policyCheckOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	Policy   string
+	JSON     bool
+}
+
+// policyReport is the result of policy check --json
+type policyReport struct {
+	File       string             `json:"file"`
+	Violations []policy.Violation `json:"violations"`
+}
+
+// enforce refuses writes that break the policy
+var enforce bool
+
+// policyNow is the time ages are measured from; tests replace it
+var policyNow = time.Now
+
+func newPolicyGroup() *group {
+	cmds := make(map[string]executor)
+
+	checkCmd := new(command[policyCheckOpts])
+	checkCmd.flags = flag.NewFlagSet("check", flag.ExitOnError)
+	checkCmd.flags.StringVarP(&checkCmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	checkCmd.flags.StringVarP(&checkCmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	checkCmd.flags.StringVarP(&checkCmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	checkCmd.flags.StringVarP(&checkCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	checkCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	checkCmd.flags.StringVar(&checkCmd.val.Policy, "policy", "", "Policy file to check against (default ENVX_POLICY or "+policy.DefaultFile+")")
+	checkCmd.flags.BoolVar(&checkCmd.val.JSON, "json", false, "Prints the violations as a JSON object")
+	checkCmd.fn = policyCheckCmdFn
+	cmds[checkCmd.flags.Name()] = checkCmd
+
+	return &group{name: "policy", cmds: cmds}
+}
+
+func policyCheckCmdFn(ctx context.Context, opts policyCheckOpts, args ...string) error {
+	p, path, err := loadPolicy(opts.Policy)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no policy found; create %s, set ENVX_POLICY or use --policy", path)
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadEnv(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+
+	var key []byte
+	if p.NeedsValues() && hasEncrypted(vars) {
+		if key, err = loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password); err != nil {
+			return fmt.Errorf("error loading key: %w", err)
+		}
+		defer secure.Zero(key)
+	}
+
+	values, err := policyValues(ctx, file, vars, key, p.NeedsAge())
+	if err != nil {
+		return err
+	}
+	violations := p.Check(values)
+	if opts.JSON {
+		if err := writeJSON(os.Stdout, policyReport{File: file, Violations: append([]policy.Violation{}, violations...)}); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range violations {
+			fmt.Printf("%s: %s\n", file, v)
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("found %d policy violation(s) in %s", len(violations), file)
+	}
+	return nil
+}
+
+// enforcePolicy refuses to write vars to file when --enforce or
+// ENVX_POLICY_ENFORCE=true is set and they break the policy. Values are
+// decrypted with key to check their entropy; with no key only plaintext
+// values are. Ages are not checked, since a write is not what makes a value
+// old.
+func enforcePolicy(ctx context.Context, file string, vars env.Variables, key []byte) error {
+	enabled, err := policyEnforced()
+	if err != nil || !enabled {
+		return err
+	}
+	p, path, err := loadPolicy("")
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("policy enforcement is on but there is no policy; create %s or set ENVX_POLICY", path)
+	}
+
+	values, err := policyValues(ctx, file, vars, key, false)
+	if err != nil {
+		return err
+	}
+	if err := policy.Enforce(p.Check(values)); err != nil {
+		return fmt.Errorf("refusing to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// policyEnforced reports whether writes are checked against the policy
+func policyEnforced() (bool, error) {
+	if enforce {
+		return true, nil
+	}
+	value := os.Getenv("ENVX_POLICY_ENFORCE")
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ENVX_POLICY_ENFORCE value %q: %w", value, err)
+	}
+	return enabled, nil
+}
+
+// loadPolicy loads the policy at path, ENVX_POLICY or the default policy
+// file. It returns a nil policy if the default file does not exist, along
+// with the path that was looked for.
+func loadPolicy(path string) (*policy.Policy, string, error) {
+	if path == "" {
+		path = os.Getenv("ENVX_POLICY")
+	}
+	if path == "" {
+		path = policy.DefaultFile
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, path, nil
+		}
+	}
+	p, err := policy.Load(path)
+	return p, path, err
+}
+
+// hasEncrypted reports whether any value in vars is encrypted
+func hasEncrypted(vars env.Variables) bool {
+	encryptor := crypto.NewAESEncryptor()
+	for _, v := range vars {
+		if encryptor.IsEncrypted(v.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyValues describes vars for the policy. With a key, encrypted values
+// are decrypted; with ages, the age of each value is taken from git blame
+// when file is tracked by git.
+func policyValues(ctx context.Context, file string, vars env.Variables, key []byte, ages bool) ([]policy.Value, error) {
+	encryptor := newEncryptor(ctx)
+	values := make([]policy.Value, len(vars))
+	for i, v := range vars {
+		values[i] = policy.Value{Key: v.Key, Value: v.Value, Encrypted: encryptor.IsEncrypted(v.Value)}
+		if values[i].Encrypted {
+			values[i].Value = ""
+		}
+	}
+
+	if key != nil {
+		decrypted := append(env.Variables(nil), vars...)
+		if err := decrypted.DecryptAll(ctx, encryptor, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i, v := range decrypted {
+			if values[i].Encrypted {
+				values[i].Key, values[i].Value, values[i].Decrypted = v.Key, v.Value, true
+			}
+		}
+	}
+
+	if ages {
+		lineAges, err := valueAges(file)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vars {
+			if age, ok := lineAges[v.Key]; ok {
+				values[i].Age, values[i].AgeKnown = age, true
+			}
+		}
+	}
+	return values, nil
+}
+
+// valueAges returns how long the line holding each key of file, in the
+// section selected with --env, has gone unchanged according to git. Files
+// that are not tracked by git have no known ages.
+func valueAges(file string) (map[string]time.Duration, error) {
+	if file == stdinFile || remote.IsURL(file) || remote.IsObjectURI(file) {
+		return nil, nil
+	}
+	if exposure, err := vcs.CheckExposure(file); err != nil || exposure != vcs.Tracked {
+		if verbose {
+			diagf("Warning: %s is not tracked by git; skipping max_age checks\n", file)
+		}
+		return nil, nil
+	}
+
+	times, err := vcs.LineTimes(file)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s file: %w", file, err)
+	}
+
+	ages := make(map[string]time.Duration)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 0; scanner.Scan() && line < len(times); line++ {
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), env.ByteOrderMark))
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		if section != envSection || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, _, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		name = strings.TrimSpace(name)
+		if _, seen := ages[name]; !ok || name == "" || seen {
+			continue
+		}
+		ages[name] = max(policyNow().Sub(times[line]), 0)
+	}
+	return ages, nil
+}
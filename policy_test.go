@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/policy"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), policy.DefaultFile)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPolicyCheck(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	path := writePolicy(t, `{"rules": [{"name": "secrets", "keys": ["*_SECRET"], "encrypted": true, "min_entropy": 40}]}`)
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_SECRET=aaaa\nDB_SECRET=q8Xv2LmZ4pRt7YwK\nPORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptCmd(context.Background(), encryptOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, Write: true}, "DB_SECRET"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := policyCheckOpts{File: envFile, KeyStore: "mock", Policy: path}
+	out, err := captureStdout(t, func() error {
+		return policyCheckCmdFn(context.Background(), opts)
+	})
+	if err == nil {
+		t.Fatal("policyCheckCmdFn() expected error for violations")
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "API_SECRET: value must be encrypted") || !strings.Contains(lines[1], "API_SECRET: value has about") {
+		t.Errorf("policyCheckCmdFn() printed %q", out)
+	}
+
+	if err := encryptCmd(context.Background(), encryptOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, Write: true}, "API_SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "API_SECRET=Zt4k9Qw2Lx7Pv3Rm"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(t, func() error { return policyCheckCmdFn(context.Background(), opts) }); err != nil {
+		t.Errorf("policyCheckCmdFn() unexpected error for a compliant file: %v", err)
+	}
+
+	t.Chdir(t.TempDir())
+	t.Setenv("ENVX_POLICY", "")
+	if err := policyCheckCmdFn(context.Background(), policyCheckOpts{File: envFile, KeyStore: "mock"}); err == nil {
+		t.Error("policyCheckCmdFn() expected error without a policy")
+	}
+}
+
+func TestEnforcePolicy(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	t.Setenv("ENVX_POLICY", writePolicy(t, `{"rules": [{"keys": ["*_SECRET"], "min_entropy": 40}]}`))
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without enforcement weak values are written
+	set := func(arg string) error {
+		return setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, arg)
+	}
+	if err := set("WEAK_SECRET=password"); err != nil {
+		t.Fatalf("setCmdFn() unexpected error: %v", err)
+	}
+
+	t.Setenv("ENVX_POLICY_ENFORCE", "true")
+	before, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set("API_SECRET=changeme"); !errors.Is(err, policy.ErrViolations) {
+		t.Errorf("setCmdFn() = %v, want a policy violation", err)
+	}
+	after, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("setCmdFn() wrote a file that breaks the policy")
+	}
+}
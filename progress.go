@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// noProgress disables progress indicators
+var noProgress bool
+
+// progressDelay is how long an operation runs before its indicator appears,
+// so fast operations never flicker
+var progressDelay = 300 * time.Millisecond
+
+// stderrIsTerminal reports whether stderr is attached to a terminal. Tests
+// replace it to exercise progress output.
+var stderrIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+var progressFrames = []string{"|", "/", "-", "\\"}
+
+// progress is a spinner shown on stderr while a slow operation runs
+type progress struct {
+	label string
+	total int
+	start time.Time
+	done  atomic.Int64
+
+	w       io.Writer
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// startProgress shows label with a spinner and the elapsed time on stderr
+// until Stop is called, counting Step calls out of total when total is
+// positive. Nothing is shown unless stderr is a terminal and neither --quiet
+// nor --no-progress is set, or if the operation ends within progressDelay.
+// With --verbose, Stop reports how long the operation took.
+func startProgress(label string, total int) *progress {
+	p := &progress{label: label, total: total, start: time.Now(), w: os.Stderr}
+	if quiet || noProgress || !stderrIsTerminal() {
+		return p
+	}
+
+	p.stop = make(chan struct{})
+	p.stopped.Add(1)
+	go p.run()
+	return p
+}
+
+// Step records that one of total items is done
+func (p *progress) Step() {
+	p.done.Add(1)
+}
+
+// Stop removes the indicator
+func (p *progress) Stop() {
+	p.once.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+			p.stopped.Wait()
+		}
+		if verbose {
+			diagf("%s took %s\n", p.label, time.Since(p.start).Round(time.Millisecond))
+		}
+	})
+}
+
+func (p *progress) run() {
+	defer p.stopped.Done()
+
+	select {
+	case <-p.stop:
+		return
+	case <-time.After(progressDelay):
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		line := fmt.Sprintf("%s %s", progressFrames[frame%len(progressFrames)], p.label)
+		if p.total > 0 {
+			line += fmt.Sprintf(" %d/%d", p.done.Load(), p.total)
+		}
+		line += fmt.Sprintf(" (%.1fs)", time.Since(p.start).Seconds())
+		_, _ = fmt.Fprintf(p.w, "\r\x1b[K%s", line)
+
+		select {
+		case <-p.stop:
+			_, _ = fmt.Fprint(p.w, "\r\x1b[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// withProgress runs fn with a progress indicator labelled label
+func withProgress[T any](label string, fn func() (T, error)) (T, error) {
+	p := startProgress(label, 0)
+	defer p.Stop()
+	return fn()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	originalTerminal, originalDelay := stderrIsTerminal, progressDelay
+	defer func() { stderrIsTerminal, progressDelay = originalTerminal, originalDelay }()
+	progressDelay = 0
+
+	tests := []struct {
+		name       string
+		terminal   bool
+		noProgress bool
+		verbose    bool
+		want       []string
+		wantEmpty  bool
+	}{
+		{name: "terminal", terminal: true, want: []string{"Encrypting 2/3", "\r\x1b[K"}},
+		{name: "pipe", terminal: false, wantEmpty: true},
+		{name: "--no-progress", terminal: true, noProgress: true, wantEmpty: true},
+		{name: "--verbose timing", terminal: false, verbose: true, want: []string{"Encrypting took "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderrIsTerminal = func() bool { return tt.terminal }
+			noProgress, verbose = tt.noProgress, tt.verbose
+			defer func() { noProgress, verbose = false, false }()
+
+			out, _ := captureStderr(t, func() error {
+				p := startProgress("Encrypting", 3)
+				p.Step()
+				p.Step()
+				time.Sleep(50 * time.Millisecond)
+				p.Stop()
+				p.Stop()
+				return nil
+			})
+			if tt.wantEmpty && out != "" {
+				t.Errorf("startProgress() printed %q, want nothing", out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("startProgress() printed %q, want it to contain %q", out, want)
+				}
+			}
+		})
+	}
+}
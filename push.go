@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/push"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type pushOpts struct {
+	Name        string
+	File        string
+	KeyStore    string
+	Password    string
+	Provider    string
+	App         string
+	Environment string
+	Prune       bool
+}
+
+// pushRun runs the platform CLIs; tests replace it
+var pushRun push.Runner
+
+// newPushCmd builds the "push" command, which sets the decrypted variables as
+// config vars on a hosting platform
+func newPushCmd() *command[pushOpts] {
+	cmd := new(command[pushOpts])
+	cmd.flags = flag.NewFlagSet("push", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.StringVar(&cmd.val.Provider, "provider", "", "Platform to push to: "+strings.Join(push.Providers, ", "))
+	cmd.flags.StringVarP(&cmd.val.App, "app", "a", "", "Heroku or Fly.io app (default from the platform CLI)")
+	cmd.flags.StringVar(&cmd.val.Environment, "environment", "production", "Vercel environment: production, preview or development")
+	cmd.flags.BoolVar(&cmd.val.Prune, "prune", false, "Removes config vars that are not in the env file")
+	cmd.fn = pushCmdFn
+	return cmd
+}
+
+func pushCmdFn(ctx context.Context, opts pushOpts, args ...string) error {
+	if opts.Provider == "" {
+		return fmt.Errorf("missing --provider (supported: %s)", strings.Join(push.Providers, ", "))
+	}
+	if opts.Prune && len(args) > 0 {
+		return fmt.Errorf("--prune cannot be used when pushing selected variables")
+	}
+	provider, err := push.New(opts.Provider, push.Config{App: opts.App, Environment: opts.Environment, Run: pushRun})
+	if err != nil {
+		return err
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadResolvedEnv(ctx, file)
+	if err != nil {
+		return fmt.Errorf("error loading env file: %w", err)
+	}
+	if vars, err = selectVars(vars, args, file); err != nil {
+		return err
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	if err := vars.DecryptAll(ctx, newEncryptor(ctx), key); err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	if err := auditAccess("push", file, opts.KeyStore, opts.Password, varKeys(vars)); err != nil {
+		return err
+	}
+
+	remote, err := provider.List()
+	if err != nil {
+		return fmt.Errorf("error listing %s config vars: %w", opts.Provider, err)
+	}
+	plan := push.NewPlan(vars, remote, opts.Prune)
+
+	fmt.Fprint(os.Stderr, plan)
+	if len(plan.Kept) > 0 {
+		diagf("Keeping %d config vars not in %s (use --prune to remove): %s\n", len(plan.Kept), file, strings.Join(plan.Kept, ", "))
+	}
+	if len(plan.Changes) == 0 {
+		diagf("Nothing to push\n")
+		return nil
+	}
+	if dryRun {
+		return nil
+	}
+	if err := confirm(fmt.Sprintf("Push %d changes to %s?", len(plan.Changes), opts.Provider)); err != nil {
+		return err
+	}
+	if err := provider.Apply(plan); err != nil {
+		return fmt.Errorf("error pushing to %s: %w", opts.Provider, err)
+	}
+	return nil
+}
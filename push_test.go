@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestPushCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "s3cret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_KEY="+secret+"\nPORT=8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	original := pushRun
+	defer func() { pushRun = original }()
+
+	tests := []struct {
+		name      string
+		opts      pushOpts
+		args      []string
+		dryRun    bool
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name: "sets changed and new values",
+			opts: pushOpts{Provider: "heroku", App: "api"},
+			wantCalls: []string{
+				"heroku config --json --app api",
+				"heroku config:set API_KEY=s3cret --app api",
+			},
+		},
+		{
+			name: "prunes removed keys",
+			opts: pushOpts{Provider: "heroku", Prune: true},
+			wantCalls: []string{
+				"heroku config --json",
+				"heroku config:set API_KEY=s3cret",
+				"heroku config:unset OLD",
+			},
+		},
+		{
+			name:      "selected variables",
+			opts:      pushOpts{Provider: "heroku"},
+			args:      []string{"PORT"},
+			wantCalls: []string{"heroku config --json"},
+		},
+		{
+			name:      "dry run only previews",
+			opts:      pushOpts{Provider: "heroku"},
+			dryRun:    true,
+			wantCalls: []string{"heroku config --json"},
+		},
+		{name: "missing provider", wantErr: true},
+		{name: "unknown provider", opts: pushOpts{Provider: "netlify"}, wantErr: true},
+		{name: "prune with selected variables", opts: pushOpts{Provider: "heroku", Prune: true}, args: []string{"PORT"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			pushRun = func(stdin []byte, name string, args ...string) ([]byte, error) {
+				calls = append(calls, name+" "+strings.Join(args, " "))
+				return []byte(`{"PORT":"8080","OLD":"x"}`), nil
+			}
+			dryRun = tt.dryRun
+			defer func() { dryRun = false }()
+
+			tt.opts.File = envFile
+			tt.opts.KeyStore = "mock"
+			err := pushCmdFn(context.Background(), tt.opts, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pushCmdFn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/qr"
+	"github.com/almahoozi/envx/pkg/secure"
+)
+
+// getQRCmdFn prints the decrypted value of a single variable as a QR code,
+// for moving it to a phone or another machine without a network channel
+func getQRCmdFn(ctx context.Context, opts getOpts, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("--qr needs exactly one variable")
+	}
+	if !stdoutIsTerminal() && !assumeYes {
+		return fmt.Errorf("refusing to print a QR code when stdout is not a terminal; use --yes to override")
+	}
+	name := args[0]
+	file := env.BuildFilename(opts.File, opts.Name)
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	lazy, err := loadLazyEnv(ctx, file, newEncryptor(ctx), key)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	value, exists, err := lazy.Get(name)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	if !exists {
+		return fmt.Errorf("variable %s not found in %s file", name, file)
+	}
+	if err := auditAccess("get", file, opts.KeyStore, opts.Password, []string{name}); err != nil {
+		return err
+	}
+
+	data := []byte(value)
+	defer secure.Zero(data)
+	return writeQR(data, name)
+}
+
+// writeQR prints data as a QR code on stdout; what names it in errors
+func writeQR(data []byte, what string) error {
+	code, err := qr.Encode(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", what, err)
+	}
+	return code.Render(os.Stdout)
+}
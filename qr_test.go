@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetQRCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_TOKEN=abc123\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, QR: true}
+
+	// Output that is not a terminal is refused unless confirmed
+	if err := getCmdFn(context.Background(), opts, "API_TOKEN"); err == nil {
+		t.Error("getCmdFn() --qr expected an error when stdout is not a terminal")
+	}
+
+	assumeYes = true
+	defer func() { assumeYes = false }()
+
+	output, err := captureStdout(t, func() error {
+		return getCmdFn(context.Background(), opts, "API_TOKEN")
+	})
+	if err != nil {
+		t.Fatalf("getCmdFn() --qr unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "█") || strings.Contains(output, "abc123") {
+		t.Errorf("getCmdFn() --qr output does not look like a QR code:\n%s", output)
+	}
+
+	for _, args := range [][]string{nil, {"API_TOKEN", "OTHER"}, {"MISSING"}} {
+		if err := getCmdFn(context.Background(), opts, args...); err == nil {
+			t.Errorf("getCmdFn(%v) --qr expected error", args)
+		}
+	}
+}
+
+func TestKeyExportQR(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := keyExportOpts{KeyStore: "mock", QR: true}
+
+	if err := keyExportCmdFn(context.Background(), opts); err == nil {
+		t.Error("keyExportCmdFn() --qr expected an error when stdout is not a terminal")
+	}
+
+	assumeYes = true
+	defer func() { assumeYes = false }()
+
+	output, err := captureStdout(t, func() error {
+		return keyExportCmdFn(context.Background(), opts)
+	})
+	if err != nil {
+		t.Fatalf("keyExportCmdFn() --qr unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "█") || strings.Contains(output, hex.EncodeToString(key)) {
+		t.Errorf("keyExportCmdFn() --qr output does not look like a QR code:\n%s", output)
+	}
+
+	if err := keyExportCmdFn(context.Background(), keyExportOpts{KeyStore: "mock", QR: true, Paper: true}); err == nil {
+		t.Error("keyExportCmdFn() with --qr and --paper expected error")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+// redactMask replaces secret values in the output of a program run with
+// --redact
+const redactMask = "****"
+
+// redactedValues returns the distinct values of vars at least minLength
+// bytes long, longest first. Shorter values such as ports and flags would
+// mask too much unrelated output.
+func redactedValues(vars env.Variables, minLength int) []string {
+	var values []string
+	for _, v := range vars {
+		if len(v.Value) >= minLength && len(v.Value) > 0 && !slices.Contains(values, v.Value) {
+			values = append(values, v.Value)
+		}
+	}
+	slices.SortStableFunc(values, func(a, b string) int { return len(b) - len(a) })
+	return values
+}
+
+// redactingWriter masks secret values in what is written through it. A
+// value may be split across writes, so output that could be the start of
+// one is held back until the next write or Flush shows it is not.
+type redactingWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newRedactingWriter(w io.Writer, secrets []string) *redactingWriter {
+	r := &redactingWriter{w: w}
+	for _, s := range secrets {
+		r.secrets = append(r.secrets, []byte(s))
+	}
+	return r
+}
+
+// Write masks the secrets in p, always reporting all of p as written
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, p...)
+	out, rest := r.redact(r.pending, false)
+	r.pending = append(r.pending[:0], rest...)
+	if len(out) > 0 {
+		if _, err := r.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes out whatever is held back
+func (r *redactingWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, _ := r.redact(r.pending, true)
+	r.pending = r.pending[:0]
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(out)
+	return err
+}
+
+// redact returns buf with the secrets masked, up to the first byte that may
+// start a secret continuing past the end of buf, and the rest. With final
+// set nothing is held back.
+func (r *redactingWriter) redact(buf []byte, final bool) ([]byte, []byte) {
+	var out bytes.Buffer
+	i := 0
+scan:
+	for i < len(buf) {
+		for _, s := range r.secrets {
+			if bytes.HasPrefix(buf[i:], s) {
+				out.WriteString(redactMask)
+				i += len(s)
+				continue scan
+			}
+		}
+		if !final {
+			for _, s := range r.secrets {
+				if len(buf)-i < len(s) && bytes.HasPrefix(s, buf[i:]) {
+					return out.Bytes(), buf[i:]
+				}
+			}
+		}
+		out.WriteByte(buf[i])
+		i++
+	}
+	return out.Bytes(), nil
+}
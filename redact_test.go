@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+func TestRedactedValues(t *testing.T) {
+	vars := env.Variables{{Key: "PORT", Value: "8080"}, {Key: "TOKEN", Value: "abcdef"}, {Key: "KEY", Value: "longer-secret"}, {Key: "COPY", Value: "abcdef"}}
+	if got, want := redactedValues(vars, 6), []string{"longer-secret", "abcdef"}; !slices.Equal(got, want) {
+		t.Errorf("redactedValues() = %q, want %q", got, want)
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"whole", []string{"token=hunter22 ok\n"}, "token=**** ok\n"},
+		{"split", []string{"token=hun", "ter22 ok\n"}, "token=**** ok\n"},
+		{"byte by byte", strings.Split("a hunter22 b", ""), "a **** b"},
+		{"prefix only", []string{"hunt", "ing\n"}, "hunting\n"},
+		{"prefix at end", []string{"ends with hunter2"}, "ends with hunter2"},
+		{"longest first", []string{"hunter22-extra hunter22"}, "**** ****"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := newRedactingWriter(&out, []string{"hunter22-extra", "hunter22"})
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSpawnRedact(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	var stdout string
+	stderr, err := captureStderr(t, func() error {
+		var err error
+		stdout, err = captureStdout(t, func() error {
+			script := `echo "connecting with s3cr3t-value"; echo "failed: s3cr3t-value" >&2`
+			return spawn(context.Background(), sh, []string{"sh", "-c", script}, 0, time.Second, []string{"s3cr3t-value"})
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("spawn() error = %v", err)
+	}
+	if stdout != "connecting with ****\n" || stderr != "failed: ****\n" {
+		t.Errorf("spawn() stdout = %q, stderr = %q, want the secret masked", stdout, stderr)
+	}
+}
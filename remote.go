@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/remote"
+)
+
+// loadRemoteEnv fetches an env file from a URL, or takes the cached copy with
+// --offline, and parses it in memory
+func loadRemoteEnv(ctx context.Context, url string) (env.Variables, error) {
+	headers, err := remoteHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(url, "http://") {
+		diagf("Warning: fetching %s without TLS\n", url)
+	}
+
+	fetcher := remote.NewFetcher(&remote.FetcherConfig{Headers: headers, Offline: offline})
+	body, err := withProgress("Fetching "+url, func() ([]byte, error) {
+		return fetcher.Fetch(ctx, url)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loadEnvContents(bytes.NewReader(body), url)
+}
+
+// loadObjectEnv reads an env file kept in S3 or GCS and parses it in memory
+func loadObjectEnv(uri string) (env.Variables, error) {
+	data, err := readObject(uri)
+	if err != nil {
+		return nil, err
+	}
+	return loadEnvContents(bytes.NewReader(data), uri)
+}
+
+// remoteHeaders returns the headers sent when fetching env files, given in
+// ENVX_HTTP_HEADERS as "Name: value" lines, e.g. an Authorization header
+func remoteHeaders() (http.Header, error) {
+	headers := http.Header{}
+	for _, line := range strings.Split(os.Getenv("ENVX_HTTP_HEADERS"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header in ENVX_HTTP_HEADERS: expected \"Name: value\"")
+		}
+		headers.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestGet_Remote(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("ENVX_HTTP_HEADERS", "Authorization: Bearer token\nX-Team: platform")
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "s3cret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Team") != "platform" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/.env":
+			w.Header().Set("ETag", `"1"`)
+			_, _ = w.Write([]byte("API_KEY=" + secret + "\n"))
+		case "/include.env":
+			_, _ = w.Write([]byte("# envx:include .env.shared\nA=1\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	get := func(file string) (string, error) {
+		return captureStdout(t, func() error {
+			return getCmdFn(context.Background(), getOpts{File: file, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "API_KEY")
+		})
+	}
+
+	output, err := get(server.URL + "/.env")
+	if err != nil {
+		t.Fatalf("get unexpected error: %v", err)
+	}
+	if strings.TrimSpace(output) != "API_KEY=s3cret" {
+		t.Errorf("get output = %q, want API_KEY=s3cret", output)
+	}
+	for _, path := range []string{"/missing.env", "/include.env"} {
+		if _, err := get(server.URL + path); err == nil {
+			t.Errorf("get %s expected error", path)
+		}
+	}
+
+	server.Close()
+	offline = true
+	defer func() { offline = false }()
+	output, err = get(server.URL + "/.env")
+	if err != nil {
+		t.Fatalf("get --offline unexpected error: %v", err)
+	}
+	if strings.TrimSpace(output) != "API_KEY=s3cret" {
+		t.Errorf("get --offline output = %q, want API_KEY=s3cret", output)
+	}
+}
+
+func TestRemoteHeaders(t *testing.T) {
+	t.Setenv("ENVX_HTTP_HEADERS", "authorization: Bearer x\n\n  private-token:abc  \n")
+	headers, err := remoteHeaders()
+	if err != nil {
+		t.Fatalf("remoteHeaders() unexpected error: %v", err)
+	}
+	if headers.Get("Authorization") != "Bearer x" || headers.Get("Private-Token") != "abc" {
+		t.Errorf("remoteHeaders() = %v", headers)
+	}
+
+	for _, invalid := range []string{"no colon", ": empty name", "two words: x"} {
+		t.Setenv("ENVX_HTTP_HEADERS", invalid)
+		if _, err := remoteHeaders(); err == nil {
+			t.Errorf("remoteHeaders(%q) expected error", invalid)
+		}
+	}
+}
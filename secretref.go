@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secretref"
+)
+
+// secretRefs resolves values referring to other secret managers; tests
+// replace it
+var secretRefs = secretref.NewRegistry(nil)
+
+// resolveSecretRefs replaces the decrypted values of vars that refer to a
+// secret in another secret manager, such as op://vault/item/field, with the
+// secret when ENVX_RESOLVE_REFS=true, and otherwise leaves them as they are.
+func resolveSecretRefs(vars env.Variables) error {
+	for i := range vars {
+		value, err := resolveSecretRef(vars[i].Value)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", vars[i].Key, err)
+		}
+		vars[i].Value = value
+	}
+	return nil
+}
+
+// unresolvedNotice tells once per command that references are left as they
+// are
+var unresolvedNotice sync.Once
+
+// resolveSecretRef returns the secret value refers to, or value itself when
+// it is not a reference or resolving is not enabled. Resolving runs the
+// secret managers' CLIs, which an env file from elsewhere must not trigger
+// on its own, so it is opt-in.
+func resolveSecretRef(value string) (string, error) {
+	if !secretRefs.IsReference(value) {
+		return value, nil
+	}
+	resolve := false
+	if setting := os.Getenv("ENVX_RESOLVE_REFS"); setting != "" {
+		var err error
+		if resolve, err = strconv.ParseBool(setting); err != nil {
+			return "", fmt.Errorf("invalid ENVX_RESOLVE_REFS value %q: %w", setting, err)
+		}
+	}
+	if !resolve {
+		unresolvedNotice.Do(func() {
+			diagf("Note: leaving secret references unresolved; set ENVX_RESOLVE_REFS=true to resolve them\n")
+		})
+		return value, nil
+	}
+	if offline {
+		return "", fmt.Errorf("cannot resolve %s while offline", value)
+	}
+	return secretRefs.Resolve(value)
+}
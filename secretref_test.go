@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/secretref"
+)
+
+func TestGetResolvesSecretRefs(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	original := secretRefs
+	defer func() { secretRefs = original }()
+	secretRefs = secretref.NewRegistry(func(name string, args ...string) ([]byte, error) {
+		return []byte("from-" + name), nil
+	})
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("DB_PASSWORD=op://prod/db/password\nPORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_RESOLVE_REFS", "true")
+	get := func(args ...string) string {
+		t.Helper()
+		output, err := captureStdout(t, func() error {
+			return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, args...)
+		})
+		if err != nil {
+			t.Fatalf("getCmdFn() error = %v", err)
+		}
+		return output
+	}
+
+	if got, want := get(), "DB_PASSWORD=from-op\nPORT=8080\n"; got != want {
+		t.Errorf("get = %q, want %q", got, want)
+	}
+	if got, want := get("DB_PASSWORD"), "DB_PASSWORD=from-op\n"; got != want {
+		t.Errorf("get DB_PASSWORD = %q, want %q", got, want)
+	}
+
+	// Resolving is opt-in
+	for _, setting := range []string{"false", ""} {
+		t.Setenv("ENVX_RESOLVE_REFS", setting)
+		if got, want := get("DB_PASSWORD"), "DB_PASSWORD=op://prod/db/password\n"; got != want {
+			t.Errorf("get with ENVX_RESOLVE_REFS=%q = %q, want %q", setting, got, want)
+		}
+	}
+
+	t.Setenv("ENVX_RESOLVE_REFS", "true")
+	offline = true
+	defer func() { offline = false }()
+	err := getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "DB_PASSWORD")
+	if err == nil {
+		t.Error("getCmdFn() offline expected error resolving a reference")
+	}
+}
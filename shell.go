@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"syscall"
+
+	"github.com/almahoozi/envx/pkg/env"
+	flag "github.com/spf13/pflag"
+)
+
+type shellOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	Shell    string
+	NoPrompt bool
+
+	RequireEncrypted    bool
+	IgnoreDecryptErrors bool
+}
+
+// newShellCmd builds the "shell" command, which starts an interactive shell
+// with the decrypted variables exported, like an activated virtualenv
+func newShellCmd() *command[shellOpts] {
+	cmd := new(command[shellOpts])
+	cmd.flags = flag.NewFlagSet("shell", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.StringVarP(&cmd.val.Shell, "shell", "s", "", "Shell to start (default $SHELL, or /bin/sh)")
+	cmd.flags.BoolVar(&cmd.val.NoPrompt, "no-prompt", false, "Leaves the shell prompt unchanged")
+	cmd.flags.BoolVar(&cmd.val.RequireEncrypted, "require-encrypted", false, "Refuses to start if secret-like keys hold plaintext values")
+	cmd.flags.BoolVar(&cmd.val.IgnoreDecryptErrors, "ignore-decrypt-errors", false, "Skips variables that cannot be decrypted, with a warning, instead of failing")
+	cmd.fn = shellCmdFn
+	return cmd
+}
+
+func shellCmdFn(ctx context.Context, opts shellOpts, args ...string) error {
+	if active := os.Getenv("ENVX_SHELL"); active != "" {
+		return fmt.Errorf("already in an envx shell for %s; exit it first", active)
+	}
+
+	shell := opts.Shell
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	exe, err := exec.LookPath(shell)
+	if err != nil {
+		return fmt.Errorf("shell not found: %s", shell)
+	}
+
+	vars, err := loadRunEnv(ctx, runOpts{
+		Name:                opts.Name,
+		File:                opts.File,
+		KeyStore:            opts.KeyStore,
+		Password:            opts.Password,
+		RequireEncrypted:    opts.RequireEncrypted,
+		IgnoreDecryptErrors: opts.IgnoreDecryptErrors,
+	}, "shell")
+	if err != nil {
+		return err
+	}
+
+	label := shellLabel(env.BuildFilename(opts.File, opts.Name))
+	environ := os.Environ()
+	for _, v := range vars {
+		environ = append(environ, v.Key+"="+v.Value)
+	}
+	environ = append(environ, "ENVX_SHELL="+label)
+
+	shellArgs := []string{exe}
+	if !opts.NoPrompt {
+		dir, err := os.MkdirTemp("", "envx-shell-")
+		if err != nil {
+			return fmt.Errorf("error preparing shell prompt: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		extraArgs, extraEnv, err := promptSetup(exe, label, dir)
+		if err != nil {
+			return err
+		}
+		shellArgs = append(shellArgs, extraArgs...)
+		environ = append(environ, extraEnv...)
+	}
+
+	diagf("envx: started %s with %d variables from %s; exit to leave\n", filepath.Base(exe), len(vars), label)
+	return runShell(exe, shellArgs, environ)
+}
+
+// runShell runs the shell in the foreground and returns its exit status as
+// an *exitError. Interrupts typed at the prompt go to the shell, not envx.
+func runShell(exe string, args, environ []string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	cmd := exec.Command(exe, args[1:]...) // #nosec G204 -- Intentional execution of the user's shell
+	cmd.Args = args
+	cmd.Env = environ
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &exitError{code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return fmt.Errorf("error running %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// unsafeLabelChars matches characters kept out of the prompt label, which is
+// written into shell startup code
+var unsafeLabelChars = regexp.MustCompile(`[^A-Za-z0-9._\-\[\]]`)
+
+// shellLabel returns the name the prompt shows for the active env file
+func shellLabel(file string) string {
+	label := filepath.Base(file)
+	if envSection != "" {
+		label += "[" + envSection + "]"
+	}
+	return unsafeLabelChars.ReplaceAllString(label, "_")
+}
+
+// promptSetup returns the extra arguments and environment that make shell
+// prefix its prompt with label, after the user's own startup files have run.
+// Files it needs are created in dir.
+func promptSetup(shell, label, dir string) ([]string, []string, error) {
+	prefix := "(envx:" + label + ") "
+
+	switch filepath.Base(shell) {
+	case "bash":
+		rc := filepath.Join(dir, "bashrc")
+		content := "[ -f ~/.bashrc ] && . ~/.bashrc\nPS1='" + prefix + "'\"$PS1\"\n"
+		if err := os.WriteFile(rc, []byte(content), 0600); err != nil {
+			return nil, nil, fmt.Errorf("error preparing shell prompt: %w", err)
+		}
+		return []string{"--rcfile", rc, "-i"}, nil, nil
+	case "zsh":
+		// zsh reads its startup files from $ZDOTDIR; ours source the user's
+		// and then restore it
+		original := os.Getenv("ZDOTDIR")
+		if original == "" {
+			original = os.Getenv("HOME")
+		}
+		files := map[string]string{
+			".zshenv": "[ -f \"$ENVX_ZDOTDIR/.zshenv\" ] && . \"$ENVX_ZDOTDIR/.zshenv\"\n",
+			".zshrc": "ZDOTDIR=\"$ENVX_ZDOTDIR\"\nunset ENVX_ZDOTDIR\n[ -f \"$ZDOTDIR/.zshrc\" ] && . \"$ZDOTDIR/.zshrc\"\n" +
+				"PROMPT='" + prefix + "'\"$PROMPT\"\n",
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				return nil, nil, fmt.Errorf("error preparing shell prompt: %w", err)
+			}
+		}
+		return []string{"-i"}, []string{"ENVX_ZDOTDIR=" + original, "ZDOTDIR=" + dir}, nil
+	case "fish":
+		init := "functions -c fish_prompt _envx_fish_prompt; function fish_prompt; echo -n '" + prefix + "'; _envx_fish_prompt; end"
+		return []string{"-i", "-C", init}, nil, nil
+	default:
+		ps1 := os.Getenv("PS1")
+		if ps1 == "" {
+			ps1 = "$ "
+		}
+		return []string{"-i"}, []string{"PS1=" + prefix + ps1}, nil
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env.staging")
+	if err := os.WriteFile(envFile, []byte("API_URL=https://staging.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stand-in shell that records its arguments and environment
+	out := filepath.Join(dir, "out")
+	fake := filepath.Join(dir, "fakesh")
+	script := "#!/bin/sh\necho \"$@\" > " + out + "\nenv >> " + out + "\nexit 3\n"
+	if err := os.WriteFile(fake, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ENVX_SHELL", "")
+	t.Setenv("PS1", "% ")
+	err := shellCmdFn(context.Background(), shellOpts{File: filepath.Join(dir, ".env"), Name: "staging", KeyStore: "mock", Shell: fake})
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != 3 {
+		t.Fatalf("shellCmdFn() error = %v, want exit status 3", err)
+	}
+
+	recorded, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-i\n", "API_URL=https://staging.example.com\n", "ENVX_SHELL=.env.staging\n", "PS1=(envx:.env.staging) % \n"} {
+		if !strings.Contains(string(recorded), want) {
+			t.Errorf("shell output missing %q:\n%s", want, recorded)
+		}
+	}
+
+	// Nested shells are refused
+	t.Setenv("ENVX_SHELL", ".env")
+	if err := shellCmdFn(context.Background(), shellOpts{File: envFile, KeyStore: "mock", Shell: fake}); err == nil || !strings.Contains(err.Error(), "already in an envx shell") {
+		t.Errorf("shellCmdFn() nested error = %v", err)
+	}
+}
+
+func TestPromptSetup(t *testing.T) {
+	dir := t.TempDir()
+
+	args, _, err := promptSetup("/bin/bash", ".env", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || args[0] != "--rcfile" {
+		t.Fatalf("promptSetup(bash) args = %v", args)
+	}
+	rc, err := os.ReadFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rc), ". ~/.bashrc") || !strings.Contains(string(rc), "PS1='(envx:.env) '\"$PS1\"") {
+		t.Errorf("bash rc file = %q", rc)
+	}
+
+	t.Setenv("ZDOTDIR", "/home/me/zsh")
+	_, environ, err := promptSetup("/usr/bin/zsh", ".env", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(environ, " ") != "ENVX_ZDOTDIR=/home/me/zsh ZDOTDIR="+dir {
+		t.Errorf("promptSetup(zsh) environment = %v", environ)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".zshrc")); err != nil {
+		t.Errorf("promptSetup(zsh) did not write .zshrc: %v", err)
+	}
+
+	args, _, _ = promptSetup("fish", ".env", dir)
+	if len(args) != 3 || !strings.Contains(args[2], "(envx:.env) ") {
+		t.Errorf("promptSetup(fish) args = %v", args)
+	}
+}
+
+func TestShellLabel(t *testing.T) {
+	originalSection := envSection
+	defer func() { envSection = originalSection }()
+
+	envSection = ""
+	if got := shellLabel("/srv/app/.env.prod"); got != ".env.prod" {
+		t.Errorf("shellLabel() = %q", got)
+	}
+	envSection = "eu west'"
+	if got := shellLabel(".env"); got != ".env[eu_west_]" {
+		t.Errorf("shellLabel() with section = %q", got)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/diff"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/errlog"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/signature"
+	flag "github.com/spf13/pflag"
+)
+
+type signOpts struct {
+	Name      string
+	File      string
+	KeyStore  string
+	Password  string
+	Write     bool
+	PublicKey bool
+}
+
+type verifySignatureOpts struct {
+	Name           string
+	File           string
+	Trusted        []string
+	AllowAnySigner bool
+	JSON           bool
+	Batch          *batchOpts
+}
+
+// signatureReport is a good signature, as printed by verify-signature --json
+type signatureReport struct {
+	File string `json:"file"`
+	// Signer is the public key that made the signature
+	Signer string `json:"signer"`
+	// Trusted is set when the signer was checked against trusted signers
+	Trusted bool `json:"trusted"`
+}
+
+// newSignCmd builds the "sign" command, which embeds an ed25519 signature
+// made with the user's signing identity in the env file
+func newSignCmd() *command[signOpts] {
+	cmd := new(command[signOpts])
+	cmd.flags = flag.NewFlagSet("sign", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVarP(&cmd.val.Write, "write", "w", false, "Overwrites the file with the signed contents")
+	cmd.flags.BoolVar(&cmd.val.PublicKey, "public-key", false, "Prints the public key of the signing identity instead of signing")
+	cmd.fn = signCmdFn
+	return cmd
+}
+
+// newVerifySignatureCmd builds the "verify-signature" command
+func newVerifySignatureCmd() *command[verifySignatureOpts] {
+	cmd := new(command[verifySignatureOpts])
+	cmd.flags = flag.NewFlagSet("verify-signature", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringSliceVar(&cmd.val.Trusted, "trust", nil, "Comma separated public keys allowed to sign the file (default ENVX_TRUSTED_SIGNERS)")
+	cmd.flags.BoolVar(&cmd.val.AllowAnySigner, "allow-any-signer", false, "Accepts a signature by anyone, only checking the file is unchanged since it was signed")
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the result as a JSON object")
+	cmd.val.Batch = NewBatchOpts(cmd.flags)
+	cmd.fn = verifySignatureCmdFn
+	return cmd
+}
+
+func signCmdFn(ctx context.Context, opts signOpts, args ...string) error {
+	seed, err := loadSigningIdentity(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading signing identity: %w", err)
+	}
+	defer secure.Zero(seed)
+
+	if opts.PublicKey {
+		pub, err := signature.PublicKey(seed)
+		if err != nil {
+			return err
+		}
+		fmt.Println(signature.EncodeKey(pub))
+		return nil
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	if err := checkPermissions(file); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if err != nil {
+		return fmt.Errorf("error reading %s file: %w", file, err)
+	}
+
+	signed, err := signature.Sign(content, seed)
+	if err != nil {
+		return fmt.Errorf("error signing %s file: %w", file, err)
+	}
+
+	if !opts.Write {
+		_, err := os.Stdout.Write(signed)
+		return err
+	}
+	if dryRun {
+		writeDiff(os.Stdout, diff.Unified(file, file, string(content), string(signed), 3), useColor())
+		return nil
+	}
+	if err := checkExternalChange(file, string(signed)); err != nil {
+		return err
+	}
+	if err := backupFile(file); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, signed, env.SecureFileMode); err != nil {
+		return fmt.Errorf("error writing %s file: %w", file, err)
+	}
+	recordWritten(file, signed)
+	return nil
+}
+
+func verifySignatureCmdFn(ctx context.Context, opts verifySignatureOpts, args ...string) error {
+	trusted, err := trustedSigners(opts.Trusted)
+	if err != nil {
+		return err
+	}
+	// The signer's public key is part of the signed file, so without trusted
+	// signers anyone who can edit the file can sign it again
+	if len(trusted) == 0 && !opts.AllowAnySigner {
+		return errors.New("no trusted signers given with --trust or ENVX_TRUSTED_SIGNERS; pass --allow-any-signer to only check that the file is unchanged since it was signed")
+	}
+
+	if opts.Batch.Enabled() {
+		files, err := opts.Batch.Files(opts.File)
+		if err != nil {
+			return err
+		}
+		return runBatch(files, opts.JSON, func(file string) (string, error) {
+			signer, err := verifyFileSignature(file, trusted)
+			if err != nil {
+				return "", err
+			}
+			return "good signature from " + signer, nil
+		})
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	signer, err := verifyFileSignature(file, trusted)
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		return writeJSON(os.Stdout, signatureReport{File: file, Signer: signer, Trusted: len(trusted) > 0})
+	}
+	fmt.Printf("%s: good signature from %s\n", file, signer)
+	return nil
+}
+
+// verifyFileSignature checks the signature of file, and that it was made by
+// one of the trusted signers unless none are given, returning the signer
+func verifyFileSignature(file string, trusted []ed25519.PublicKey) (string, error) {
+	content, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if err != nil {
+		return "", fmt.Errorf("error reading %s file: %w", file, err)
+	}
+
+	pub, err := signature.Verify(content)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	signer := signature.EncodeKey(pub)
+
+	if len(trusted) == 0 {
+		diagf("Warning: any signer is allowed; only checked that %s is unchanged since it was signed\n", file)
+	} else if !containsKey(trusted, pub) {
+		return "", fmt.Errorf("%s: signed by %s, which is not a trusted signer", file, signer)
+	}
+	return signer, nil
+}
+
+// loadSigningIdentity loads the ed25519 seed of the current user's signing
+// identity, creating one on first use. It is kept in the keystore next to the
+// encryption key, under its own account, so the two can never be mixed up.
+// Keystores holding one key for every account cannot keep it apart, so it is
+// derived from their key with HKDF instead.
+func loadSigningIdentity(storeTypeStr, password string) ([]byte, error) {
+	storeType, password, err := resolveKeyStoreType(storeTypeStr, password)
+	if err != nil {
+		return nil, err
+	}
+	account, err := currentAccount()
+	if err != nil {
+		return nil, err
+	}
+	account = signingAccount(account)
+
+	store, err := newKeyStore(storeType, password, account)
+	if err != nil {
+		return nil, err
+	}
+	if shared, ok := store.(keystore.SharedKeyStore); ok && shared.SharesKey() {
+		return deriveSigningIdentity(store, account)
+	}
+	seed, err := store.LoadOrCreateKey(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load or create signing identity: %w", err)
+	}
+	errlog.RegisterKey(seed)
+	return seed, nil
+}
+
+// deriveSigningIdentity derives the signing identity from the key store
+// gives every account, labelled so it is never the encryption key itself
+func deriveSigningIdentity(store keystore.KeyStore, account string) ([]byte, error) {
+	key, err := store.GetKey(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing identity: %w", err)
+	}
+	defer secure.Zero(key)
+
+	seed, err := hkdf.Key(sha256.New, key, nil, signingLabel, ed25519.SeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive signing identity: %w", err)
+	}
+	errlog.RegisterKey(seed)
+	return seed, nil
+}
+
+// signingLabel is the HKDF info signing identities are derived with
+const signingLabel = "envx signing identity"
+
+// signingAccount returns the keystore account holding the signing identity
+// of the given user account
+func signingAccount(account string) string {
+	return account + "." + signingSuffix
+}
+
+// signingSuffix ends the keystore accounts of signing identities
+const signingSuffix = "signing"
+
+// trustedSigners parses the public keys given with --trust, falling back to
+// ENVX_TRUSTED_SIGNERS when the flag is not used
+func trustedSigners(keys []string) ([]ed25519.PublicKey, error) {
+	if len(keys) == 0 {
+		if value := os.Getenv("ENVX_TRUSTED_SIGNERS"); value != "" {
+			keys = strings.Split(value, ",")
+		}
+	}
+
+	var trusted []ed25519.PublicKey
+	for _, k := range keys {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		pub, err := signature.DecodeKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted signer: %w", err)
+		}
+		trusted = append(trusted, pub)
+	}
+	return trusted, nil
+}
+
+// containsKey reports whether pub is one of keys
+func containsKey(keys []ed25519.PublicKey, pub ed25519.PublicKey) bool {
+	for _, k := range keys {
+		if k.Equal(pub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/signature"
+)
+
+func TestSignAndVerifySignature(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("A=1\nB=2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := captureStdout(t, func() error {
+		return signCmdFn(context.Background(), signOpts{KeyStore: "mock", PublicKey: true})
+	})
+	if err != nil {
+		t.Fatalf("signCmdFn() --public-key unexpected error: %v", err)
+	}
+	publicKey = strings.TrimSpace(publicKey)
+	if _, err := signature.DecodeKey(publicKey); err != nil {
+		t.Fatalf("signCmdFn() --public-key printed %q: %v", publicKey, err)
+	}
+
+	// The signing identity is separate from the encryption key
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, _ := signature.PublicKey(key); signature.EncodeKey(pub) == publicKey {
+		t.Error("signing identity reuses the encryption key")
+	}
+
+	if err := signCmdFn(context.Background(), signOpts{File: envFile, KeyStore: "mock", Write: true}); err != nil {
+		t.Fatalf("signCmdFn() unexpected error: %v", err)
+	}
+	content, _ := os.ReadFile(envFile)
+	if !strings.HasPrefix(string(content), "A=1\nB=2\n"+signature.Prefix+publicKey) {
+		t.Errorf("signed file = %q", content)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile, Trusted: []string{publicKey}})
+	})
+	if err != nil {
+		t.Fatalf("verifySignatureCmdFn() unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "good signature from "+publicKey) {
+		t.Errorf("verifySignatureCmdFn() output = %q", output)
+	}
+
+	// Trusted signers can come from the environment
+	t.Setenv("ENVX_TRUSTED_SIGNERS", publicKey)
+	if _, err := captureStdout(t, func() error {
+		return verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile})
+	}); err != nil {
+		t.Errorf("verifySignatureCmdFn() with ENVX_TRUSTED_SIGNERS unexpected error: %v", err)
+	}
+
+	// Without trusted signers anyone could have signed it
+	t.Setenv("ENVX_TRUSTED_SIGNERS", "")
+	err = verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile})
+	if err == nil || !strings.Contains(err.Error(), "--allow-any-signer") {
+		t.Errorf("verifySignatureCmdFn() without trusted signers error = %v, want refusal", err)
+	}
+	if _, err := captureStdout(t, func() error {
+		return verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile, AllowAnySigner: true})
+	}); err != nil {
+		t.Errorf("verifySignatureCmdFn() --allow-any-signer unexpected error: %v", err)
+	}
+
+	other, _ := signature.PublicKey([]byte(strings.Repeat("x", 32)))
+	err = verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile, Trusted: []string{signature.EncodeKey(other)}})
+	if err == nil || !strings.Contains(err.Error(), "not a trusted signer") {
+		t.Errorf("verifySignatureCmdFn() untrusted signer error = %v", err)
+	}
+
+	tampered := strings.Replace(string(content), "B=2", "B=3", 1)
+	if err := os.WriteFile(envFile, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile, Trusted: []string{publicKey}})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("verifySignatureCmdFn() tampered file error = %v", err)
+	}
+
+	err = verifySignatureCmdFn(context.Background(), verifySignatureOpts{File: envFile, Trusted: []string{"bogus"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid trusted signer") {
+		t.Errorf("verifySignatureCmdFn() bogus trusted key error = %v", err)
+	}
+}
+
+func TestLoadSigningIdentity_SharedKey(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, crypto.KeySize)
+	if err := os.WriteFile(filepath.Join(dir, "envx-key"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_PASSWORD", "")
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+	seed, err := loadSigningIdentity("systemd", "")
+	if err != nil {
+		t.Fatalf("loadSigningIdentity() unexpected error: %v", err)
+	}
+	if bytes.Equal(seed, key) {
+		t.Error("loadSigningIdentity() returned the credential's encryption key")
+	}
+	again, err := loadSigningIdentity("systemd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(seed, again) {
+		t.Error("loadSigningIdentity() derived a different identity from the same credential")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// timeoutExitCode is the exit status used when the child is stopped because
+// --timeout expired, matching timeout(1)
+const timeoutExitCode = 124
+
+// forwardedSignals are relayed from envx to a spawned child
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// execProcess replaces the current process with the program; tests replace it
+var execProcess = syscall.Exec
+
+// exitError makes envx exit with the given status. The wrapped error, if
+// any, is printed first.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// execOrSpawn replaces envx with the program, or runs it as a child with
+// spawn when the platform or the program does not allow that
+func execOrSpawn(ctx context.Context, exe string, args []string, grace time.Duration) error {
+	err := execProcess(exe, args, os.Environ()) // #nosec G204 -- Intentional subprocess execution with validated executable path
+	if verbose {
+		diagf("Warning: could not replace envx with %s (%v); running it as a child process\n", args[0], err)
+	}
+	return spawn(ctx, exe, args, 0, grace, nil)
+}
+
+// spawn runs the program as a child process instead of replacing envx with
+// it, and mirrors its exit status as an *exitError (128+n when killed by
+// signal n). SIGINT, SIGTERM and SIGHUP received by envx are forwarded to the
+// child. When the timeout expires or ctx is cancelled the child gets SIGTERM.
+// Either way, a child still running grace after the first signal is killed.
+// The redact values are masked in the child's stdout and stderr.
+func spawn(ctx context.Context, exe string, args []string, timeout, grace time.Duration, redact []string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	cmd := exec.Command(exe, args[1:]...) // #nosec G204 -- Intentional subprocess execution with validated executable path
+	cmd.Args = args
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if len(redact) > 0 {
+		stdout, stderr := newRedactingWriter(os.Stdout, redact), newRedactingWriter(os.Stderr, redact)
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		defer func() {
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+		}()
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error running %s: %w", args[0], err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var kill <-chan time.Time
+	var killTimer *time.Timer
+	defer func() {
+		if killTimer != nil {
+			killTimer.Stop()
+		}
+	}()
+	escalate := func(sig os.Signal) {
+		_ = cmd.Process.Signal(sig)
+		if killTimer == nil {
+			killTimer = time.NewTimer(grace)
+			kill = killTimer.C
+		}
+	}
+
+	cancelled := ctx.Done()
+	timedOut := false
+	for {
+		select {
+		case err := <-done:
+			if timedOut {
+				return &exitError{code: timeoutExitCode, err: fmt.Errorf("%s timed out after %s", args[0], timeout)}
+			}
+			return childExitError(args[0], err)
+		case sig := <-signals:
+			escalate(sig)
+		case <-deadline:
+			deadline = nil
+			timedOut = true
+			escalate(syscall.SIGTERM)
+		case <-cancelled:
+			cancelled = nil
+			escalate(syscall.SIGTERM)
+		case <-kill:
+			kill = nil
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+// childExitError converts the result of waiting for a child into the exit
+// status envx should mirror
+func childExitError(name string, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return &exitError{code: 128 + int(status.Signal())}
+		}
+		return &exitError{code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return fmt.Errorf("error running %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSpawn(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell and signals")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		expected int
+	}{
+		{name: "success", script: "exit 0", expected: 0},
+		{name: "exit status", script: "exit 3", expected: 3},
+		{name: "timeout", script: "exec sleep 5", timeout: 100 * time.Millisecond, expected: timeoutExitCode},
+		// The child ignores SIGTERM, so it must be killed after the grace period
+		{name: "kill after grace", script: "trap '' TERM; while :; do :; done", timeout: 100 * time.Millisecond, expected: timeoutExitCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := spawn(context.Background(), sh, []string{"sh", "-c", tt.script}, tt.timeout, 200*time.Millisecond, nil)
+
+			code := 0
+			var exitErr *exitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.code
+			} else if err != nil {
+				t.Fatalf("spawn() unexpected error: %v", err)
+			}
+			if code != tt.expected {
+				t.Errorf("spawn() exit code = %d, want %d", code, tt.expected)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("spawn() took %s, the child was not stopped", elapsed)
+			}
+		})
+	}
+}
+
+func TestSpawn_ForwardsSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell and signals")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name     string
+		signal   syscall.Signal
+		script   string
+		expected int
+	}{
+		// The child sees the signal envx received, not always SIGTERM
+		{name: "SIGHUP trapped", signal: syscall.SIGHUP, script: "trap 'exit 42' HUP; while :; do sleep 0.05; done", expected: 42},
+		{name: "SIGINT trapped", signal: syscall.SIGINT, script: "trap 'exit 43' INT; while :; do sleep 0.05; done", expected: 43},
+		{name: "SIGTERM default", signal: syscall.SIGTERM, script: "exec sleep 5", expected: 128 + int(syscall.SIGTERM)},
+		// A child ignoring the signal is killed after the grace period
+		{name: "escalates to SIGKILL", signal: syscall.SIGTERM, script: "trap '' TERM; while :; do :; done", expected: 128 + int(syscall.SIGKILL)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			go func() {
+				// Give the child time to install its traps
+				time.Sleep(300 * time.Millisecond)
+				_ = syscall.Kill(os.Getpid(), tt.signal)
+			}()
+
+			start := time.Now()
+			err := spawn(context.Background(), sh, []string{"sh", "-c", tt.script}, 0, 200*time.Millisecond, nil)
+			var exitErr *exitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("spawn() error = %v, want an exit status", err)
+			}
+			if exitErr.code != tt.expected {
+				t.Errorf("spawn() exit code = %d, want %d", exitErr.code, tt.expected)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("spawn() took %s, the signal was not forwarded", elapsed)
+			}
+		})
+	}
+}
+
+func TestExecOrSpawn_FallsBackToSpawn(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	original := execProcess
+	defer func() { execProcess = original }()
+	execProcess = func(string, []string, []string) error { return syscall.ENOEXEC }
+
+	err = execOrSpawn(context.Background(), sh, []string{"sh", "-c", "exit 7"}, time.Second)
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != 7 {
+		t.Errorf("execOrSpawn() error = %v, want exit status 7", err)
+	}
+
+	err = execOrSpawn(context.Background(), "/nonexistent/program", []string{"program"}, time.Second)
+	if err == nil || errors.As(err, &exitErr) {
+		t.Errorf("execOrSpawn() of a missing program error = %v, want a start error", err)
+	}
+}
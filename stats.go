@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type statsOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	JSON     bool
+}
+
+// fileStats is the summary printed by stats
+type fileStats struct {
+	File      string `json:"file"`
+	Variables int    `json:"variables"`
+	Encrypted int    `json:"encrypted"`
+	// Coverage is the percentage of variables that are encrypted
+	Coverage float64 `json:"coverage"`
+	// LastRotated is the day the most recently rotated variable with a
+	// rotation interval was last set, and NextRotation the earliest due date
+	LastRotated  string `json:"last_rotated,omitempty"`
+	NextRotation string `json:"next_rotation,omitempty"`
+	Backups      int    `json:"backups"`
+	KeyStore     string `json:"keystore"`
+	Key          string `json:"key"`
+	// Fingerprint identifies the key, when it is available without a prompt
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func newStatsCmd() *command[statsOpts] {
+	cmd := new(command[statsOpts])
+	cmd.flags = flag.NewFlagSet("stats", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the statistics as a JSON object")
+	cmd.fn = statsCmdFn
+	return cmd
+}
+
+// statsCmdFn prints a summary of the env file for security reviews. Nothing
+// is decrypted or sent anywhere.
+func statsCmdFn(ctx context.Context, opts statsOpts, args ...string) error {
+	stats, err := currentStats(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		return writeJSON(os.Stdout, stats)
+	}
+
+	orNone := func(s string) string {
+		if s == "" {
+			return "none"
+		}
+		return s
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "file:\t%s\n", stats.File)
+	fmt.Fprintf(tw, "variables:\t%d\n", stats.Variables)
+	fmt.Fprintf(tw, "encrypted:\t%d (%.1f%%)\n", stats.Encrypted, stats.Coverage)
+	fmt.Fprintf(tw, "last rotated:\t%s\n", orNone(stats.LastRotated))
+	fmt.Fprintf(tw, "next rotation:\t%s\n", orNone(stats.NextRotation))
+	fmt.Fprintf(tw, "backups:\t%d\n", stats.Backups)
+	fmt.Fprintf(tw, "keystore:\t%s (key %s)\n", stats.KeyStore, stats.Key)
+	fmt.Fprintf(tw, "fingerprint:\t%s\n", orNone(stats.Fingerprint))
+	return tw.Flush()
+}
+
+// currentStats gathers the statistics of the env file. The key is only
+// loaded for its fingerprint when that needs no prompt, and never created.
+func currentStats(ctx context.Context, opts statsOpts) (fileStats, error) {
+	file := env.BuildFilename(opts.File, opts.Name)
+	vars, err := loadEnv(ctx, file)
+	if err != nil {
+		return fileStats{}, fmt.Errorf("error loading %s file: %w", file, err)
+	}
+
+	stats := fileStats{File: absPath(file), Variables: len(vars)}
+	encryptor := newEncryptor(ctx)
+	for _, v := range vars {
+		if encryptor.IsEncrypted(v.Value) {
+			stats.Encrypted++
+		}
+	}
+	if stats.Variables > 0 {
+		stats.Coverage = float64(stats.Encrypted) * 100 / float64(stats.Variables)
+	}
+
+	rotations, err := fileRotations(ctx, file)
+	if err != nil {
+		return fileStats{}, err
+	}
+	for _, r := range rotations {
+		if due := r.Due.Format(env.DateLayout); stats.NextRotation == "" || due < stats.NextRotation {
+			stats.NextRotation = due
+		}
+		if r.Every > 0 {
+			if set := r.Due.Add(-r.Every).Format(env.DateLayout); set > stats.LastRotated {
+				stats.LastRotated = set
+			}
+		}
+	}
+
+	_, dir, _, err := backupConfig()
+	if err != nil {
+		return fileStats{}, err
+	}
+	backups, err := listBackups(file, backupDir(file, dir))
+	if err != nil {
+		return fileStats{}, err
+	}
+	stats.Backups = len(backups)
+
+	storeType, password, err := resolveKeyStoreType(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fileStats{}, err
+	}
+	stats.KeyStore = string(storeType)
+	key, _, err := keyOverride()
+	if err == nil && key == nil {
+		stats.Key = keyState(storeType, password)
+		if stats.Key == keyAvailable {
+			key, err = loadKeyWithTypeAndPassword(storeType, password)
+		}
+	}
+	if err != nil {
+		return fileStats{}, fmt.Errorf("error loading key: %w", err)
+	}
+	if key != nil {
+		defer secure.Zero(key)
+		stats.Key = keyAvailable
+		stats.Fingerprint = crypto.Fingerprint(key)
+	}
+	return stats, nil
+}
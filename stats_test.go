@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestStats(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "secret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	content := "# envx:rotate-after API_TOKEN 2027-01-14 every 90d\n" +
+		"# envx:rotate-after DB_PASSWORD 2026-10-20\n" +
+		"API_TOKEN=" + encrypted + "\nDB_PASSWORD=" + encrypted + "\nPORT=8080\nHOST=localhost\n"
+	if err := os.WriteFile(envFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_BACKUP_DIR", dir)
+	for _, stamp := range []string{"20260101T000000.000000000Z", "20260102T000000.000000000Z"} {
+		if err := os.WriteFile(envFile+".backup."+stamp, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := captureStdout(t, func() error {
+		return statsCmdFn(context.Background(), statsOpts{File: envFile, KeyStore: "mock", JSON: true})
+	})
+	if err != nil {
+		t.Fatalf("statsCmdFn() error = %v", err)
+	}
+	var stats fileStats
+	if err := json.Unmarshal([]byte(output), &stats); err != nil {
+		t.Fatalf("output %q is not JSON: %v", output, err)
+	}
+	want := fileStats{
+		File:         absPath(envFile),
+		Variables:    4,
+		Encrypted:    2,
+		Coverage:     50,
+		LastRotated:  "2026-10-16",
+		NextRotation: "2026-10-20",
+		Backups:      2,
+		KeyStore:     "mock",
+		Key:          keyAvailable,
+		Fingerprint:  crypto.Fingerprint(key),
+	}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type statusOpts struct {
+	Name     string
+	File     string
+	KeyStore string
+	Password string
+	JSON     bool
+	Batch    *batchOpts
+}
+
+// Key states reported by status
+const (
+	keyAvailable = "available" // usable without any prompt
+	keyLocked    = "locked"    // stored, but needs a password or token touch
+	keyMissing   = "missing"   // would be created on first use
+	keyUnknown   = "unknown"   // the keystore could not be queried
+)
+
+// envStatus is the machine readable state printed by status
+type envStatus struct {
+	Env      string `json:"env"`
+	File     string `json:"file"`
+	Exists   bool   `json:"exists"`
+	Section  string `json:"section"`
+	Shell    bool   `json:"shell"`
+	KeyStore string `json:"keystore"`
+	Key      string `json:"key"`
+	// Due counts the variables due for rotation
+	Due int `json:"due"`
+}
+
+// newStatusCmd builds the "env-name" (active environment only) or "status"
+// command. Both are meant to be cheap enough to run from a shell prompt.
+func newStatusCmd(name string, full bool) *command[statusOpts] {
+	cmd := new(command[statusOpts])
+	cmd.flags = flag.NewFlagSet(name, flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	if full {
+		cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+		cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+		cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+		cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the status as a JSON object")
+		cmd.val.Batch = NewBatchOpts(cmd.flags)
+		cmd.fn = statusCmdFn
+	} else {
+		cmd.fn = envNameCmdFn
+	}
+	return cmd
+}
+
+// envNameCmdFn prints the active environment: the one of the envx shell this
+// runs in, or else the env file that would be used if it exists. With
+// --quiet it prints nothing, without failing, when there is none.
+func envNameCmdFn(ctx context.Context, opts statusOpts, args ...string) error {
+	if active := os.Getenv("ENVX_SHELL"); active != "" {
+		fmt.Println(active)
+		return nil
+	}
+
+	file := env.BuildFilename(opts.File, opts.Name)
+	if _, err := os.Stat(file); err != nil {
+		if quiet {
+			return nil
+		}
+		return fmt.Errorf("no active environment: %s not found", file)
+	}
+	fmt.Println(shellLabel(file))
+	return nil
+}
+
+func statusCmdFn(ctx context.Context, opts statusOpts, args ...string) error {
+	if opts.Batch.Enabled() {
+		return statusBatch(ctx, opts)
+	}
+
+	status, err := currentStatus(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		return writeJSON(os.Stdout, status)
+	}
+
+	fields := []string{
+		"env=" + status.Env,
+		"file=" + status.File,
+		"exists=" + strconv.FormatBool(status.Exists),
+		"section=" + status.Section,
+		"shell=" + strconv.FormatBool(status.Shell),
+		"keystore=" + status.KeyStore,
+		"key=" + status.Key,
+		"due=" + strconv.Itoa(status.Due),
+	}
+	fmt.Println(strings.Join(fields, " "))
+	return nil
+}
+
+// statusBatch prints the status of several files as a table, or as a JSON
+// array with --json
+func statusBatch(ctx context.Context, opts statusOpts) error {
+	files, err := opts.Batch.Files(opts.File)
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]envStatus, 0, len(files))
+	for _, file := range files {
+		opts.File, opts.Name = file, ""
+		status, err := currentStatus(ctx, opts)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	if opts.JSON {
+		return writeJSON(os.Stdout, statuses)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tENV\tSECTION\tKEYSTORE\tKEY\tDUE")
+	for i, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", files[i], s.Env, s.Section, s.KeyStore, s.Key, s.Due)
+	}
+	return w.Flush()
+}
+
+// currentStatus gathers the status without loading, creating or prompting
+// for a key
+func currentStatus(ctx context.Context, opts statusOpts) (envStatus, error) {
+	file := env.BuildFilename(opts.File, opts.Name)
+	_, statErr := os.Stat(file)
+	status := envStatus{
+		Env:     shellLabel(file),
+		File:    absPath(file),
+		Exists:  statErr == nil,
+		Section: envSection,
+	}
+	if active := os.Getenv("ENVX_SHELL"); active != "" {
+		status.Env = active
+		status.Shell = true
+	}
+	if status.Exists {
+		rotations, _ := fileRotations(ctx, file)
+		status.Due = len(dueRotations(rotations, 0))
+	}
+
+	storeType, password, err := resolveKeyStoreType(opts.KeyStore, opts.Password)
+	if err != nil {
+		return envStatus{}, err
+	}
+	status.KeyStore = string(storeType)
+	if key, _, err := keyOverride(); err == nil && key != nil {
+		secure.Zero(key)
+		status.Key = keyAvailable
+	} else {
+		status.Key = keyState(storeType, password)
+	}
+	return status, nil
+}
+
+// keyState reports whether the keystore can hand out the key without
+// prompting. Failures are reported as keyUnknown rather than errors so a
+// prompt never breaks.
+func keyState(storeType KeyStoreType, password string) string {
+	account, err := currentAccount()
+	if err != nil {
+		return keyUnknown
+	}
+
+	switch storeType {
+	case KeyStoreTypePassword:
+		// The key is derived on demand; it exists once the salt does
+		if _, err := os.Stat(keystore.SaltFilePath(account)); err != nil {
+			return keyMissing
+		}
+		if password != "" || os.Getenv("ENVX_PASSWORD") != "" {
+			return keyAvailable
+		}
+		return keyLocked
+	default:
+		store, err := newKeyStore(storeType, password, account)
+		if err != nil {
+			return keyUnknown
+		}
+		exists, err := keystore.HasKey(store, account)
+		switch {
+		case err != nil:
+			return keyUnknown
+		case !exists:
+			return keyMissing
+		case storeType == KeyStoreTypeYubiKey:
+			return keyLocked
+		default:
+			return keyAvailable
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvNameCmdFn(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	t.Setenv("ENVX_SHELL", "")
+
+	tests := []struct {
+		name    string
+		opts    statusOpts
+		quiet   bool
+		shell   string
+		create  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "existing file", opts: statusOpts{File: envFile, Name: "prod"}, create: true, want: ".env.prod\n"},
+		{name: "missing file", opts: statusOpts{File: envFile, Name: "dev"}, wantErr: true},
+		{name: "missing file quiet", opts: statusOpts{File: envFile, Name: "dev"}, quiet: true, want: ""},
+		{name: "active shell", opts: statusOpts{File: envFile, Name: "dev"}, quiet: true, shell: ".env.staging", want: ".env.staging\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENVX_SHELL", tt.shell)
+			quiet = tt.quiet
+			defer func() { quiet = false }()
+			if tt.create {
+				if err := os.WriteFile(envFile+"."+tt.opts.Name, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			output, err := captureStdout(t, func() error {
+				return envNameCmdFn(context.Background(), tt.opts)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("envNameCmdFn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if output != tt.want {
+				t.Errorf("envNameCmdFn() = %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	t.Setenv("ENVX_SHELL", "")
+	t.Setenv("ENVX_PASSWORD", "")
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# envx:rotate-after A 2020-01-01\nA=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := statusOpts{File: envFile, KeyStore: "mock"}
+
+	output, err := captureStdout(t, func() error {
+		return statusCmdFn(context.Background(), opts)
+	})
+	if err != nil {
+		t.Fatalf("statusCmdFn() unexpected error: %v", err)
+	}
+	want := "env=.env file=" + envFile + " exists=true section= shell=false keystore=mock key=missing due=1\n"
+	if output != want {
+		t.Errorf("statusCmdFn() = %q, want %q", output, want)
+	}
+
+	if _, err := loadKeyWithType(KeyStoreTypeMock); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_SHELL", ".env.staging")
+	opts.JSON = true
+	output, err = captureStdout(t, func() error {
+		return statusCmdFn(context.Background(), opts)
+	})
+	if err != nil {
+		t.Fatalf("statusCmdFn() --json unexpected error: %v", err)
+	}
+	var status envStatus
+	if err := json.Unmarshal([]byte(output), &status); err != nil {
+		t.Fatalf("statusCmdFn() --json printed invalid JSON %q: %v", output, err)
+	}
+	if status.Env != ".env.staging" || !status.Shell || status.Key != keyAvailable {
+		t.Errorf("statusCmdFn() --json = %+v", status)
+	}
+}
+
+func TestKeyState_Password(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ENVX_PASSWORD", "")
+	saltDir := filepath.Join(home, ".config", "envx", "salts")
+	if err := os.MkdirAll(saltDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := keyState(KeyStoreTypePassword, ""); got != keyMissing {
+		t.Errorf("keyState() without salt = %q, want %q", got, keyMissing)
+	}
+
+	account, err := currentAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(saltDir, account+".salt"), []byte(strings.Repeat("s", 32)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := keyState(KeyStoreTypePassword, ""); got != keyLocked {
+		t.Errorf("keyState() without password = %q, want %q", got, keyLocked)
+	}
+	if got := keyState(KeyStoreTypePassword, "secret"); got != keyAvailable {
+		t.Errorf("keyState() with password = %q, want %q", got, keyAvailable)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Values of --restart
+const (
+	restartNo        = "no"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+const (
+	// maxRestartDelay caps the restart backoff
+	maxRestartDelay = time.Minute
+	// stableRunTime is how long the program must run for the backoff to reset
+	stableRunTime = 10 * time.Second
+)
+
+// supervise runs the program as a child and restarts it according to
+// --restart, reloading and decrypting the env file before every restart so
+// the program picks up changed secrets. original holds the arguments before
+// interpolation and exported the variables set for the first run. It returns
+// once the program exits and is not restarted, or envx is asked to stop.
+func supervise(ctx context.Context, opts runOpts, exe string, original, args, exported []string, mounts *mountSet) error {
+	switch opts.Restart {
+	case restartOnFailure, restartAlways:
+	default:
+		return fmt.Errorf("invalid --restart value %q (supported: %s, %s, %s)", opts.Restart, restartNo, restartOnFailure, restartAlways)
+	}
+	if opts.File == stdinFile {
+		return fmt.Errorf("--restart cannot reload env contents read from stdin")
+	}
+	// Without a delay a crashing program would be reloaded in a tight loop
+	if opts.RestartDelay <= 0 {
+		return fmt.Errorf("--restart-delay must be positive, got %s", opts.RestartDelay)
+	}
+
+	// Signals forwarded to the child also mean envx should stop supervising
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, forwardedSignals...)
+	defer signal.Stop(stop)
+
+	delay := opts.RestartDelay
+	for restarts := 0; ; restarts++ {
+		if restarts > 0 {
+			vars, err := loadRunEnv(ctx, opts, "run")
+			if err != nil {
+				return err
+			}
+			if opts.Redact {
+				opts.redact = redactedValues(vars, opts.RedactMinLength)
+			}
+			previous := exported
+			if args, exported, err = exportRunEnv(opts, vars, original, mounts); err != nil {
+				return err
+			}
+			unsetRemoved(previous, exported)
+		}
+
+		started := time.Now()
+		err := spawn(ctx, exe, args, opts.Timeout, opts.KillAfter, opts.redact)
+
+		select {
+		case <-stop:
+			return err
+		default:
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		code := 0
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		} else if err != nil {
+			return err
+		}
+		if code == 0 && opts.Restart == restartOnFailure {
+			return nil
+		}
+		if opts.MaxRestarts > 0 && restarts >= opts.MaxRestarts {
+			diagf("envx: %s exited with status %d; giving up after %d restarts\n", original[0], code, restarts)
+			return err
+		}
+
+		if time.Since(started) >= stableRunTime {
+			delay = opts.RestartDelay
+		}
+		diagf("envx: %s exited with status %d; restarting in %s\n", original[0], code, delay)
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return err
+		case <-ctx.Done():
+			return err
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// unsetRemoved unsets previously exported variables that are no longer in
+// the env file, so a restarted program does not see stale values
+func unsetRemoved(previous, current []string) {
+	keep := make(map[string]bool, len(current))
+	for _, key := range current {
+		keep[key] = true
+	}
+	for _, key := range previous {
+		if !keep[key] {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
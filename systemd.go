@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/keystore"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type systemdUnitOpts struct {
+	Unit       string
+	Name       string
+	Credential string
+	Plain      bool
+}
+
+type systemdCredentialOpts struct {
+	KeyStore string
+	Password string
+	Name     string
+	Output   string
+}
+
+// systemdCreds is the systemd-creds executable; tests replace it
+var systemdCreds = "systemd-creds"
+
+func newSystemdGroup() *group {
+	cmds := make(map[string]executor)
+
+	unitCmd := new(command[systemdUnitOpts])
+	unitCmd.flags = flag.NewFlagSet("unit", flag.ExitOnError)
+	unitCmd.flags.StringVarP(&unitCmd.val.Unit, "unit", "u", "app.service", "Service the drop-in is for")
+	unitCmd.flags.StringVar(&unitCmd.val.Name, "name", keystore.DefaultCredentialName, "Name of the credential holding the key")
+	unitCmd.flags.StringVarP(&unitCmd.val.Credential, "credential", "c", "", "Path of the credential file (default /etc/credstore.encrypted/<name>, or /etc/credstore/<name> with --plain)")
+	unitCmd.flags.BoolVar(&unitCmd.val.Plain, "plain", false, "Uses LoadCredential= with an unencrypted key file instead of LoadCredentialEncrypted=")
+	unitCmd.fn = systemdUnitCmdFn
+	cmds[unitCmd.flags.Name()] = unitCmd
+
+	credCmd := new(command[systemdCredentialOpts])
+	credCmd.flags = flag.NewFlagSet("credential", flag.ExitOnError)
+	credCmd.flags.StringVarP(&credCmd.val.KeyStore, "keystore", "k", "", "Keystore type to read the key from (macos, password, mock; default macos)")
+	credCmd.flags.StringVarP(&credCmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	credCmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	credCmd.flags.StringVar(&credCmd.val.Name, "name", keystore.DefaultCredentialName, "Name of the credential holding the key")
+	credCmd.flags.StringVarP(&credCmd.val.Output, "output", "o", "", "Credential file to write (default <name>.cred)")
+	credCmd.fn = systemdCredentialCmdFn
+	cmds[credCmd.flags.Name()] = credCmd
+
+	return &group{name: "systemd", cmds: cmds}
+}
+
+// systemdUnitCmdFn prints a unit drop-in that hands the key to the service as
+// a credential, which envx run then reads from $CREDENTIALS_DIRECTORY
+func systemdUnitCmdFn(ctx context.Context, opts systemdUnitOpts, args ...string) error {
+	if opts.Name == "" || strings.ContainsAny(opts.Name, "/:") {
+		return fmt.Errorf("invalid credential name: %q", opts.Name)
+	}
+
+	directive, dir := "LoadCredentialEncrypted", "/etc/credstore.encrypted/"
+	if opts.Plain {
+		directive, dir = "LoadCredential", "/etc/credstore/"
+	}
+	path := opts.Credential
+	if path == "" {
+		path = dir + opts.Name
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Save as /etc/systemd/system/%s.d/envx.conf, then run: systemctl daemon-reload\n", opts.Unit)
+	sb.WriteString("[Service]\n")
+	fmt.Fprintf(&sb, "%s=%s:%s\n", directive, opts.Name, path)
+	if opts.Name != keystore.DefaultCredentialName {
+		fmt.Fprintf(&sb, "Environment=ENVX_CREDENTIAL=%s\n", opts.Name)
+	}
+	fmt.Print(sb.String())
+	return nil
+}
+
+// systemdCredentialCmdFn encrypts the key with systemd-creds so it can be
+// installed for LoadCredentialEncrypted=
+func systemdCredentialCmdFn(ctx context.Context, opts systemdCredentialOpts, args ...string) error {
+	output := opts.Output
+	if output == "" {
+		output = opts.Name + ".cred"
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	if dryRun {
+		diagf("would run: %s encrypt --name=%s - %s\n", systemdCreds, opts.Name, output)
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, systemdCreds, "encrypt", "--name="+opts.Name, "-", output) // #nosec G204 -- Fixed executable with validated arguments
+	cmd.Stdin = bytes.NewReader(key)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemd-creds encrypt failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := os.Chmod(output, 0600); err != nil {
+		return fmt.Errorf("error restricting %s permissions: %w", output, err)
+	}
+	diagf("Wrote %s; install it as /etc/credstore.encrypted/%s and add the drop-in from \"envx systemd unit\"\n", output, opts.Name)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestSystemdUnitCmdFn(t *testing.T) {
+	tests := []struct {
+		name string
+		opts systemdUnitOpts
+		want []string
+	}{
+		{
+			name: "encrypted",
+			opts: systemdUnitOpts{Unit: "api.service", Name: "envx-key"},
+			want: []string{"/etc/systemd/system/api.service.d/envx.conf", "[Service]\nLoadCredentialEncrypted=envx-key:/etc/credstore.encrypted/envx-key\n"},
+		},
+		{
+			name: "plain with custom name",
+			opts: systemdUnitOpts{Unit: "api.service", Name: "api-key", Credential: "/srv/api.key", Plain: true},
+			want: []string{"LoadCredential=api-key:/srv/api.key\n", "Environment=ENVX_CREDENTIAL=api-key\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := captureStdout(t, func() error {
+				return systemdUnitCmdFn(context.Background(), tt.opts)
+			})
+			if err != nil {
+				t.Fatalf("systemdUnitCmdFn() unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("systemdUnitCmdFn() output missing %q:\n%s", want, output)
+				}
+			}
+		})
+	}
+
+	if err := systemdUnitCmdFn(context.Background(), systemdUnitOpts{Name: "a:b"}); err == nil {
+		t.Error("systemdUnitCmdFn() expected error for an invalid name")
+	}
+}
+
+func TestSystemdCredentialCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	// A stand-in for systemd-creds that stores its input unencrypted
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "systemd-creds")
+	script := "#!/bin/sh\n[ \"$1\" = encrypt ] && [ \"$2\" = --name=envx-key ] && [ \"$3\" = - ] || exit 2\ncat > \"$4\"\n"
+	if err := os.WriteFile(fake, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	original := systemdCreds
+	defer func() { systemdCreds = original }()
+	systemdCreds = fake
+
+	output := filepath.Join(dir, "envx-key.cred")
+	if err := systemdCredentialCmdFn(context.Background(), systemdCredentialOpts{KeyStore: "mock", Name: "envx-key", Output: output}); err != nil {
+		t.Fatalf("systemdCredentialCmdFn() unexpected error: %v", err)
+	}
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("systemd-creds did not receive the key")
+	}
+
+	systemdCreds = filepath.Join(dir, "missing")
+	if err := systemdCredentialCmdFn(context.Background(), systemdCredentialOpts{KeyStore: "mock", Name: "envx-key", Output: output}); err == nil {
+		t.Error("systemdCredentialCmdFn() expected error when systemd-creds fails")
+	}
+}
+
+func TestLoadKey_SystemdCredential(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, crypto.KeySize)
+	if err := os.WriteFile(filepath.Join(dir, "envx-key"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVX_PASSWORD", "")
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+	storeType, _, err := resolveKeyStoreType("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storeType != KeyStoreTypeSystemd {
+		t.Errorf("resolveKeyStoreType() = %s, want %s", storeType, KeyStoreTypeSystemd)
+	}
+	// An explicitly chosen keystore is kept, even the default one
+	if storeType, _, _ := resolveKeyStoreType("mock", ""); storeType != KeyStoreTypeMock {
+		t.Errorf("resolveKeyStoreType(mock) = %s", storeType)
+	}
+	if storeType, _, _ := resolveKeyStoreType("macos", ""); storeType != KeyStoreTypeMacOS {
+		t.Errorf("resolveKeyStoreType(macos) = %s", storeType)
+	}
+
+	got, err := loadKeyWithStringTypeAndPassword("", "")
+	if err != nil {
+		t.Fatalf("loadKeyWithStringTypeAndPassword() unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("loadKeyWithStringTypeAndPassword() did not return the credential key")
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := loadKeyWithStringTypeAndPassword("systemd", ""); err == nil || !strings.Contains(err.Error(), "CREDENTIALS_DIRECTORY") {
+		t.Errorf("loadKeyWithStringTypeAndPassword(systemd) error = %v", err)
+	}
+}
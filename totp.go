@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/secure"
+	"github.com/almahoozi/envx/pkg/totp"
+	flag "github.com/spf13/pflag"
+)
+
+type totpOpts struct {
+	Name      string
+	File      string
+	KeyStore  string
+	Password  string
+	Remaining bool
+}
+
+// totpNow returns the time codes are generated for; tests replace it
+var totpNow = time.Now
+
+// newTotpCmd builds the "totp" command, which prints the current one-time
+// password for a TOTP seed stored in the env file
+func newTotpCmd() *command[totpOpts] {
+	cmd := new(command[totpOpts])
+	cmd.flags = flag.NewFlagSet("totp", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.BoolVar(&cmd.val.Remaining, "remaining", false, "Prints how many seconds the code stays valid to stderr")
+	cmd.fn = totpCmdFn
+	return cmd
+}
+
+func totpCmdFn(ctx context.Context, opts totpOpts, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one variable holding a TOTP seed")
+	}
+	name := args[0]
+	file := env.BuildFilename(opts.File, opts.Name)
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	lazy, err := loadLazyEnv(ctx, file, newEncryptor(ctx), key)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	seed, exists, err := lazy.Get(name)
+	if err != nil {
+		return fmt.Errorf("error loading %s file: %w", file, err)
+	}
+	if !exists {
+		return fmt.Errorf("variable %s not found in %s file", name, file)
+	}
+	if err := auditAccess("totp", file, opts.KeyStore, opts.Password, []string{name}); err != nil {
+		return err
+	}
+
+	config, err := totp.Parse(seed)
+	if err != nil {
+		return fmt.Errorf("error reading TOTP seed %s: %w", name, err)
+	}
+	defer secure.Zero(config.Secret)
+
+	now := totpNow()
+	code, err := config.Code(now)
+	if err != nil {
+		return fmt.Errorf("error generating code: %w", err)
+	}
+	fmt.Println(code)
+	if opts.Remaining {
+		fmt.Fprintf(os.Stderr, "valid for %s\n", config.Remaining(now))
+	}
+	return nil
+}
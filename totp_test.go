@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+)
+
+func TestTotpCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	originalNow := totpNow
+	defer func() { totpNow = originalNow }()
+	totpNow = func() time.Time { return time.Unix(59, 0) }
+
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// base32 of the RFC 6238 test secret "12345678901234567890"
+	seed, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("GITHUB_TOTP="+seed+"\nPLAIN=not-base32!\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := totpOpts{File: envFile, KeyStore: "mock"}
+
+	output, err := captureStdout(t, func() error {
+		return totpCmdFn(context.Background(), opts, "GITHUB_TOTP")
+	})
+	if err != nil {
+		t.Fatalf("totpCmdFn() unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(output); got != "287082" {
+		t.Errorf("totpCmdFn() = %q, want %q", got, "287082")
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no arguments", nil, "exactly one"},
+		{"missing variable", []string{"MISSING"}, "not found"},
+		{"invalid seed", []string{"PLAIN"}, "invalid TOTP secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := totpCmdFn(context.Background(), opts, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("totpCmdFn() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
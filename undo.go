@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/almahoozi/envx/pkg/diff"
+	"github.com/almahoozi/envx/pkg/env"
+	flag "github.com/spf13/pflag"
+)
+
+type undoOpts struct {
+	Name string
+	File string
+}
+
+func newUndoCmd() *command[undoOpts] {
+	cmd := new(command[undoOpts])
+	cmd.flags = flag.NewFlagSet("undo", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.fn = undoCmdFn
+	return cmd
+}
+
+// undoCmdFn restores the env file from its most recent backup, undoing the
+// last write. The backup is removed, so undoing again goes further back.
+func undoCmdFn(ctx context.Context, opts undoOpts, args ...string) error {
+	_, dir, _, err := backupConfig()
+	if err != nil {
+		return err
+	}
+	file := env.BuildFilename(opts.File, opts.Name)
+	backups, err := listBackups(file, backupDir(file, dir))
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups of %s to restore; enable them with ENVX_BACKUP=true", file)
+	}
+	backup := backups[len(backups)-1]
+
+	previous, err := os.ReadFile(backup) // #nosec G304 -- Backup path is derived from the env file
+	if err != nil {
+		return fmt.Errorf("error reading backup: %w", err)
+	}
+	current, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s file: %w", file, err)
+	}
+
+	unified := diff.Unified(file, backup, string(current), string(previous), 3)
+	if dryRun {
+		if unified == "" {
+			diagf("%s: no changes\n", file)
+			return nil
+		}
+		writeDiff(os.Stdout, unified, useColor())
+		return nil
+	}
+	if unified != "" {
+		writeDiff(os.Stderr, unified, useColor() && stderrIsTerminal())
+		if err := confirm(fmt.Sprintf("Restore %s from %s?", file, backup)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(file, previous, env.SecureFileMode); err != nil {
+		return fmt.Errorf("error writing %s file: %w", file, err)
+	}
+	recordWritten(file, previous)
+	if err := os.Remove(backup); err != nil {
+		return fmt.Errorf("error removing backup: %w", err)
+	}
+	diagf("Restored %s from %s\n", file, backup)
+	return nil
+}
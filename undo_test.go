@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUndoCmdFn(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	assumeYes = true
+	defer func() { assumeYes = false }()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	readFile := func() string {
+		t.Helper()
+		content, err := os.ReadFile(envFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+	undo := func() error {
+		return undoCmdFn(context.Background(), undoOpts{File: envFile})
+	}
+
+	if err := undo(); err == nil || !strings.Contains(err.Error(), "ENVX_BACKUP=true") {
+		t.Fatalf("undoCmdFn() without backups error = %v", err)
+	}
+
+	t.Setenv("ENVX_BACKUP", "true")
+	if err := sortCmdFn(context.Background(), sortOpts{File: envFile, FmtOpts: &fmtOpts{}, Write: true}); err != nil {
+		t.Fatalf("sortCmdFn() unexpected error: %v", err)
+	}
+	if err := setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "HOST=localhost"); err != nil {
+		t.Fatalf("setCmdFn() unexpected error: %v", err)
+	}
+	if !strings.Contains(readFile(), "HOST=") {
+		t.Fatalf("file not updated:\n%s", readFile())
+	}
+
+	dryRun = true
+	output, err := captureStdout(t, undo)
+	dryRun = false
+	if err != nil {
+		t.Fatalf("undoCmdFn() with --dry-run unexpected error: %v", err)
+	}
+	if !strings.Contains(output, "-HOST=") || !strings.Contains(readFile(), "HOST=") {
+		t.Errorf("undoCmdFn() with --dry-run printed %q and left:\n%s", output, readFile())
+	}
+
+	if err := undo(); err != nil {
+		t.Fatalf("undoCmdFn() unexpected error: %v", err)
+	}
+	if got := readFile(); got != "PORT=1\n" {
+		t.Errorf("file after undo = %q, want %q", got, "PORT=1\n")
+	}
+	if err := undo(); err != nil {
+		t.Fatalf("second undoCmdFn() unexpected error: %v", err)
+	}
+	if err := undo(); err == nil {
+		t.Error("undoCmdFn() expected error once the backups are used up")
+	}
+}
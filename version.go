@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/keystore"
+	flag "github.com/spf13/pflag"
+)
+
+// Build information, set with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildDate=...". Builds without them fall back to what the Go
+// toolchain recorded.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+type versionOpts struct {
+	JSON bool
+}
+
+// buildInfo is what version prints, for bug reports and for checking that
+// teammates' binaries read each other's files
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Modified  bool     `json:"modified"`
+	BuildDate string   `json:"build_date"`
+	Go        string   `json:"go"`
+	Platform  string   `json:"platform"`
+	KeyStores []string `json:"keystores"`
+	// Formats are the versions of the encrypted value format this build reads
+	Formats []ciphertextFormat `json:"ciphertext_formats"`
+}
+
+type ciphertextFormat struct {
+	Version int    `json:"version"`
+	Cipher  string `json:"cipher"`
+}
+
+func newVersionCmd() *command[versionOpts] {
+	cmd := new(command[versionOpts])
+	cmd.flags = flag.NewFlagSet("version", flag.ExitOnError)
+	cmd.flags.BoolVar(&cmd.val.JSON, "json", false, "Prints the build information as a JSON object")
+	cmd.fn = versionCmdFn
+	return cmd
+}
+
+// versionCmdFn prints the version, build and compatibility information
+func versionCmdFn(ctx context.Context, opts versionOpts, args ...string) error {
+	info := currentBuildInfo()
+	if opts.JSON {
+		return writeJSON(os.Stdout, info)
+	}
+
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if info.Modified {
+		commit += " (modified)"
+	}
+	buildDate := info.BuildDate
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	formats := make([]string, len(info.Formats))
+	for i, f := range info.Formats {
+		formats[i] = fmt.Sprintf("%d (%s)", f.Version, f.Cipher)
+	}
+
+	fmt.Printf("envx %s\n", info.Version)
+	fmt.Printf("commit:             %s\n", commit)
+	fmt.Printf("built:              %s\n", buildDate)
+	fmt.Printf("go:                 %s %s\n", info.Go, info.Platform)
+	fmt.Printf("keystores:          %s\n", strings.Join(info.KeyStores, ", "))
+	fmt.Printf("ciphertext formats: %s\n", strings.Join(formats, ", "))
+	return nil
+}
+
+// currentBuildInfo returns the build information of the running binary.
+// Values set at link time take precedence over the module version and VCS
+// details the toolchain embeds, where the build date is the commit time.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		Go:        runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		KeyStores: supportedKeyStores(),
+	}
+	for _, f := range crypto.Formats {
+		info.Formats = append(info.Formats, ciphertextFormat{Version: f.Version, Cipher: f.Cipher})
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// supportedKeyStores returns the keystore types this build can use, leaving
+// out the keychain on platforms without one
+func supportedKeyStores() []string {
+	var stores []string
+	if keystore.KeychainSupported {
+		stores = append(stores, string(KeyStoreTypeMacOS))
+	}
+	for _, t := range []KeyStoreType{KeyStoreTypePassword, KeyStoreTypeSystemd, KeyStoreTypeTPM, KeyStoreTypeYubiKey, KeyStoreTypeMock} {
+		stores = append(stores, string(t))
+	}
+	return stores
+}
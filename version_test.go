@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/keystore"
+)
+
+func TestVersionJSON(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "v1.2.3", "abc123", "2025-01-02T03:04:05Z"
+
+	output, err := captureStdout(t, func() error {
+		return versionCmdFn(context.Background(), versionOpts{JSON: true})
+	})
+	if err != nil {
+		t.Fatalf("versionCmdFn() error = %v", err)
+	}
+
+	var info buildInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("output %q is not JSON: %v", output, err)
+	}
+	if info.Version != "v1.2.3" || info.Commit != "abc123" || info.BuildDate != "2025-01-02T03:04:05Z" {
+		t.Errorf("build info = %+v, want the link time values", info)
+	}
+	if got := slices.Contains(info.KeyStores, "macos"); got != keystore.KeychainSupported {
+		t.Errorf("keystores = %v, macos listed = %v, want %v", info.KeyStores, got, keystore.KeychainSupported)
+	}
+	if !slices.Contains(info.KeyStores, "password") {
+		t.Errorf("keystores = %v, want password", info.KeyStores)
+	}
+	if len(info.Formats) == 0 || info.Formats[0].Version != 1 {
+		t.Errorf("ciphertext formats = %v, want version 1", info.Formats)
+	}
+}
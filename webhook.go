@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/errlog"
+	"github.com/almahoozi/envx/pkg/secure"
+	flag "github.com/spf13/pflag"
+)
+
+type webhookOpts struct {
+	Name      string
+	File      string
+	KeyStore  string
+	Password  string
+	Listen    string
+	TokenFile string
+	TLSCert   string
+	TLSKey    string
+}
+
+// webhookServer answers the requests of the External Secrets Operator
+// webhook provider with variables of an env file. The file is read again
+// for every request, so changes are served without a restart.
+type webhookServer struct {
+	file     string
+	keyStore string
+	password string
+	key      []byte
+	token    string
+}
+
+func newWebhookCmd() *command[webhookOpts] {
+	cmd := new(command[webhookOpts])
+	cmd.flags = flag.NewFlagSet("webhook", flag.ExitOnError)
+	cmd.flags.StringVarP(&cmd.val.File, "file", "f", ".env", "Uses a specific file instead of the default .env")
+	cmd.flags.StringVarP(&cmd.val.Name, "name", "n", "", "Looks for .env.<name> file instead of .env")
+	cmd.flags.StringVarP(&cmd.val.KeyStore, "keystore", "k", "", "Keystore type to use (macos, password, mock; default macos)")
+	cmd.flags.StringVarP(&cmd.val.Password, "password", "P", "", "Password for password-based keystore (implies --keystore password; use ENVX_PASSWORD env var for better security)")
+	cmd.flags.Lookup("password").NoOptDefVal = emptyPassword
+	cmd.flags.StringVar(&cmd.val.Listen, "listen", "127.0.0.1:8080", "Address to listen on")
+	cmd.flags.StringVar(&cmd.val.TokenFile, "token-file", "", "File holding the bearer token clients must send (default ENVX_WEBHOOK_TOKEN)")
+	cmd.flags.StringVar(&cmd.val.TLSCert, "tls-cert", "", "Certificate to serve HTTPS with")
+	cmd.flags.StringVar(&cmd.val.TLSKey, "tls-key", "", "Private key of the --tls-cert certificate")
+	cmd.fn = webhookCmdFn
+	return cmd
+}
+
+// webhookCmdFn serves the env file to the External Secrets Operator until
+// interrupted
+func webhookCmdFn(ctx context.Context, opts webhookOpts, args ...string) error {
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be used together")
+	}
+	token, err := webhookToken(opts.TokenFile)
+	if err != nil {
+		return err
+	}
+
+	key, err := loadKeyWithStringTypeAndPassword(opts.KeyStore, opts.Password)
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+	defer secure.Zero(key)
+
+	s := &webhookServer{
+		file:     env.BuildFilename(opts.File, opts.Name),
+		keyStore: opts.KeyStore,
+		password: opts.Password,
+		key:      key,
+		token:    token,
+	}
+	server := s.httpServer(ctx, opts.Listen)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	diagf("Serving %s on %s\n", s.file, opts.Listen)
+	if opts.TLSCert != "" {
+		err = server.ListenAndServeTLS(opts.TLSCert, opts.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving webhook: %w", err)
+	}
+	return nil
+}
+
+// httpServer returns the server for s listening on addr. Requests run in
+// ctx, the command's context, so they use its encryptor, but each gets a
+// cache of its own: the command's would keep every value served in memory
+// for as long as the server runs.
+func (s *webhookServer) httpServer(ctx context.Context, addr string) *http.Server {
+	handler := s.handler()
+	return &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r.WithContext(env.WithCache(r.Context(), env.NewCache())))
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+}
+
+// webhookToken returns the bearer token from tokenFile or
+// ENVX_WEBHOOK_TOKEN. One is required: the webhook hands out secrets.
+func webhookToken(tokenFile string) (string, error) {
+	token := os.Getenv("ENVX_WEBHOOK_TOKEN")
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile) // #nosec G304 -- User-provided token file
+		if err != nil {
+			return "", fmt.Errorf("error reading token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return "", fmt.Errorf("a bearer token is required; set ENVX_WEBHOOK_TOKEN or use --token-file")
+	}
+	return token, nil
+}
+
+// handler routes GET /secrets/{key} to a single variable, as
+// {"key": ..., "value": ...}, and GET /secrets to all of them as one object.
+// /healthz needs no token, for probes.
+func (s *webhookServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle("GET /secrets", s.authorize(http.HandlerFunc(s.serveAll)))
+	mux.Handle("GET /secrets/{key}", s.authorize(http.HandlerFunc(s.serveOne)))
+	return mux
+}
+
+// authorize rejects requests without the bearer token
+func (s *webhookServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeWebhookError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *webhookServer) serveOne(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	lazy, err := loadLazyEnv(r.Context(), s.file, newEncryptor(r.Context()), s.key)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if !lazy.Has(key) {
+		writeWebhookError(w, http.StatusNotFound, fmt.Sprintf("%s is not set", key))
+		return
+	}
+	if err := auditAccess("webhook", s.file, s.keyStore, s.password, []string{key}); err != nil {
+		s.fail(w, err)
+		return
+	}
+	value, _, err := lazy.Get(key)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, map[string]string{"key": key, "value": value})
+}
+
+func (s *webhookServer) serveAll(w http.ResponseWriter, r *http.Request) {
+	lazy, err := loadLazyEnv(r.Context(), s.file, newEncryptor(r.Context()), s.key)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	vars, err := lazy.All()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if err := auditAccess("webhook", s.file, s.keyStore, s.password, varKeys(vars)); err != nil {
+		s.fail(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, vars.ToMap())
+}
+
+// fail logs err on stderr and answers with a generic error, so details of
+// the file never reach the client
+func (s *webhookServer) fail(w http.ResponseWriter, err error) {
+	diagf("Error: %s\n", errlog.Redact(err.Error()))
+	writeWebhookError(w, http.StatusInternalServerError, "error reading "+s.file)
+}
+
+func writeWebhookError(w http.ResponseWriter, status int, message string) {
+	writeWebhookJSON(w, status, map[string]string{"error": message})
+}
+
+func writeWebhookJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
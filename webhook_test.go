@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+)
+
+func TestWebhook(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+	key, err := loadKeyWithType(KeyStoreTypeMock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "hunter2", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("DB_PASSWORD="+encrypted+"\nPORT=8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests use the encryptor of the command, but not its cache
+	encryptor := &countingEncryptor{Encryptor: crypto.NewAESEncryptor()}
+	ctx := env.WithCache(context.WithValue(context.Background(), encryptorContextKey{}, encryptor), env.NewCache())
+	s := &webhookServer{file: envFile, keyStore: "mock", key: key, token: "s3cret"}
+	server := httptest.NewUnstartedServer(nil)
+	server.Config = s.httpServer(ctx, "")
+	server.Start()
+	defer server.Close()
+
+	get := func(path, token string) (int, map[string]string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, _ := get("/healthz", ""); status != http.StatusNoContent {
+		t.Errorf("GET /healthz status = %d", status)
+	}
+	if status, _ := get("/secrets/DB_PASSWORD", ""); status != http.StatusUnauthorized {
+		t.Errorf("GET without a token status = %d, want 401", status)
+	}
+	if status, _ := get("/secrets/DB_PASSWORD", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("GET with a wrong token status = %d, want 401", status)
+	}
+	if status, body := get("/secrets/DB_PASSWORD", "s3cret"); status != http.StatusOK || body["value"] != "hunter2" {
+		t.Errorf("GET /secrets/DB_PASSWORD = %d %v", status, body)
+	}
+	if status, _ := get("/secrets/MISSING", "s3cret"); status != http.StatusNotFound {
+		t.Errorf("GET of a missing variable status = %d, want 404", status)
+	}
+	if status, body := get("/secrets", "s3cret"); status != http.StatusOK || body["DB_PASSWORD"] != "hunter2" || body["PORT"] != "8080" {
+		t.Errorf("GET /secrets = %d %v", status, body)
+	}
+	if got := encryptor.decrypts.Load(); got == 0 {
+		t.Error("requests did not use the command's encryptor")
+	}
+
+	// Nothing decrypted by one request is kept for the next: a changed file
+	// is served as is, and changing it back decrypts the old value again
+	rotated, err := crypto.NewAESEncryptor().Encrypt(context.Background(), "hunter3", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ ciphertext, want string }{{rotated, "hunter3"}, {encrypted, "hunter2"}} {
+		if err := os.WriteFile(envFile, []byte("DB_PASSWORD="+tt.ciphertext+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		before := encryptor.decrypts.Load()
+		if status, body := get("/secrets/DB_PASSWORD", "s3cret"); status != http.StatusOK || body["value"] != tt.want {
+			t.Errorf("GET /secrets/DB_PASSWORD after a change = %d %v, want %s", status, body, tt.want)
+		}
+		if encryptor.decrypts.Load() == before {
+			t.Error("GET /secrets/DB_PASSWORD served a value kept from an earlier request")
+		}
+	}
+}
+
+// countingEncryptor counts the values it decrypts
+type countingEncryptor struct {
+	crypto.Encryptor
+	decrypts atomic.Int32
+}
+
+func (c *countingEncryptor) Decrypt(ctx context.Context, ciphertext string, key []byte) (string, error) {
+	c.decrypts.Add(1)
+	return c.Encryptor.Decrypt(ctx, ciphertext, key)
+}
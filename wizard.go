@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/almahoozi/envx/pkg/crypto"
+	"github.com/almahoozi/envx/pkg/env"
+	"github.com/almahoozi/envx/pkg/schema"
+)
+
+// defaultExampleFile lists the variables a project expects, with
+// placeholder values, by common convention
+const defaultExampleFile = ".env.example"
+
+// maxPromptAttempts is how many times add --interactive asks for a value
+// that breaks its constraints before giving up
+const maxPromptAttempts = 3
+
+// promptSecret reads a value without echoing it; tests replace it
+var promptSecret = promptForSecretValue
+
+// expectedVars returns the variables the schema describes followed by the
+// others in the example file. Only an example file given with --example has
+// to exist, but there must be a schema or an example file.
+func expectedVars(ctx context.Context, schemaPath, examplePath string) ([]schema.Var, error) {
+	s, path, err := loadSchema(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	var expected []schema.Var
+	if s != nil {
+		expected = append(expected, s.Vars...)
+	}
+
+	if _, err := os.Stat(examplePath); err != nil {
+		if examplePath != defaultExampleFile || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading %s: %w", examplePath, err)
+		}
+		if s == nil {
+			return nil, fmt.Errorf("no variables to ask for; create %s or %s", path, examplePath)
+		}
+		return expected, nil
+	}
+	example, err := env.NewFileLoader().Load(ctx, examplePath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", examplePath, err)
+	}
+	for _, v := range example {
+		if s.Get(v.Key) == nil {
+			expected = append(expected, schema.Var{Key: v.Key})
+		}
+	}
+	return expected, nil
+}
+
+// promptMissing asks for a value for each expected variable index does not
+// hold, hiding what is typed. A value breaking its constraints is asked for
+// again; optional variables left empty are skipped.
+func promptMissing(expected []schema.Var, index *env.Index, key []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, v := range expected {
+		if index.Has(v.Key) || index.Has(crypto.NameToken(v.Key, key)) {
+			continue
+		}
+		switch {
+		case v.Description != "" && !v.Required:
+			fmt.Fprintf(os.Stderr, "%s: %s (optional, leave empty to skip)\n", v.Key, v.Description)
+		case v.Description != "":
+			fmt.Fprintf(os.Stderr, "%s: %s\n", v.Key, v.Description)
+		case !v.Required:
+			fmt.Fprintf(os.Stderr, "%s is optional, leave it empty to skip\n", v.Key)
+		}
+
+		for attempt := 1; ; attempt++ {
+			value, err := promptSecret(v.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get value for key %s: %w", v.Key, err)
+			}
+			err = v.Check(value)
+			if err == nil {
+				if value != "" {
+					values[v.Key] = value
+				}
+				break
+			}
+			if attempt == maxPromptAttempts {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "Invalid value: %v\n", err)
+		}
+	}
+	return values, nil
+}
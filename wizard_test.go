@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddInteractive(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	schemaFile := filepath.Join(dir, "schema.json")
+	exampleFile := filepath.Join(dir, ".env.example")
+	files := map[string]string{
+		envFile: "PORT=8080\n",
+		schemaFile: `{"vars": [
+			{"key": "PORT", "required": true},
+			{"key": "DATABASE_URL", "description": "Primary database", "required": true, "pattern": "^postgres://"},
+			{"key": "LOG_LEVEL", "description": "Verbosity"}
+		]}`,
+		exampleFile: "DATABASE_URL=postgres://localhost/app\nSENTRY_DSN=\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	original := promptSecret
+	defer func() { promptSecret = original }()
+	var asked []string
+	answers := []string{"mysql://db", "postgres://db/app", "", "https://sentry"}
+	promptSecret = func(key string) (string, error) {
+		asked = append(asked, key)
+		if len(answers) == 0 {
+			return "", fmt.Errorf("unexpected prompt for %s", key)
+		}
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+
+	opts := addOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}, Interactive: true, Schema: schemaFile, Example: exampleFile}
+	if _, err := captureStderr(t, func() error { return addCmdFn(context.Background(), opts) }); err != nil {
+		t.Fatalf("add --interactive error = %v", err)
+	}
+	if want := "[DATABASE_URL DATABASE_URL LOG_LEVEL SENTRY_DSN]"; fmt.Sprint(asked) != want {
+		t.Errorf("asked for %v, want %s", asked, want)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return getCmdFn(context.Background(), getOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, "DATABASE_URL", "SENTRY_DSN")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "DATABASE_URL=postgres://db/app\nSENTRY_DSN=https://sentry\n"; output != want {
+		t.Errorf("added variables = %q, want %q", output, want)
+	}
+
+	// Nothing is missing any more but the skipped optional variable
+	asked, answers = nil, []string{""}
+	if _, err := captureStderr(t, func() error { return addCmdFn(context.Background(), opts) }); err != nil {
+		t.Fatalf("second add --interactive error = %v", err)
+	}
+	if want := "[LOG_LEVEL]"; fmt.Sprint(asked) != want {
+		t.Errorf("second run asked for %v, want %s", asked, want)
+	}
+
+	// A value that keeps breaking its constraints is given up on
+	opts.File = filepath.Join(dir, ".env.other")
+	asked, answers = nil, []string{"", "", ""}
+	if _, err := captureStderr(t, func() error { return addCmdFn(context.Background(), opts) }); err == nil {
+		t.Error("add --interactive with invalid values expected error")
+	}
+	if len(asked) != maxPromptAttempts {
+		t.Errorf("asked %d times, want %d", len(asked), maxPromptAttempts)
+	}
+
+	opts.Example = filepath.Join(dir, "missing.example")
+	if err := addCmdFn(context.Background(), opts); err == nil {
+		t.Error("add --interactive with a missing --example expected error")
+	}
+	opts.Example = exampleFile
+	if err := addCmdFn(context.Background(), opts, "A=1"); err == nil {
+		t.Error("add --interactive with arguments expected error")
+	}
+}
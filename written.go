@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/almahoozi/envx/pkg/diff"
+	"github.com/almahoozi/envx/pkg/env"
+	"golang.org/x/term"
+)
+
+// writtenDir returns the directory holding the hash of each env file as envx
+// last wrote it; tests replace it
+var writtenDir = func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "envx", "written")
+}
+
+// writtenPath returns where the hash of file as envx last wrote it is kept,
+// named after the hash of its absolute path
+func writtenPath(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(writtenDir(), hex.EncodeToString(sum[:])), nil
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordWritten remembers the hash of content as written to file. Errors are
+// ignored so the record never stops a write that already happened.
+func recordWritten(file string, content []byte) {
+	path, err := writtenPath(file)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, []byte(contentHash(content)+"\n"), env.SecureFileMode)
+}
+
+// checkExternalChange warns when file no longer matches what envx last wrote
+// to it, as after an edit in another program. On a terminal it then shows
+// what writing content would change and asks before going ahead.
+func checkExternalChange(file, content string) error {
+	path, err := writtenPath(file)
+	if err != nil {
+		return nil
+	}
+	recorded, err := os.ReadFile(path) // #nosec G304 -- Path is derived from the env file
+	if err != nil {
+		return nil
+	}
+	current, err := os.ReadFile(file) // #nosec G304 -- User-provided env file path is intentional
+	if err != nil || contentHash(current) == strings.TrimSpace(string(recorded)) {
+		return nil
+	}
+
+	diagf("Warning: %s changed outside envx since envx last wrote it\n", file)
+	if assumeYes || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+	if unified := diff.Unified(file, file, string(current), content, 3); unified != "" {
+		writeDiff(os.Stderr, unified, useColor() && stderrIsTerminal())
+	}
+	return confirm(fmt.Sprintf("Write %s anyway?", file))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckExternalChange(t *testing.T) {
+	setupTestKeystore(t)
+	defer teardownTestKeystore(t)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("PORT=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	set := func(arg string) string {
+		t.Helper()
+		output, err := captureStderr(t, func() error {
+			return setCmdFn(context.Background(), setOpts{File: envFile, KeyStore: "mock", FmtOpts: &fmtOpts{}}, arg)
+		})
+		if err != nil {
+			t.Fatalf("setCmdFn() unexpected error: %v", err)
+		}
+		return output
+	}
+
+	// Files envx never wrote have nothing to compare against
+	if output := set("HOST=a"); strings.Contains(output, "outside envx") {
+		t.Errorf("first write warned: %q", output)
+	}
+	if output := set("HOST=b"); strings.Contains(output, "outside envx") {
+		t.Errorf("write after an envx write warned: %q", output)
+	}
+
+	f, err := os.OpenFile(envFile, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("DEBUG=true\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if output := set("HOST=c"); !strings.Contains(output, "Warning: "+envFile+" changed outside envx") {
+		t.Errorf("write after an external edit did not warn: %q", output)
+	}
+	if content, _ := os.ReadFile(envFile); !strings.Contains(string(content), "DEBUG=true") {
+		t.Errorf("external edit lost:\n%s", content)
+	}
+	if output := set("HOST=d"); strings.Contains(output, "outside envx") {
+		t.Errorf("warned again after the change was written: %q", output)
+	}
+}